@@ -0,0 +1,222 @@
+package common
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// 信封加密：每条数据使用独立的随机数据密钥（DEK）以 AES-256-GCM 加密，
+// DEK 再由主密钥（KEK）加密后与数据一同存储。轮换主密钥时只需重新包装 DEK。
+//
+// 密文格式：enc:v1:<base64(nonce|ciphertext)>
+// 数据密钥格式：<主密钥 ID>:<base64(nonce|wrapped DEK)>
+
+const envelopeCiphertextPrefix = "enc:v1:"
+
+var (
+	ErrEnvelopeKeyNotConfigured = errors.New("secret master key is not configured")
+	ErrEnvelopeMasterKeyUnknown = errors.New("secret master key for data key not found")
+)
+
+type envelopeMasterKey struct {
+	id  string
+	key []byte
+}
+
+var (
+	envelopeCurrentKey  *envelopeMasterKey
+	envelopePreviousKey []*envelopeMasterKey
+)
+
+func newEnvelopeMasterKey(secret string) *envelopeMasterKey {
+	sum := sha256.Sum256([]byte(secret))
+	id := sha256.Sum256(sum[:])
+	return &envelopeMasterKey{id: hex.EncodeToString(id[:4]), key: sum[:]}
+}
+
+// InitEnvelopeEncryption 从环境变量加载主密钥：
+// SECRET_MASTER_KEY 或 SECRET_MASTER_KEY_FILE 为当前主密钥，
+// SECRET_PREVIOUS_MASTER_KEYS（逗号分隔）为轮换前的旧主密钥，仅用于解密
+func InitEnvelopeEncryption() error {
+	secret := strings.TrimSpace(os.Getenv("SECRET_MASTER_KEY"))
+	if secret == "" {
+		if path := strings.TrimSpace(os.Getenv("SECRET_MASTER_KEY_FILE")); path != "" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("failed to read SECRET_MASTER_KEY_FILE: %w", err)
+			}
+			secret = strings.TrimSpace(string(data))
+		}
+	}
+	SetEnvelopeMasterKeys(secret, strings.Split(os.Getenv("SECRET_PREVIOUS_MASTER_KEYS"), ","))
+	return nil
+}
+
+// SetEnvelopeMasterKeys 设置当前与旧主密钥，current 为空表示不启用加密
+func SetEnvelopeMasterKeys(current string, previous []string) {
+	envelopeCurrentKey = nil
+	envelopePreviousKey = nil
+	if current != "" {
+		envelopeCurrentKey = newEnvelopeMasterKey(current)
+	}
+	for _, secret := range previous {
+		secret = strings.TrimSpace(secret)
+		if secret == "" {
+			continue
+		}
+		envelopePreviousKey = append(envelopePreviousKey, newEnvelopeMasterKey(secret))
+	}
+}
+
+// EnvelopeEncryptionEnabled 是否配置了主密钥
+func EnvelopeEncryptionEnabled() bool {
+	return envelopeCurrentKey != nil
+}
+
+// IsEnvelopeCiphertext 判断字符串是否为信封加密后的密文
+func IsEnvelopeCiphertext(value string) bool {
+	return strings.HasPrefix(value, envelopeCiphertextPrefix)
+}
+
+func findEnvelopeMasterKey(id string) *envelopeMasterKey {
+	if envelopeCurrentKey != nil && envelopeCurrentKey.id == id {
+		return envelopeCurrentKey
+	}
+	for _, key := range envelopePreviousKey {
+		if key.id == id {
+			return key
+		}
+	}
+	return nil
+}
+
+func aesGCMSeal(key []byte, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func aesGCMOpen(key []byte, sealed []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+func wrapDataKey(master *envelopeMasterKey, dek []byte) (string, error) {
+	wrapped, err := aesGCMSeal(master.key, dek)
+	if err != nil {
+		return "", err
+	}
+	return master.id + ":" + base64.StdEncoding.EncodeToString(wrapped), nil
+}
+
+func unwrapDataKey(dataKey string) ([]byte, *envelopeMasterKey, error) {
+	id, encoded, ok := strings.Cut(dataKey, ":")
+	if !ok {
+		return nil, nil, errors.New("invalid data key")
+	}
+	master := findEnvelopeMasterKey(id)
+	if master == nil {
+		return nil, nil, ErrEnvelopeMasterKeyUnknown
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, nil, err
+	}
+	dek, err := aesGCMOpen(master.key, wrapped)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dek, master, nil
+}
+
+// EnvelopeEncrypt 使用新生成的数据密钥加密 plaintext，返回密文与被主密钥包装后的数据密钥
+func EnvelopeEncrypt(plaintext string) (ciphertext string, dataKey string, err error) {
+	if envelopeCurrentKey == nil {
+		return "", "", ErrEnvelopeKeyNotConfigured
+	}
+	dek := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return "", "", err
+	}
+	sealed, err := aesGCMSeal(dek, []byte(plaintext))
+	if err != nil {
+		return "", "", err
+	}
+	dataKey, err = wrapDataKey(envelopeCurrentKey, dek)
+	if err != nil {
+		return "", "", err
+	}
+	return envelopeCiphertextPrefix + base64.StdEncoding.EncodeToString(sealed), dataKey, nil
+}
+
+// EnvelopeDecrypt 解密 EnvelopeEncrypt 的输出；非密文按原样返回，兼容尚未迁移的数据
+func EnvelopeDecrypt(ciphertext string, dataKey string) (string, error) {
+	if !IsEnvelopeCiphertext(ciphertext) {
+		return ciphertext, nil
+	}
+	if envelopeCurrentKey == nil && len(envelopePreviousKey) == 0 {
+		return "", ErrEnvelopeKeyNotConfigured
+	}
+	dek, _, err := unwrapDataKey(dataKey)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(ciphertext, envelopeCiphertextPrefix))
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := aesGCMOpen(dek, sealed)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// RewrapEnvelopeDataKey 使用当前主密钥重新包装数据密钥，已由当前主密钥包装时返回 changed=false
+func RewrapEnvelopeDataKey(dataKey string) (rewrapped string, changed bool, err error) {
+	if envelopeCurrentKey == nil {
+		return "", false, ErrEnvelopeKeyNotConfigured
+	}
+	dek, master, err := unwrapDataKey(dataKey)
+	if err != nil {
+		return "", false, err
+	}
+	if master == envelopeCurrentKey {
+		return dataKey, false, nil
+	}
+	rewrapped, err = wrapDataKey(envelopeCurrentKey, dek)
+	if err != nil {
+		return "", false, err
+	}
+	return rewrapped, true, nil
+}
@@ -19,6 +19,17 @@ const (
 	ContextKeyTokenModelLimitEnabled ContextKey = "token_model_limit_enabled"
 	ContextKeyTokenModelLimit        ContextKey = "token_model_limit"
 	ContextKeyTokenCrossGroupRetry   ContextKey = "token_cross_group_retry"
+	ContextKeyTokenPreviousKey       ContextKey = "token_previous_key"
+	ContextKeyTokenEndUserRPM        ContextKey = "token_end_user_rpm"
+	ContextKeyTokenEndUserDailyQuota ContextKey = "token_end_user_daily_quota"
+	ContextKeyTokenBlockedEndUsers   ContextKey = "token_blocked_end_users"
+	ContextKeyTokenMcpAllowlist      ContextKey = "token_mcp_allowlist"
+
+	/* ephemeral token related keys */
+	ContextKeyEphemeralTokenId        ContextKey = "ephemeral_token_id"
+	ContextKeyEphemeralTokenMaxSpend  ContextKey = "ephemeral_token_max_spend"
+	ContextKeyEphemeralTokenExpiresAt ContextKey = "ephemeral_token_expires_at"
+	ContextKeyEndUserId               ContextKey = "end_user_id"
 
 	/* channel related keys */
 	ContextKeyChannelId                ContextKey = "channel_id"
@@ -65,4 +76,19 @@ const (
 
 	// ContextKeyLanguage stores the user's language preference for i18n
 	ContextKeyLanguage ContextKey = "language"
+
+	// ContextKeyResponsesResult stores the final Responses API response object (raw JSON) for gateway-side storage
+	ContextKeyResponsesResult ContextKey = "responses_result"
+
+	// ContextKeyResponsesExpansion stores the client input and conversation chain before previous_response_id was expanded
+	ContextKeyResponsesExpansion ContextKey = "responses_expansion"
+
+	// ContextKeyStructuredOutputAttempts stores structured output validation attempts across channel retries for admin_info
+	ContextKeyStructuredOutputAttempts ContextKey = "structured_output_attempts"
+
+	// ContextKeyPromptTemplate stores the prompt template id/version rendered into the request for log recording
+	ContextKeyPromptTemplate ContextKey = "prompt_template"
+
+	// ContextKeyExperiment stores the traffic-split experiment assignment (*model.ExperimentAssignment) of the request
+	ContextKeyExperiment ContextKey = "experiment"
 )
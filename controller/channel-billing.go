@@ -357,6 +357,15 @@ func updateChannelMoonshotBalance(channel *model.Channel) (float64, error) {
 }
 
 func updateChannelBalance(channel *model.Channel) (float64, error) {
+	// 余额查询直接使用 channel.Key，在副本上填入解密后的密钥，避免明文写回缓存
+	key, err := channel.DecryptKey()
+	if err != nil {
+		return 0, err
+	}
+	plainChannel := *channel
+	plainChannel.Key = key
+	channel = &plainChannel
+
 	baseURL := constant.ChannelBaseURLs[channel.Type]
 	if channel.GetBaseURL() == "" {
 		channel.BaseURL = &baseURL
@@ -402,6 +402,12 @@ func GetChannelKey(c *gin.Context) {
 		return
 	}
 
+	key, err := channel.DecryptKey()
+	if err != nil {
+		common.ApiError(c, fmt.Errorf("解密渠道密钥失败: %v", err))
+		return
+	}
+
 	// 记录操作日志
 	model.RecordLog(userId, model.LogTypeSystem, fmt.Sprintf("查看渠道密钥信息 (渠道ID: %d)", channelId))
 
@@ -410,7 +416,7 @@ func GetChannelKey(c *gin.Context) {
 		"success": true,
 		"message": "获取成功",
 		"data": map[string]interface{}{
-			"key": channel.Key,
+			"key": key,
 		},
 	})
 }
@@ -489,6 +495,28 @@ func validateChannel(channel *model.Channel, isAdd bool) error {
 		}
 	}
 
+	// MCP 渠道：渠道名称即服务器标识，不参与模型分发
+	if channel.Type == constant.ChannelTypeMCP {
+		if channel.BaseURL == nil || !strings.HasPrefix(*channel.BaseURL, "http") {
+			return fmt.Errorf("MCP 渠道必须填写服务器地址")
+		}
+		if strings.TrimSpace(channel.Models) != "" {
+			return fmt.Errorf("MCP 渠道不能配置模型")
+		}
+		if channel.Name == "" || strings.ContainsAny(channel.Name, "/ ") {
+			return fmt.Errorf("MCP 渠道名称不能为空，且不能包含空格或斜杠")
+		}
+		settings := channel.GetOtherSettings()
+		switch settings.McpTransport {
+		case "", dto.McpTransportStreamableHTTP, dto.McpTransportSSE:
+		default:
+			return fmt.Errorf("不支持的 MCP 传输方式: %s", settings.McpTransport)
+		}
+		if settings.McpCallPrice < 0 {
+			return fmt.Errorf("MCP 调用价格不能为负数")
+		}
+	}
+
 	return nil
 }
 
@@ -880,22 +908,9 @@ func UpdateChannel(c *gin.Context) {
 			// 追加模式：将新密钥添加到现有密钥列表
 			if originChannel.Key != "" {
 				var newKeys []string
-				var existingKeys []string
-
-				// 解析现有密钥
-				if strings.HasPrefix(strings.TrimSpace(originChannel.Key), "[") {
-					// JSON数组格式
-					var arr []json.RawMessage
-					if err := json.Unmarshal([]byte(strings.TrimSpace(originChannel.Key)), &arr); err == nil {
-						existingKeys = make([]string, len(arr))
-						for i, v := range arr {
-							existingKeys[i] = string(v)
-						}
-					}
-				} else {
-					// 换行分隔格式
-					existingKeys = strings.Split(strings.Trim(originChannel.Key, "\n"), "\n")
-				}
+
+				// 解析现有密钥（JSON数组或换行分隔格式）
+				existingKeys := originChannel.GetKeys()
 
 				// 处理 Vertex AI 的特殊情况
 				if channel.Type == constant.ChannelTypeVertexAi && channel.GetOtherSettings().VertexKeyType != dto.VertexKeyTypeAPIKey {
@@ -1698,6 +1713,15 @@ func ManageMultiKeys(c *gin.Context) {
 }
 
 // OllamaPullModel 拉取 Ollama 模型
+// firstChannelKey 返回渠道的第一个明文密钥，多 Key 渠道取首个
+func firstChannelKey(channel *model.Channel) string {
+	keys := channel.GetKeys()
+	if len(keys) == 0 {
+		return ""
+	}
+	return keys[0]
+}
+
 func OllamaPullModel(c *gin.Context) {
 	var req struct {
 		ChannelID int    `json:"channel_id"`
@@ -1744,7 +1768,7 @@ func OllamaPullModel(c *gin.Context) {
 		baseURL = channel.GetBaseURL()
 	}
 
-	key := strings.Split(channel.Key, "\n")[0]
+	key := firstChannelKey(channel)
 	err = ollama.PullOllamaModel(baseURL, key, req.ModelName)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -1813,7 +1837,7 @@ func OllamaPullModelStream(c *gin.Context) {
 	c.Header("Connection", "keep-alive")
 	c.Header("Access-Control-Allow-Origin", "*")
 
-	key := strings.Split(channel.Key, "\n")[0]
+	key := firstChannelKey(channel)
 
 	// 创建进度回调函数
 	progressCallback := func(progress ollama.OllamaPullResponse) {
@@ -1889,7 +1913,7 @@ func OllamaDeleteModel(c *gin.Context) {
 		baseURL = channel.GetBaseURL()
 	}
 
-	key := strings.Split(channel.Key, "\n")[0]
+	key := firstChannelKey(channel)
 	err = ollama.DeleteOllamaModel(baseURL, key, req.ModelName)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -1938,7 +1962,7 @@ func OllamaVersion(c *gin.Context) {
 		baseURL = channel.GetBaseURL()
 	}
 
-	key := strings.Split(channel.Key, "\n")[0]
+	key := firstChannelKey(channel)
 	version, err := ollama.FetchOllamaVersion(baseURL, key)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
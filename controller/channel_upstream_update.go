@@ -242,7 +242,7 @@ func fetchChannelUpstreamModelIDs(channel *model.Channel) ([]string, error) {
 	}
 
 	if channel.Type == constant.ChannelTypeOllama {
-		key := strings.TrimSpace(strings.Split(channel.Key, "\n")[0])
+		key := strings.TrimSpace(firstChannelKey(channel))
 		models, err := ollama.FetchOllamaModels(baseURL, key)
 		if err != nil {
 			return nil, err
@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/relay"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RelayCountTokens 处理 Anthropic /v1/messages/count_tokens 与 Gemini :countTokens 请求。
+// 分发到的渠道提供原生计数接口时转发上游，否则（或上游失败时）使用本地 tokenizer 估算；该接口不扣费
+func RelayCountTokens(c *gin.Context, relayFormat types.RelayFormat) {
+	request, err := helper.GetAndValidateRequest(c, relayFormat)
+	if err != nil {
+		countTokensError(c, relayFormat, types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry()))
+		return
+	}
+	info, err := relaycommon.GenRelayInfo(c, relayFormat, request, nil)
+	if err != nil {
+		countTokensError(c, relayFormat, types.NewError(err, types.ErrorCodeGenRelayInfoFailed))
+		return
+	}
+
+	tokens := -1
+	info.InitChannelMeta(c)
+	if info.ChannelId != 0 && relay.CountTokensUpstreamSupported(info) {
+		upstreamTokens, newAPIError := relay.CountTokensHelper(c, info)
+		if newAPIError != nil {
+			logger.LogWarn(c, fmt.Sprintf("count tokens via channel #%d failed, fallback to local tokenizer: %s", info.ChannelId, newAPIError.Error()))
+		} else {
+			tokens = upstreamTokens
+		}
+	}
+	if tokens < 0 {
+		tokens = service.CountTokenMeta(request.GetTokenCountMeta(), info.OriginModelName)
+	}
+
+	switch relayFormat {
+	case types.RelayFormatClaude:
+		c.JSON(http.StatusOK, dto.ClaudeCountTokensResponse{InputTokens: tokens})
+	default:
+		c.JSON(http.StatusOK, dto.GeminiCountTokensResponse{TotalTokens: tokens})
+	}
+}
+
+func countTokensError(c *gin.Context, relayFormat types.RelayFormat, newAPIError *types.NewAPIError) {
+	newAPIError.SetMessage(common.MessageWithRequestId(newAPIError.Error(), c.GetString(common.RequestIdKey)))
+	if relayFormat == types.RelayFormatClaude {
+		c.JSON(newAPIError.StatusCode, gin.H{
+			"type":  "error",
+			"error": newAPIError.ToClaudeError(),
+		})
+		return
+	}
+	c.JSON(newAPIError.StatusCode, gin.H{
+		"error": newAPIError.ToOpenAIError(),
+	})
+}
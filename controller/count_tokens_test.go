@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func newCountTokensTestContext(path string, body string, modelName string) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	// 没有分发到渠道，仅设置原始模型
+	common.SetContextKey(c, constant.ContextKeyOriginalModel, modelName)
+	return c, recorder
+}
+
+func TestRelayCountTokensLocalFallback(t *testing.T) {
+	c, recorder := newCountTokensTestContext("/v1/messages/count_tokens",
+		`{"model":"claude-sonnet-4-5","system":"be brief","messages":[{"role":"user","content":"hello, how are you today?"}]}`,
+		"claude-sonnet-4-5")
+	Relay(c, types.RelayFormatClaude)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Greater(t, gjson.Get(recorder.Body.String(), "input_tokens").Int(), int64(0))
+
+	c, recorder = newCountTokensTestContext("/v1beta/models/gemini-2.5-flash:countTokens",
+		`{"generateContentRequest":{"contents":[{"role":"user","parts":[{"text":"hello, how are you today?"}]}]}}`,
+		"gemini-2.5-flash")
+	Relay(c, types.RelayFormatGemini)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.Greater(t, gjson.Get(recorder.Body.String(), "totalTokens").Int(), int64(0))
+
+	// 缺少 contents 时返回错误
+	c, recorder = newCountTokensTestContext("/v1beta/models/gemini-2.5-flash:countTokens", `{}`, "gemini-2.5-flash")
+	Relay(c, types.RelayFormatGemini)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
@@ -0,0 +1,293 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stripe/stripe-go/v81"
+	stripecoupon "github.com/stripe/stripe-go/v81/coupon"
+)
+
+var errCouponCreemDiscountUnsupported = errors.New("该优惠券未配置 Creem 折扣码，无法用于 Creem 支付")
+
+// ---- Checkout helpers ----
+
+// createStripeCheckoutCoupon 为单笔订单创建一次性的 Stripe 折扣券，未减免金额时返回空字符串
+func createStripeCheckoutCoupon(quote *model.CouponQuote, referenceId string) (string, error) {
+	percentOff := quote.DiscountPercent()
+	if percentOff <= 0 {
+		return "", nil
+	}
+	stripe.Key = setting.StripeApiSecret
+	params := &stripe.CouponParams{
+		Name:           stripe.String(fmt.Sprintf("Coupon %s", quote.Code)),
+		PercentOff:     stripe.Float64(percentOff),
+		Duration:       stripe.String(string(stripe.CouponDurationOnce)),
+		MaxRedemptions: stripe.Int64(1),
+	}
+	params.AddMetadata("reference_id", referenceId)
+	params.AddMetadata("coupon_code", quote.Code)
+	result, err := stripecoupon.New(params)
+	if err != nil {
+		return "", err
+	}
+	return result.ID, nil
+}
+
+// getCreemCouponDiscountCode 返回 Creem 结账时使用的折扣码
+func getCreemCouponDiscountCode(quote *model.CouponQuote) (string, error) {
+	if quote == nil || quote.DiscountMoney <= 0 {
+		return "", nil
+	}
+	if quote.Coupon.CreemDiscountCode == "" {
+		return "", errCouponCreemDiscountUnsupported
+	}
+	return quote.Coupon.CreemDiscountCode, nil
+}
+
+// ---- User APIs ----
+
+type CouponPreviewRequest struct {
+	Code          string `json:"code"`
+	OrderType     string `json:"order_type"`
+	PlanId        int    `json:"plan_id"`
+	PaymentMethod string `json:"payment_method"`
+	Amount        int64  `json:"amount"`
+	ProductId     string `json:"product_id"`
+}
+
+func getCouponPreviewMoney(req *CouponPreviewRequest, group string) (float64, error) {
+	if req.OrderType == model.CouponOrderTypeSubscription {
+		plan, err := model.GetSubscriptionPlanById(req.PlanId)
+		if err != nil {
+			return 0, err
+		}
+		return plan.PriceAmount, nil
+	}
+	switch req.PaymentMethod {
+	case model.PaymentMethodStripe:
+		return getStripePayMoney(float64(req.Amount), group), nil
+	case model.PaymentMethodCreem:
+		var products []CreemProduct
+		if err := json.Unmarshal([]byte(setting.CreemProducts), &products); err != nil {
+			return 0, errors.New("产品配置错误")
+		}
+		for _, product := range products {
+			if product.ProductId == req.ProductId {
+				return product.Price, nil
+			}
+		}
+		return 0, errors.New("产品不存在")
+	case model.PaymentMethodWaffo:
+		return getWaffoPayMoney(float64(req.Amount), group), nil
+	case model.PaymentMethodWaffoPancake:
+		return getWaffoPancakePayMoney(req.Amount, group), nil
+	default:
+		return getPayMoney(req.Amount, group), nil
+	}
+}
+
+// PreviewCoupon 试算优惠券在指定订单上的优惠金额
+func PreviewCoupon(c *gin.Context) {
+	var req CouponPreviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Code) == "" {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	if req.OrderType != model.CouponOrderTypeSubscription {
+		req.OrderType = model.CouponOrderTypeTopUp
+	}
+	userId := c.GetInt("id")
+	group, err := model.GetUserGroup(userId, true)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	money, err := getCouponPreviewMoney(&req, group)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	quote, err := model.PrepareCoupon(req.Code, model.CouponOrder{
+		UserId:        userId,
+		OrderType:     req.OrderType,
+		PlanId:        req.PlanId,
+		PaymentMethod: req.PaymentMethod,
+		Money:         money,
+	})
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.PaymentMethod == model.PaymentMethodCreem {
+		if _, err := getCreemCouponDiscountCode(quote); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+	}
+	common.ApiSuccess(c, quote)
+}
+
+// ---- Admin APIs ----
+
+func normalizeCouponInput(coupon *model.Coupon) error {
+	coupon.Code = strings.ToUpper(strings.TrimSpace(coupon.Code))
+	if coupon.Code == "" {
+		return errors.New("优惠码不能为空")
+	}
+	switch coupon.DiscountType {
+	case "":
+		coupon.DiscountType = model.CouponDiscountTypeNone
+	case model.CouponDiscountTypeNone, model.CouponDiscountTypeFixed:
+	case model.CouponDiscountTypePercent:
+		if coupon.DiscountValue > 100 {
+			return errors.New("折扣百分比不能超过 100")
+		}
+	default:
+		return errors.New("无效的折扣类型")
+	}
+	switch coupon.Scope {
+	case "":
+		coupon.Scope = model.CouponScopeAll
+	case model.CouponScopeAll, model.CouponScopeTopUp, model.CouponScopeSubscription:
+	default:
+		return errors.New("无效的适用范围")
+	}
+	if coupon.DiscountValue < 0 || coupon.BonusQuota < 0 || coupon.MinAmount < 0 {
+		return errors.New("金额与额度不能为负数")
+	}
+	if coupon.MaxUses < 0 || coupon.MaxUsesPerUser < 0 {
+		return errors.New("使用次数上限不能为负数")
+	}
+	if coupon.EndTime > 0 && coupon.StartTime > coupon.EndTime {
+		return errors.New("生效时间不能晚于过期时间")
+	}
+	if !coupon.HasPriceDiscount() && coupon.BonusQuota == 0 {
+		return errors.New("优惠券至少需要设置折扣或赠送额度")
+	}
+	return nil
+}
+
+func GetAllCoupons(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	coupons, total, err := model.GetAllCoupons(c.Query("keyword"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(coupons)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetCoupon(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	coupon, err := model.GetCouponById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, coupon)
+}
+
+func AddCoupon(c *gin.Context) {
+	var coupon model.Coupon
+	if err := c.ShouldBindJSON(&coupon); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := normalizeCouponInput(&coupon); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	coupon.Id = 0
+	coupon.UsedCount = 0
+	if err := coupon.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, coupon)
+}
+
+func UpdateCoupon(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	existing, err := model.GetCouponById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	var coupon model.Coupon
+	if err := c.ShouldBindJSON(&coupon); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	// 优惠码创建后不允许修改，避免核销记录与优惠券对不上
+	coupon.Id = existing.Id
+	coupon.Code = existing.Code
+	if err := normalizeCouponInput(&coupon); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := coupon.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func DeleteCoupon(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.DeleteCouponById(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func GetCouponRedemptions(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo := common.GetPageQuery(c)
+	redemptions, total, err := model.GetCouponRedemptions(id, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(redemptions)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetCouponCampaignReport(c *gin.Context) {
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	items, err := model.GetCouponCampaignReport(startTimestamp, endTimestamp)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, items)
+}
@@ -36,6 +36,13 @@ type CustomOAuthProviderResponse struct {
 	AuthStyle             int    `json:"auth_style"`
 	AccessPolicy          string `json:"access_policy"`
 	AccessDeniedMessage   string `json:"access_denied_message"`
+	Protocol              string `json:"protocol"`
+	SamlIdpMetadataUrl    string `json:"saml_idp_metadata_url"`
+	SamlIdpMetadata       string `json:"saml_idp_metadata"`
+	SamlGroupField        string `json:"saml_group_field"`
+	SamlDefaultGroup      string `json:"saml_default_group"`
+	SamlMetadataUrl       string `json:"saml_metadata_url,omitempty"` // SP metadata to register at the IdP
+	SamlAcsUrl            string `json:"saml_acs_url,omitempty"`      // SP assertion consumer service URL
 }
 
 type UserOAuthBindingResponse struct {
@@ -47,7 +54,7 @@ type UserOAuthBindingResponse struct {
 }
 
 func toCustomOAuthProviderResponse(p *model.CustomOAuthProvider) *CustomOAuthProviderResponse {
-	return &CustomOAuthProviderResponse{
+	response := &CustomOAuthProviderResponse{
 		Id:                    p.Id,
 		Name:                  p.Name,
 		Slug:                  p.Slug,
@@ -66,7 +73,17 @@ func toCustomOAuthProviderResponse(p *model.CustomOAuthProvider) *CustomOAuthPro
 		AuthStyle:             p.AuthStyle,
 		AccessPolicy:          p.AccessPolicy,
 		AccessDeniedMessage:   p.AccessDeniedMessage,
+		Protocol:              p.Protocol,
+		SamlIdpMetadataUrl:    p.SamlIdpMetadataUrl,
+		SamlIdpMetadata:       p.SamlIdpMetadata,
+		SamlGroupField:        p.SamlGroupField,
+		SamlDefaultGroup:      p.SamlDefaultGroup,
 	}
+	if p.IsSAML() {
+		response.SamlMetadataUrl = oauth.SAMLServiceURL(p.Slug, "metadata")
+		response.SamlAcsUrl = oauth.SAMLServiceURL(p.Slug, "acs")
+	}
+	return response
 }
 
 // GetCustomOAuthProviders returns all custom OAuth providers
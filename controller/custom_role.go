@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CustomRoleRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type AssignCustomRoleRequest struct {
+	RoleId int `json:"role_id"`
+}
+
+func GetCustomRoles(c *gin.Context) {
+	roles, err := model.GetAllCustomRoles()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, roles)
+}
+
+func AddCustomRole(c *gin.Context) {
+	var req CustomRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	role := model.CustomRole{Name: req.Name, Description: req.Description}
+	if err := role.Normalize(req.Permissions); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := role.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, role)
+}
+
+func UpdateCustomRole(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	role, err := model.GetCustomRoleById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	var req CustomRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	role.Name = req.Name
+	role.Description = req.Description
+	if err := role.Normalize(req.Permissions); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := role.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, role)
+}
+
+func DeleteCustomRole(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.DeleteCustomRoleById(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// AssignUserCustomRole 为用户分配自定义角色，role_id 为 0 表示撤销；仅对普通用户生效
+func AssignUserCustomRole(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	var req AssignCustomRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	user, err := model.GetUserById(userId, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.RoleId != 0 && user.Role != common.RoleCommonUser {
+		common.ApiErrorMsg(c, "自定义角色仅能分配给普通用户")
+		return
+	}
+	if err := model.SetUserCustomRole(userId, req.RoleId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
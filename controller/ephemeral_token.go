@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreateEphemeralTokenRequest struct {
+	ExpiresIn int64    `json:"expires_in"`
+	Models    []string `json:"models"`
+	MaxSpend  int      `json:"max_spend"`
+	User      string   `json:"user"`
+	// AllowAnyIp 为 true 时临时令牌不受父令牌 IP 白名单限制，用于白名单只包含签发方服务器、
+	// 而临时令牌交给浏览器或移动端直连的场景；默认沿用父令牌的白名单
+	AllowAnyIp bool `json:"allow_any_ip"`
+}
+
+type EphemeralTokenResponse struct {
+	Object     string   `json:"object"`
+	Token      string   `json:"token"`
+	ExpiresAt  int64    `json:"expires_at"`
+	Models     []string `json:"models,omitempty"`
+	MaxSpend   int      `json:"max_spend,omitempty"`
+	User       string   `json:"user,omitempty"`
+	AllowAnyIp bool     `json:"allow_any_ip,omitempty"`
+}
+
+func ephemeralTokenError(c *gin.Context, statusCode int, code types.ErrorCode, err error) {
+	apiErr := types.NewErrorWithStatusCode(err, code, statusCode)
+	apiErr.SetMessage(common.MessageWithRequestId(apiErr.Error(), c.GetString(common.RequestIdKey)))
+	c.JSON(statusCode, gin.H{
+		"error": apiErr.ToOpenAIError(),
+	})
+}
+
+// CreateEphemeralToken 使用当前令牌签发短期临时令牌，供浏览器、移动端直接调用 /v1/realtime、/v1/chat/completions 等接口
+func CreateEphemeralToken(c *gin.Context) {
+	if common.GetContextKeyString(c, constant.ContextKeyEphemeralTokenId) != "" {
+		ephemeralTokenError(c, http.StatusForbidden, types.ErrorCodeAccessDenied, errors.New("临时令牌不能签发新的临时令牌"))
+		return
+	}
+	var req CreateEphemeralTokenRequest
+	// 请求体可省略，全部使用默认值
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil && !errors.Is(err, io.EOF) {
+		ephemeralTokenError(c, http.StatusBadRequest, types.ErrorCodeInvalidRequest, errors.New("无效的请求体"))
+		return
+	}
+	if req.ExpiresIn == 0 {
+		req.ExpiresIn = model.EphemeralTokenDefaultTTL
+	}
+	if req.ExpiresIn < 0 || req.ExpiresIn > model.EphemeralTokenMaxTTL {
+		ephemeralTokenError(c, http.StatusBadRequest, types.ErrorCodeInvalidRequest,
+			fmt.Errorf("expires_in 须在 1 到 %d 秒之间", model.EphemeralTokenMaxTTL))
+		return
+	}
+	if req.MaxSpend < 0 {
+		ephemeralTokenError(c, http.StatusBadRequest, types.ErrorCodeInvalidRequest, errors.New("max_spend 不能为负数"))
+		return
+	}
+	if len(req.User) > 64 {
+		ephemeralTokenError(c, http.StatusBadRequest, types.ErrorCodeInvalidRequest, errors.New("user 长度不能超过 64"))
+		return
+	}
+
+	token, err := model.GetTokenById(c.GetInt("token_id"))
+	if err != nil {
+		ephemeralTokenError(c, http.StatusInternalServerError, types.ErrorCodeQueryDataError, err)
+		return
+	}
+	if token.ModelLimitsEnabled {
+		limits := token.GetModelLimitsMap()
+		for _, modelName := range req.Models {
+			if !limits[modelName] {
+				ephemeralTokenError(c, http.StatusForbidden, types.ErrorCodeAccessDenied,
+					fmt.Errorf("该令牌无权访问模型 %s", modelName))
+				return
+			}
+		}
+	}
+
+	key, claims, err := model.MintEphemeralToken(token, req.ExpiresIn, req.Models, req.MaxSpend, req.User, req.AllowAnyIp)
+	if err != nil {
+		ephemeralTokenError(c, http.StatusInternalServerError, types.ErrorCodeUpdateDataError, err)
+		return
+	}
+	c.JSON(http.StatusOK, EphemeralTokenResponse{
+		Object:     "ephemeral_token",
+		Token:      key,
+		ExpiresAt:  claims.ExpiresAt,
+		Models:     claims.Models,
+		MaxSpend:   claims.MaxSpend,
+		User:       claims.EndUserId,
+		AllowAnyIp: claims.AllowAnyIp,
+	})
+}
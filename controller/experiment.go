@@ -0,0 +1,151 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ExperimentFeedbackRequest struct {
+	RequestId string   `json:"request_id"`
+	Score     *float64 `json:"score"`
+}
+
+func GetAllExperiments(c *gin.Context) {
+	experiments, err := model.GetAllExperiments()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, experiments)
+}
+
+func CreateExperiment(c *gin.Context) {
+	var experiment model.Experiment
+	if err := c.ShouldBindJSON(&experiment); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	experiment.Id = 0
+	if err := service.ValidateExperiment(&experiment); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := experiment.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	service.InvalidateExperimentCache()
+	common.ApiSuccess(c, experiment)
+}
+
+// UpdateExperiment 修改实验配置或状态，status 为 2 时停止分流，已记录的结果保留
+func UpdateExperiment(c *gin.Context) {
+	var experiment model.Experiment
+	if err := c.ShouldBindJSON(&experiment); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	existing, err := model.GetExperimentById(experiment.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := service.ValidateExperiment(&experiment); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	experiment.CreatedTime = existing.CreatedTime
+	if err := experiment.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	service.InvalidateExperimentCache()
+	common.ApiSuccess(c, experiment)
+}
+
+func DeleteExperiment(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.DeleteExperimentById(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	service.InvalidateExperimentCache()
+	common.ApiSuccess(c, nil)
+}
+
+// GetExperimentReport 按实验组统计请求数、错误率、平均延迟、花费与反馈评分，
+// 可通过 start_timestamp/end_timestamp 限定时间范围
+func GetExperimentReport(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	experiment, err := model.GetExperimentById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	arms, err := model.GetExperimentReport(id, startTimestamp, endTimestamp)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"experiment": experiment,
+		"arms":       arms,
+	})
+}
+
+// SubmitExperimentFeedback 对应 POST /v1/feedback，为本人的实验请求提交评分，request_id 为响应头 X-Oneapi-Request-Id
+func SubmitExperimentFeedback(c *gin.Context) {
+	var req ExperimentFeedbackRequest
+	if err := common.UnmarshalBodyReusable(c, &req); err != nil {
+		experimentFeedbackError(c, http.StatusBadRequest, types.ErrorCodeInvalidRequest, err)
+		return
+	}
+	if req.RequestId == "" || req.Score == nil {
+		experimentFeedbackError(c, http.StatusBadRequest, types.ErrorCodeInvalidRequest, errors.New("request_id and score are required"))
+		return
+	}
+	if err := service.ValidateExperimentFeedbackScore(*req.Score); err != nil {
+		experimentFeedbackError(c, http.StatusBadRequest, types.ErrorCodeInvalidRequest, err)
+		return
+	}
+	userId := common.GetContextKeyInt(c, constant.ContextKeyUserId)
+	if err := model.UpdateExperimentFeedback(req.RequestId, userId, *req.Score); err != nil {
+		if errors.Is(err, model.ErrExperimentNotFound) {
+			experimentFeedbackError(c, http.StatusNotFound, types.ErrorCodeInvalidRequest, errors.New("no experiment request found for request_id"))
+			return
+		}
+		experimentFeedbackError(c, http.StatusInternalServerError, types.ErrorCodeUpdateDataError, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"request_id": req.RequestId,
+		"score":      *req.Score,
+	})
+}
+
+func experimentFeedbackError(c *gin.Context, statusCode int, code types.ErrorCode, err error) {
+	apiErr := types.NewErrorWithStatusCode(err, code, statusCode)
+	apiErr.SetMessage(common.MessageWithRequestId(apiErr.Error(), c.GetString(common.RequestIdKey)))
+	c.JSON(statusCode, gin.H{
+		"error": apiErr.ToOpenAIError(),
+	})
+}
@@ -21,7 +21,8 @@ func GetAllLogs(c *gin.Context) {
 	channel, _ := strconv.Atoi(c.Query("channel"))
 	group := c.Query("group")
 	requestId := c.Query("request_id")
-	logs, total, err := model.GetAllLogs(logType, startTimestamp, endTimestamp, modelName, username, tokenName, pageInfo.GetStartIdx(), pageInfo.GetPageSize(), channel, group, requestId)
+	endUserId := c.Query("end_user_id")
+	logs, total, err := model.GetAllLogs(logType, startTimestamp, endTimestamp, modelName, username, tokenName, pageInfo.GetStartIdx(), pageInfo.GetPageSize(), channel, group, requestId, endUserId)
 	if err != nil {
 		common.ApiError(c, err)
 		return
@@ -42,7 +43,8 @@ func GetUserLogs(c *gin.Context) {
 	modelName := c.Query("model_name")
 	group := c.Query("group")
 	requestId := c.Query("request_id")
-	logs, total, err := model.GetUserLogs(userId, logType, startTimestamp, endTimestamp, modelName, tokenName, pageInfo.GetStartIdx(), pageInfo.GetPageSize(), group, requestId)
+	endUserId := c.Query("end_user_id")
+	logs, total, err := model.GetUserLogs(userId, logType, startTimestamp, endTimestamp, modelName, tokenName, pageInfo.GetStartIdx(), pageInfo.GetPageSize(), group, requestId, endUserId)
 	if err != nil {
 		common.ApiError(c, err)
 		return
@@ -169,3 +171,45 @@ func DeleteHistoryLogs(c *gin.Context) {
 	})
 	return
 }
+
+// GetMarginReport 按渠道、模型或分组统计收入、上游成本与毛利
+func GetMarginReport(c *gin.Context) {
+	groupBy := c.Query("group_by")
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	channel, _ := strconv.Atoi(c.Query("channel"))
+	modelName := c.Query("model_name")
+	group := c.Query("group")
+	items, err := model.GetMarginReport(groupBy, startTimestamp, endTimestamp, channel, modelName, group)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, items)
+}
+
+// getEndUserUsage 按终端用户汇总用量，userId 为 0 时统计全部用户
+func getEndUserUsage(c *gin.Context, userId int) {
+	pageInfo := common.GetPageQuery(c)
+	tokenId, _ := strconv.Atoi(c.Query("token_id"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	endUserId := c.Query("end_user_id")
+	items, total, err := model.GetEndUserUsage(userId, tokenId, startTimestamp, endTimestamp, endUserId, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(items)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetEndUserUsage(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	getEndUserUsage(c, userId)
+}
+
+func GetSelfEndUserUsage(c *gin.Context) {
+	getEndUserUsage(c, c.GetInt("id"))
+}
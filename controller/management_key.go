@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ManagementKeyRequest struct {
+	Name        string   `json:"name"`
+	Scopes      []string `json:"scopes"`
+	Status      int      `json:"status"`
+	ExpiredTime int64    `json:"expired_time"`
+	AllowIps    *string  `json:"allow_ips"`
+}
+
+// applyManagementKeyRequest 校验请求并写入可编辑字段
+func applyManagementKeyRequest(key *model.ManagementKey, req *ManagementKeyRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return model.ErrManagementKeyNameEmpty
+	}
+	if len(req.Name) > 64 {
+		return errors.New("管理密钥名称过长")
+	}
+	scopes, err := model.NormalizeManagementScopes(req.Scopes)
+	if err != nil {
+		return err
+	}
+	if req.ExpiredTime == 0 {
+		req.ExpiredTime = -1
+	}
+	if req.ExpiredTime != -1 && req.ExpiredTime < common.GetTimestamp() {
+		return model.ErrManagementKeyExpired
+	}
+	key.Name = req.Name
+	key.Scopes = scopes
+	key.ExpiredTime = req.ExpiredTime
+	key.AllowIps = req.AllowIps
+	if req.Status == model.ManagementKeyStatusEnabled || req.Status == model.ManagementKeyStatusDisabled {
+		key.Status = req.Status
+	}
+	return nil
+}
+
+func GetManagementKeys(c *gin.Context) {
+	keys, err := model.GetUserManagementKeys(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, keys)
+}
+
+func AddManagementKey(c *gin.Context) {
+	var req ManagementKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	key := model.ManagementKey{
+		UserId: c.GetInt("id"),
+		Status: model.ManagementKeyStatusEnabled,
+	}
+	if err := applyManagementKeyRequest(&key, &req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	plaintext, err := key.GenerateManagementKey()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := key.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	// 明文密钥仅在创建时返回一次
+	common.ApiSuccess(c, gin.H{
+		"id":  key.Id,
+		"key": plaintext,
+	})
+}
+
+func UpdateManagementKey(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	key, err := model.GetManagementKeyByIdAndUserId(id, c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	var req ManagementKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := applyManagementKeyRequest(key, &req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := key.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, key)
+}
+
+func DeleteManagementKey(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.DeleteManagementKeyById(id, c.GetInt("id")); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
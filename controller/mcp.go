@@ -0,0 +1,276 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+// mcpResponseHeaders 回传给客户端的上游响应头，Mcp-Session-Id 单独处理
+var mcpResponseHeaders = []string{"Content-Type", "Cache-Control", "Mcp-Protocol-Version"}
+
+// RelayMcp 代理 MCP 客户端对已登记 MCP 服务器的访问（/mcp/:server，streamable HTTP）。
+// 上游为旧版 SSE 传输时由网关保持 SSE 会话，客户端侧仍使用 streamable HTTP
+func RelayMcp(c *gin.Context) {
+	label := c.Param("server")
+	allowlist := service.ParseMcpAllowlist(common.GetContextKeyString(c, constant.ContextKeyTokenMcpAllowlist))
+	if !allowlist.AllowServer(label) || !mcpEphemeralScopeAllowed(c, label) {
+		mcpAbort(c, http.StatusForbidden, dto.McpErrorCodeToolForbidden, fmt.Sprintf("token is not allowed to access mcp server %s", label))
+		return
+	}
+	server, err := service.GetMcpServer(label)
+	if err != nil {
+		mcpAbort(c, http.StatusNotFound, dto.McpErrorCodeInvalidRequest, fmt.Sprintf("mcp server %s not found", label))
+		return
+	}
+
+	switch c.Request.Method {
+	case http.MethodPost:
+		relayMcpMessage(c, server, allowlist)
+	case http.MethodDelete:
+		relayMcpDeleteSession(c, server)
+	default:
+		relayMcpStream(c, server)
+	}
+}
+
+// mcpEphemeralScopeAllowed 为 Responses 工具签发的临时令牌仅能访问 mcp/<server> 声明的服务器
+func mcpEphemeralScopeAllowed(c *gin.Context, label string) bool {
+	if common.GetContextKeyString(c, constant.ContextKeyEphemeralTokenId) == "" ||
+		!common.GetContextKeyBool(c, constant.ContextKeyTokenModelLimitEnabled) {
+		return true
+	}
+	limits, _ := common.GetContextKeyType[map[string]bool](c, constant.ContextKeyTokenModelLimit)
+	scoped := false
+	for modelName := range limits {
+		if strings.HasPrefix(modelName, service.McpModelPrefix) {
+			scoped = true
+			break
+		}
+	}
+	return !scoped || limits[service.McpModelPrefix+label]
+}
+
+func mcpAbort(c *gin.Context, statusCode int, code int, message string) {
+	c.JSON(statusCode, dto.NewMcpErrorResponse(nil, code, message))
+}
+
+func relayMcpMessage(c *gin.Context, server *service.McpServer, allowlist service.McpAllowlist) {
+	storage, err := common.GetBodyStorage(c)
+	if err != nil {
+		mcpAbort(c, http.StatusBadRequest, dto.McpErrorCodeParseError, err.Error())
+		return
+	}
+	body, err := storage.Bytes()
+	if err != nil {
+		mcpAbort(c, http.StatusBadRequest, dto.McpErrorCodeParseError, err.Error())
+		return
+	}
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		// 批量请求无法逐个校验工具权限，且已从 MCP 规范中移除
+		mcpAbort(c, http.StatusBadRequest, dto.McpErrorCodeInvalidRequest, "batch requests are not supported")
+		return
+	}
+	var message dto.McpJsonRpcMessage
+	if err := common.Unmarshal(body, &message); err != nil {
+		mcpAbort(c, http.StatusBadRequest, dto.McpErrorCodeParseError, "invalid json-rpc message")
+		return
+	}
+	if message.JsonRpc != "2.0" {
+		mcpAbort(c, http.StatusBadRequest, dto.McpErrorCodeInvalidRequest, "invalid json-rpc version")
+		return
+	}
+
+	var toolName string
+	if message.Method == "tools/call" {
+		var params dto.McpToolCallParams
+		if err := common.Unmarshal(message.Params, &params); err != nil || params.Name == "" {
+			c.JSON(http.StatusOK, dto.NewMcpErrorResponse(message.Id, dto.McpErrorCodeInvalidParams, "invalid tools/call params"))
+			return
+		}
+		toolName = params.Name
+		if !allowlist.AllowTool(server.Label, toolName) {
+			c.JSON(http.StatusOK, dto.NewMcpErrorResponse(message.Id, dto.McpErrorCodeToolForbidden,
+				fmt.Sprintf("tool %s is not allowed for this token", toolName)))
+			return
+		}
+		if err := service.CheckMcpToolCallQuota(c, server, toolName); err != nil {
+			c.JSON(http.StatusOK, dto.NewMcpErrorResponse(message.Id, dto.McpErrorCodeToolForbidden, err.Error()))
+			return
+		}
+	}
+
+	// 处理上游对本次请求的响应：过滤工具列表、结算工具调用
+	handleResponse := func(data []byte) []byte {
+		var response dto.McpJsonRpcMessage
+		if err := common.Unmarshal(data, &response); err != nil || !response.IsResponse() ||
+			strings.TrimSpace(string(response.Id)) != strings.TrimSpace(string(message.Id)) {
+			return data
+		}
+		switch message.Method {
+		case "tools/list":
+			return service.FilterMcpToolsListResponse(data, func(tool string) bool {
+				return allowlist.AllowTool(server.Label, tool)
+			})
+		case "tools/call":
+			if response.Error == nil && len(response.Result) > 0 {
+				service.SettleMcpToolCall(c, server, toolName, gjson.GetBytes(response.Result, "isError").Bool())
+			}
+		}
+		return data
+	}
+
+	if server.Transport == dto.McpTransportSSE {
+		relayMcpSSEMessage(c, server, &message, body, handleResponse)
+		return
+	}
+
+	tokenId := common.GetContextKeyInt(c, constant.ContextKeyTokenId)
+	upstreamSessionId, ok := mcpUpstreamSessionId(c, server.Label, tokenId)
+	if !ok {
+		mcpAbort(c, http.StatusNotFound, dto.McpErrorCodeInvalidRequest, "mcp session not found")
+		return
+	}
+	resp, err := service.DoMcpStreamableRequest(c.Request.Context(), server, http.MethodPost, body, c.Request.Header, upstreamSessionId)
+	if err != nil {
+		logger.LogError(c, fmt.Sprintf("mcp server %s request failed: %s", server.Label, err.Error()))
+		mcpAbort(c, http.StatusBadGateway, dto.McpErrorCodeInternalError, "mcp server request failed")
+		return
+	}
+	defer service.CloseResponseBodyGracefully(resp)
+	copyMcpResponseHeaders(c, resp, server.Label, tokenId)
+
+	if !message.IsRequest() || resp.StatusCode != http.StatusOK {
+		c.Status(resp.StatusCode)
+		_, _ = io.Copy(c.Writer, resp.Body)
+		return
+	}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		c.Status(resp.StatusCode)
+		if err := service.RewriteMcpSSEStream(c.Writer, c.Writer.Flush, resp.Body, handleResponse); err != nil {
+			logger.LogError(c, fmt.Sprintf("mcp server %s stream failed: %s", server.Label, err.Error()))
+		}
+		return
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		mcpAbort(c, http.StatusBadGateway, dto.McpErrorCodeInternalError, "failed to read mcp server response")
+		return
+	}
+	c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), handleResponse(data))
+}
+
+func relayMcpSSEMessage(c *gin.Context, server *service.McpServer, message *dto.McpJsonRpcMessage, body []byte, handleResponse func([]byte) []byte) {
+	tokenId := common.GetContextKeyInt(c, constant.ContextKeyTokenId)
+	var session *service.McpSSESession
+	if message.Method == "initialize" {
+		var err error
+		session, err = service.OpenMcpSSESession(c.Request.Context(), server, tokenId)
+		if err != nil {
+			logger.LogError(c, fmt.Sprintf("mcp server %s sse connection failed: %s", server.Label, err.Error()))
+			mcpAbort(c, http.StatusBadGateway, dto.McpErrorCodeInternalError, "mcp server connection failed")
+			return
+		}
+	} else {
+		session = service.GetMcpSSESession(c.GetHeader("Mcp-Session-Id"), server.Label, tokenId)
+		if session == nil {
+			mcpAbort(c, http.StatusNotFound, dto.McpErrorCodeInvalidRequest, "mcp session not found")
+			return
+		}
+	}
+
+	data, err := session.Send(c.Request.Context(), message, body)
+	if err != nil {
+		logger.LogError(c, fmt.Sprintf("mcp server %s request failed: %s", server.Label, err.Error()))
+		c.JSON(http.StatusBadGateway, dto.NewMcpErrorResponse(message.Id, dto.McpErrorCodeInternalError, "mcp server request failed"))
+		return
+	}
+	c.Header("Mcp-Session-Id", session.Id())
+	if data == nil {
+		c.Status(http.StatusAccepted)
+		return
+	}
+	c.Data(http.StatusOK, "application/json", handleResponse(data))
+}
+
+// relayMcpStream 转发服务器主动推送的 SSE 流（GET），旧版 SSE 传输不支持
+func relayMcpStream(c *gin.Context, server *service.McpServer) {
+	if server.Transport == dto.McpTransportSSE {
+		c.Status(http.StatusMethodNotAllowed)
+		return
+	}
+	tokenId := common.GetContextKeyInt(c, constant.ContextKeyTokenId)
+	upstreamSessionId, ok := mcpUpstreamSessionId(c, server.Label, tokenId)
+	if !ok {
+		mcpAbort(c, http.StatusNotFound, dto.McpErrorCodeInvalidRequest, "mcp session not found")
+		return
+	}
+	resp, err := service.DoMcpStreamableRequest(c.Request.Context(), server, http.MethodGet, nil, c.Request.Header, upstreamSessionId)
+	if err != nil {
+		logger.LogError(c, fmt.Sprintf("mcp server %s request failed: %s", server.Label, err.Error()))
+		mcpAbort(c, http.StatusBadGateway, dto.McpErrorCodeInternalError, "mcp server request failed")
+		return
+	}
+	defer service.CloseResponseBodyGracefully(resp)
+	copyMcpResponseHeaders(c, resp, server.Label, tokenId)
+	c.Status(resp.StatusCode)
+	_ = service.RewriteMcpSSEStream(c.Writer, c.Writer.Flush, resp.Body, func(data []byte) []byte { return data })
+}
+
+// relayMcpDeleteSession 客户端结束会话
+func relayMcpDeleteSession(c *gin.Context, server *service.McpServer) {
+	tokenId := common.GetContextKeyInt(c, constant.ContextKeyTokenId)
+	if server.Transport == dto.McpTransportSSE {
+		session := service.GetMcpSSESession(c.GetHeader("Mcp-Session-Id"), server.Label, tokenId)
+		if session == nil {
+			mcpAbort(c, http.StatusNotFound, dto.McpErrorCodeInvalidRequest, "mcp session not found")
+			return
+		}
+		session.Close()
+		c.Status(http.StatusOK)
+		return
+	}
+	upstreamSessionId, ok := mcpUpstreamSessionId(c, server.Label, tokenId)
+	if !ok || upstreamSessionId == "" {
+		mcpAbort(c, http.StatusNotFound, dto.McpErrorCodeInvalidRequest, "mcp session not found")
+		return
+	}
+	resp, err := service.DoMcpStreamableRequest(c.Request.Context(), server, http.MethodDelete, nil, c.Request.Header, upstreamSessionId)
+	if err != nil {
+		mcpAbort(c, http.StatusBadGateway, dto.McpErrorCodeInternalError, "mcp server request failed")
+		return
+	}
+	service.CloseResponseBodyGracefully(resp)
+	c.Status(resp.StatusCode)
+}
+
+// mcpUpstreamSessionId 还原客户端携带的会话 ID，未携带时返回空字符串
+func mcpUpstreamSessionId(c *gin.Context, label string, tokenId int) (string, bool) {
+	sessionId := c.GetHeader("Mcp-Session-Id")
+	if sessionId == "" {
+		return "", true
+	}
+	return service.UnwrapMcpSessionId(label, tokenId, sessionId)
+}
+
+func copyMcpResponseHeaders(c *gin.Context, resp *http.Response, label string, tokenId int) {
+	for _, name := range mcpResponseHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			c.Header(name, value)
+		}
+	}
+	if sessionId := resp.Header.Get("Mcp-Session-Id"); sessionId != "" {
+		c.Header("Mcp-Session-Id", service.WrapMcpSessionId(label, tokenId, sessionId))
+	}
+}
@@ -145,13 +145,18 @@ func GetStatus(c *gin.Context) {
 		providersInfo := make([]CustomOAuthInfo, 0, len(customProviders))
 		for _, p := range customProviders {
 			config := p.GetConfig()
+			authorizationEndpoint := config.AuthorizationEndpoint
+			if config.IsSAML() {
+				// SAML login starts at our own endpoint, which redirects to the IdP
+				authorizationEndpoint = oauth.SAMLServiceURL(config.Slug, "login")
+			}
 			providersInfo = append(providersInfo, CustomOAuthInfo{
 				Id:                    config.Id,
 				Name:                  config.Name,
 				Slug:                  config.Slug,
 				Icon:                  config.Icon,
 				ClientId:              config.ClientId,
-				AuthorizationEndpoint: config.AuthorizationEndpoint,
+				AuthorizationEndpoint: authorizationEndpoint,
 				Scopes:                config.Scopes,
 			})
 		}
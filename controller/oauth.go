@@ -3,6 +3,7 @@ package controller
 import (
 	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
 
 	"github.com/QuantumNous/new-api/common"
@@ -207,6 +208,7 @@ func findOrCreateOAuthUser(c *gin.Context, provider oauth.Provider, oauthUser *o
 		if user.Id == 0 {
 			return nil, &OAuthUserDeletedError{}
 		}
+		syncOAuthUserGroup(user, oauthUser)
 		return user, nil
 	}
 
@@ -259,6 +261,12 @@ func findOrCreateOAuthUser(c *gin.Context, provider oauth.Provider, oauthUser *o
 	}
 	user.Role = common.RoleCommonUser
 	user.Status = common.UserStatusEnabled
+	// Just-in-time provisioning: mapped group first, then the provider's default group
+	if group, ok := oauthUser.Extra["group"].(string); ok && group != "" {
+		user.Group = group
+	} else if group, ok := oauthUser.Extra["default_group"].(string); ok && group != "" {
+		user.Group = group
+	}
 
 	// Handle affiliate code
 	affCode := session.Get("aff")
@@ -328,6 +336,28 @@ func findOrCreateOAuthUser(c *gin.Context, provider oauth.Provider, oauthUser *o
 	return user, nil
 }
 
+// syncOAuthUserGroup applies the group mapped from the provider (e.g. a SAML group attribute) on login.
+// Nothing changes when no provider group maps to a known group, or when the user's current group is
+// still one of the mapped groups, so groups assigned manually by an admin are kept
+func syncOAuthUserGroup(user *model.User, oauthUser *oauth.OAuthUser) {
+	group, ok := oauthUser.Extra["group"].(string)
+	if !ok || group == "" || group == user.Group {
+		return
+	}
+	// Extra 经过 JSON 往返，groups 为 []any
+	if groups, ok := oauthUser.Extra["groups"].([]any); ok && slices.Contains(groups, any(user.Group)) {
+		return
+	}
+	if err := model.DB.Model(user).Update("group", group).Error; err != nil {
+		common.SysError(fmt.Sprintf("[OAuth] Failed to sync group of user %d: %s", user.Id, err.Error()))
+		return
+	}
+	user.Group = group
+	if err := model.UpdateUserGroupCache(user.Id, group); err != nil {
+		common.SysError(fmt.Sprintf("[OAuth] Failed to update group cache of user %d: %s", user.Id, err.Error()))
+	}
+}
+
 // Error types for OAuth
 type OAuthUserDeletedError struct{}
 
@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminUpsertPostpaidAccountRequest struct {
+	UserId          int    `json:"user_id"`
+	Enabled         bool   `json:"enabled"`
+	CreditLimit     int64  `json:"credit_limit"`
+	CycleDays       int    `json:"cycle_days"`
+	PaymentTermDays int    `json:"payment_term_days"`
+	Remark          string `json:"remark"`
+}
+
+type AdminRecordPostpaidPaymentRequest struct {
+	Amount    int64  `json:"amount"`
+	Method    string `json:"method"`
+	Reference string `json:"reference"`
+	Remark    string `json:"remark"`
+}
+
+// AdminListPostpaidAccounts 分页列出所有后付费账户
+func AdminListPostpaidAccounts(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	accounts, total, err := model.GetAllPostpaidAccounts(pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(accounts)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// AdminGetPostpaidAccount 获取指定用户的后付费账户
+func AdminGetPostpaidAccount(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Param("id"))
+	if userId <= 0 {
+		common.ApiErrorMsg(c, "无效的用户ID")
+		return
+	}
+	account, err := model.GetPostpaidAccountByUserId(userId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, account)
+}
+
+// AdminUpsertPostpaidAccount 为用户开通或修改后付费配置
+func AdminUpsertPostpaidAccount(c *gin.Context) {
+	var req AdminUpsertPostpaidAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.UserId <= 0 {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	if _, err := model.GetUserById(req.UserId, false); err != nil {
+		common.ApiErrorMsg(c, "用户不存在")
+		return
+	}
+	account, err := model.UpsertPostpaidAccount(req.UserId, req.Enabled, req.CreditLimit, req.CycleDays, req.PaymentTermDays, req.Remark)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.RecordLog(req.UserId, model.LogTypeManage, fmt.Sprintf("管理员更新后付费配置：启用 %t，信用额度 %s，账期 %d 天，付款期限 %d 天",
+		account.Enabled, logger.FormatQuota(int(account.CreditLimit)), account.CycleDays, account.PaymentTermDays))
+	common.ApiSuccess(c, account)
+}
+
+// AdminClosePostpaidCycle 立即关闭用户当前账期并生成账单
+func AdminClosePostpaidCycle(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Param("id"))
+	if userId <= 0 {
+		common.ApiErrorMsg(c, "无效的用户ID")
+		return
+	}
+	statement, err := model.ClosePostpaidCycle(userId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.RecordLog(userId, model.LogTypeManage, fmt.Sprintf("管理员手动关闭后付费账期，账单金额 %s", logger.FormatQuota(int(statement.AmountDue))))
+	common.ApiSuccess(c, statement)
+}
+
+// AdminListPostpaidStatements 列出后付费账单，可按用户和状态筛选
+func AdminListPostpaidStatements(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	status := c.Query("status")
+	statements, total, err := model.GetPostpaidStatements(userId, status, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(statements)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// AdminListPostpaidPayments 列出账单的付款记录
+func AdminListPostpaidPayments(c *gin.Context) {
+	statementId, _ := strconv.Atoi(c.Param("id"))
+	if statementId <= 0 {
+		common.ApiErrorMsg(c, "无效的账单ID")
+		return
+	}
+	payments, err := model.GetPostpaidPaymentsByStatementId(statementId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, payments)
+}
+
+// AdminRecordPostpaidPayment 登记线下付款
+func AdminRecordPostpaidPayment(c *gin.Context) {
+	statementId, _ := strconv.Atoi(c.Param("id"))
+	if statementId <= 0 {
+		common.ApiErrorMsg(c, "无效的账单ID")
+		return
+	}
+	var req AdminRecordPostpaidPaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Amount <= 0 {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	statement, err := model.RecordPostpaidPayment(statementId, req.Amount, req.Method, req.Reference, req.Remark, c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.RecordLog(statement.UserId, model.LogTypeManage, fmt.Sprintf("管理员登记后付费账单 #%d 线下付款 %s，付款方式 %s，参考号 %s",
+		statement.Id, logger.FormatQuota(int(req.Amount)), req.Method, req.Reference))
+	common.ApiSuccess(c, statement)
+}
+
+// GetPostpaidSelf 获取当前用户的后付费账户与账单
+func GetPostpaidSelf(c *gin.Context) {
+	userId := c.GetInt("id")
+	account, err := model.GetPostpaidAccountByUserId(userId)
+	if err != nil {
+		common.ApiSuccess(c, gin.H{"enabled": false})
+		return
+	}
+	pageInfo := common.GetPageQuery(c)
+	statements, total, err := model.GetPostpaidStatements(userId, "", pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(statements)
+	common.ApiSuccess(c, gin.H{
+		"enabled":    account.Enabled,
+		"account":    account,
+		"statements": pageInfo,
+	})
+}
@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PromptTemplateRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Messages    string `json:"messages"`
+	Variables   string `json:"variables"`
+}
+
+// promptTemplateOwner 全局模板路由下返回 0，其余为当前用户
+func promptTemplateOwner(c *gin.Context, global bool) int {
+	if global {
+		return 0
+	}
+	return c.GetInt("id")
+}
+
+func getPromptTemplates(c *gin.Context, global bool) {
+	templates, err := model.GetPromptTemplates(promptTemplateOwner(c, global), c.Query("name"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, templates)
+}
+
+// createPromptTemplate 创建模板的新版本，同名模板不存在时版本号从 1 开始
+func createPromptTemplate(c *gin.Context, global bool) {
+	var req PromptTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	template := model.PromptTemplate{
+		UserId:      promptTemplateOwner(c, global),
+		Name:        req.Name,
+		Description: req.Description,
+		Messages:    req.Messages,
+		Variables:   req.Variables,
+	}
+	if err := service.ValidatePromptTemplate(&template); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := template.InsertNewVersion(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, template)
+}
+
+func activatePromptTemplate(c *gin.Context, global bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	template, err := model.ActivatePromptTemplate(id, promptTemplateOwner(c, global))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, template)
+}
+
+func deletePromptTemplate(c *gin.Context, global bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.DeletePromptTemplate(id, promptTemplateOwner(c, global)); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// GetPromptTemplates 获取当前用户的模板版本，可通过 ?name=xxx 过滤
+func GetPromptTemplates(c *gin.Context) {
+	getPromptTemplates(c, false)
+}
+
+func CreatePromptTemplate(c *gin.Context) {
+	createPromptTemplate(c, false)
+}
+
+func ActivatePromptTemplate(c *gin.Context) {
+	activatePromptTemplate(c, false)
+}
+
+func DeletePromptTemplate(c *gin.Context) {
+	deletePromptTemplate(c, false)
+}
+
+// GetGlobalPromptTemplates 获取全局模板版本，全局模板对所有用户可用
+func GetGlobalPromptTemplates(c *gin.Context) {
+	getPromptTemplates(c, true)
+}
+
+func CreateGlobalPromptTemplate(c *gin.Context) {
+	createPromptTemplate(c, true)
+}
+
+func ActivateGlobalPromptTemplate(c *gin.Context) {
+	activatePromptTemplate(c, true)
+}
+
+func DeleteGlobalPromptTemplate(c *gin.Context) {
+	deletePromptTemplate(c, true)
+}
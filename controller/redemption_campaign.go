@@ -0,0 +1,172 @@
+package controller
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// redemptionCampaignMaxCodes 单个活动一次最多生成的兑换码数量
+const redemptionCampaignMaxCodes = 10000
+
+type RedemptionCampaignRequest struct {
+	model.RedemptionCampaign
+	Count int `json:"count"`
+}
+
+func GetRedemptionCampaigns(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	campaigns, total, err := model.GetRedemptionCampaigns(pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(campaigns)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetRedemptionCampaign(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	campaign, err := model.GetRedemptionCampaignById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	stats, err := model.GetRedemptionCampaignStats(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, model.RedemptionCampaignSummary{RedemptionCampaign: campaign, Stats: stats})
+}
+
+func AddRedemptionCampaign(c *gin.Context) {
+	var req RedemptionCampaignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if utf8.RuneCountInString(req.Name) == 0 || utf8.RuneCountInString(req.Name) > 20 {
+		common.ApiErrorI18n(c, i18n.MsgRedemptionNameLength)
+		return
+	}
+	if req.Count <= 0 {
+		common.ApiErrorI18n(c, i18n.MsgRedemptionCountPositive)
+		return
+	}
+	if req.Count > redemptionCampaignMaxCodes {
+		common.ApiErrorMsg(c, fmt.Sprintf("单个活动最多生成 %d 个兑换码", redemptionCampaignMaxCodes))
+		return
+	}
+	if valid, msg := validateExpiredTime(c, req.ExpiredTime); !valid {
+		common.ApiErrorMsg(c, msg)
+		return
+	}
+	if req.RewardType == model.RedemptionRewardGroup && !ratio_setting.ContainsGroupRatio(req.Group) {
+		common.ApiErrorMsg(c, "目标分组不存在")
+		return
+	}
+	campaign := req.RedemptionCampaign
+	campaign.Id = 0
+	campaign.CreatedBy = c.GetInt("id")
+	if err := model.CreateRedemptionCampaign(&campaign, req.Count); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.RecordLog(c.GetInt("id"), model.LogTypeManage, fmt.Sprintf("创建兑换码活动「%s」，生成 %d 个兑换码", campaign.Name, req.Count))
+	common.ApiSuccess(c, campaign)
+}
+
+func UpdateRedemptionCampaign(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	campaign, err := model.GetRedemptionCampaignById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	var req model.RedemptionCampaign
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if utf8.RuneCountInString(req.Name) == 0 || utf8.RuneCountInString(req.Name) > 20 {
+		common.ApiErrorI18n(c, i18n.MsgRedemptionNameLength)
+		return
+	}
+	if valid, msg := validateExpiredTime(c, req.ExpiredTime); !valid {
+		common.ApiErrorMsg(c, msg)
+		return
+	}
+	campaign.Name = req.Name
+	campaign.MaxRedemptionsPerUser = req.MaxRedemptionsPerUser
+	campaign.ExpiredTime = req.ExpiredTime
+	if err := model.UpdateRedemptionCampaign(campaign); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, campaign)
+}
+
+func redemptionStatusText(redemption *model.Redemption, now int64) string {
+	switch redemption.Status {
+	case common.RedemptionCodeStatusUsed:
+		return "redeemed"
+	case common.RedemptionCodeStatusDisabled:
+		return "disabled"
+	}
+	if redemption.ExpiredTime != 0 && redemption.ExpiredTime < now {
+		return "expired"
+	}
+	return "unredeemed"
+}
+
+// ExportRedemptionCampaign 以 CSV 导出活动下的全部兑换码
+func ExportRedemptionCampaign(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	campaign, err := model.GetRedemptionCampaignById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	redemptions, err := model.GetRedemptionsByCampaignId(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=redemption-campaign-%d.csv", campaign.Id))
+	writer := csv.NewWriter(c.Writer)
+	_ = writer.Write([]string{"key", "status", "used_user_id", "redeemed_time", "expired_time"})
+	now := common.GetTimestamp()
+	for _, redemption := range redemptions {
+		_ = writer.Write([]string{
+			redemption.Key,
+			redemptionStatusText(redemption, now),
+			strconv.Itoa(redemption.UsedUserId),
+			strconv.FormatInt(redemption.RedeemedTime, 10),
+			strconv.FormatInt(redemption.ExpiredTime, 10),
+		})
+	}
+	writer.Flush()
+}
@@ -0,0 +1,230 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/oauth"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/gin-gonic/gin"
+)
+
+// SAMLProviderRequest is the request structure for creating or updating a SAML provider.
+// SAML providers share the custom OAuth provider table, slug space and user bindings.
+type SAMLProviderRequest struct {
+	Name                string `json:"name"`
+	Slug                string `json:"slug"`
+	Icon                string `json:"icon"`
+	Enabled             bool   `json:"enabled"`
+	IdpMetadataUrl      string `json:"saml_idp_metadata_url"`
+	IdpMetadata         string `json:"saml_idp_metadata"`
+	UserIdField         string `json:"user_id_field"`
+	UsernameField       string `json:"username_field"`
+	DisplayNameField    string `json:"display_name_field"`
+	EmailField          string `json:"email_field"`
+	GroupField          string `json:"saml_group_field"`
+	DefaultGroup        string `json:"saml_default_group"`
+	AccessPolicy        string `json:"access_policy"`
+	AccessDeniedMessage string `json:"access_denied_message"`
+}
+
+// applySAMLProviderRequest copies request fields and resolves IdP metadata from its URL if needed
+func applySAMLProviderRequest(c *gin.Context, provider *model.CustomOAuthProvider, req *SAMLProviderRequest) error {
+	provider.Protocol = model.CustomOAuthProtocolSAML
+	provider.Name = req.Name
+	provider.Slug = req.Slug
+	provider.Icon = req.Icon
+	provider.Enabled = req.Enabled
+	provider.SamlIdpMetadataUrl = strings.TrimSpace(req.IdpMetadataUrl)
+	provider.SamlIdpMetadata = strings.TrimSpace(req.IdpMetadata)
+	provider.UserIdField = req.UserIdField
+	provider.UsernameField = req.UsernameField
+	provider.DisplayNameField = req.DisplayNameField
+	provider.EmailField = req.EmailField
+	provider.SamlGroupField = req.GroupField
+	provider.SamlDefaultGroup = req.DefaultGroup
+	provider.AccessPolicy = req.AccessPolicy
+	provider.AccessDeniedMessage = req.AccessDeniedMessage
+
+	if provider.SamlIdpMetadata == "" && provider.SamlIdpMetadataUrl != "" {
+		metadata, err := oauth.FetchSAMLIdPMetadata(c.Request.Context(), provider.SamlIdpMetadataUrl)
+		if err != nil {
+			return fmt.Errorf("获取 IdP Metadata 失败: %w", err)
+		}
+		provider.SamlIdpMetadata = metadata
+	}
+	if provider.SamlIdpMetadata != "" {
+		if _, err := oauth.ParseSAMLIdPMetadata([]byte(provider.SamlIdpMetadata)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateSAMLProvider creates a new SAML 2.0 provider
+func CreateSAMLProvider(c *gin.Context) {
+	var req SAMLProviderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "无效的请求参数: "+err.Error())
+		return
+	}
+	if model.IsSlugTaken(req.Slug, 0) {
+		common.ApiErrorMsg(c, "该 Slug 已被使用")
+		return
+	}
+	if oauth.IsProviderRegistered(req.Slug) && !oauth.IsCustomProvider(req.Slug) {
+		common.ApiErrorMsg(c, "该 Slug 与内置 OAuth 提供商冲突")
+		return
+	}
+
+	provider := &model.CustomOAuthProvider{}
+	if err := applySAMLProviderRequest(c, provider, &req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.CreateCustomOAuthProvider(provider); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	oauth.RegisterOrUpdateCustomProvider(provider)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "创建成功",
+		"data":    toCustomOAuthProviderResponse(provider),
+	})
+}
+
+// UpdateSAMLProvider updates an existing SAML 2.0 provider
+func UpdateSAMLProvider(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的 ID")
+		return
+	}
+	var req SAMLProviderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "无效的请求参数: "+err.Error())
+		return
+	}
+	provider, err := model.GetCustomOAuthProviderById(id)
+	if err != nil || !provider.IsSAML() {
+		common.ApiErrorMsg(c, "未找到该 SAML 提供商")
+		return
+	}
+	if req.Slug != provider.Slug {
+		if model.IsSlugTaken(req.Slug, id) {
+			common.ApiErrorMsg(c, "该 Slug 已被使用")
+			return
+		}
+		if oauth.IsProviderRegistered(req.Slug) && !oauth.IsCustomProvider(req.Slug) {
+			common.ApiErrorMsg(c, "该 Slug 与内置 OAuth 提供商冲突")
+			return
+		}
+	}
+
+	oldSlug := provider.Slug
+	if err := applySAMLProviderRequest(c, provider, &req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.UpdateCustomOAuthProvider(provider); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if oldSlug != provider.Slug {
+		oauth.UnregisterCustomProvider(oldSlug)
+	}
+	oauth.RegisterOrUpdateCustomProvider(provider)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "更新成功",
+		"data":    toCustomOAuthProviderResponse(provider),
+	})
+}
+
+// getSAMLProviderConfig returns the registered SAML provider config for the slug in the path
+func getSAMLProviderConfig(c *gin.Context) *model.CustomOAuthProvider {
+	provider, ok := oauth.GetProvider(c.Param("slug")).(*oauth.GenericOAuthProvider)
+	if !ok || !provider.GetConfig().IsSAML() {
+		return nil
+	}
+	return provider.GetConfig()
+}
+
+// GetSAMLMetadata serves the SP metadata to be registered at the IdP
+func GetSAMLMetadata(c *gin.Context) {
+	config := getSAMLProviderConfig(c)
+	if config == nil {
+		c.String(http.StatusNotFound, "SAML provider not found")
+		return
+	}
+	metadata, err := oauth.SAMLMetadata(config)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.Data(http.StatusOK, "application/samlmetadata+xml", metadata)
+}
+
+// StartSAMLLogin acts as the authorization endpoint of a SAML provider, redirecting to the IdP
+func StartSAMLLogin(c *gin.Context) {
+	config := getSAMLProviderConfig(c)
+	if config == nil {
+		c.String(http.StatusNotFound, "SAML provider not found")
+		return
+	}
+	if !config.Enabled {
+		c.String(http.StatusForbidden, i18n.T(c, i18n.MsgOAuthNotEnabled, providerParams(config.Name)))
+		return
+	}
+	redirect, err := oauth.StartSAMLLogin(config, c.Query("state"))
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.Redirect(http.StatusFound, redirect)
+}
+
+// HandleSAMLACS is the Assertion Consumer Service; after validating the response it sends the
+// browser to the OAuth callback page, which finishes login or binding via /api/oauth/{slug}
+func HandleSAMLACS(c *gin.Context) {
+	config := getSAMLProviderConfig(c)
+	if config == nil {
+		c.String(http.StatusNotFound, "SAML provider not found")
+		return
+	}
+	// 关闭 SAML 后不再接受 IdP 发来的断言
+	if !config.Enabled {
+		c.String(http.StatusForbidden, i18n.T(c, i18n.MsgOAuthNotEnabled, providerParams(config.Name)))
+		return
+	}
+	state, code, err := oauth.HandleSAMLResponse(c.Request.Context(), config, c.Request)
+	if state == "" && err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	query := url.Values{}
+	query.Set("state", state)
+	if err != nil {
+		message := err.Error()
+		var oauthErr *oauth.OAuthError
+		if errors.As(err, &oauthErr) {
+			message = i18n.T(c, oauthErr.MsgKey, oauthErr.Params)
+		}
+		query.Set("error", "access_denied")
+		query.Set("error_description", message)
+	} else {
+		query.Set("code", code)
+	}
+	callback := fmt.Sprintf("%s/oauth/%s?%s", strings.TrimRight(system_setting.ServerAddress, "/"), config.Slug, query.Encode())
+	c.Redirect(http.StatusFound, callback)
+}
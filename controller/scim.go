@@ -0,0 +1,782 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SCIM 2.0 用户与分组同步接口，供 IdP 自动创建、更新、停用和删除用户，并维护用户分组。
+// SCIM Group 对应系统中已在分组倍率里配置的分组，Group 的 id 即分组名称；
+// 用户只能属于一个分组，从分组中移除的用户回到 default 分组
+
+const (
+	scimDefaultGroup = "default"
+	scimMaxPageSize  = 100
+)
+
+var scimFilterRegex = regexp.MustCompile(`(?i)^\s*([a-z][a-z0-9.]*)\s+eq\s+("(?:[^"\\]|\\.)*")\s*$`)
+
+// scimRequestError 携带 SCIM 错误响应所需的状态码与 scimType
+type scimRequestError struct {
+	status   int
+	scimType string
+	detail   string
+}
+
+func (e *scimRequestError) Error() string {
+	return e.detail
+}
+
+func newScimBadRequest(scimType string, detail string) error {
+	return &scimRequestError{status: http.StatusBadRequest, scimType: scimType, detail: detail}
+}
+
+func scimRespond(c *gin.Context, status int, obj any) {
+	c.Header("Content-Type", dto.ScimContentType)
+	c.JSON(status, obj)
+}
+
+func scimFail(c *gin.Context, err error) {
+	var reqErr *scimRequestError
+	if errors.As(err, &reqErr) {
+		scimRespond(c, reqErr.status, dto.NewScimError(reqErr.status, reqErr.scimType, reqErr.detail))
+		return
+	}
+	scimRespond(c, http.StatusInternalServerError, dto.NewScimError(http.StatusInternalServerError, "", err.Error()))
+}
+
+func scimLocation(resource string, id string) string {
+	return fmt.Sprintf("%s/scim/v2/%s/%s", strings.TrimRight(system_setting.ServerAddress, "/"), resource, id)
+}
+
+// parseScimFilter 解析形如 userName eq "alice" 的过滤条件，仅支持 eq
+func parseScimFilter(filter string) (attr string, value string, err error) {
+	if strings.TrimSpace(filter) == "" {
+		return "", "", nil
+	}
+	matches := scimFilterRegex.FindStringSubmatch(filter)
+	if matches == nil {
+		return "", "", newScimBadRequest("invalidFilter", "仅支持 <属性> eq \"<值>\" 形式的过滤条件")
+	}
+	value, err = strconv.Unquote(matches[2])
+	if err != nil {
+		return "", "", newScimBadRequest("invalidFilter", "过滤条件的值格式错误")
+	}
+	return matches[1], value, nil
+}
+
+// scimPagination 读取 startIndex（从 1 开始）与 count 参数
+func scimPagination(c *gin.Context) (startIndex int, count int) {
+	startIndex, _ = strconv.Atoi(c.Query("startIndex"))
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	count, err := strconv.Atoi(c.Query("count"))
+	if err != nil || count > scimMaxPageSize {
+		count = scimMaxPageSize
+	}
+	if count < 0 {
+		count = 0
+	}
+	return startIndex, count
+}
+
+func newScimListResponse(resources []any, total int, startIndex int) *dto.ScimListResponse {
+	return &dto.ScimListResponse{
+		Schemas:      []string{dto.ScimSchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	}
+}
+
+// GetScimServiceProviderConfig 返回服务能力说明
+func GetScimServiceProviderConfig(c *gin.Context) {
+	scimRespond(c, http.StatusOK, gin.H{
+		"schemas":        []string{dto.ScimSchemaServiceProviderConfig},
+		"patch":          gin.H{"supported": true},
+		"bulk":           gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         gin.H{"supported": true, "maxResults": scimMaxPageSize},
+		"changePassword": gin.H{"supported": false},
+		"sort":           gin.H{"supported": false},
+		"etag":           gin.H{"supported": false},
+		"authenticationSchemes": []gin.H{{
+			"type":        "oauthbearertoken",
+			"name":        "Management Key",
+			"description": "使用拥有 users 作用域的管理密钥作为 Bearer Token",
+		}},
+	})
+}
+
+func scimUserFromModel(user *model.User) *dto.ScimUser {
+	active := user.Status == common.UserStatusEnabled
+	scimUser := &dto.ScimUser{
+		Schemas:     []string{dto.ScimSchemaUser},
+		Id:          strconv.Itoa(user.Id),
+		UserName:    user.Username,
+		DisplayName: user.DisplayName,
+		Active:      &active,
+		Meta: &dto.ScimMeta{
+			ResourceType: "User",
+			Location:     scimLocation("Users", strconv.Itoa(user.Id)),
+		},
+	}
+	if user.DisplayName != "" {
+		scimUser.Name = &dto.ScimName{Formatted: user.DisplayName}
+	}
+	if user.Email != "" {
+		scimUser.Emails = []dto.ScimMultiValue{{Value: user.Email, Type: "work", Primary: true}}
+	}
+	if user.Group != "" {
+		scimUser.Groups = []dto.ScimMultiValue{{Value: user.Group, Display: user.Group}}
+	}
+	return scimUser
+}
+
+// scimDisplayName 依次取 displayName、name.formatted、givenName familyName，最后回退到用户名
+func scimDisplayName(scimUser *dto.ScimUser) string {
+	displayName := strings.TrimSpace(scimUser.DisplayName)
+	if displayName == "" && scimUser.Name != nil {
+		displayName = strings.TrimSpace(scimUser.Name.Formatted)
+		if displayName == "" {
+			displayName = strings.TrimSpace(scimUser.Name.GivenName + " " + scimUser.Name.FamilyName)
+		}
+	}
+	if displayName == "" {
+		displayName = scimUser.UserName
+	}
+	if runes := []rune(displayName); len(runes) > 20 {
+		displayName = string(runes[:20])
+	}
+	return displayName
+}
+
+// applyScimUser 将 SCIM 用户资料写入模型，用户名变更时校验唯一性
+func applyScimUser(user *model.User, scimUser *dto.ScimUser) error {
+	username := strings.TrimSpace(scimUser.UserName)
+	if username == "" {
+		return newScimBadRequest("invalidValue", "userName 不能为空")
+	}
+	if len(username) > model.UserNameMaxLength {
+		return newScimBadRequest("invalidValue", fmt.Sprintf("userName 长度不能超过 %d", model.UserNameMaxLength))
+	}
+	if username != user.Username {
+		exist, err := model.CheckUserExistOrDeleted(username, "")
+		if err != nil {
+			return err
+		}
+		if exist {
+			return &scimRequestError{status: http.StatusConflict, scimType: "uniqueness", detail: "用户名已存在"}
+		}
+	}
+	email := strings.TrimSpace(scimUser.PrimaryEmail())
+	if len(email) > 50 {
+		return newScimBadRequest("invalidValue", "邮箱长度不能超过 50")
+	}
+	user.Username = username
+	user.DisplayName = scimDisplayName(scimUser)
+	user.Email = email
+	return nil
+}
+
+// getScimTargetUser 读取路径中的用户，并按管理员层级校验操作权限
+func getScimTargetUser(c *gin.Context) (*model.User, error) {
+	notFound := &scimRequestError{status: http.StatusNotFound, detail: "用户不存在"}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, notFound
+	}
+	user, err := model.GetUserById(id, false)
+	if err != nil {
+		return nil, notFound
+	}
+	if err := checkScimUserHierarchy(c, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func checkScimUserHierarchy(c *gin.Context, user *model.User) error {
+	myRole := c.GetInt("role")
+	if myRole <= user.Role && myRole != common.RoleRootUser {
+		return &scimRequestError{status: http.StatusForbidden, detail: "无权操作同级或更高级别的用户"}
+	}
+	return nil
+}
+
+// saveScimUser 持久化资料与启用状态，停用时同时禁用该用户的令牌
+func saveScimUser(user *model.User, scimUser *dto.ScimUser) error {
+	if err := applyScimUser(user, scimUser); err != nil {
+		return err
+	}
+	if err := user.UpdateScimProfile(); err != nil {
+		return err
+	}
+	status := common.UserStatusEnabled
+	if !scimUser.IsActive() {
+		status = common.UserStatusDisabled
+	}
+	if status == user.Status {
+		return nil
+	}
+	if status == common.UserStatusDisabled && user.Role == common.RoleRootUser {
+		return newScimBadRequest("mutability", "不能停用超级管理员")
+	}
+	if err := model.UpdateUserStatus(user.Id, status); err != nil {
+		return err
+	}
+	user.Status = status
+	return nil
+}
+
+func GetScimUsers(c *gin.Context) {
+	attr, value, err := parseScimFilter(c.Query("filter"))
+	if err != nil {
+		scimFail(c, err)
+		return
+	}
+	if attr != "" && !strings.EqualFold(attr, "userName") {
+		scimFail(c, newScimBadRequest("invalidFilter", "用户仅支持按 userName 过滤"))
+		return
+	}
+	startIndex, count := scimPagination(c)
+	users, total, err := model.SearchScimUsers(value, startIndex-1, count)
+	if err != nil {
+		scimFail(c, err)
+		return
+	}
+	resources := make([]any, 0, len(users))
+	for _, user := range users {
+		resources = append(resources, scimUserFromModel(user))
+	}
+	scimRespond(c, http.StatusOK, newScimListResponse(resources, int(total), startIndex))
+}
+
+func GetScimUser(c *gin.Context) {
+	user, err := getScimTargetUser(c)
+	if err != nil {
+		scimFail(c, err)
+		return
+	}
+	scimRespond(c, http.StatusOK, scimUserFromModel(user))
+}
+
+func CreateScimUser(c *gin.Context) {
+	var scimUser dto.ScimUser
+	if err := common.DecodeJson(c.Request.Body, &scimUser); err != nil {
+		scimFail(c, newScimBadRequest("invalidSyntax", "无效的请求体"))
+		return
+	}
+	user := model.User{
+		Role:   common.RoleCommonUser,
+		Status: common.UserStatusEnabled,
+		Group:  scimDefaultGroup,
+	}
+	if err := applyScimUser(&user, &scimUser); err != nil {
+		scimFail(c, err)
+		return
+	}
+	if !scimUser.IsActive() {
+		user.Status = common.UserStatusDisabled
+	}
+	// IdP 推送的密码仅在创建时使用，未提供时生成随机密码，用户通过 SSO 登录
+	user.Password = scimUser.Password
+	if len(user.Password) < 8 {
+		user.Password = common.GetRandomString(24)
+	}
+	if err := user.Insert(0); err != nil {
+		scimFail(c, err)
+		return
+	}
+	scimRespond(c, http.StatusCreated, scimUserFromModel(&user))
+}
+
+func ReplaceScimUser(c *gin.Context) {
+	user, err := getScimTargetUser(c)
+	if err != nil {
+		scimFail(c, err)
+		return
+	}
+	var scimUser dto.ScimUser
+	if err := common.DecodeJson(c.Request.Body, &scimUser); err != nil {
+		scimFail(c, newScimBadRequest("invalidSyntax", "无效的请求体"))
+		return
+	}
+	if err := saveScimUser(user, &scimUser); err != nil {
+		scimFail(c, err)
+		return
+	}
+	scimRespond(c, http.StatusOK, scimUserFromModel(user))
+}
+
+func PatchScimUser(c *gin.Context) {
+	user, err := getScimTargetUser(c)
+	if err != nil {
+		scimFail(c, err)
+		return
+	}
+	var req dto.ScimPatchRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		scimFail(c, newScimBadRequest("invalidSyntax", "无效的请求体"))
+		return
+	}
+	scimUser, err := patchScimUser(scimUserFromModel(user), req.Operations)
+	if err != nil {
+		scimFail(c, err)
+		return
+	}
+	if err := saveScimUser(user, scimUser); err != nil {
+		scimFail(c, err)
+		return
+	}
+	scimRespond(c, http.StatusOK, scimUserFromModel(user))
+}
+
+func DeleteScimUser(c *gin.Context) {
+	user, err := getScimTargetUser(c)
+	if err != nil {
+		scimFail(c, err)
+		return
+	}
+	if user.Role == common.RoleRootUser {
+		scimFail(c, newScimBadRequest("mutability", "不能删除超级管理员"))
+		return
+	}
+	if err := user.Delete(); err != nil {
+		scimFail(c, err)
+		return
+	}
+	if err := model.InvalidateUserTokensCache(user.Id); err != nil {
+		common.SysLog(fmt.Sprintf("failed to invalidate tokens cache for user %d: %s", user.Id, err.Error()))
+	}
+	revokeUserSessions(user.Id, 0)
+	c.Status(http.StatusNoContent)
+}
+
+// scimUserAttributes 支持修改的用户属性（SCIM 属性名大小写不敏感），其余属性忽略
+var scimUserAttributes = map[string]string{
+	"username":        "userName",
+	"displayname":     "displayName",
+	"active":          "active",
+	"name":            "name",
+	"name.formatted":  "name.formatted",
+	"name.givenname":  "name.givenName",
+	"name.familyname": "name.familyName",
+	"emails":          "emails",
+}
+
+// patchScimUser 在用户当前表示上应用 PATCH 操作，兼容 Okta（无 path、value 为对象）
+// 与 Azure AD（path 形如 emails[type eq "work"].value、active 值为字符串）的写法
+func patchScimUser(scimUser *dto.ScimUser, operations []dto.ScimPatchOperation) (*dto.ScimUser, error) {
+	doc := map[string]any{}
+	raw, err := common.Marshal(scimUser)
+	if err != nil {
+		return nil, err
+	}
+	if err := common.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	for _, operation := range operations {
+		op := strings.ToLower(operation.Op)
+		if op != "add" && op != "replace" && op != "remove" {
+			return nil, newScimBadRequest("invalidSyntax", "不支持的 PATCH 操作: "+operation.Op)
+		}
+		var value any
+		if len(operation.Value) > 0 {
+			if err := common.Unmarshal(operation.Value, &value); err != nil {
+				return nil, newScimBadRequest("invalidValue", "无效的 PATCH 值")
+			}
+		}
+		if operation.Path == "" {
+			attributes, ok := value.(map[string]any)
+			if !ok || op == "remove" {
+				return nil, newScimBadRequest("noTarget", "缺少 PATCH 路径")
+			}
+			for path, attrValue := range attributes {
+				setScimUserAttribute(doc, path, attrValue, false)
+			}
+			continue
+		}
+		setScimUserAttribute(doc, operation.Path, value, op == "remove")
+	}
+	if active, ok := doc["active"].(string); ok {
+		doc["active"] = strings.EqualFold(active, "true")
+	}
+	raw, err = common.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	patched := &dto.ScimUser{}
+	if err := common.Unmarshal(raw, patched); err != nil {
+		return nil, newScimBadRequest("invalidValue", "PATCH 后的用户属性无效")
+	}
+	return patched, nil
+}
+
+func setScimUserAttribute(doc map[string]any, path string, value any, remove bool) {
+	path = strings.TrimPrefix(path, dto.ScimSchemaUser+":")
+	// 仅维护一个邮箱，emails[type eq "work"].value 之类的路径直接替换主邮箱
+	if lower := strings.ToLower(path); strings.HasPrefix(lower, "emails[") || strings.HasPrefix(lower, "emails.") {
+		if email, ok := value.(string); ok && !remove {
+			doc["emails"] = []any{map[string]any{"value": email, "type": "work", "primary": true}}
+		} else {
+			delete(doc, "emails")
+		}
+		return
+	}
+	attr, ok := scimUserAttributes[strings.ToLower(path)]
+	if !ok {
+		return
+	}
+	parent, child, nested := strings.Cut(attr, ".")
+	if !nested {
+		if remove {
+			delete(doc, attr)
+		} else {
+			doc[attr] = value
+		}
+		return
+	}
+	name, _ := doc[parent].(map[string]any)
+	if name == nil {
+		name = map[string]any{}
+	}
+	if remove {
+		delete(name, child)
+	} else {
+		name[child] = value
+	}
+	doc[parent] = name
+}
+
+// scimGroupNames 返回已配置倍率的分组名称
+func scimGroupNames() []string {
+	groups := ratio_setting.GetGroupRatioCopy()
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func scimGroupFromName(name string, withMembers bool) (*dto.ScimGroup, error) {
+	group := &dto.ScimGroup{
+		Schemas:     []string{dto.ScimSchemaGroup},
+		Id:          name,
+		DisplayName: name,
+		Meta: &dto.ScimMeta{
+			ResourceType: "Group",
+			Location:     scimLocation("Groups", name),
+		},
+	}
+	if !withMembers {
+		return group, nil
+	}
+	users, err := model.GetUsersByGroup(name)
+	if err != nil {
+		return nil, err
+	}
+	group.Members = make([]dto.ScimMultiValue, 0, len(users))
+	for _, user := range users {
+		group.Members = append(group.Members, dto.ScimMultiValue{
+			Value:   strconv.Itoa(user.Id),
+			Display: user.Username,
+		})
+	}
+	return group, nil
+}
+
+func scimExcludesMembers(c *gin.Context) bool {
+	for _, attr := range strings.Split(c.Query("excludedAttributes"), ",") {
+		if strings.EqualFold(strings.TrimSpace(attr), "members") {
+			return true
+		}
+	}
+	return false
+}
+
+func getScimTargetGroup(c *gin.Context) (string, error) {
+	name := c.Param("id")
+	if !ratio_setting.ContainsGroupRatio(name) {
+		return "", &scimRequestError{status: http.StatusNotFound, detail: "分组不存在"}
+	}
+	return name, nil
+}
+
+// scimMemberUsers 解析成员列表中的用户并校验操作权限
+func scimMemberUsers(c *gin.Context, members []dto.ScimMultiValue) ([]*model.User, error) {
+	users := make([]*model.User, 0, len(members))
+	for _, member := range members {
+		id, err := strconv.Atoi(member.Value)
+		if err != nil {
+			return nil, newScimBadRequest("invalidValue", "无效的成员 ID: "+member.Value)
+		}
+		user, err := model.GetUserById(id, false)
+		if err != nil {
+			return nil, newScimBadRequest("invalidValue", "成员用户不存在: "+member.Value)
+		}
+		if err := checkScimUserHierarchy(c, user); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+func addScimGroupMembers(c *gin.Context, group string, members []dto.ScimMultiValue) error {
+	users, err := scimMemberUsers(c, members)
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		if user.Group == group {
+			continue
+		}
+		if err := model.UpdateUserGroup(user.Id, group); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeScimGroupMembers 将仍属于该分组的成员移回 default 分组
+func removeScimGroupMembers(c *gin.Context, group string, members []dto.ScimMultiValue) error {
+	users, err := scimMemberUsers(c, members)
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		if user.Group != group || group == scimDefaultGroup {
+			continue
+		}
+		if err := model.UpdateUserGroup(user.Id, scimDefaultGroup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceScimGroupMembers 使分组成员与给定列表一致
+func replaceScimGroupMembers(c *gin.Context, group string, members []dto.ScimMultiValue) error {
+	current, err := model.GetUsersByGroup(group)
+	if err != nil {
+		return err
+	}
+	keep := make(map[string]bool, len(members))
+	for _, member := range members {
+		keep[member.Value] = true
+	}
+	var removed []dto.ScimMultiValue
+	for _, user := range current {
+		if id := strconv.Itoa(user.Id); !keep[id] {
+			removed = append(removed, dto.ScimMultiValue{Value: id})
+		}
+	}
+	if err := removeScimGroupMembers(c, group, removed); err != nil {
+		return err
+	}
+	return addScimGroupMembers(c, group, members)
+}
+
+var scimMemberPathRegex = regexp.MustCompile(`(?i)^members\[\s*value\s+eq\s+("(?:[^"\\]|\\.)*")\s*\]$`)
+
+// scimPatchMembers 解析 PATCH 操作涉及的成员：value 中的成员数组，或 members[value eq "id"] 路径
+func scimPatchMembers(operation dto.ScimPatchOperation) (members []dto.ScimMultiValue, isMembers bool, err error) {
+	path := strings.TrimSpace(operation.Path)
+	if matches := scimMemberPathRegex.FindStringSubmatch(path); matches != nil {
+		value, err := strconv.Unquote(matches[1])
+		if err != nil {
+			return nil, true, newScimBadRequest("invalidPath", "无效的成员路径")
+		}
+		return []dto.ScimMultiValue{{Value: value}}, true, nil
+	}
+	if path != "" && !strings.EqualFold(path, "members") {
+		return nil, false, nil
+	}
+	if len(operation.Value) == 0 {
+		return nil, path != "", nil
+	}
+	if path == "" {
+		var attributes struct {
+			Members []dto.ScimMultiValue `json:"members"`
+		}
+		if err := common.Unmarshal(operation.Value, &attributes); err != nil {
+			return nil, false, nil
+		}
+		return attributes.Members, attributes.Members != nil, nil
+	}
+	if err := common.Unmarshal(operation.Value, &members); err != nil {
+		return nil, true, newScimBadRequest("invalidValue", "无效的成员列表")
+	}
+	return members, true, nil
+}
+
+func GetScimGroups(c *gin.Context) {
+	attr, value, err := parseScimFilter(c.Query("filter"))
+	if err != nil {
+		scimFail(c, err)
+		return
+	}
+	if attr != "" && !strings.EqualFold(attr, "displayName") && !strings.EqualFold(attr, "id") {
+		scimFail(c, newScimBadRequest("invalidFilter", "分组仅支持按 displayName 过滤"))
+		return
+	}
+	names := scimGroupNames()
+	if attr != "" {
+		names = []string{}
+		if ratio_setting.ContainsGroupRatio(value) {
+			names = append(names, value)
+		}
+	}
+	startIndex, count := scimPagination(c)
+	start := min(startIndex-1, len(names))
+	end := min(start+count, len(names))
+	withMembers := !scimExcludesMembers(c)
+	resources := make([]any, 0, end-start)
+	for _, name := range names[start:end] {
+		group, err := scimGroupFromName(name, withMembers)
+		if err != nil {
+			scimFail(c, err)
+			return
+		}
+		resources = append(resources, group)
+	}
+	scimRespond(c, http.StatusOK, newScimListResponse(resources, len(names), startIndex))
+}
+
+func GetScimGroup(c *gin.Context) {
+	name, err := getScimTargetGroup(c)
+	if err != nil {
+		scimFail(c, err)
+		return
+	}
+	group, err := scimGroupFromName(name, !scimExcludesMembers(c))
+	if err != nil {
+		scimFail(c, err)
+		return
+	}
+	scimRespond(c, http.StatusOK, group)
+}
+
+// CreateScimGroup 关联已配置的分组，分组本身需先在分组倍率中配置
+func CreateScimGroup(c *gin.Context) {
+	var req dto.ScimGroup
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		scimFail(c, newScimBadRequest("invalidSyntax", "无效的请求体"))
+		return
+	}
+	name := strings.TrimSpace(req.DisplayName)
+	if !ratio_setting.ContainsGroupRatio(name) {
+		scimFail(c, newScimBadRequest("invalidValue", "分组未在分组倍率中配置: "+name))
+		return
+	}
+	if err := addScimGroupMembers(c, name, req.Members); err != nil {
+		scimFail(c, err)
+		return
+	}
+	group, err := scimGroupFromName(name, true)
+	if err != nil {
+		scimFail(c, err)
+		return
+	}
+	scimRespond(c, http.StatusCreated, group)
+}
+
+func ReplaceScimGroup(c *gin.Context) {
+	name, err := getScimTargetGroup(c)
+	if err != nil {
+		scimFail(c, err)
+		return
+	}
+	var req dto.ScimGroup
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		scimFail(c, newScimBadRequest("invalidSyntax", "无效的请求体"))
+		return
+	}
+	if req.DisplayName != "" && req.DisplayName != name {
+		scimFail(c, newScimBadRequest("mutability", "不支持修改分组名称"))
+		return
+	}
+	if err := replaceScimGroupMembers(c, name, req.Members); err != nil {
+		scimFail(c, err)
+		return
+	}
+	group, err := scimGroupFromName(name, true)
+	if err != nil {
+		scimFail(c, err)
+		return
+	}
+	scimRespond(c, http.StatusOK, group)
+}
+
+func PatchScimGroup(c *gin.Context) {
+	name, err := getScimTargetGroup(c)
+	if err != nil {
+		scimFail(c, err)
+		return
+	}
+	var req dto.ScimPatchRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		scimFail(c, newScimBadRequest("invalidSyntax", "无效的请求体"))
+		return
+	}
+	for _, operation := range req.Operations {
+		members, isMembers, err := scimPatchMembers(operation)
+		if err != nil {
+			scimFail(c, err)
+			return
+		}
+		if !isMembers {
+			// 分组名称等其他属性不可修改，忽略
+			continue
+		}
+		switch strings.ToLower(operation.Op) {
+		case "add":
+			err = addScimGroupMembers(c, name, members)
+		case "remove":
+			if members == nil && strings.EqualFold(operation.Path, "members") {
+				err = replaceScimGroupMembers(c, name, nil)
+			} else {
+				err = removeScimGroupMembers(c, name, members)
+			}
+		case "replace":
+			err = replaceScimGroupMembers(c, name, members)
+		default:
+			err = newScimBadRequest("invalidSyntax", "不支持的 PATCH 操作: "+operation.Op)
+		}
+		if err != nil {
+			scimFail(c, err)
+			return
+		}
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// DeleteScimGroup 解除 IdP 分组关联，成员全部移回 default 分组，分组配置保持不变
+func DeleteScimGroup(c *gin.Context) {
+	name, err := getScimTargetGroup(c)
+	if err != nil {
+		scimFail(c, err)
+		return
+	}
+	if err := replaceScimGroupMembers(c, name, nil); err != nil {
+		scimFail(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,136 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func newScimTestRouter() *gin.Engine {
+	router := gin.New()
+	scim := router.Group("/scim/v2")
+	scim.Use(func(c *gin.Context) {
+		c.Set("id", 1)
+		c.Set("role", common.RoleRootUser)
+	})
+	scim.GET("/Users", GetScimUsers)
+	scim.POST("/Users", CreateScimUser)
+	scim.GET("/Users/:id", GetScimUser)
+	scim.PATCH("/Users/:id", PatchScimUser)
+	scim.DELETE("/Users/:id", DeleteScimUser)
+	scim.GET("/Groups/:id", GetScimGroup)
+	scim.PATCH("/Groups/:id", PatchScimGroup)
+	return router
+}
+
+func doScimRequest(t *testing.T, router *gin.Engine, method string, target string, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	request := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+	request.Header.Set("Content-Type", dto.ScimContentType)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestScimUserLifecycle(t *testing.T) {
+	db := setupTokenControllerTestDB(t)
+	require.NoError(t, db.AutoMigrate(&model.User{}, &model.Log{}, &model.UserSession{}))
+	router := newScimTestRouter()
+
+	recorder := doScimRequest(t, router, http.MethodPost, "/scim/v2/Users", `{
+		"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+		"userName": "alice",
+		"name": {"givenName": "Alice", "familyName": "Liddell"},
+		"emails": [{"value": "alice@example.com", "primary": true}],
+		"active": true
+	}`)
+	require.Equal(t, http.StatusCreated, recorder.Code, recorder.Body.String())
+	var created dto.ScimUser
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &created))
+	require.Equal(t, "Alice Liddell", created.DisplayName)
+	require.Equal(t, "alice@example.com", created.PrimaryEmail())
+	require.True(t, created.IsActive())
+	userId, err := strconv.Atoi(created.Id)
+	require.NoError(t, err)
+
+	recorder = doScimRequest(t, router, http.MethodPost, "/scim/v2/Users", `{"userName": "alice"}`)
+	require.Equal(t, http.StatusConflict, recorder.Code)
+
+	recorder = doScimRequest(t, router, http.MethodGet, `/scim/v2/Users?filter=userName%20eq%20%22alice%22`, "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var list dto.ScimListResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &list))
+	require.Equal(t, 1, list.TotalResults)
+
+	token := seedToken(t, db, userId, "alice-token", "scimtestkey000000000000000000000000000000000001")
+
+	// Azure AD 风格：带 path 且 active 为字符串
+	recorder = doScimRequest(t, router, http.MethodPatch, "/scim/v2/Users/"+created.Id, `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [
+			{"op": "Replace", "path": "active", "value": "False"},
+			{"op": "Replace", "path": "emails[type eq \"work\"].value", "value": "alice@corp.example.com"}
+		]
+	}`)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	userCache, err := model.GetUserCache(userId)
+	require.NoError(t, err)
+	require.Equal(t, common.UserStatusDisabled, userCache.Status)
+	require.Equal(t, "alice@corp.example.com", userCache.Email)
+	var reloaded model.Token
+	require.NoError(t, db.First(&reloaded, token.Id).Error)
+	require.Equal(t, common.TokenStatusDisabled, reloaded.Status)
+
+	// Okta 风格：无 path，value 为属性对象
+	recorder = doScimRequest(t, router, http.MethodPatch, "/scim/v2/Users/"+created.Id, `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{"op": "replace", "value": {"active": true}}]
+	}`)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	userCache, err = model.GetUserCache(userId)
+	require.NoError(t, err)
+	require.Equal(t, common.UserStatusEnabled, userCache.Status)
+
+	recorder = doScimRequest(t, router, http.MethodPatch, "/scim/v2/Groups/vip", `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{"op": "add", "path": "members", "value": [{"value": "`+created.Id+`"}]}]
+	}`)
+	require.Equal(t, http.StatusNoContent, recorder.Code, recorder.Body.String())
+	userCache, err = model.GetUserCache(userId)
+	require.NoError(t, err)
+	require.Equal(t, "vip", userCache.Group)
+
+	recorder = doScimRequest(t, router, http.MethodGet, "/scim/v2/Groups/vip", "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var group dto.ScimGroup
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &group))
+	require.Len(t, group.Members, 1)
+	require.Equal(t, created.Id, group.Members[0].Value)
+
+	recorder = doScimRequest(t, router, http.MethodPatch, "/scim/v2/Groups/vip", `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{"op": "remove", "path": "members[value eq \"`+created.Id+`\"]"}]
+	}`)
+	require.Equal(t, http.StatusNoContent, recorder.Code, recorder.Body.String())
+	userCache, err = model.GetUserCache(userId)
+	require.NoError(t, err)
+	require.Equal(t, "default", userCache.Group)
+
+	recorder = doScimRequest(t, router, http.MethodGet, "/scim/v2/Groups/unknown", "")
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder = doScimRequest(t, router, http.MethodDelete, "/scim/v2/Users/"+created.Id, "")
+	require.Equal(t, http.StatusNoContent, recorder.Code)
+	recorder = doScimRequest(t, router, http.MethodGet, "/scim/v2/Users/"+created.Id, "")
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
@@ -0,0 +1,147 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	storedResponseInputItemsDefaultLimit = 20
+	storedResponseInputItemsMaxLimit     = 100
+)
+
+type StoredResponseInputItemsResponse struct {
+	Object  string           `json:"object"`
+	Data    []map[string]any `json:"data"`
+	FirstId string           `json:"first_id,omitempty"`
+	LastId  string           `json:"last_id,omitempty"`
+	HasMore bool             `json:"has_more"`
+}
+
+func storedResponseError(c *gin.Context, statusCode int, code types.ErrorCode, err error) {
+	apiErr := types.NewErrorWithStatusCode(err, code, statusCode)
+	apiErr.SetMessage(common.MessageWithRequestId(apiErr.Error(), c.GetString(common.RequestIdKey)))
+	c.JSON(statusCode, gin.H{
+		"error": apiErr.ToOpenAIError(),
+	})
+}
+
+// getOwnedStoredResponse 读取当前令牌名下的响应，失败时已写入错误响应
+func getOwnedStoredResponse(c *gin.Context) (*model.StoredResponse, bool) {
+	responseId := c.Param("id")
+	if !service.ResponsesStoreEnabled() {
+		storedResponseError(c, http.StatusNotFound, types.ErrorCodeInvalidRequest, errors.New("网关未启用 Responses 响应存储"))
+		return nil, false
+	}
+	stored, err := model.GetStoredResponse(responseId, common.GetContextKeyInt(c, constant.ContextKeyTokenId))
+	if err != nil {
+		if errors.Is(err, model.ErrStoredResponseNotFound) {
+			storedResponseError(c, http.StatusNotFound, types.ErrorCodeInvalidRequest, fmt.Errorf("Response with id '%s' not found.", responseId))
+		} else {
+			storedResponseError(c, http.StatusInternalServerError, types.ErrorCodeQueryDataError, err)
+		}
+		return nil, false
+	}
+	return stored, true
+}
+
+// GetStoredResponse 对应 GET /v1/responses/:id，返回网关保存的响应对象
+func GetStoredResponse(c *gin.Context) {
+	stored, ok := getOwnedStoredResponse(c)
+	if !ok {
+		return
+	}
+	c.Data(http.StatusOK, "application/json", stored.Response)
+}
+
+// DeleteStoredResponse 对应 DELETE /v1/responses/:id
+func DeleteStoredResponse(c *gin.Context) {
+	stored, ok := getOwnedStoredResponse(c)
+	if !ok {
+		return
+	}
+	if err := model.DeleteStoredResponse(stored.ResponseId, stored.TokenId); err != nil && !errors.Is(err, model.ErrStoredResponseNotFound) {
+		storedResponseError(c, http.StatusInternalServerError, types.ErrorCodeUpdateDataError, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      stored.ResponseId,
+		"object":  "response",
+		"deleted": true,
+	})
+}
+
+// ListStoredResponseInputItems 对应 GET /v1/responses/:id/input_items，支持 limit、order、after 分页参数
+func ListStoredResponseInputItems(c *gin.Context) {
+	stored, ok := getOwnedStoredResponse(c)
+	if !ok {
+		return
+	}
+	items, err := service.GetStoredResponseInputItems(stored)
+	if err != nil {
+		if errors.Is(err, model.ErrStoredResponseNotFound) {
+			storedResponseError(c, http.StatusNotFound, types.ErrorCodeInvalidRequest, errors.New("对话链中的历史响应已过期或被删除"))
+		} else {
+			storedResponseError(c, http.StatusInternalServerError, types.ErrorCodeQueryDataError, err)
+		}
+		return
+	}
+
+	limit := storedResponseInputItemsDefaultLimit
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > storedResponseInputItemsMaxLimit {
+			storedResponseError(c, http.StatusBadRequest, types.ErrorCodeInvalidRequest,
+				fmt.Errorf("limit 须在 1 到 %d 之间", storedResponseInputItemsMaxLimit))
+			return
+		}
+		limit = parsed
+	}
+	order := c.DefaultQuery("order", "desc")
+	switch order {
+	case "asc":
+	case "desc":
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	default:
+		storedResponseError(c, http.StatusBadRequest, types.ErrorCodeInvalidRequest, errors.New("order 只能为 asc 或 desc"))
+		return
+	}
+	if after := c.Query("after"); after != "" {
+		for i, item := range items {
+			if id, _ := item["id"].(string); id == after {
+				items = items[i+1:]
+				break
+			}
+		}
+	}
+
+	hasMore := len(items) > limit
+	if hasMore {
+		items = items[:limit]
+	}
+	resp := StoredResponseInputItemsResponse{
+		Object:  "list",
+		Data:    items,
+		HasMore: hasMore,
+	}
+	if resp.Data == nil {
+		resp.Data = []map[string]any{}
+	}
+	if len(items) > 0 {
+		resp.FirstId, _ = items[0]["id"].(string)
+		resp.LastId, _ = items[len(items)-1]["id"].(string)
+	}
+	c.JSON(http.StatusOK, resp)
+}
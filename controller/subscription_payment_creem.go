@@ -17,7 +17,8 @@ import (
 )
 
 type SubscriptionCreemPayRequest struct {
-	PlanId int `json:"plan_id"`
+	PlanId     int    `json:"plan_id"`
+	CouponCode string `json:"coupon_code,omitempty"`
 }
 
 func SubscriptionRequestCreemPay(c *gin.Context) {
@@ -81,17 +82,44 @@ func SubscriptionRequestCreemPay(c *gin.Context) {
 	reference := "sub-creem-ref-" + randstr.String(6)
 	referenceId := "sub_ref_" + common.Sha1([]byte(reference+time.Now().String()+user.Username))
 
+	couponOrder := model.CouponOrder{
+		UserId:        userId,
+		OrderType:     model.CouponOrderTypeSubscription,
+		PlanId:        plan.Id,
+		PaymentMethod: model.PaymentMethodCreem,
+		Money:         plan.PriceAmount,
+	}
+	couponQuote, err := model.PrepareCoupon(req.CouponCode, couponOrder)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	discountCode, err := getCreemCouponDiscountCode(couponQuote)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	money := plan.PriceAmount
+	if couponQuote != nil {
+		money = couponQuote.FinalMoney
+	}
+	if err := model.ReserveCoupon(couponQuote, couponOrder, referenceId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+
 	// create pending order first
 	order := &model.SubscriptionOrder{
 		UserId:        userId,
 		PlanId:        plan.Id,
-		Money:         plan.PriceAmount,
+		Money:         money,
 		TradeNo:       referenceId,
 		PaymentMethod: model.PaymentMethodCreem,
 		CreateTime:    time.Now().Unix(),
 		Status:        common.TopUpStatusPending,
 	}
 	if err := order.Insert(); err != nil {
+		_ = model.CancelCouponRedemption(referenceId)
 		c.JSON(http.StatusOK, gin.H{"message": "error", "data": "创建订单失败"})
 		return
 	}
@@ -114,8 +142,9 @@ func SubscriptionRequestCreemPay(c *gin.Context) {
 		Quota:     0,
 	}
 
-	checkoutUrl, err := genCreemLink(c.Request.Context(), referenceId, product, user.Email, user.Username)
+	checkoutUrl, err := genCreemLink(c.Request.Context(), referenceId, product, user.Email, user.Username, discountCode)
 	if err != nil {
+		_ = model.ExpireSubscriptionOrder(referenceId, model.PaymentMethodCreem)
 		logger.LogError(c.Request.Context(), fmt.Sprintf("Creem 订阅支付链接创建失败 trade_no=%s product_id=%s error=%q", referenceId, product.ProductId, err.Error()))
 		c.JSON(http.StatusOK, gin.H{"message": "error", "data": "拉起支付失败"})
 		return
@@ -20,6 +20,7 @@ import (
 type SubscriptionEpayPayRequest struct {
 	PlanId        int    `json:"plan_id"`
 	PaymentMethod string `json:"payment_method"`
+	CouponCode    string `json:"coupon_code,omitempty"`
 }
 
 func SubscriptionRequestEpay(c *gin.Context) {
@@ -60,6 +61,23 @@ func SubscriptionRequestEpay(c *gin.Context) {
 		}
 	}
 
+	couponOrder := model.CouponOrder{
+		UserId:        userId,
+		OrderType:     model.CouponOrderTypeSubscription,
+		PlanId:        plan.Id,
+		PaymentMethod: req.PaymentMethod,
+		Money:         plan.PriceAmount,
+	}
+	couponQuote, err := model.PrepareCoupon(req.CouponCode, couponOrder)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	payMoney := plan.PriceAmount
+	if couponQuote != nil {
+		payMoney = couponQuote.FinalMoney
+	}
+
 	callBackAddress := service.GetCallbackAddress()
 	returnUrl, err := url.Parse(callBackAddress + "/api/subscription/epay/return")
 	if err != nil {
@@ -81,16 +99,21 @@ func SubscriptionRequestEpay(c *gin.Context) {
 		return
 	}
 
+	if err := model.ReserveCoupon(couponQuote, couponOrder, tradeNo); err != nil {
+		common.ApiError(c, err)
+		return
+	}
 	order := &model.SubscriptionOrder{
 		UserId:        userId,
 		PlanId:        plan.Id,
-		Money:         plan.PriceAmount,
+		Money:         payMoney,
 		TradeNo:       tradeNo,
 		PaymentMethod: req.PaymentMethod,
 		CreateTime:    time.Now().Unix(),
 		Status:        common.TopUpStatusPending,
 	}
 	if err := order.Insert(); err != nil {
+		_ = model.CancelCouponRedemption(tradeNo)
 		common.ApiErrorMsg(c, "创建订单失败")
 		return
 	}
@@ -98,7 +121,7 @@ func SubscriptionRequestEpay(c *gin.Context) {
 		Type:           req.PaymentMethod,
 		ServiceTradeNo: tradeNo,
 		Name:           fmt.Sprintf("SUB:%s", plan.Title),
-		Money:          strconv.FormatFloat(plan.PriceAmount, 'f', 2, 64),
+		Money:          strconv.FormatFloat(payMoney, 'f', 2, 64),
 		Device:         epay.PC,
 		NotifyUrl:      notifyUrl,
 		ReturnUrl:      returnUrl,
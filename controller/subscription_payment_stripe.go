@@ -18,7 +18,8 @@ import (
 )
 
 type SubscriptionStripePayRequest struct {
-	PlanId int `json:"plan_id"`
+	PlanId     int    `json:"plan_id"`
+	CouponCode string `json:"coupon_code,omitempty"`
 }
 
 func SubscriptionRequestStripePay(c *gin.Context) {
@@ -76,9 +77,39 @@ func SubscriptionRequestStripePay(c *gin.Context) {
 	reference := fmt.Sprintf("sub-stripe-ref-%d-%d-%s", user.Id, time.Now().UnixMilli(), randstr.String(4))
 	referenceId := "sub_ref_" + common.Sha1([]byte(reference))
 
-	payLink, err := genStripeSubscriptionLink(referenceId, user.StripeCustomer, user.Email, plan.StripePriceId)
+	couponOrder := model.CouponOrder{
+		UserId:        userId,
+		OrderType:     model.CouponOrderTypeSubscription,
+		PlanId:        plan.Id,
+		PaymentMethod: model.PaymentMethodStripe,
+		Money:         plan.PriceAmount,
+	}
+	couponQuote, err := model.PrepareCoupon(req.CouponCode, couponOrder)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.ReserveCoupon(couponQuote, couponOrder, referenceId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	money := plan.PriceAmount
+	stripeCouponId := ""
+	if couponQuote != nil {
+		money = couponQuote.FinalMoney
+		stripeCouponId, err = createStripeCheckoutCoupon(couponQuote, referenceId)
+		if err != nil {
+			logger.LogError(c.Request.Context(), fmt.Sprintf("Stripe 订阅折扣券创建失败 trade_no=%s plan_id=%d coupon=%s error=%q", referenceId, plan.Id, couponQuote.Code, err.Error()))
+			_ = model.CancelCouponRedemption(referenceId)
+			c.JSON(http.StatusOK, gin.H{"message": "error", "data": "拉起支付失败"})
+			return
+		}
+	}
+
+	payLink, err := genStripeSubscriptionLink(referenceId, user.StripeCustomer, user.Email, plan.StripePriceId, stripeCouponId)
 	if err != nil {
 		logger.LogError(c.Request.Context(), fmt.Sprintf("Stripe 订阅支付链接创建失败 trade_no=%s plan_id=%d error=%q", referenceId, plan.Id, err.Error()))
+		_ = model.CancelCouponRedemption(referenceId)
 		c.JSON(http.StatusOK, gin.H{"message": "error", "data": "拉起支付失败"})
 		return
 	}
@@ -86,13 +117,14 @@ func SubscriptionRequestStripePay(c *gin.Context) {
 	order := &model.SubscriptionOrder{
 		UserId:        userId,
 		PlanId:        plan.Id,
-		Money:         plan.PriceAmount,
+		Money:         money,
 		TradeNo:       referenceId,
 		PaymentMethod: model.PaymentMethodStripe,
 		CreateTime:    time.Now().Unix(),
 		Status:        common.TopUpStatusPending,
 	}
 	if err := order.Insert(); err != nil {
+		_ = model.CancelCouponRedemption(referenceId)
 		c.JSON(http.StatusOK, gin.H{"message": "error", "data": "创建订单失败"})
 		return
 	}
@@ -105,7 +137,7 @@ func SubscriptionRequestStripePay(c *gin.Context) {
 	})
 }
 
-func genStripeSubscriptionLink(referenceId string, customerId string, email string, priceId string) (string, error) {
+func genStripeSubscriptionLink(referenceId string, customerId string, email string, priceId string, couponId string) (string, error) {
 	stripe.Key = setting.StripeApiSecret
 
 	params := &stripe.CheckoutSessionParams{
@@ -120,6 +152,11 @@ func genStripeSubscriptionLink(referenceId string, customerId string, email stri
 		},
 		Mode: stripe.String(string(stripe.CheckoutSessionModeSubscription)),
 	}
+	if couponId != "" {
+		params.Discounts = []*stripe.CheckoutSessionDiscountParams{
+			{Coupon: stripe.String(couponId)},
+		}
+	}
 
 	if "" == customerId {
 		if "" != email {
@@ -9,8 +9,10 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/i18n"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
 
+	"github.com/bytedance/gopkg/util/gopool"
 	"github.com/gin-gonic/gin"
 )
 
@@ -89,6 +91,10 @@ func GetTokenKey(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	if token.IsHashed() {
+		common.ApiErrorMsg(c, "该令牌以哈希形式存储，完整密钥仅在创建时显示")
+		return
+	}
 	common.ApiSuccess(c, gin.H{
 		"key": token.GetFullKey(),
 	})
@@ -232,6 +238,10 @@ func AddToken(c *gin.Context) {
 			return
 		}
 	}
+	if msg := validateTokenAccessSettings(&token); msg != "" {
+		common.ApiErrorMsg(c, msg)
+		return
+	}
 	// 检查用户令牌数量是否已达上限
 	maxTokens := operation_setting.GetMaxUserTokens()
 	count, err := model.CountUserTokens(c.GetInt("id"))
@@ -255,7 +265,6 @@ func AddToken(c *gin.Context) {
 	cleanToken := model.Token{
 		UserId:             c.GetInt("id"),
 		Name:               token.Name,
-		Key:                key,
 		CreatedTime:        common.GetTimestamp(),
 		AccessedTime:       common.GetTimestamp(),
 		ExpiredTime:        token.ExpiredTime,
@@ -266,15 +275,25 @@ func AddToken(c *gin.Context) {
 		AllowIps:           token.AllowIps,
 		Group:              token.Group,
 		CrossGroupRetry:    token.CrossGroupRetry,
+		EndUserRPM:         token.EndUserRPM,
+		EndUserDailyQuota:  token.EndUserDailyQuota,
+		BlockedEndUsers:    token.BlockedEndUsers,
+		McpAllowlist:       token.McpAllowlist,
 	}
+	cleanToken.SetKey(key)
 	err = cleanToken.Insert()
 	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
+	// 完整密钥仅在创建时返回一次（哈希存储的令牌之后无法再次查看）
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
+		"data": gin.H{
+			"id":  cleanToken.Id,
+			"key": key,
+		},
 	})
 }
 
@@ -331,6 +350,22 @@ func UpdateToken(c *gin.Context) {
 			return
 		}
 	}
+	if statusOnly == "" && token.RotationInterval != 0 {
+		if token.RotationInterval < model.TokenRotationMinInterval {
+			common.ApiErrorMsg(c, fmt.Sprintf("自动轮换间隔不能小于 %d 秒", model.TokenRotationMinInterval))
+			return
+		}
+		if cleanToken.IsHashed() {
+			common.ApiErrorMsg(c, "哈希存储的令牌无法查看新密钥，不支持自动轮换")
+			return
+		}
+	}
+	if statusOnly == "" {
+		if msg := validateTokenAccessSettings(&token); msg != "" {
+			common.ApiErrorMsg(c, msg)
+			return
+		}
+	}
 	if statusOnly != "" {
 		cleanToken.Status = token.Status
 	} else {
@@ -344,6 +379,11 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.AllowIps = token.AllowIps
 		cleanToken.Group = token.Group
 		cleanToken.CrossGroupRetry = token.CrossGroupRetry
+		cleanToken.RotationInterval = token.RotationInterval
+		cleanToken.EndUserRPM = token.EndUserRPM
+		cleanToken.EndUserDailyQuota = token.EndUserDailyQuota
+		cleanToken.BlockedEndUsers = token.BlockedEndUsers
+		cleanToken.McpAllowlist = token.McpAllowlist
 	}
 	err = cleanToken.Update()
 	if err != nil {
@@ -357,6 +397,67 @@ func UpdateToken(c *gin.Context) {
 	})
 }
 
+// validateTokenAccessSettings 校验终端用户限制与 MCP 白名单配置，返回错误信息，合法时返回空字符串
+func validateTokenAccessSettings(token *model.Token) string {
+	if token.EndUserRPM < 0 || token.EndUserDailyQuota < 0 {
+		return "终端用户限制不能为负数"
+	}
+	if len(token.BlockedEndUsers) > 65535 {
+		return "终端用户黑名单过长"
+	}
+	if len(token.McpAllowlist) > 65535 {
+		return "MCP 白名单过长"
+	}
+	return ""
+}
+
+type RotateTokenRequest struct {
+	GracePeriod *int64 `json:"grace_period"` // 旧密钥宽限期（秒），为空时使用系统默认值
+}
+
+// RotateToken 为令牌生成新密钥，旧密钥在宽限期内仍可使用；新的完整密钥仅在此次响应中返回
+func RotateToken(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	var req RotateTokenRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+			return
+		}
+	}
+	gracePeriod := operation_setting.GetTokenSetting().RotationGracePeriod
+	if req.GracePeriod != nil {
+		gracePeriod = *req.GracePeriod
+	}
+	if gracePeriod < 0 || gracePeriod > model.TokenRotationMaxGracePeriod {
+		common.ApiErrorMsg(c, fmt.Sprintf("宽限期须在 0 到 %d 秒之间", model.TokenRotationMaxGracePeriod))
+		return
+	}
+	token, err := model.GetTokenByIds(id, c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	key, err := model.RotateTokenKey(token, gracePeriod)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	rotated := *token
+	gopool.Go(func() {
+		service.NotifyTokenKeyRotated(&rotated)
+	})
+	common.ApiSuccess(c, gin.H{
+		"id":                        token.Id,
+		"key":                       key,
+		"previous_key_expires_time": token.PreviousKeyExpiresTime,
+	})
+}
+
 type TokenBatch struct {
 	Ids []int `json:"ids"`
 }
@@ -50,6 +50,7 @@ func verifyCreemSignature(payload string, signature string, secret string) bool
 type CreemPayRequest struct {
 	ProductId     string `json:"product_id"`
 	PaymentMethod string `json:"payment_method"`
+	CouponCode    string `json:"coupon_code,omitempty"`
 }
 
 type CreemProduct struct {
@@ -104,11 +105,37 @@ func (*CreemAdaptor) RequestPay(c *gin.Context, req *CreemPayRequest) {
 	reference := fmt.Sprintf("creem-api-ref-%d-%d-%s", user.Id, time.Now().UnixMilli(), randstr.String(4))
 	referenceId := "ref_" + common.Sha1([]byte(reference))
 
+	// Creem 按产品定价收款，优惠券折扣依赖在 Creem 后台预先配置的折扣码
+	couponOrder := model.CouponOrder{
+		UserId:        id,
+		OrderType:     model.CouponOrderTypeTopUp,
+		PaymentMethod: model.PaymentMethodCreem,
+		Money:         selectedProduct.Price,
+	}
+	couponQuote, err := model.PrepareCoupon(req.CouponCode, couponOrder)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"message": "error", "data": err.Error()})
+		return
+	}
+	discountCode, err := getCreemCouponDiscountCode(couponQuote)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"message": "error", "data": err.Error()})
+		return
+	}
+	payMoney := selectedProduct.Price
+	if couponQuote != nil {
+		payMoney = couponQuote.FinalMoney
+	}
+	if err := model.ReserveCoupon(couponQuote, couponOrder, referenceId); err != nil {
+		c.JSON(http.StatusOK, gin.H{"message": "error", "data": err.Error()})
+		return
+	}
+
 	// 先创建订单记录，使用产品配置的金额和充值额度
 	topUp := &model.TopUp{
 		UserId:        id,
 		Amount:        selectedProduct.Quota, // 充值额度
-		Money:         selectedProduct.Price, // 支付金额
+		Money:         payMoney,              // 支付金额
 		TradeNo:       referenceId,
 		PaymentMethod: model.PaymentMethodCreem,
 		CreateTime:    time.Now().Unix(),
@@ -117,19 +144,21 @@ func (*CreemAdaptor) RequestPay(c *gin.Context, req *CreemPayRequest) {
 	err = topUp.Insert()
 	if err != nil {
 		logger.LogError(c.Request.Context(), fmt.Sprintf("Creem 创建充值订单失败 user_id=%d trade_no=%s product_id=%s error=%q", id, referenceId, selectedProduct.ProductId, err.Error()))
+		_ = model.CancelCouponRedemption(referenceId)
 		c.JSON(http.StatusOK, gin.H{"message": "error", "data": "创建订单失败"})
 		return
 	}
 
 	// 创建支付链接，传入用户邮箱
-	checkoutUrl, err := genCreemLink(c.Request.Context(), referenceId, selectedProduct, user.Email, user.Username)
+	checkoutUrl, err := genCreemLink(c.Request.Context(), referenceId, selectedProduct, user.Email, user.Username, discountCode)
 	if err != nil {
 		logger.LogError(c.Request.Context(), fmt.Sprintf("Creem 创建支付链接失败 user_id=%d trade_no=%s product_id=%s error=%q", id, referenceId, selectedProduct.ProductId, err.Error()))
+		_ = model.UpdatePendingTopUpStatus(referenceId, model.PaymentMethodCreem, common.TopUpStatusFailed)
 		c.JSON(http.StatusOK, gin.H{"message": "error", "data": "拉起支付失败"})
 		return
 	}
 
-	logger.LogInfo(c.Request.Context(), fmt.Sprintf("Creem 充值订单创建成功 user_id=%d trade_no=%s product_id=%s product_name=%q quota=%d money=%.2f", id, referenceId, selectedProduct.ProductId, selectedProduct.Name, selectedProduct.Quota, selectedProduct.Price))
+	logger.LogInfo(c.Request.Context(), fmt.Sprintf("Creem 充值订单创建成功 user_id=%d trade_no=%s product_id=%s product_name=%q quota=%d money=%.2f", id, referenceId, selectedProduct.ProductId, selectedProduct.Name, selectedProduct.Quota, payMoney))
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "success",
@@ -363,7 +392,8 @@ type CreemCheckoutRequest struct {
 	Customer  struct {
 		Email string `json:"email"`
 	} `json:"customer"`
-	Metadata map[string]string `json:"metadata,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+	DiscountCode string            `json:"discount_code,omitempty"`
 }
 
 type CreemCheckoutResponse struct {
@@ -371,7 +401,7 @@ type CreemCheckoutResponse struct {
 	Id          string `json:"id"`
 }
 
-func genCreemLink(ctx context.Context, referenceId string, product *CreemProduct, email string, username string) (string, error) {
+func genCreemLink(ctx context.Context, referenceId string, product *CreemProduct, email string, username string, discountCode string) (string, error) {
 	if setting.CreemApiKey == "" {
 		return "", fmt.Errorf("未配置Creem API密钥")
 	}
@@ -398,6 +428,7 @@ func genCreemLink(ctx context.Context, referenceId string, product *CreemProduct
 			"product_name": product.Name,
 			"quota":        fmt.Sprintf("%d", product.Quota),
 		},
+		DiscountCode: discountCode,
 	}
 
 	// 序列化请求数据
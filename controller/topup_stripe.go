@@ -38,6 +38,8 @@ type StripePayRequest struct {
 	// CancelURL is the optional custom URL to redirect when payment is canceled.
 	// If empty, defaults to the server's console topup page.
 	CancelURL string `json:"cancel_url,omitempty"`
+	// CouponCode is the optional coupon applied to this checkout.
+	CouponCode string `json:"coupon_code,omitempty"`
 }
 
 type StripeAdaptor struct {
@@ -93,9 +95,37 @@ func (*StripeAdaptor) RequestPay(c *gin.Context, req *StripePayRequest) {
 	reference := fmt.Sprintf("new-api-ref-%d-%d-%s", user.Id, time.Now().UnixMilli(), randstr.String(4))
 	referenceId := "ref_" + common.Sha1([]byte(reference))
 
-	payLink, err := genStripeLink(referenceId, user.StripeCustomer, user.Email, req.Amount, req.SuccessURL, req.CancelURL)
+	// Stripe 按后台价格收款，优惠券折扣通过一次性 Stripe 折扣券实现；Money 仍用于计算到账额度，不做减免
+	couponOrder := model.CouponOrder{
+		UserId:        id,
+		OrderType:     model.CouponOrderTypeTopUp,
+		PaymentMethod: model.PaymentMethodStripe,
+		Money:         getStripePayMoney(float64(req.Amount), user.Group),
+	}
+	couponQuote, err := model.PrepareCoupon(req.CouponCode, couponOrder)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"message": "error", "data": err.Error()})
+		return
+	}
+	if err := model.ReserveCoupon(couponQuote, couponOrder, referenceId); err != nil {
+		c.JSON(http.StatusOK, gin.H{"message": "error", "data": err.Error()})
+		return
+	}
+	stripeCouponId := ""
+	if couponQuote != nil {
+		stripeCouponId, err = createStripeCheckoutCoupon(couponQuote, referenceId)
+		if err != nil {
+			logger.LogError(c.Request.Context(), fmt.Sprintf("Stripe 创建折扣券失败 user_id=%d trade_no=%s coupon=%s error=%q", id, referenceId, couponQuote.Code, err.Error()))
+			_ = model.CancelCouponRedemption(referenceId)
+			c.JSON(http.StatusOK, gin.H{"message": "error", "data": "拉起支付失败"})
+			return
+		}
+	}
+
+	payLink, err := genStripeLink(referenceId, user.StripeCustomer, user.Email, req.Amount, req.SuccessURL, req.CancelURL, stripeCouponId)
 	if err != nil {
 		logger.LogError(c.Request.Context(), fmt.Sprintf("Stripe 创建 Checkout Session 失败 user_id=%d trade_no=%s amount=%d error=%q", id, referenceId, req.Amount, err.Error()))
+		_ = model.CancelCouponRedemption(referenceId)
 		c.JSON(http.StatusOK, gin.H{"message": "error", "data": "拉起支付失败"})
 		return
 	}
@@ -112,6 +142,7 @@ func (*StripeAdaptor) RequestPay(c *gin.Context, req *StripePayRequest) {
 	err = topUp.Insert()
 	if err != nil {
 		logger.LogError(c.Request.Context(), fmt.Sprintf("Stripe 创建充值订单失败 user_id=%d trade_no=%s amount=%d error=%q", id, referenceId, req.Amount, err.Error()))
+		_ = model.CancelCouponRedemption(referenceId)
 		c.JSON(http.StatusOK, gin.H{"message": "error", "data": "创建订单失败"})
 		return
 	}
@@ -336,9 +367,10 @@ func sessionExpired(ctx context.Context, event stripe.Event) {
 //   - amount: quantity of units to purchase
 //   - successURL: custom URL to redirect after successful payment (empty for default)
 //   - cancelURL: custom URL to redirect when payment is canceled (empty for default)
+//   - couponId: one-off Stripe coupon created for the order's coupon discount (empty for none)
 //
 // Returns the checkout session URL or an error if the session creation fails.
-func genStripeLink(referenceId string, customerId string, email string, amount int64, successURL string, cancelURL string) (string, error) {
+func genStripeLink(referenceId string, customerId string, email string, amount int64, successURL string, cancelURL string, couponId string) (string, error) {
 	if !strings.HasPrefix(setting.StripeApiSecret, "sk_") && !strings.HasPrefix(setting.StripeApiSecret, "rk_") {
 		return "", fmt.Errorf("无效的Stripe API密钥")
 	}
@@ -366,6 +398,13 @@ func genStripeLink(referenceId string, customerId string, email string, amount i
 		Mode:                stripe.String(string(stripe.CheckoutSessionModePayment)),
 		AllowPromotionCodes: stripe.Bool(setting.StripePromotionCodesEnabled),
 	}
+	// Stripe 不允许同时指定 discounts 与 allow_promotion_codes
+	if couponId != "" {
+		params.AllowPromotionCodes = nil
+		params.Discounts = []*stripe.CheckoutSessionDiscountParams{
+			{Coupon: stripe.String(couponId)},
+		}
+	}
 
 	if "" == customerId {
 		if "" != email {
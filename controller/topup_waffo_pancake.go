@@ -20,7 +20,8 @@ import (
 )
 
 type WaffoPancakePayRequest struct {
-	Amount int64 `json:"amount"`
+	Amount     int64  `json:"amount"`
+	CouponCode string `json:"coupon_code,omitempty"`
 }
 
 func RequestWaffoPancakeAmount(c *gin.Context) {
@@ -157,7 +158,26 @@ func RequestWaffoPancakePay(c *gin.Context) {
 		return
 	}
 
+	couponOrder := model.CouponOrder{
+		UserId:        id,
+		OrderType:     model.CouponOrderTypeTopUp,
+		PaymentMethod: model.PaymentMethodWaffoPancake,
+		Money:         payMoney,
+	}
+	couponQuote, err := model.PrepareCoupon(req.CouponCode, couponOrder)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"message": "error", "data": err.Error()})
+		return
+	}
+	if couponQuote != nil {
+		payMoney = couponQuote.FinalMoney
+	}
+
 	tradeNo := fmt.Sprintf("WAFFO_PANCAKE-%d-%d-%s", id, time.Now().UnixMilli(), randstr.String(6))
+	if err := model.ReserveCoupon(couponQuote, couponOrder, tradeNo); err != nil {
+		c.JSON(http.StatusOK, gin.H{"message": "error", "data": err.Error()})
+		return
+	}
 	topUp := &model.TopUp{
 		UserId:        id,
 		Amount:        normalizeWaffoPancakeTopUpAmount(req.Amount),
@@ -169,6 +189,7 @@ func RequestWaffoPancakePay(c *gin.Context) {
 	}
 	if err := topUp.Insert(); err != nil {
 		logger.LogError(c.Request.Context(), fmt.Sprintf("Waffo Pancake 创建充值订单失败 user_id=%d trade_no=%s amount=%d error=%q", id, tradeNo, req.Amount, err.Error()))
+		_ = model.CancelCouponRedemption(tradeNo)
 		c.JSON(http.StatusOK, gin.H{"message": "error", "data": "创建订单失败"})
 		return
 	}
@@ -192,6 +213,7 @@ func RequestWaffoPancakePay(c *gin.Context) {
 		logger.LogError(c.Request.Context(), fmt.Sprintf("Waffo Pancake 创建结账会话失败 user_id=%d trade_no=%s error=%q", id, tradeNo, err.Error()))
 		topUp.Status = common.TopUpStatusFailed
 		_ = topUp.Update()
+		_ = model.CancelCouponRedemption(tradeNo)
 		c.JSON(http.StatusOK, gin.H{"message": "error", "data": "拉起支付失败"})
 		return
 	}
@@ -263,6 +263,8 @@ func Disable2FA(c *gin.Context) {
 		return
 	}
 
+	revokeUserSessions(userId, c.GetInt("session_id"))
+
 	// 记录操作日志
 	model.RecordLog(userId, model.LogTypeSystem, "禁用两步验证")
 
@@ -540,6 +542,7 @@ func AdminDisable2FA(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	revokeUserSessions(userId, 0)
 
 	// 记录操作日志：管理员身份通过 admin_info 传递，避免在非管理员可见的日志内容中泄露。
 	adminId := c.GetInt("id")
@@ -87,12 +87,22 @@ func Login(c *gin.Context) {
 // setup session & cookies and then return user info
 func setupLogin(user *model.User, c *gin.Context) {
 	session := sessions.Default(c)
+	// 每次登录都登记新的服务端会话，同一浏览器重复登录时替换旧会话
+	if oldSid, ok := session.Get("sid").(string); ok && oldSid != "" {
+		_ = model.DeleteUserSessionBySid(oldSid)
+	}
+	sid, _, err := model.CreateUserSession(user.Id, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgUserSessionSaveFailed)
+		return
+	}
+	session.Set("sid", sid)
 	session.Set("id", user.Id)
 	session.Set("username", user.Username)
 	session.Set("role", user.Role)
 	session.Set("status", user.Status)
 	session.Set("group", user.Group)
-	err := session.Save()
+	err = session.Save()
 	if err != nil {
 		common.ApiErrorI18n(c, i18n.MsgUserSessionSaveFailed)
 		return
@@ -113,6 +123,11 @@ func setupLogin(user *model.User, c *gin.Context) {
 
 func Logout(c *gin.Context) {
 	session := sessions.Default(c)
+	if sid, ok := session.Get("sid").(string); ok && sid != "" {
+		if err := model.DeleteUserSessionBySid(sid); err != nil {
+			common.SysLog("failed to revoke login session: " + err.Error())
+		}
+	}
 	session.Clear()
 	err := session.Save()
 	if err != nil {
@@ -202,7 +217,6 @@ func Register(c *gin.Context) {
 		token := model.Token{
 			UserId:             insertedUser.Id, // 使用插入后的用户ID
 			Name:               cleanUser.Username + "的初始令牌",
-			Key:                key,
 			CreatedTime:        common.GetTimestamp(),
 			AccessedTime:       common.GetTimestamp(),
 			ExpiredTime:        -1,     // 永不过期
@@ -210,6 +224,7 @@ func Register(c *gin.Context) {
 			UnlimitedQuota:     true,
 			ModelLimitsEnabled: false,
 		}
+		token.SetKey(key)
 		if setting.DefaultUseAutoGroup {
 			token.Group = "auto"
 		}
@@ -382,6 +397,20 @@ func GetSelf(c *gin.Context) {
 	// 获取用户设置并提取sidebar_modules
 	userSetting := user.GetSetting()
 
+	// 限时额度明细，按到期时间排序
+	quotaBuckets, err := model.GetActiveQuotaBuckets(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+
+	// 自定义角色授予的管理权限
+	customRole, err := model.GetUserCustomRole(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+
 	// 构建响应数据，包含用户信息和权限
 	responseData := map[string]interface{}{
 		"id":                user.Id,
@@ -409,6 +438,8 @@ func GetSelf(c *gin.Context) {
 		"stripe_customer":   user.StripeCustomer,
 		"sidebar_modules":   userSetting.SidebarModules, // 正确提取sidebar_modules字段
 		"permissions":       permissions,                // 新增权限字段
+		"quota_buckets":     quotaBuckets,
+		"custom_role":       customRole,
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -572,6 +603,9 @@ func UpdateUser(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	if updatePassword {
+		revokeUserSessions(originUser.Id, 0)
+	}
 	if originUser.Quota != updatedUser.Quota {
 		model.RecordLog(originUser.Id, model.LogTypeManage, fmt.Sprintf("管理员将用户额度从 %s修改为 %s", logger.LogQuota(originUser.Quota), logger.LogQuota(updatedUser.Quota)))
 	}
@@ -724,6 +758,10 @@ func UpdateSelf(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	if updatePassword {
+		// 修改密码后吊销其他设备上的登录会话，保留当前会话
+		revokeUserSessions(cleanUser.Id, c.GetInt("session_id"))
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -792,6 +830,7 @@ func DeleteSelf(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	revokeUserSessions(id, 0)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -971,6 +1010,9 @@ func ManageUser(c *gin.Context) {
 	// 避免在 Redis TTL 过期前仍使用旧状态（尤其是禁用后仍可发起请求的问题）。
 	// InvalidateUserCache 会让下一次 GetUserCache 从数据库重新加载，
 	// InvalidateUserTokensCache 则确保令牌侧的缓存也同步刷新。
+	if req.Action == "disable" || req.Action == "delete" {
+		revokeUserSessions(user.Id, 0)
+	}
 	if req.Action == "disable" || req.Action == "promote" || req.Action == "demote" {
 		if err := model.InvalidateUserCache(user.Id); err != nil {
 			common.SysLog(fmt.Sprintf("failed to invalidate user cache for user %d: %s", user.Id, err.Error()))
@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+type userSessionResponse struct {
+	*model.UserSession
+	Current bool `json:"current"`
+}
+
+// revokeUserSessions 吊销用户的登录会话，exceptId 为保留的会话（通常为当前会话），失败时仅记录日志
+func revokeUserSessions(userId int, exceptId int) {
+	if err := model.RevokeUserSessions(userId, exceptId); err != nil {
+		common.SysLog(fmt.Sprintf("failed to revoke login sessions for user %d: %s", userId, err.Error()))
+	}
+}
+
+func listUserSessions(c *gin.Context, userId int) {
+	sessions, err := model.GetUserSessions(userId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	currentId := 0
+	if c.GetInt("id") == userId {
+		currentId = c.GetInt("session_id")
+	}
+	items := make([]userSessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		items = append(items, userSessionResponse{
+			UserSession: session,
+			Current:     currentId != 0 && session.Id == currentId,
+		})
+	}
+	common.ApiSuccess(c, items)
+}
+
+// GetSelfSessions 列出当前用户的登录会话
+func GetSelfSessions(c *gin.Context) {
+	listUserSessions(c, c.GetInt("id"))
+}
+
+// RevokeSelfSession 吊销当前用户的指定会话
+func RevokeSelfSession(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("session_id"))
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	if err := model.DeleteUserSessionById(id, c.GetInt("id")); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// RevokeSelfOtherSessions 吊销当前用户除当前会话外的全部会话
+func RevokeSelfOtherSessions(c *gin.Context) {
+	if err := model.RevokeUserSessions(c.GetInt("id"), c.GetInt("session_id")); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// getManagedSessionUserId 解析路径中的用户 ID，并校验管理员层级
+func getManagedSessionUserId(c *gin.Context) (int, bool) {
+	userId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return 0, false
+	}
+	user, err := model.GetUserById(userId, false)
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgUserNotExists)
+		return 0, false
+	}
+	myRole := c.GetInt("role")
+	if myRole <= user.Role && myRole != common.RoleRootUser && user.Id != c.GetInt("id") {
+		common.ApiErrorI18n(c, i18n.MsgUserNoPermissionHigherLevel)
+		return 0, false
+	}
+	return userId, true
+}
+
+// GetUserSessions 管理员查看指定用户的登录会话
+func GetUserSessions(c *gin.Context) {
+	userId, ok := getManagedSessionUserId(c)
+	if !ok {
+		return
+	}
+	listUserSessions(c, userId)
+}
+
+// RevokeUserSession 管理员吊销指定用户的某个会话
+func RevokeUserSession(c *gin.Context) {
+	userId, ok := getManagedSessionUserId(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(c.Param("session_id"))
+	if err != nil {
+		common.ApiErrorI18n(c, i18n.MsgInvalidParams)
+		return
+	}
+	if err := model.DeleteUserSessionById(id, userId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// RevokeAllUserSessions 管理员强制下线指定用户的全部会话
+func RevokeAllUserSessions(c *gin.Context) {
+	userId, ok := getManagedSessionUserId(c)
+	if !ok {
+		return
+	}
+	if err := model.RevokeUserSessions(userId, 0); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	adminInfo := map[string]interface{}{
+		"admin_id":       c.GetInt("id"),
+		"admin_username": c.GetString("username"),
+	}
+	model.RecordLogWithAdminInfo(userId, model.LogTypeManage, "管理员强制下线了用户的全部登录会话", adminInfo)
+	common.ApiSuccess(c, nil)
+}
@@ -221,7 +221,7 @@ func getVertexTaskKey(channel *model.Channel, task *model.Task) string {
 			return key
 		}
 	}
-	return strings.TrimSpace(channel.Key)
+	return ""
 }
 
 func extractVertexVideoURLFromTaskData(task *model.Task) string {
@@ -23,23 +23,37 @@ const (
 	AwsKeyTypeApiKey AwsKeyType = "api_key"
 )
 
+// McpTransport MCP 渠道连接上游服务器的传输方式
+type McpTransport string
+
+const (
+	McpTransportStreamableHTTP McpTransport = "streamable_http" // 默认
+	McpTransportSSE            McpTransport = "sse"             // 旧版 HTTP+SSE 传输
+)
+
 type ChannelOtherSettings struct {
-	AzureResponsesVersion                 string        `json:"azure_responses_version,omitempty"`
-	VertexKeyType                         VertexKeyType `json:"vertex_key_type,omitempty"` // "json" or "api_key"
-	OpenRouterEnterprise                  *bool         `json:"openrouter_enterprise,omitempty"`
-	ClaudeBetaQuery                       bool          `json:"claude_beta_query,omitempty"`         // Claude 渠道是否强制追加 ?beta=true
-	AllowServiceTier                      bool          `json:"allow_service_tier,omitempty"`        // 是否允许 service_tier 透传（默认过滤以避免额外计费）
-	AllowInferenceGeo                     bool          `json:"allow_inference_geo,omitempty"`       // 是否允许 inference_geo 透传（仅 Claude，默认过滤以满足数据驻留合规
-	AllowSafetyIdentifier                 bool          `json:"allow_safety_identifier,omitempty"`   // 是否允许 safety_identifier 透传（默认过滤以保护用户隐私）
-	DisableStore                          bool          `json:"disable_store,omitempty"`             // 是否禁用 store 透传（默认允许透传，禁用后可能导致 Codex 无法使用）
-	AllowIncludeObfuscation               bool          `json:"allow_include_obfuscation,omitempty"` // 是否允许 stream_options.include_obfuscation 透传（默认过滤以避免关闭流混淆保护）
-	AwsKeyType                            AwsKeyType    `json:"aws_key_type,omitempty"`
-	UpstreamModelUpdateCheckEnabled       bool          `json:"upstream_model_update_check_enabled,omitempty"`        // 是否检测上游模型更新
-	UpstreamModelUpdateAutoSyncEnabled    bool          `json:"upstream_model_update_auto_sync_enabled,omitempty"`    // 是否自动同步上游模型更新
-	UpstreamModelUpdateLastCheckTime      int64         `json:"upstream_model_update_last_check_time,omitempty"`      // 上次检测时间
-	UpstreamModelUpdateLastDetectedModels []string      `json:"upstream_model_update_last_detected_models,omitempty"` // 上次检测到的可加入模型
-	UpstreamModelUpdateLastRemovedModels  []string      `json:"upstream_model_update_last_removed_models,omitempty"`  // 上次检测到的可删除模型
-	UpstreamModelUpdateIgnoredModels      []string      `json:"upstream_model_update_ignored_models,omitempty"`       // 手动忽略的模型
+	AzureResponsesVersion                 string             `json:"azure_responses_version,omitempty"`
+	VertexKeyType                         VertexKeyType      `json:"vertex_key_type,omitempty"` // "json" or "api_key"
+	OpenRouterEnterprise                  *bool              `json:"openrouter_enterprise,omitempty"`
+	ClaudeBetaQuery                       bool               `json:"claude_beta_query,omitempty"`         // Claude 渠道是否强制追加 ?beta=true
+	AllowServiceTier                      bool               `json:"allow_service_tier,omitempty"`        // 是否允许 service_tier 透传（默认过滤以避免额外计费）
+	AllowInferenceGeo                     bool               `json:"allow_inference_geo,omitempty"`       // 是否允许 inference_geo 透传（仅 Claude，默认过滤以满足数据驻留合规
+	AllowSafetyIdentifier                 bool               `json:"allow_safety_identifier,omitempty"`   // 是否允许 safety_identifier 透传（默认过滤以保护用户隐私）
+	DisableStore                          bool               `json:"disable_store,omitempty"`             // 是否禁用 store 透传（默认允许透传，禁用后可能导致 Codex 无法使用）
+	AllowIncludeObfuscation               bool               `json:"allow_include_obfuscation,omitempty"` // 是否允许 stream_options.include_obfuscation 透传（默认过滤以避免关闭流混淆保护）
+	AwsKeyType                            AwsKeyType         `json:"aws_key_type,omitempty"`
+	UpstreamModelUpdateCheckEnabled       bool               `json:"upstream_model_update_check_enabled,omitempty"`        // 是否检测上游模型更新
+	UpstreamModelUpdateAutoSyncEnabled    bool               `json:"upstream_model_update_auto_sync_enabled,omitempty"`    // 是否自动同步上游模型更新
+	UpstreamModelUpdateLastCheckTime      int64              `json:"upstream_model_update_last_check_time,omitempty"`      // 上次检测时间
+	UpstreamModelUpdateLastDetectedModels []string           `json:"upstream_model_update_last_detected_models,omitempty"` // 上次检测到的可加入模型
+	UpstreamModelUpdateLastRemovedModels  []string           `json:"upstream_model_update_last_removed_models,omitempty"`  // 上次检测到的可删除模型
+	UpstreamModelUpdateIgnoredModels      []string           `json:"upstream_model_update_ignored_models,omitempty"`       // 手动忽略的模型
+	CostRatio                             *float64           `json:"cost_ratio,omitempty"`                                 // 渠道成本倍率（相对模型标价，如 0.8 表示八折进货）
+	ModelCostRatios                       map[string]float64 `json:"model_cost_ratios,omitempty"`                          // 按模型配置的成本倍率，优先于 cost_ratio
+
+	// MCP 渠道：上游传输方式与每次工具调用的价格（美元，0 表示不计费）
+	McpTransport McpTransport `json:"mcp_transport,omitempty"`
+	McpCallPrice float64      `json:"mcp_call_price,omitempty"`
 }
 
 func (s *ChannelOtherSettings) IsOpenRouterEnterprise() bool {
@@ -48,3 +62,17 @@ func (s *ChannelOtherSettings) IsOpenRouterEnterprise() bool {
 	}
 	return *s.OpenRouterEnterprise
 }
+
+// GetCostRatio 返回指定模型的成本倍率，按模型配置优先，其次为渠道统一倍率；未配置时返回 false
+func (s *ChannelOtherSettings) GetCostRatio(modelName string) (float64, bool) {
+	if s == nil {
+		return 0, false
+	}
+	if ratio, ok := s.ModelCostRatios[modelName]; ok && ratio >= 0 {
+		return ratio, true
+	}
+	if s.CostRatio != nil && *s.CostRatio >= 0 {
+		return *s.CostRatio, true
+	}
+	return 0, false
+}
@@ -0,0 +1,54 @@
+package dto
+
+import "encoding/json"
+
+// MCP 网关转发的 JSON-RPC 2.0 消息，只解析网关需要的字段，其余内容原样透传
+
+const (
+	McpErrorCodeParseError     = -32700
+	McpErrorCodeInvalidRequest = -32600
+	McpErrorCodeInvalidParams  = -32602
+	McpErrorCodeInternalError  = -32603
+	// McpErrorCodeToolForbidden 网关自定义错误码：令牌无权调用该工具
+	McpErrorCodeToolForbidden = -32001
+)
+
+type McpJsonRpcMessage struct {
+	JsonRpc string           `json:"jsonrpc"`
+	Id      json.RawMessage  `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *McpJsonRpcError `json:"error,omitempty"`
+}
+
+type McpJsonRpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// IsRequest 带 id 的调用请求，需要等待响应；没有 id 的为通知
+func (m *McpJsonRpcMessage) IsRequest() bool {
+	return m.Method != "" && len(m.Id) > 0
+}
+
+// IsResponse 对客户端请求的响应
+func (m *McpJsonRpcMessage) IsResponse() bool {
+	return m.Method == "" && len(m.Id) > 0
+}
+
+type McpToolCallParams struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+func NewMcpErrorResponse(id json.RawMessage, code int, message string) *McpJsonRpcMessage {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	return &McpJsonRpcMessage{
+		JsonRpc: "2.0",
+		Id:      id,
+		Error:   &McpJsonRpcError{Code: code, Message: message},
+	}
+}
@@ -331,6 +331,7 @@ func (o *OpenAIResponsesResponse) GetSize() string {
 
 type IncompleteDetails struct {
 	Reasoning string `json:"reasoning"`
+	Reason    string `json:"reason,omitempty"` // max_output_tokens / content_filter
 }
 
 type ResponsesOutput struct {
@@ -344,6 +345,10 @@ type ResponsesOutput struct {
 	CallId    string                   `json:"call_id,omitempty"`
 	Name      string                   `json:"name,omitempty"`
 	Arguments string                   `json:"arguments,omitempty"`
+
+	// reasoning 项：summary 为摘要数组（reasoning 项必须携带，可为空数组），encrypted_content 用于下一轮原样回传
+	Summary          json.RawMessage `json:"summary,omitempty"`
+	EncryptedContent string          `json:"encrypted_content,omitempty"`
 }
 
 type ResponsesOutputContent struct {
@@ -384,6 +389,10 @@ type ResponsesStreamResponse struct {
 	SummaryIndex *int                           `json:"summary_index,omitempty"`
 	ItemID       string                         `json:"item_id,omitempty"`
 	Part         *ResponsesReasoningSummaryPart `json:"part,omitempty"`
+
+	SequenceNumber int    `json:"sequence_number"`
+	Text           string `json:"text,omitempty"`      // response.output_text.done / response.reasoning_summary_text.done
+	Arguments      string `json:"arguments,omitempty"` // response.function_call_arguments.done
 }
 
 // GetOpenAIError 从动态错误类型中提取OpenAIError结构
@@ -114,6 +114,18 @@ func main() {
 	// Subscription quota reset task (daily/weekly/monthly/custom)
 	service.StartSubscriptionQuotaResetTask()
 
+	// Postpaid billing cycle close & overdue status task
+	service.StartPostpaidBillingTask()
+
+	// Expiring quota bucket task
+	service.StartQuotaBucketExpireTask()
+
+	// Token key scheduled rotation & previous key expiry task
+	service.StartTokenRotationTask()
+
+	// Expired gateway-side Responses API storage cleanup task
+	service.StartStoredResponseCleanupTask()
+
 	// OSS 图片生命周期清理任务（仅 master 节点启动）
 	oss.StartOssImageCleanupTask()
 
@@ -294,6 +306,26 @@ func InitResources() error {
 
 	model.CheckSetup()
 
+	// 渠道密钥加密：轮换主密钥后退出；否则由 master 节点透明加密存量明文密钥
+	if *common.RotateSecretMasterKey {
+		count, err := model.RotateChannelKeyMasterKey()
+		if err != nil {
+			common.FatalLog("failed to rotate secret master key: " + err.Error())
+		}
+		common.SysLog(fmt.Sprintf("secret master key rotated, %d channels updated", count))
+		os.Exit(0)
+	}
+	if common.IsMasterNode {
+		if count, err := model.MigrateChannelKeyEncryption(); err != nil {
+			common.SysError("failed to encrypt channel keys: " + err.Error())
+		} else if count > 0 {
+			common.SysLog(fmt.Sprintf("encrypted %d plaintext channel keys", count))
+		}
+	}
+	if !common.EnvelopeEncryptionEnabled() {
+		common.SysLog("SECRET_MASTER_KEY is not set, channel keys are stored in plaintext")
+	}
+
 	// Initialize options, should after model.InitDB()
 	model.InitOptionMap()
 
@@ -30,13 +30,23 @@ func validUserInfo(username string, role int) bool {
 	return true
 }
 
-func authHelper(c *gin.Context, minRole int) {
+// authHelper 校验登录态或 access token 与角色等级；permission 非空时，
+// 角色等级不足的普通用户若通过自定义角色拥有该资源的权限也可访问
+func authHelper(c *gin.Context, minRole int, permission string) {
 	session := sessions.Default(c)
 	username := session.Get("username")
 	role := session.Get("role")
 	id := session.Get("id")
 	status := session.Get("status")
 	useAccessToken := false
+	if username != nil && !checkLoginSession(c, session) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": model.ErrUserSessionInvalid.Error(),
+		})
+		c.Abort()
+		return
+	}
 	if username == nil {
 		// Check access token
 		accessToken := c.Request.Header.Get("Authorization")
@@ -48,7 +58,16 @@ func authHelper(c *gin.Context, minRole int) {
 			c.Abort()
 			return
 		}
-		user := model.ValidateAccessToken(accessToken)
+		var user *model.User
+		if model.IsManagementKey(accessToken) {
+			var ok bool
+			user, ok = authManagementKey(c, accessToken)
+			if !ok {
+				return
+			}
+		} else {
+			user = model.ValidateAccessToken(accessToken)
+		}
 		if user != nil && user.Username != "" {
 			if !validUserInfo(user.Username, user.Role) {
 				c.JSON(http.StatusOK, gin.H{
@@ -110,12 +129,18 @@ func authHelper(c *gin.Context, minRole int) {
 		return
 	}
 	if role.(int) < minRole {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": "无权进行此操作，权限不足",
-		})
-		c.Abort()
-		return
+		customRole := customRoleForRoute(c, id.(int), role.(int), minRole, permission)
+		if customRole == nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无权进行此操作，权限不足",
+			})
+			c.Abort()
+			return
+		}
+		// 本次请求按管理员身份处理，沿用控制器中基于角色等级的层级校验
+		role = common.RoleAdminUser
+		c.Set("custom_role_id", customRole.Id)
 	}
 	if !validUserInfo(username.(string), role.(int)) {
 		c.JSON(http.StatusOK, gin.H{
@@ -137,11 +162,51 @@ func authHelper(c *gin.Context, minRole int) {
 	c.Next()
 }
 
+// authManagementKey 校验管理密钥的有效期、IP 白名单及当前路由所需的作用域，返回密钥所属用户。
+// 校验失败时已写入响应并中止请求
+func authManagementKey(c *gin.Context, accessToken string) (*model.User, bool) {
+	abort := func(status int, message string) (*model.User, bool) {
+		c.JSON(status, gin.H{
+			"success": false,
+			"message": message,
+		})
+		c.Abort()
+		return nil, false
+	}
+	key, err := model.ValidateManagementKey(accessToken)
+	if err != nil {
+		return abort(http.StatusUnauthorized, "无权进行此操作，"+err.Error())
+	}
+	clientIp := c.ClientIP()
+	if allowIps := key.GetIpLimits(); len(allowIps) > 0 {
+		ip := net.ParseIP(clientIp)
+		if ip == nil || !common.IsIpInCIDRList(ip, allowIps) {
+			return abort(http.StatusForbidden, "无权进行此操作，您的 IP 不在管理密钥允许访问的列表中")
+		}
+	}
+	resource, action, ok := managementScopeForRoute(c.Request.Method, c.FullPath())
+	if !ok {
+		return abort(http.StatusForbidden, "无权进行此操作，该接口不允许使用管理密钥访问")
+	}
+	if !key.HasScope(resource, action) {
+		return abort(http.StatusForbidden, fmt.Sprintf("无权进行此操作，管理密钥缺少 %s:%s 作用域", resource, action))
+	}
+	user, err := model.GetUserById(key.UserId, false)
+	if err != nil {
+		return abort(http.StatusUnauthorized, "无权进行此操作，管理密钥所属用户不存在")
+	}
+	if err := model.TouchManagementKey(key, clientIp); err != nil {
+		common.SysLog(fmt.Sprintf("failed to update management key %d last used time: %s", key.Id, err.Error()))
+	}
+	c.Set("management_key_id", key.Id)
+	return user, true
+}
+
 func TryUserAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		session := sessions.Default(c)
 		id := session.Get("id")
-		if id != nil {
+		if id != nil && checkLoginSession(c, session) {
 			c.Set("id", id)
 		}
 		c.Next()
@@ -150,19 +215,27 @@ func TryUserAuth() func(c *gin.Context) {
 
 func UserAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
-		authHelper(c, common.RoleCommonUser)
+		authHelper(c, common.RoleCommonUser, "")
 	}
 }
 
 func AdminAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
-		authHelper(c, common.RoleAdminUser)
+		authHelper(c, common.RoleAdminUser, "")
+	}
+}
+
+// PermissionAuth 管理员可直接访问；普通用户需通过自定义角色拥有 resource 的权限，
+// GET/HEAD 请求需要 read 权限，其余需要 write 权限
+func PermissionAuth(resource string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		authHelper(c, common.RoleAdminUser, resource)
 	}
 }
 
 func RootAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
-		authHelper(c, common.RoleRootUser)
+		authHelper(c, common.RoleRootUser, "")
 	}
 }
 
@@ -176,7 +249,7 @@ func TokenOrUserAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		// Try session auth first (dashboard users)
 		session := sessions.Default(c)
-		if id := session.Get("id"); id != nil {
+		if id := session.Get("id"); id != nil && checkLoginSession(c, session) {
 			if status, ok := session.Get("status").(int); ok && status == common.UserStatusEnabled {
 				c.Set("id", id)
 				c.Next()
@@ -288,6 +361,10 @@ func TokenAuth() func(c *gin.Context) {
 		if strings.HasPrefix(key, "Bearer ") || strings.HasPrefix(key, "bearer ") {
 			key = strings.TrimSpace(key[7:])
 		}
+		if model.IsEphemeralTokenKey(key) {
+			ephemeralTokenAuth(c, key)
+			return
+		}
 		if key == "" || key == "midjourney-proxy" {
 			key = c.Request.Header.Get("mj-api-secret")
 			if strings.HasPrefix(key, "Bearer ") || strings.HasPrefix(key, "bearer ") {
@@ -313,60 +390,111 @@ func TokenAuth() func(c *gin.Context) {
 			return
 		}
 
-		allowIps := token.GetIpLimits()
-		if len(allowIps) > 0 {
-			clientIp := c.ClientIP()
-			logger.LogDebug(c, "Token has IP restrictions, checking client IP %s", clientIp)
-			ip := net.ParseIP(clientIp)
-			if ip == nil {
-				abortWithOpenAiMessage(c, http.StatusForbidden, "无法解析客户端 IP 地址")
-				return
-			}
-			if common.IsIpInCIDRList(ip, allowIps) == false {
-				abortWithOpenAiMessage(c, http.StatusForbidden, "您的 IP 不在令牌允许访问的列表中", types.ErrorCodeAccessDenied)
-				return
-			}
-			logger.LogDebug(c, "Client IP %s passed the token IP restrictions check", clientIp)
-		}
-
-		userCache, err := model.GetUserCache(token.UserId)
-		if err != nil {
-			abortWithOpenAiMessage(c, http.StatusInternalServerError, err.Error())
+		if !checkTokenIpLimits(c, token) {
 			return
 		}
-		userEnabled := userCache.Status == common.UserStatusEnabled
-		if !userEnabled {
-			abortWithOpenAiMessage(c, http.StatusForbidden, "用户已被封禁")
+
+		if !setupTokenUserContext(c, token, parts...) {
 			return
 		}
+		c.Next()
+	}
+}
 
-		userCache.WriteContext(c)
+// setupTokenUserContext 校验令牌所属用户及分组并写入上下文，失败时已中止请求并返回 false
+func setupTokenUserContext(c *gin.Context, token *model.Token, parts ...string) bool {
+	userCache, err := model.GetUserCache(token.UserId)
+	if err != nil {
+		abortWithOpenAiMessage(c, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	userEnabled := userCache.Status == common.UserStatusEnabled
+	if !userEnabled {
+		abortWithOpenAiMessage(c, http.StatusForbidden, "用户已被封禁")
+		return false
+	}
 
-		userGroup := userCache.Group
-		tokenGroup := token.Group
-		if tokenGroup != "" {
-			// check common.UserUsableGroups[userGroup]
-			if _, ok := service.GetUserUsableGroups(userGroup)[tokenGroup]; !ok {
-				abortWithOpenAiMessage(c, http.StatusForbidden, fmt.Sprintf("无权访问 %s 分组", tokenGroup))
-				return
-			}
-			// check group in common.GroupRatio
-			if !ratio_setting.ContainsGroupRatio(tokenGroup) {
-				if tokenGroup != "auto" {
-					abortWithOpenAiMessage(c, http.StatusForbidden, fmt.Sprintf("分组 %s 已被弃用", tokenGroup))
-					return
-				}
+	userCache.WriteContext(c)
+
+	userGroup := userCache.Group
+	tokenGroup := token.Group
+	if tokenGroup != "" {
+		// check common.UserUsableGroups[userGroup]
+		if _, ok := service.GetUserUsableGroups(userGroup)[tokenGroup]; !ok {
+			abortWithOpenAiMessage(c, http.StatusForbidden, fmt.Sprintf("无权访问 %s 分组", tokenGroup))
+			return false
+		}
+		// check group in common.GroupRatio
+		if !ratio_setting.ContainsGroupRatio(tokenGroup) {
+			if tokenGroup != "auto" {
+				abortWithOpenAiMessage(c, http.StatusForbidden, fmt.Sprintf("分组 %s 已被弃用", tokenGroup))
+				return false
 			}
-			userGroup = tokenGroup
 		}
-		common.SetContextKey(c, constant.ContextKeyUsingGroup, userGroup)
+		userGroup = tokenGroup
+	}
+	common.SetContextKey(c, constant.ContextKeyUsingGroup, userGroup)
 
-		err = SetupContextForToken(c, token, parts...)
-		if err != nil {
-			return
+	return SetupContextForToken(c, token, parts...) == nil
+}
+
+// checkTokenIpLimits 校验客户端 IP 是否在令牌的 IP 白名单内，未通过时中止请求
+func checkTokenIpLimits(c *gin.Context, token *model.Token) bool {
+	allowIps := token.GetIpLimits()
+	if len(allowIps) == 0 {
+		return true
+	}
+	clientIp := c.ClientIP()
+	logger.LogDebug(c, "Token has IP restrictions, checking client IP %s", clientIp)
+	ip := net.ParseIP(clientIp)
+	if ip == nil {
+		abortWithOpenAiMessage(c, http.StatusForbidden, "无法解析客户端 IP 地址")
+		return false
+	}
+	if common.IsIpInCIDRList(ip, allowIps) == false {
+		abortWithOpenAiMessage(c, http.StatusForbidden, "您的 IP 不在令牌允许访问的列表中", types.ErrorCodeAccessDenied)
+		return false
+	}
+	logger.LogDebug(c, "Client IP %s passed the token IP restrictions check", clientIp)
+	return true
+}
+
+// ephemeralTokenAuth 校验临时令牌，并以其父令牌的身份与额度继续处理请求。
+// 临时令牌默认沿用父令牌的 IP 白名单，签发时显式指定 allow_any_ip 的除外
+func ephemeralTokenAuth(c *gin.Context, key string) {
+	claims, token, err := model.ValidateEphemeralToken(key)
+	if err != nil {
+		abortWithOpenAiMessage(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if !claims.AllowAnyIp && !checkTokenIpLimits(c, token) {
+		return
+	}
+	spendJti, spendExpiresAt := claims.SpendCounter()
+	if claims.MaxSpend > 0 && model.GetEphemeralTokenSpend(spendJti) >= claims.MaxSpend {
+		abortWithOpenAiMessage(c, http.StatusForbidden, "临时令牌额度已用尽", types.ErrorCodeInsufficientUserQuota)
+		return
+	}
+	if !setupTokenUserContext(c, token) {
+		return
+	}
+	if len(claims.Models) > 0 {
+		parentLimits := token.GetModelLimitsMap()
+		limits := make(map[string]bool, len(claims.Models))
+		for _, modelName := range claims.Models {
+			// mcp/<server> 限定 MCP 网关的服务器，由令牌的 MCP 白名单约束，不受父令牌模型限制
+			if !token.ModelLimitsEnabled || parentLimits[modelName] || strings.HasPrefix(modelName, "mcp/") {
+				limits[modelName] = true
+			}
 		}
-		c.Next()
+		c.Set("token_model_limit_enabled", true)
+		c.Set("token_model_limit", limits)
 	}
+	common.SetContextKey(c, constant.ContextKeyEphemeralTokenId, spendJti)
+	common.SetContextKey(c, constant.ContextKeyEphemeralTokenMaxSpend, claims.MaxSpend)
+	common.SetContextKey(c, constant.ContextKeyEphemeralTokenExpiresAt, spendExpiresAt)
+	common.SetContextKey(c, constant.ContextKeyEndUserId, claims.EndUserId)
+	c.Next()
 }
 
 func SetupContextForToken(c *gin.Context, token *model.Token, parts ...string) error {
@@ -389,6 +517,13 @@ func SetupContextForToken(c *gin.Context, token *model.Token, parts ...string) e
 	}
 	common.SetContextKey(c, constant.ContextKeyTokenGroup, token.Group)
 	common.SetContextKey(c, constant.ContextKeyTokenCrossGroupRetry, token.CrossGroupRetry)
+	if token.UsingPreviousKey {
+		common.SetContextKey(c, constant.ContextKeyTokenPreviousKey, true)
+	}
+	common.SetContextKey(c, constant.ContextKeyTokenEndUserRPM, token.EndUserRPM)
+	common.SetContextKey(c, constant.ContextKeyTokenEndUserDailyQuota, token.EndUserDailyQuota)
+	common.SetContextKey(c, constant.ContextKeyTokenBlockedEndUsers, token.BlockedEndUsers)
+	common.SetContextKey(c, constant.ContextKeyTokenMcpAllowlist, token.McpAllowlist)
 	if len(parts) > 1 {
 		if model.IsAdmin(token.UserId) {
 			c.Set("specific_channel_id", parts[1])
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// customRoleForRoute 返回授予当前请求所需权限的自定义角色，未授予时返回 nil。
+// 自定义角色只用于代替管理员权限，不能用于超级管理员接口
+func customRoleForRoute(c *gin.Context, userId int, role int, minRole int, permission string) *model.CustomRole {
+	if permission == "" || minRole != common.RoleAdminUser || role != common.RoleCommonUser {
+		return nil
+	}
+	customRole, err := model.GetUserCustomRole(userId)
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to load custom role of user %d: %s", userId, err.Error()))
+		return nil
+	}
+	if customRole == nil || !customRole.HasPermission(permission, scopeActionForMethod(c.Request.Method)) {
+		return nil
+	}
+	return customRole
+}
@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestPermissionAuthWithCustomRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	oldDB := model.DB
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open test db: %v", err)
+	}
+	model.DB = db
+	defer func() { model.DB = oldDB }()
+
+	if err := db.AutoMigrate(&model.User{}, &model.CustomRole{}); err != nil {
+		t.Fatalf("failed to migrate test tables: %v", err)
+	}
+
+	support := &model.CustomRole{Name: "support"}
+	if err := support.Normalize([]string{"users:read", "logs:read"}); err != nil {
+		t.Fatalf("failed to normalize role: %v", err)
+	}
+	if err := support.Insert(); err != nil {
+		t.Fatalf("failed to create role: %v", err)
+	}
+	accessToken := "support-access-token"
+	user := &model.User{
+		Username:    "agent",
+		Password:    "password123",
+		Role:        common.RoleCommonUser,
+		Status:      common.UserStatusEnabled,
+		AccessToken: &accessToken,
+		AffCode:     "agent",
+	}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	router := gin.New()
+	router.Use(sessions.Sessions("session", cookie.NewStore([]byte("secret"))))
+	handler := func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"success": true, "role": c.GetInt("role")})
+	}
+	router.GET("/api/user/:id", PermissionAuth(model.ManagementScopeUsers), handler)
+	router.PUT("/api/user/", PermissionAuth(model.ManagementScopeUsers), handler)
+	router.GET("/api/channel/", PermissionAuth(model.ManagementScopeChannels), handler)
+	router.GET("/api/option/", RootAuth(), handler)
+
+	request := func(method, path string) map[string]any {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", accessToken)
+		req.Header.Set("New-Api-User", strconv.Itoa(user.Id))
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		var body map[string]any
+		if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+			t.Fatalf("failed to decode response of %s %s: %v", method, path, err)
+		}
+		return body
+	}
+
+	// 未分配角色时普通用户无权访问管理接口
+	if body := request(http.MethodGet, "/api/user/2"); body["success"] != false {
+		t.Fatalf("expected user without custom role to be rejected, got %v", body)
+	}
+
+	if err := model.SetUserCustomRole(user.Id, support.Id); err != nil {
+		t.Fatalf("failed to assign role: %v", err)
+	}
+	body := request(http.MethodGet, "/api/user/2")
+	if body["success"] != true || body["role"] != float64(common.RoleAdminUser) {
+		t.Fatalf("expected users:read to allow GET with admin role in context, got %v", body)
+	}
+	if body := request(http.MethodPut, "/api/user/"); body["success"] != false {
+		t.Fatalf("expected users:read to reject PUT, got %v", body)
+	}
+	if body := request(http.MethodGet, "/api/channel/"); body["success"] != false {
+		t.Fatalf("expected missing channels permission to be rejected, got %v", body)
+	}
+	if body := request(http.MethodGet, "/api/option/"); body["success"] != false {
+		t.Fatalf("expected custom role not to grant root routes, got %v", body)
+	}
+
+	// 删除角色后撤销授权
+	if err := model.DeleteCustomRoleById(support.Id); err != nil {
+		t.Fatalf("failed to delete role: %v", err)
+	}
+	if body := request(http.MethodGet, "/api/user/2"); body["success"] != false {
+		t.Fatalf("expected deleted role to be revoked, got %v", body)
+	}
+}
@@ -99,25 +99,27 @@ func Distribute() func(c *gin.Context) {
 					}
 				}
 
-				if preferredChannelID, found := service.GetPreferredChannelByAffinity(c, modelRequest.Model, usingGroup); found {
-					preferred, err := model.CacheGetChannel(preferredChannelID)
-					if err == nil && preferred != nil && preferred.Status == common.ChannelStatusEnabled {
-						if usingGroup == "auto" {
-							userGroup := common.GetContextKeyString(c, constant.ContextKeyUserGroup)
-							autoGroups := service.GetUserAutoGroup(userGroup)
-							for _, g := range autoGroups {
-								if model.IsChannelEnabledForGroupModel(g, modelRequest.Model, preferred.Id) {
-									selectGroup = g
-									common.SetContextKey(c, constant.ContextKeyAutoGroup, g)
-									channel = preferred
-									service.MarkChannelAffinityUsed(c, g, preferred.Id)
-									break
-								}
-							}
-						} else if model.IsChannelEnabledForGroupModel(usingGroup, modelRequest.Model, preferred.Id) {
-							channel = preferred
-							selectGroup = usingGroup
-							service.MarkChannelAffinityUsed(c, usingGroup, preferred.Id)
+				// 流量切分实验：实验组可改用其他模型或指定渠道，对照组保持不变
+				originModel := modelRequest.Model
+				experimentArm := service.AssignExperiment(c, modelRequest.Model, usingGroup)
+				if experimentArm != nil {
+					if experimentArm.Model != "" {
+						modelRequest.Model = experimentArm.Model
+					}
+					if experimentArm.ChannelId > 0 {
+						channel, selectGroup = selectPreferredChannel(c, experimentArm.ChannelId, modelRequest.Model, usingGroup)
+						// 仅指定渠道的实验组在渠道不可用时与对照组无异，不计入实验
+						if channel == nil && experimentArm.Model == "" {
+							service.ClearExperimentAssignment(c)
+						}
+					}
+				}
+
+				if channel == nil {
+					if preferredChannelID, found := service.GetPreferredChannelByAffinity(c, modelRequest.Model, usingGroup); found {
+						channel, selectGroup = selectPreferredChannel(c, preferredChannelID, modelRequest.Model, usingGroup)
+						if channel != nil {
+							service.MarkChannelAffinityUsed(c, selectGroup, channel.Id)
 						}
 					}
 				}
@@ -129,7 +131,21 @@ func Distribute() func(c *gin.Context) {
 						TokenGroup: usingGroup,
 						Retry:      common.GetPointer(0),
 					})
-					if err != nil {
+					// 实验组的模型在当前分组没有可用渠道时回退到原模型，该请求不计入实验
+					if (err != nil || channel == nil) && experimentArm != nil && modelRequest.Model != originModel {
+						service.ClearExperimentAssignment(c)
+						modelRequest.Model = originModel
+						channel, selectGroup, err = service.CacheGetRandomSatisfiedChannel(&service.RetryParam{
+							Ctx:        c,
+							ModelName:  modelRequest.Model,
+							TokenGroup: usingGroup,
+							Retry:      common.GetPointer(0),
+						})
+					}
+					// token 计数请求没有可用渠道时不中断，由本地 tokenizer 计数
+					if (err != nil || channel == nil) && relayconstant.Path2RelayMode(c.Request.URL.Path) == relayconstant.RelayModeCountTokens {
+						channel, err = nil, nil
+					} else if err != nil {
 						showGroup := usingGroup
 						if usingGroup == "auto" {
 							showGroup = fmt.Sprintf("auto(%s)", selectGroup)
@@ -142,8 +158,7 @@ func Distribute() func(c *gin.Context) {
 						//}
 						abortWithOpenAiMessage(c, http.StatusServiceUnavailable, message, types.ErrorCodeModelNotFound)
 						return
-					}
-					if channel == nil {
+					} else if channel == nil {
 						abortWithOpenAiMessage(c, http.StatusServiceUnavailable, i18n.T(c, i18n.MsgDistributorNoAvailableChannel, map[string]any{"Group": usingGroup, "Model": modelRequest.Model}), types.ErrorCodeModelNotFound)
 						return
 					}
@@ -159,6 +174,29 @@ func Distribute() func(c *gin.Context) {
 	}
 }
 
+// selectPreferredChannel 优先使用指定渠道，渠道需启用且在当前分组（auto 分组下为任一自动分组）中支持该模型，
+// 不满足时返回 nil，由调用方按权重随机选择渠道
+func selectPreferredChannel(c *gin.Context, channelId int, modelName string, usingGroup string) (*model.Channel, string) {
+	preferred, err := model.CacheGetChannel(channelId)
+	if err != nil || preferred == nil || preferred.Status != common.ChannelStatusEnabled {
+		return nil, ""
+	}
+	if usingGroup == "auto" {
+		userGroup := common.GetContextKeyString(c, constant.ContextKeyUserGroup)
+		for _, g := range service.GetUserAutoGroup(userGroup) {
+			if model.IsChannelEnabledForGroupModel(g, modelName, preferred.Id) {
+				common.SetContextKey(c, constant.ContextKeyAutoGroup, g)
+				return preferred, g
+			}
+		}
+		return nil, ""
+	}
+	if model.IsChannelEnabledForGroupModel(usingGroup, modelName, preferred.Id) {
+		return preferred, usingGroup
+	}
+	return nil, ""
+}
+
 // getModelFromRequest 从请求中读取模型信息
 // 根据 Content-Type 自动处理：
 // - application/json
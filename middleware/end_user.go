@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	endUserRPMLimitDurationSeconds int64 = 60
+	EndUserRPMLimitMark                  = "EURPM"
+)
+
+// endUserIdRequest 请求体中可能携带终端用户标识的字段，类型宽松以兼容各家格式
+type endUserIdRequest struct {
+	SafetyIdentifier any `json:"safety_identifier"`
+	User             any `json:"user"`
+	Metadata         any `json:"metadata"`
+}
+
+// resolveEndUserId 解析终端用户标识，优先级：临时令牌声明 > 配置的请求头 > 请求体
+// （safety_identifier、user、Claude 格式的 metadata.user_id）
+func resolveEndUserId(c *gin.Context) string {
+	if id := common.GetContextKeyString(c, constant.ContextKeyEndUserId); id != "" {
+		return id
+	}
+	if header := operation_setting.GetTokenSetting().EndUserIdHeader; header != "" {
+		if id := model.NormalizeEndUserId(c.GetHeader(header)); id != "" {
+			return id
+		}
+	}
+	if c.Request.Method != http.MethodPost || !strings.HasPrefix(c.Request.Header.Get("Content-Type"), "application/json") {
+		return ""
+	}
+	var req endUserIdRequest
+	if err := common.UnmarshalBodyReusable(c, &req); err != nil {
+		return ""
+	}
+	if id, ok := req.SafetyIdentifier.(string); ok && strings.TrimSpace(id) != "" {
+		return model.NormalizeEndUserId(id)
+	}
+	if id, ok := req.User.(string); ok && strings.TrimSpace(id) != "" {
+		return model.NormalizeEndUserId(id)
+	}
+	if metadata, ok := req.Metadata.(map[string]any); ok {
+		if id, ok := metadata["user_id"].(string); ok {
+			return model.NormalizeEndUserId(id)
+		}
+	}
+	return ""
+}
+
+func endUserRPMExceededMessage(rpm int) string {
+	return fmt.Sprintf("当前终端用户已达到 RPM 限制：1分钟内最多请求%d次", rpm)
+}
+
+func redisEndUserRPMLimitHandler(c *gin.Context, tokenId int, endUserId string, rpm int) bool {
+	ctx := context.Background()
+	key := fmt.Sprintf("rateLimit:%s:token:%d:%s", EndUserRPMLimitMark, tokenId, endUserId)
+
+	allowed, err := checkRedisRateLimit(ctx, common.RDB, key, rpm, endUserRPMLimitDurationSeconds)
+	if err != nil {
+		abortWithOpenAiMessage(c, http.StatusInternalServerError, "end_user_rpm_rate_limit_check_failed")
+		return false
+	}
+	if !allowed {
+		abortWithOpenAiMessage(c, http.StatusTooManyRequests, endUserRPMExceededMessage(rpm))
+		return false
+	}
+
+	recordRedisRequest(ctx, common.RDB, key, rpm)
+	return true
+}
+
+func memoryEndUserRPMLimitHandler(c *gin.Context, tokenId int, endUserId string, rpm int) bool {
+	inMemoryRateLimiter.Init(common.RateLimitKeyExpirationDuration)
+
+	key := fmt.Sprintf("%s:token:%d:%s", EndUserRPMLimitMark, tokenId, endUserId)
+	if !inMemoryRateLimiter.Request(key, rpm, endUserRPMLimitDurationSeconds) {
+		abortWithOpenAiMessage(c, http.StatusTooManyRequests, endUserRPMExceededMessage(rpm))
+		return false
+	}
+	return true
+}
+
+// EndUserLimit 识别令牌调用方的终端用户，记录到上下文（写入日志），并执行令牌上配置的终端用户黑名单、RPM 与每日额度限制
+func EndUserLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenId := c.GetInt("token_id")
+		if tokenId <= 0 {
+			c.Next()
+			return
+		}
+		endUserId := resolveEndUserId(c)
+		if endUserId == "" {
+			c.Next()
+			return
+		}
+		common.SetContextKey(c, constant.ContextKeyEndUserId, endUserId)
+
+		if model.IsEndUserBlocked(common.GetContextKeyString(c, constant.ContextKeyTokenBlockedEndUsers), endUserId) {
+			abortWithOpenAiMessage(c, http.StatusForbidden, "该终端用户已被禁止访问", types.ErrorCodeAccessDenied)
+			return
+		}
+		// 仅提前拒绝当天额度已用尽的请求；额度的实际占用在预扣费时通过 INCRBY 原子完成，并发请求不会同时越过上限
+		if dailyQuota := common.GetContextKeyInt(c, constant.ContextKeyTokenEndUserDailyQuota); dailyQuota > 0 &&
+			model.GetEndUserDailySpend(tokenId, endUserId) >= dailyQuota {
+			abortWithOpenAiMessage(c, http.StatusTooManyRequests, "当前终端用户今日额度已用尽", types.ErrorCodeInsufficientUserQuota)
+			return
+		}
+		if rpm := common.GetContextKeyInt(c, constant.ContextKeyTokenEndUserRPM); rpm > 0 {
+			var allowed bool
+			if common.RedisEnabled && common.RDB != nil {
+				allowed = redisEndUserRPMLimitHandler(c, tokenId, endUserId, rpm)
+			} else {
+				allowed = memoryEndUserRPMLimitHandler(c, tokenId, endUserId, rpm)
+			}
+			if !allowed {
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newEndUserTestRouter(t *testing.T, token *model.Token) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		require.NoError(t, SetupContextForToken(c, token))
+		c.Next()
+	})
+	router.Use(EndUserLimit())
+	router.POST("/v1/chat/completions", func(c *gin.Context) {
+		c.String(http.StatusOK, common.GetContextKeyString(c, constant.ContextKeyEndUserId))
+	})
+	return router
+}
+
+func doEndUserRequest(router *gin.Engine, body string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestEndUserLimitResolvesEndUserId(t *testing.T) {
+	setting := operation_setting.GetTokenSetting()
+	original := *setting
+	t.Cleanup(func() { *setting = original })
+	setting.EndUserIdHeader = "X-End-User-Id"
+
+	router := newEndUserTestRouter(t, &model.Token{Id: 91001, UserId: 1})
+
+	recorder := doEndUserRequest(router, `{"model":"gpt-4o","user":"alice"}`, nil)
+	assert.Equal(t, "alice", recorder.Body.String())
+	recorder = doEndUserRequest(router, `{"model":"gpt-4o","user":"alice","safety_identifier":"hashed-alice"}`, nil)
+	assert.Equal(t, "hashed-alice", recorder.Body.String())
+	recorder = doEndUserRequest(router, `{"model":"claude","metadata":{"user_id":"bob"}}`, nil)
+	assert.Equal(t, "bob", recorder.Body.String())
+	recorder = doEndUserRequest(router, `{"model":"gpt-4o","user":"alice"}`, map[string]string{"X-End-User-Id": "carol"})
+	assert.Equal(t, "carol", recorder.Body.String())
+	// 非字符串的 user 字段不影响请求
+	recorder = doEndUserRequest(router, `{"model":"gpt-4o","user":{"id":1}}`, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Empty(t, recorder.Body.String())
+}
+
+func TestEndUserLimitEnforcesTokenLimits(t *testing.T) {
+	token := &model.Token{Id: 91002, UserId: 1, EndUserRPM: 1, BlockedEndUsers: "mallory\ntrudy"}
+	router := newEndUserTestRouter(t, token)
+
+	recorder := doEndUserRequest(router, `{"user":"mallory"}`, nil)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	recorder = doEndUserRequest(router, `{"user":"alice"}`, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	recorder = doEndUserRequest(router, `{"user":"alice"}`, nil)
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	// 限流按终端用户分别计数
+	recorder = doEndUserRequest(router, `{"user":"bob"}`, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	// 未携带终端用户标识的请求不受终端用户限制
+	recorder = doEndUserRequest(router, `{}`, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	recorder = doEndUserRequest(router, `{}`, nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
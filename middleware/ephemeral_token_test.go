@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestEphemeralTokenInheritsParentIpLimits(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	oldDB := model.DB
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	model.DB = db
+	redisEnabled := common.RedisEnabled
+	common.RedisEnabled = false
+	t.Cleanup(func() {
+		model.DB = oldDB
+		common.RedisEnabled = redisEnabled
+	})
+	require.NoError(t, db.AutoMigrate(&model.User{}, &model.Token{}))
+
+	user := &model.User{Username: "ip_user", Password: "password", Status: common.UserStatusEnabled, Group: "default", AffCode: "ip01"}
+	require.NoError(t, db.Create(user).Error)
+	allowIps := "10.0.0.1"
+	parent := &model.Token{UserId: user.Id, Key: "ip-parent-key", Name: "ip", Status: common.TokenStatusEnabled,
+		ExpiredTime: -1, UnlimitedQuota: true, AllowIps: &allowIps}
+	require.NoError(t, db.Create(parent).Error)
+
+	router := gin.New()
+	router.POST("/v1/chat/completions", func(c *gin.Context) {
+		ephemeralTokenAuth(c, c.GetHeader("Authorization"))
+	}, func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	request := func(key string, remoteAddr string) int {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("Authorization", key)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	restricted, _, err := model.MintEphemeralToken(parent, 600, nil, 0, "", false)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, request(restricted, "10.0.0.1:4000"))
+	assert.Equal(t, http.StatusForbidden, request(restricted, "192.0.2.7:4000"))
+
+	// 签发时显式放开 IP 限制的临时令牌可从任意 IP 使用
+	anyIp, _, err := model.MintEphemeralToken(parent, 600, nil, 0, "", true)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, request(anyIp, "192.0.2.7:4000"))
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/model"
+)
+
+// managementScopeRule 将路由映射到管理密钥作用域资源，prefix 为 true 时匹配该路径及其子路径
+type managementScopeRule struct {
+	path     string
+	prefix   bool
+	resource string
+}
+
+// managementScopeRules 按路由模板（gin FullPath）匹配，未列出的路由（系统设置、个人账户、
+// 生成 access token、管理密钥自身等）一律拒绝管理密钥访问
+var managementScopeRules = []managementScopeRule{
+	{path: "/api/channel", prefix: true, resource: model.ManagementScopeChannels},
+	{path: "/api/models", prefix: true, resource: model.ManagementScopeModels},
+	{path: "/api/vendors", prefix: true, resource: model.ManagementScopeModels},
+	{path: "/api/group", prefix: true, resource: model.ManagementScopeModels},
+	{path: "/api/prefill_group", prefix: true, resource: model.ManagementScopeModels},
+	{path: "/api/log", prefix: true, resource: model.ManagementScopeLogs},
+	{path: "/api/data", prefix: true, resource: model.ManagementScopeLogs},
+	{path: "/api/token", prefix: true, resource: model.ManagementScopeTokens},
+	{path: "/api/redemption", prefix: true, resource: model.ManagementScopeBilling},
+	{path: "/api/coupon", prefix: true, resource: model.ManagementScopeBilling},
+	{path: "/api/subscription", prefix: true, resource: model.ManagementScopeBilling},
+	{path: "/api/postpaid", prefix: true, resource: model.ManagementScopeBilling},
+	{path: "/api/user/topup", prefix: true, resource: model.ManagementScopeBilling},
+	{path: "/api/user/", resource: model.ManagementScopeUsers},
+	{path: "/api/user/search", resource: model.ManagementScopeUsers},
+	{path: "/api/user/manage", resource: model.ManagementScopeUsers},
+	{path: "/api/user/:id", prefix: true, resource: model.ManagementScopeUsers},
+}
+
+// managementScopeForRoute 返回访问该路由所需的作用域，ok 为 false 表示管理密钥不可访问
+func managementScopeForRoute(method string, fullPath string) (resource string, action string, ok bool) {
+	for _, rule := range managementScopeRules {
+		matched := fullPath == rule.path
+		if !matched && rule.prefix {
+			matched = strings.HasPrefix(fullPath, strings.TrimSuffix(rule.path, "/")+"/")
+		}
+		if !matched {
+			continue
+		}
+		return rule.resource, scopeActionForMethod(method), true
+	}
+	return "", "", false
+}
+
+// scopeActionForMethod 只读请求需要 read 权限，其余需要 write 权限
+func scopeActionForMethod(method string) string {
+	if method == http.MethodGet || method == http.MethodHead {
+		return model.ManagementScopeActionRead
+	}
+	return model.ManagementScopeActionWrite
+}
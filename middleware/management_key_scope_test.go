@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/QuantumNous/new-api/model"
+)
+
+func TestManagementScopeForRoute(t *testing.T) {
+	cases := []struct {
+		method   string
+		path     string
+		resource string
+		action   string
+		ok       bool
+	}{
+		{http.MethodGet, "/api/channel/", model.ManagementScopeChannels, model.ManagementScopeActionRead, true},
+		{http.MethodPut, "/api/channel/", model.ManagementScopeChannels, model.ManagementScopeActionWrite, true},
+		{http.MethodGet, "/api/log/self", model.ManagementScopeLogs, model.ManagementScopeActionRead, true},
+		{http.MethodPost, "/api/token/", model.ManagementScopeTokens, model.ManagementScopeActionWrite, true},
+		{http.MethodGet, "/api/user/topup", model.ManagementScopeBilling, model.ManagementScopeActionRead, true},
+		{http.MethodDelete, "/api/user/:id", model.ManagementScopeUsers, model.ManagementScopeActionWrite, true},
+		{http.MethodGet, "/api/tokenx", "", "", false},
+		{http.MethodGet, "/api/user/token", "", "", false},
+		{http.MethodGet, "/api/user/self", "", "", false},
+		{http.MethodPut, "/api/option/", "", "", false},
+		{http.MethodPost, "/api/management_key/", "", "", false},
+	}
+	for _, tc := range cases {
+		resource, action, ok := managementScopeForRoute(tc.method, tc.path)
+		if ok != tc.ok || resource != tc.resource || action != tc.action {
+			t.Errorf("%s %s: got (%q, %q, %v), want (%q, %q, %v)", tc.method, tc.path, resource, action, ok, tc.resource, tc.action, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	postpaidThrottleDurationSeconds int64 = 60
+	PostpaidThrottleMark                  = "PPTH"
+)
+
+func postpaidThrottledMessage(rpm int) string {
+	return fmt.Sprintf("后付费账单逾期未付，账户已被限流：1分钟内最多请求%d次", rpm)
+}
+
+// PostpaidAccessControl 根据后付费账户的逾期状态限流或拒绝请求
+func PostpaidAccessControl() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId := c.GetInt("id")
+		if userId <= 0 {
+			c.Next()
+			return
+		}
+		account, err := model.GetPostpaidAccountCached(userId)
+		if err != nil {
+			abortWithOpenAiMessage(c, http.StatusInternalServerError, "postpaid_account_lookup_failed")
+			return
+		}
+		if !account.IsActive() {
+			c.Next()
+			return
+		}
+		switch account.Status {
+		case model.PostpaidStatusSuspended:
+			abortWithOpenAiMessage(c, http.StatusForbidden, "后付费账单逾期未付，账户已被暂停使用", types.ErrorCodePostpaidAccountSuspended)
+			return
+		case model.PostpaidStatusThrottled:
+			rpm := operation_setting.GetPostpaidSetting().ThrottledRPM
+			if rpm > 0 && !postpaidThrottleAllow(userId, rpm) {
+				abortWithOpenAiMessage(c, http.StatusTooManyRequests, postpaidThrottledMessage(rpm), types.ErrorCodePostpaidAccountThrottled)
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+func postpaidThrottleAllow(userId int, rpm int) bool {
+	if common.RedisEnabled && common.RDB != nil {
+		ctx := context.Background()
+		key := fmt.Sprintf("rateLimit:%s:user:%d", PostpaidThrottleMark, userId)
+		allowed, err := checkRedisRateLimit(ctx, common.RDB, key, rpm, postpaidThrottleDurationSeconds)
+		if err != nil {
+			// 限流检查失败时放行，避免 Redis 故障导致后付费用户完全不可用
+			return true
+		}
+		if allowed {
+			recordRedisRequest(ctx, common.RDB, key, rpm)
+		}
+		return allowed
+	}
+	inMemoryRateLimiter.Init(common.RateLimitKeyExpirationDuration)
+	key := fmt.Sprintf("%s:user:%d", PostpaidThrottleMark, userId)
+	return inMemoryRateLimiter.Request(key, rpm, postpaidThrottleDurationSeconds)
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ScimAuth 校验 SCIM 请求的 Bearer 凭据：必须是拥有 users 作用域的管理密钥，且所属用户为启用状态的管理员。
+// IdP 无法携带 New-Api-User 等自定义请求头，因此不复用 authHelper；错误按 SCIM 错误格式返回
+func ScimAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		abort := func(status int, detail string) {
+			c.Header("Content-Type", dto.ScimContentType)
+			c.JSON(status, dto.NewScimError(status, "", detail))
+			c.Abort()
+		}
+		key, err := model.ValidateManagementKey(c.GetHeader("Authorization"))
+		if err != nil {
+			abort(http.StatusUnauthorized, err.Error())
+			return
+		}
+		clientIp := c.ClientIP()
+		if allowIps := key.GetIpLimits(); len(allowIps) > 0 {
+			ip := net.ParseIP(clientIp)
+			if ip == nil || !common.IsIpInCIDRList(ip, allowIps) {
+				abort(http.StatusForbidden, "您的 IP 不在管理密钥允许访问的列表中")
+				return
+			}
+		}
+		action := scopeActionForMethod(c.Request.Method)
+		if !key.HasScope(model.ManagementScopeUsers, action) {
+			abort(http.StatusForbidden, fmt.Sprintf("管理密钥缺少 %s:%s 作用域", model.ManagementScopeUsers, action))
+			return
+		}
+		user, err := model.GetUserById(key.UserId, false)
+		if err != nil {
+			abort(http.StatusUnauthorized, "管理密钥所属用户不存在")
+			return
+		}
+		if user.Status != common.UserStatusEnabled || user.Role < common.RoleAdminUser {
+			abort(http.StatusForbidden, "管理密钥所属用户无管理员权限")
+			return
+		}
+		if err := model.TouchManagementKey(key, clientIp); err != nil {
+			common.SysLog(fmt.Sprintf("failed to update management key %d last used time: %s", key.Id, err.Error()))
+		}
+		c.Set("id", user.Id)
+		c.Set("username", user.Username)
+		c.Set("role", user.Role)
+		c.Set("management_key_id", key.Id)
+		c.Next()
+	}
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// checkLoginSession 校验 cookie 会话在服务端是否仍然有效，已吊销时清空 cookie 会话并返回 false。
+// 未登记会话 ID 的旧 cookie 同样视为失效：若为其补登记，被盗用的旧 cookie 每次都会重新登记而无法吊销
+func checkLoginSession(c *gin.Context, session sessions.Session) bool {
+	userId, ok := session.Get("id").(int)
+	if !ok {
+		return false
+	}
+	sid, _ := session.Get("sid").(string)
+	if sid == "" {
+		session.Clear()
+		_ = session.Save()
+		return false
+	}
+	userSession, err := model.ValidateUserSession(sid)
+	if err != nil {
+		if errors.Is(err, model.ErrUserSessionInvalid) {
+			session.Clear()
+			_ = session.Save()
+		} else {
+			common.SysLog("failed to validate login session: " + err.Error())
+		}
+		return false
+	}
+	if userSession.UserId != userId {
+		session.Clear()
+		_ = session.Save()
+		return false
+	}
+	if err := model.TouchUserSession(userSession, c.ClientIP()); err != nil {
+		common.SysLog(fmt.Sprintf("failed to update login session %d last seen time: %s", userSession.Id, err.Error()))
+	}
+	c.Set("session_id", userSession.Id)
+	return true
+}
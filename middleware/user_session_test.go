@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestUserAuthRejectsRevokedSession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	oldDB := model.DB
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open test db: %v", err)
+	}
+	model.DB = db
+	defer func() { model.DB = oldDB }()
+
+	if err := db.AutoMigrate(&model.UserSession{}); err != nil {
+		t.Fatalf("failed to migrate test tables: %v", err)
+	}
+
+	const userId = 7
+	router := gin.New()
+	router.Use(sessions.Sessions("session", cookie.NewStore([]byte("secret"))))
+	router.POST("/login", func(c *gin.Context) {
+		session := sessions.Default(c)
+		session.Set("id", userId)
+		session.Set("username", "alice")
+		session.Set("role", common.RoleCommonUser)
+		session.Set("status", common.UserStatusEnabled)
+		if c.Query("legacy") == "" {
+			sid, _, err := model.CreateUserSession(userId, c.ClientIP(), c.Request.UserAgent())
+			if err != nil {
+				t.Fatalf("failed to create session: %v", err)
+			}
+			session.Set("sid", sid)
+		}
+		_ = session.Save()
+	})
+	router.GET("/api/user/self", UserAuth(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"success": true, "session_id": c.GetInt("session_id")})
+	})
+
+	login := func(target string) []*http.Cookie {
+		req := httptest.NewRequest(http.MethodPost, target, nil)
+		req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 Chrome/126.0 Safari/537.36")
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		return recorder.Result().Cookies()
+	}
+	request := func(cookies []*http.Cookie) (int, map[string]any) {
+		req := httptest.NewRequest(http.MethodGet, "/api/user/self", nil)
+		req.Header.Set("New-Api-User", strconv.Itoa(userId))
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		var body map[string]any
+		_ = json.Unmarshal(recorder.Body.Bytes(), &body)
+		return recorder.Code, body
+	}
+
+	laptop := login("/login")
+	phone := login("/login")
+	if code, body := request(laptop); code != http.StatusOK || body["success"] != true {
+		t.Fatalf("expected registered session to be accepted, got %d %v", code, body)
+	}
+
+	userSessions, err := model.GetUserSessions(userId)
+	if err != nil || len(userSessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d (%v)", len(userSessions), err)
+	}
+	if userSessions[0].Device != "Chrome on macOS" {
+		t.Fatalf("unexpected device %q", userSessions[0].Device)
+	}
+
+	// 吊销除笔记本外的全部会话
+	_, body := request(laptop)
+	laptopSessionId := int(body["session_id"].(float64))
+	if err := model.RevokeUserSessions(userId, laptopSessionId); err != nil {
+		t.Fatalf("failed to revoke sessions: %v", err)
+	}
+	if code, _ := request(phone); code != http.StatusUnauthorized {
+		t.Fatalf("expected revoked session to be rejected, got %d", code)
+	}
+	if code, _ := request(laptop); code != http.StatusOK {
+		t.Fatalf("expected kept session to be accepted, got %d", code)
+	}
+
+	// 未登记会话 ID 的旧 cookie 需要重新登录
+	if code, _ := request(login("/login?legacy=1")); code != http.StatusUnauthorized {
+		t.Fatalf("expected legacy session without sid to be rejected, got %d", code)
+	}
+	if err := model.RevokeUserSessions(userId, 0); err != nil {
+		t.Fatalf("failed to revoke sessions: %v", err)
+	}
+	if code, _ := request(laptop); code != http.StatusUnauthorized {
+		t.Fatalf("expected session to be rejected after revoking all, got %d", code)
+	}
+}
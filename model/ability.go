@@ -7,6 +7,7 @@ import (
 	"sync"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 
 	"github.com/samber/lo"
 	"gorm.io/gorm"
@@ -119,6 +120,9 @@ func GetChannel(group string, model string, retry int) (*Channel, error) {
 	if err != nil {
 		return nil, err
 	}
+	if len(abilities) > 1 && operation_setting.IsPreferCheapestChannelEnabled() {
+		abilities = filterCheapestAbilities(abilities, model)
+	}
 	channel := Channel{}
 	if len(abilities) > 0 {
 		// Randomly choose one
@@ -22,6 +22,7 @@ type Channel struct {
 	Id                 int     `json:"id"`
 	Type               int     `json:"type" gorm:"default:0"`
 	Key                string  `json:"key" gorm:"not null"`
+	KeyDataKey         string  `json:"-" gorm:"column:key_data_key;type:varchar(128);default:''"` // 加密密钥所用的数据密钥（由主密钥包装）
 	OpenAIOrganization *string `json:"openai_organization"`
 	TestModel          *string `json:"test_model"`
 	Status             int     `json:"status" gorm:"default:1"`
@@ -85,7 +86,20 @@ func (channel *Channel) GetKeys() []string {
 	if len(channel.Keys) > 0 {
 		return channel.Keys
 	}
-	trimmed := strings.TrimSpace(channel.Key)
+	key, err := channel.DecryptKey()
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to decrypt key of channel %d: %v", channel.Id, err))
+		return []string{}
+	}
+	return parseChannelKeys(key)
+}
+
+// parseChannelKeys 将明文密钥解析为多 Key 列表
+func parseChannelKeys(key string) []string {
+	if key == "" {
+		return []string{}
+	}
+	trimmed := strings.TrimSpace(key)
 	// If the key starts with '[', try to parse it as a JSON array (e.g., for Vertex AI scenarios)
 	if strings.HasPrefix(trimmed, "[") {
 		var arr []json.RawMessage
@@ -98,14 +112,18 @@ func (channel *Channel) GetKeys() []string {
 		}
 	}
 	// Otherwise, fall back to splitting by newline
-	keys := strings.Split(strings.Trim(channel.Key, "\n"), "\n")
+	keys := strings.Split(strings.Trim(key, "\n"), "\n")
 	return keys
 }
 
 func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 	// If not in multi-key mode, return the original key string directly.
 	if !channel.ChannelInfo.IsMultiKey {
-		return channel.Key, 0, nil
+		key, err := channel.DecryptKey()
+		if err != nil {
+			return "", 0, types.NewError(err, types.ErrorCodeChannelInvalidKey, types.ErrOptionWithSkipRetry())
+		}
+		return key, 0, nil
 	}
 
 	// Obtain all keys (split by \n)
@@ -257,7 +275,7 @@ func (channel *Channel) SaveWithoutKey() error {
 	if channel.Id == 0 {
 		return errors.New("channel ID is 0")
 	}
-	return DB.Omit("key").Save(channel).Error
+	return DB.Omit("key", "key_data_key").Save(channel).Error
 }
 
 func GetAllChannels(startIdx int, num int, selectAll bool, idSort bool) ([]*Channel, error) {
@@ -355,6 +373,17 @@ func GetChannelById(id int, selectAll bool) (*Channel, error) {
 	return channel, nil
 }
 
+// GetEnabledMcpChannel 按服务器标识（渠道名称）查找启用的 MCP 渠道
+func GetEnabledMcpChannel(serverLabel string) (*Channel, error) {
+	channel := &Channel{}
+	err := DB.Where("type = ? AND name = ? AND status = ?", constant.ChannelTypeMCP, serverLabel, common.ChannelStatusEnabled).
+		Order("id desc").First(channel).Error
+	if err != nil {
+		return nil, err
+	}
+	return channel, nil
+}
+
 func BatchInsertChannels(channels []Channel) error {
 	if len(channels) == 0 {
 		return nil
@@ -458,30 +487,13 @@ func (channel *Channel) Insert() error {
 func (channel *Channel) Update() error {
 	// If this is a multi-key channel, recalculate MultiKeySize based on the current key list to avoid inconsistency after editing keys
 	if channel.ChannelInfo.IsMultiKey {
-		var keyStr string
+		var keys []string
 		if channel.Key != "" {
-			keyStr = channel.Key
+			keys = channel.GetKeys()
 		} else {
 			// If key is not provided, read the existing key from the database
 			if existing, err := GetChannelById(channel.Id, true); err == nil {
-				keyStr = existing.Key
-			}
-		}
-		// Parse the key list (supports newline separation or JSON array)
-		keys := []string{}
-		if keyStr != "" {
-			trimmed := strings.TrimSpace(keyStr)
-			if strings.HasPrefix(trimmed, "[") {
-				var arr []json.RawMessage
-				if err := common.Unmarshal([]byte(trimmed), &arr); err == nil {
-					keys = make([]string, len(arr))
-					for i, v := range arr {
-						keys[i] = string(v)
-					}
-				}
-			}
-			if len(keys) == 0 { // fallback to newline split
-				keys = strings.Split(strings.Trim(keyStr, "\n"), "\n")
+				keys = existing.GetKeys()
 			}
 		}
 		channel.ChannelInfo.MultiKeySize = len(keys)
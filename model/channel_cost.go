@@ -0,0 +1,91 @@
+package model
+
+import (
+	"math"
+)
+
+// GetCostRatio 返回渠道针对指定模型的成本倍率（相对于模型标价），
+// 优先使用按模型配置的成本倍率，其次使用渠道统一折扣倍率。
+// 未配置成本时返回 false。
+func (channel *Channel) GetCostRatio(modelName string) (float64, bool) {
+	settings := channel.GetOtherSettings()
+	return settings.GetCostRatio(modelName)
+}
+
+// CalculateChannelUpstreamCost 根据渠道成本设置估算一次请求的上游成本（额度单位）。
+// quota 为实际向用户计费的额度，groupRatio 为计费时使用的分组倍率，
+// 先还原为模型标价再乘以渠道成本倍率。渠道未配置成本时返回 0。
+func CalculateChannelUpstreamCost(channelId int, modelName string, quota int, groupRatio float64) int {
+	if channelId == 0 || quota <= 0 {
+		return 0
+	}
+	channel, err := CacheGetChannel(channelId)
+	if err != nil || channel == nil {
+		return 0
+	}
+	costRatio, ok := channel.GetCostRatio(modelName)
+	if !ok {
+		return 0
+	}
+	if groupRatio <= 0 {
+		groupRatio = 1
+	}
+	return int(math.Round(float64(quota) / groupRatio * costRatio))
+}
+
+// getEffectiveCostRatio 返回渠道用于路由比较的成本倍率，未配置成本的渠道按标价（1）处理
+func getEffectiveCostRatio(channel *Channel, modelName string) float64 {
+	costRatio, ok := channel.GetCostRatio(modelName)
+	if !ok {
+		return 1
+	}
+	return costRatio
+}
+
+// filterCheapestChannels 从同优先级渠道中筛选出成本倍率最低的渠道
+func filterCheapestChannels(channels []*Channel, modelName string) []*Channel {
+	if len(channels) <= 1 {
+		return channels
+	}
+	minRatio := math.MaxFloat64
+	costRatios := make([]float64, len(channels))
+	for i, channel := range channels {
+		costRatios[i] = getEffectiveCostRatio(channel, modelName)
+		if costRatios[i] < minRatio {
+			minRatio = costRatios[i]
+		}
+	}
+	cheapest := make([]*Channel, 0, len(channels))
+	for i, channel := range channels {
+		if costRatios[i] == minRatio {
+			cheapest = append(cheapest, channel)
+		}
+	}
+	return cheapest
+}
+
+// filterCheapestAbilities 在未启用内存缓存时，从同优先级的能力记录中筛选出成本倍率最低的渠道
+func filterCheapestAbilities(abilities []Ability, modelName string) []Ability {
+	channelIds := make([]int, 0, len(abilities))
+	for _, ability := range abilities {
+		channelIds = append(channelIds, ability.ChannelId)
+	}
+	channels, err := GetChannelsByIds(channelIds)
+	if err != nil || len(channels) == 0 {
+		return abilities
+	}
+	cheapestIds := make(map[int]struct{}, len(channels))
+	for _, channel := range filterCheapestChannels(channels, modelName) {
+		cheapestIds[channel.Id] = struct{}{}
+	}
+	filtered := make([]Ability, 0, len(cheapestIds))
+	for _, ability := range abilities {
+		if _, ok := cheapestIds[ability.ChannelId]; ok {
+			filtered = append(filtered, ability)
+		}
+	}
+	if len(filtered) == 0 {
+		return abilities
+	}
+	return filtered
+}
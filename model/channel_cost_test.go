@@ -0,0 +1,84 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCostTestChannel(id int, settings dto.ChannelOtherSettings) *Channel {
+	channel := &Channel{Id: id, Name: "cost-test", Status: common.ChannelStatusEnabled}
+	channel.SetOtherSettings(settings)
+	return channel
+}
+
+func TestChannelGetCostRatio(t *testing.T) {
+	discount := 0.6
+	channel := newCostTestChannel(1, dto.ChannelOtherSettings{
+		CostRatio:       &discount,
+		ModelCostRatios: map[string]float64{"gpt-4o": 0.4},
+	})
+
+	ratio, ok := channel.GetCostRatio("gpt-4o")
+	assert.True(t, ok)
+	assert.Equal(t, 0.4, ratio)
+
+	ratio, ok = channel.GetCostRatio("gpt-4o-mini")
+	assert.True(t, ok)
+	assert.Equal(t, 0.6, ratio)
+
+	_, ok = newCostTestChannel(2, dto.ChannelOtherSettings{}).GetCostRatio("gpt-4o")
+	assert.False(t, ok)
+}
+
+func TestFilterCheapestChannels(t *testing.T) {
+	cheap := 0.3
+	expensive := 0.9
+	channels := []*Channel{
+		newCostTestChannel(1, dto.ChannelOtherSettings{CostRatio: &expensive}),
+		newCostTestChannel(2, dto.ChannelOtherSettings{CostRatio: &cheap}),
+		newCostTestChannel(3, dto.ChannelOtherSettings{}),
+		newCostTestChannel(4, dto.ChannelOtherSettings{ModelCostRatios: map[string]float64{"gpt-4o": 0.3}}),
+	}
+
+	result := filterCheapestChannels(channels, "gpt-4o")
+	require.Len(t, result, 2)
+	assert.Equal(t, 2, result[0].Id)
+	assert.Equal(t, 4, result[1].Id)
+}
+
+func TestGetMarginReportByChannel(t *testing.T) {
+	truncateTables(t)
+
+	logs := []*Log{
+		{Type: LogTypeConsume, ChannelId: 1, ModelName: "gpt-4o", Group: "default", Quota: 1000, UpstreamCost: 600},
+		{Type: LogTypeConsume, ChannelId: 1, ModelName: "gpt-4o", Group: "default", Quota: 500, UpstreamCost: 300},
+		{Type: LogTypeConsume, ChannelId: 2, ModelName: "gpt-4o", Group: "vip", Quota: 200},
+		{Type: LogTypeError, ChannelId: 2, ModelName: "gpt-4o", Group: "vip", Quota: 0},
+	}
+	for _, log := range logs {
+		log.CreatedAt = common.GetTimestamp()
+		require.NoError(t, LOG_DB.Create(log).Error)
+	}
+
+	items, err := GetMarginReport(MarginGroupByChannel, 0, 0, 0, "", "")
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+
+	assert.Equal(t, 1, items[0].ChannelId)
+	assert.EqualValues(t, 2, items[0].Requests)
+	assert.EqualValues(t, 1500, items[0].Revenue)
+	assert.EqualValues(t, 900, items[0].UpstreamCost)
+	assert.EqualValues(t, 600, items[0].Margin)
+	assert.InDelta(t, 0.4, items[0].MarginRate, 1e-9)
+
+	assert.Equal(t, 2, items[1].ChannelId)
+	assert.EqualValues(t, 1, items[1].Requests)
+	assert.EqualValues(t, 200, items[1].Margin)
+
+	_, err = GetMarginReport("token", 0, 0, 0, "", "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,134 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+)
+
+const channelKeyMigrateBatchSize = 100
+
+// BeforeSave 配置了主密钥时，将明文密钥加密后再写入数据库。
+// 不写入 key 列的更新（Omit 或 Select 了其他列）直接跳过，不修改接收者，
+// 避免对缓存中共享的 *Channel 做响应时间、余额等更新时改写其密钥字段
+func (channel *Channel) BeforeSave(tx *gorm.DB) error {
+	if !statementWritesChannelKey(tx.Statement) {
+		return nil
+	}
+	if channel.Key == "" || common.IsEnvelopeCiphertext(channel.Key) || !common.EnvelopeEncryptionEnabled() {
+		return nil
+	}
+	ciphertext, dataKey, err := common.EnvelopeEncrypt(channel.Key)
+	if err != nil {
+		return err
+	}
+	channel.Key = ciphertext
+	channel.KeyDataKey = dataKey
+	channel.Keys = nil
+	return nil
+}
+
+func statementWritesChannelKey(stmt *gorm.Statement) bool {
+	if lo.Contains(stmt.Omits, "key") {
+		return false
+	}
+	if len(stmt.Selects) == 0 {
+		return true
+	}
+	return lo.ContainsBy(stmt.Selects, func(column string) bool {
+		return column == "*" || strings.EqualFold(column, "key")
+	})
+}
+
+// DecryptKey 返回渠道的明文密钥，仅在真正需要使用密钥时调用
+func (channel *Channel) DecryptKey() (string, error) {
+	return common.EnvelopeDecrypt(channel.Key, channel.KeyDataKey)
+}
+
+// UpdateChannelKey 仅更新渠道密钥（如 OAuth 凭据刷新），配置了主密钥时加密存储
+func UpdateChannelKey(channelId int, key string) error {
+	updates := map[string]interface{}{"key": key, "key_data_key": ""}
+	if common.EnvelopeEncryptionEnabled() {
+		ciphertext, dataKey, err := common.EnvelopeEncrypt(key)
+		if err != nil {
+			return err
+		}
+		updates["key"] = ciphertext
+		updates["key_data_key"] = dataKey
+	}
+	return DB.Model(&Channel{}).Where("id = ?", channelId).Updates(updates).Error
+}
+
+// MigrateChannelKeyEncryption 将尚未加密的渠道密钥加密存储，返回迁移的渠道数量
+func MigrateChannelKeyEncryption() (int, error) {
+	if !common.EnvelopeEncryptionEnabled() {
+		return 0, nil
+	}
+	migrated := 0
+	lastId := 0
+	for {
+		var channels []*Channel
+		if err := DB.Select("id", "key", "key_data_key").Where("id > ?", lastId).
+			Order("id asc").Limit(channelKeyMigrateBatchSize).Find(&channels).Error; err != nil {
+			return migrated, err
+		}
+		if len(channels) == 0 {
+			return migrated, nil
+		}
+		for _, channel := range channels {
+			lastId = channel.Id
+			if channel.Key == "" || common.IsEnvelopeCiphertext(channel.Key) {
+				continue
+			}
+			if err := UpdateChannelKey(channel.Id, channel.Key); err != nil {
+				return migrated, fmt.Errorf("failed to encrypt key of channel %d: %w", channel.Id, err)
+			}
+			migrated++
+		}
+	}
+}
+
+// RotateChannelKeyMasterKey 使用当前主密钥重新包装所有渠道的数据密钥，返回更新的渠道数量。
+// 旧主密钥需通过 SECRET_PREVIOUS_MASTER_KEYS 提供；尚未加密的密钥会一并加密。
+func RotateChannelKeyMasterKey() (int, error) {
+	if !common.EnvelopeEncryptionEnabled() {
+		return 0, common.ErrEnvelopeKeyNotConfigured
+	}
+	migrated, err := MigrateChannelKeyEncryption()
+	if err != nil {
+		return migrated, err
+	}
+	rotated := 0
+	lastId := 0
+	for {
+		var channels []*Channel
+		if err := DB.Select("id", "key", "key_data_key").Where("id > ?", lastId).
+			Order("id asc").Limit(channelKeyMigrateBatchSize).Find(&channels).Error; err != nil {
+			return migrated + rotated, err
+		}
+		if len(channels) == 0 {
+			return migrated + rotated, nil
+		}
+		for _, channel := range channels {
+			lastId = channel.Id
+			if !common.IsEnvelopeCiphertext(channel.Key) {
+				continue
+			}
+			dataKey, changed, err := common.RewrapEnvelopeDataKey(channel.KeyDataKey)
+			if err != nil {
+				return migrated + rotated, fmt.Errorf("failed to rewrap data key of channel %d: %w", channel.Id, err)
+			}
+			if !changed {
+				continue
+			}
+			if err := DB.Model(&Channel{}).Where("id = ?", channel.Id).Update("key_data_key", dataKey).Error; err != nil {
+				return migrated + rotated, err
+			}
+			rotated++
+		}
+	}
+}
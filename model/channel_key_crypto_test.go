@@ -0,0 +1,103 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rawChannelKey(t *testing.T, id int) (string, string) {
+	t.Helper()
+	var row struct {
+		Key        string
+		KeyDataKey string
+	}
+	require.NoError(t, DB.Table("channels").Select("key", "key_data_key").Where("id = ?", id).Scan(&row).Error)
+	return row.Key, row.KeyDataKey
+}
+
+func TestChannelKeyEncryptedAtRest(t *testing.T) {
+	truncateTables(t)
+	common.SetEnvelopeMasterKeys("master-one", nil)
+	t.Cleanup(func() { common.SetEnvelopeMasterKeys("", nil) })
+
+	channel := &Channel{Name: "enc", Key: "sk-a\nsk-b", ChannelInfo: ChannelInfo{IsMultiKey: true}}
+	require.NoError(t, DB.Create(channel).Error)
+
+	stored, dataKey := rawChannelKey(t, channel.Id)
+	assert.True(t, common.IsEnvelopeCiphertext(stored))
+	assert.NotEmpty(t, dataKey)
+
+	loaded, err := GetChannelById(channel.Id, true)
+	require.NoError(t, err)
+	assert.True(t, common.IsEnvelopeCiphertext(loaded.Key))
+	assert.Equal(t, []string{"sk-a", "sk-b"}, loaded.GetKeys())
+
+	// 状态更新不应改写密钥或数据密钥
+	loaded.Status = common.ChannelStatusManuallyDisabled
+	require.NoError(t, loaded.SaveWithoutKey())
+	storedAfter, dataKeyAfter := rawChannelKey(t, channel.Id)
+	assert.Equal(t, stored, storedAfter)
+	assert.Equal(t, dataKey, dataKeyAfter)
+}
+
+func TestMigrateAndRotateChannelKeys(t *testing.T) {
+	truncateTables(t)
+	t.Cleanup(func() { common.SetEnvelopeMasterKeys("", nil) })
+
+	// 未配置主密钥时以明文写入
+	common.SetEnvelopeMasterKeys("", nil)
+	channel := &Channel{Name: "legacy", Key: "sk-legacy"}
+	require.NoError(t, DB.Create(channel).Error)
+	stored, _ := rawChannelKey(t, channel.Id)
+	assert.Equal(t, "sk-legacy", stored)
+
+	common.SetEnvelopeMasterKeys("master-one", nil)
+	migrated, err := MigrateChannelKeyEncryption()
+	require.NoError(t, err)
+	assert.Equal(t, 1, migrated)
+	stored, oldDataKey := rawChannelKey(t, channel.Id)
+	assert.True(t, common.IsEnvelopeCiphertext(stored))
+
+	// 轮换：新主密钥 + 旧主密钥仅用于解密
+	common.SetEnvelopeMasterKeys("master-two", []string{"master-one"})
+	rotated, err := RotateChannelKeyMasterKey()
+	require.NoError(t, err)
+	assert.Equal(t, 1, rotated)
+	storedAfter, newDataKey := rawChannelKey(t, channel.Id)
+	assert.Equal(t, stored, storedAfter)
+	assert.NotEqual(t, oldDataKey, newDataKey)
+
+	// 移除旧主密钥后仍可解密
+	common.SetEnvelopeMasterKeys("master-two", nil)
+	loaded, err := GetChannelById(channel.Id, true)
+	require.NoError(t, err)
+	key, _, apiErr := loaded.GetNextEnabledKey()
+	require.Nil(t, apiErr)
+	assert.Equal(t, "sk-legacy", key)
+}
+
+func TestChannelSelectUpdateKeepsCachedKey(t *testing.T) {
+	truncateTables(t)
+	t.Cleanup(func() { common.SetEnvelopeMasterKeys("", nil) })
+
+	common.SetEnvelopeMasterKeys("", nil)
+	channel := &Channel{Name: "cached", Key: "sk-plain"}
+	require.NoError(t, DB.Create(channel).Error)
+
+	// 迁移前缓存中的渠道仍持有明文密钥，只更新响应时间和余额时不应改写它
+	common.SetEnvelopeMasterKeys("master-one", nil)
+	channel.UpdateResponseTime(120)
+	channel.UpdateBalance(3.5)
+	assert.Equal(t, "sk-plain", channel.Key)
+	assert.Empty(t, channel.KeyDataKey)
+	stored, _ := rawChannelKey(t, channel.Id)
+	assert.Equal(t, "sk-plain", stored)
+
+	var saved Channel
+	require.NoError(t, DB.First(&saved, channel.Id).Error)
+	assert.Equal(t, 120, saved.ResponseTime)
+}
@@ -100,7 +100,14 @@ func userCheckinWithTransaction(checkin *Checkin, userId int, quotaAwarded int)
 			return errors.New("签到失败，请稍后重试")
 		}
 
-		// 步骤2: 在事务中增加用户额度
+		// 步骤2: 在事务中增加用户额度，配置了有效期时作为限时额度发放
+		if expireDays := operation_setting.GetCheckinSetting().QuotaExpireDays; expireDays > 0 {
+			expireTime := time.Now().AddDate(0, 0, expireDays).Unix()
+			if _, err := GrantQuotaBucketTx(tx, userId, int64(quotaAwarded), QuotaBucketSourceCheckin, checkin.Id, expireTime); err != nil {
+				return errors.New("签到失败：更新额度出错")
+			}
+			return nil
+		}
 		if err := tx.Model(&User{}).Where("id = ?", userId).
 			Update("quota", gorm.Expr("quota + ?", quotaAwarded)).Error; err != nil {
 			return errors.New("签到失败：更新额度出错")
@@ -129,9 +136,10 @@ func userCheckinWithoutTransaction(checkin *Checkin, userId int, quotaAwarded in
 		return nil, errors.New("签到失败，请稍后重试")
 	}
 
-	// 步骤2: 增加用户额度
+	// 步骤2: 增加用户额度，配置了有效期时作为限时额度发放
 	// 使用 db=true 强制直接写入数据库，不使用批量更新
-	if err := IncreaseUserQuota(userId, quotaAwarded, true); err != nil {
+	expireDays := operation_setting.GetCheckinSetting().QuotaExpireDays
+	if err := GrantExpiringQuota(userId, quotaAwarded, expireDays, QuotaBucketSourceCheckin, checkin.Id); err != nil {
 		// 如果增加额度失败，需要回滚签到记录
 		DB.Delete(checkin)
 		return nil, errors.New("签到失败：更新额度出错")
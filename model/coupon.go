@@ -0,0 +1,484 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	CouponDiscountTypeNone    = "none"    // 不打折，仅赠送额度
+	CouponDiscountTypePercent = "percent" // 百分比折扣，DiscountValue 为折扣百分比（如 20 表示减免 20%）
+	CouponDiscountTypeFixed   = "fixed"   // 固定金额立减，DiscountValue 为减免金额
+)
+
+const (
+	CouponScopeAll          = "all"
+	CouponScopeTopUp        = "topup"
+	CouponScopeSubscription = "subscription"
+)
+
+const (
+	CouponOrderTypeTopUp        = "topup"
+	CouponOrderTypeSubscription = "subscription"
+)
+
+const (
+	CouponRedemptionStatusPending   = "pending"
+	CouponRedemptionStatusSuccess   = "success"
+	CouponRedemptionStatusCancelled = "cancelled"
+)
+
+// couponPendingHoldSeconds 待支付的优惠券占用在该时间内计入使用上限，超时未支付的订单不再占用名额
+const couponPendingHoldSeconds int64 = 2 * 60 * 60
+
+// couponMinPayMoney 使用优惠券后订单的最低支付金额
+const couponMinPayMoney = 0.01
+
+var (
+	ErrCouponNotFound          = errors.New("优惠券不存在")
+	ErrCouponDisabled          = errors.New("优惠券已停用")
+	ErrCouponNotStarted        = errors.New("优惠券尚未生效")
+	ErrCouponExpired           = errors.New("优惠券已过期")
+	ErrCouponScopeMismatch     = errors.New("优惠券不适用于该订单类型")
+	ErrCouponPlanMismatch      = errors.New("优惠券不适用于该套餐")
+	ErrCouponPaymentMismatch   = errors.New("优惠券不适用于该支付方式")
+	ErrCouponMinAmount         = errors.New("订单金额未达到优惠券使用门槛")
+	ErrCouponFirstPurchaseOnly = errors.New("优惠券仅限首次购买使用")
+	ErrCouponUsageExhausted    = errors.New("优惠券已被领完")
+	ErrCouponUserLimitReached  = errors.New("已达到该优惠券的个人使用上限")
+	ErrCouponCodeDuplicated    = errors.New("优惠码已存在")
+)
+
+// Coupon 优惠券定义，可用于充值与订阅下单
+type Coupon struct {
+	Id       int    `json:"id"`
+	Code     string `json:"code" gorm:"type:varchar(64);uniqueIndex"`
+	Name     string `json:"name" gorm:"type:varchar(128);default:''"`
+	Campaign string `json:"campaign" gorm:"type:varchar(64);index;default:''"` // 所属活动，用于统计
+
+	DiscountType  string  `json:"discount_type" gorm:"type:varchar(16);not null;default:'none'"`
+	DiscountValue float64 `json:"discount_value" gorm:"not null;default:0"`
+	BonusQuota    int64   `json:"bonus_quota" gorm:"type:bigint;not null;default:0"` // 充值成功后额外赠送的额度
+
+	Scope          string  `json:"scope" gorm:"type:varchar(16);not null;default:'all'"`
+	PlanId         int     `json:"plan_id" gorm:"type:int;default:0"`                   // 限定订阅套餐（0 = 不限）
+	PaymentMethods string  `json:"payment_methods" gorm:"type:varchar(255);default:''"` // 限定支付方式，逗号分隔（空 = 不限）
+	MinAmount      float64 `json:"min_amount" gorm:"not null;default:0"`
+
+	FirstPurchaseOnly bool  `json:"first_purchase_only" gorm:"default:false"`
+	StartTime         int64 `json:"start_time" gorm:"type:bigint;default:0"` // 0 = 立即生效
+	EndTime           int64 `json:"end_time" gorm:"type:bigint;default:0"`   // 0 = 永不过期
+
+	MaxUses        int `json:"max_uses" gorm:"type:int;default:0"`          // 全局使用上限（0 = 不限）
+	MaxUsesPerUser int `json:"max_uses_per_user" gorm:"type:int;default:0"` // 每用户使用上限（0 = 不限）
+	UsedCount      int `json:"used_count" gorm:"type:int;default:0"`
+
+	// Creem 不支持按订单动态改价，需要在 Creem 后台配置对应的折扣码
+	CreemDiscountCode string `json:"creem_discount_code" gorm:"type:varchar(64);default:''"`
+
+	Enabled   bool  `json:"enabled" gorm:"default:true"`
+	CreatedAt int64 `json:"created_at" gorm:"bigint"`
+	UpdatedAt int64 `json:"updated_at" gorm:"bigint"`
+}
+
+func (coupon *Coupon) BeforeCreate(tx *gorm.DB) error {
+	now := common.GetTimestamp()
+	coupon.CreatedAt = now
+	coupon.UpdatedAt = now
+	return nil
+}
+
+func (coupon *Coupon) BeforeUpdate(tx *gorm.DB) error {
+	coupon.UpdatedAt = common.GetTimestamp()
+	return nil
+}
+
+// HasPriceDiscount 返回优惠券是否会减免支付金额
+func (coupon *Coupon) HasPriceDiscount() bool {
+	return coupon.DiscountType != CouponDiscountTypeNone && coupon.DiscountType != "" && coupon.DiscountValue > 0
+}
+
+func (coupon *Coupon) allowsPaymentMethod(paymentMethod string) bool {
+	if strings.TrimSpace(coupon.PaymentMethods) == "" {
+		return true
+	}
+	for _, method := range strings.Split(coupon.PaymentMethods, ",") {
+		if strings.TrimSpace(method) == paymentMethod {
+			return true
+		}
+	}
+	return false
+}
+
+// CouponRedemption 优惠券核销记录，下单时以 pending 状态占用，支付成功后标记为 success
+type CouponRedemption struct {
+	Id            int     `json:"id"`
+	CouponId      int     `json:"coupon_id" gorm:"index"`
+	Code          string  `json:"code" gorm:"type:varchar(64)"`
+	Campaign      string  `json:"campaign" gorm:"type:varchar(64);index;default:''"`
+	UserId        int     `json:"user_id" gorm:"index"`
+	TradeNo       string  `json:"trade_no" gorm:"type:varchar(255);uniqueIndex"`
+	OrderType     string  `json:"order_type" gorm:"type:varchar(16)"`
+	PlanId        int     `json:"plan_id" gorm:"type:int;default:0"`
+	PaymentMethod string  `json:"payment_method" gorm:"type:varchar(50)"`
+	OriginalMoney float64 `json:"original_money"`
+	DiscountMoney float64 `json:"discount_money"`
+	FinalMoney    float64 `json:"final_money"`
+	BonusQuota    int64   `json:"bonus_quota" gorm:"type:bigint;default:0"`
+	Status        string  `json:"status" gorm:"type:varchar(16);index"`
+	CreateTime    int64   `json:"create_time" gorm:"bigint"`
+	CompleteTime  int64   `json:"complete_time" gorm:"bigint"`
+}
+
+// CouponOrder 描述一次待使用优惠券的下单请求
+type CouponOrder struct {
+	UserId        int
+	OrderType     string
+	PlanId        int
+	PaymentMethod string
+	Money         float64 // 优惠前的支付金额
+}
+
+// CouponQuote 优惠券试算结果
+type CouponQuote struct {
+	Coupon        *Coupon `json:"-"`
+	Code          string  `json:"code"`
+	OriginalMoney float64 `json:"original_money"`
+	DiscountMoney float64 `json:"discount_money"`
+	FinalMoney    float64 `json:"final_money"`
+	BonusQuota    int64   `json:"bonus_quota"`
+}
+
+// DiscountPercent 返回减免金额占原价的百分比，用于只支持百分比折扣的支付渠道
+func (q *CouponQuote) DiscountPercent() float64 {
+	if q == nil || q.OriginalMoney <= 0 || q.DiscountMoney <= 0 {
+		return 0
+	}
+	return math.Round(q.DiscountMoney/q.OriginalMoney*10000) / 100
+}
+
+func normalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func roundMoney(money float64) float64 {
+	return math.Round(money*100) / 100
+}
+
+func GetCouponById(id int) (*Coupon, error) {
+	var coupon Coupon
+	if err := DB.First(&coupon, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+func GetCouponByCode(code string) (*Coupon, error) {
+	code = normalizeCouponCode(code)
+	if code == "" {
+		return nil, ErrCouponNotFound
+	}
+	var coupon Coupon
+	if err := DB.Where("code = ?", code).First(&coupon).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCouponNotFound
+		}
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+func GetAllCoupons(keyword string, startIdx int, num int) (coupons []*Coupon, total int64, err error) {
+	query := DB.Model(&Coupon{})
+	if keyword != "" {
+		like := "%" + keyword + "%"
+		query = query.Where("code LIKE ? OR name LIKE ? OR campaign LIKE ?", like, like, like)
+	}
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("id desc").Limit(num).Offset(startIdx).Find(&coupons).Error
+	return coupons, total, err
+}
+
+func (coupon *Coupon) Insert() error {
+	coupon.Code = normalizeCouponCode(coupon.Code)
+	var count int64
+	if err := DB.Model(&Coupon{}).Where("code = ?", coupon.Code).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrCouponCodeDuplicated
+	}
+	return DB.Create(coupon).Error
+}
+
+// Update 更新优惠券配置，不覆盖已使用次数
+func (coupon *Coupon) Update() error {
+	return DB.Model(coupon).Select(
+		"name", "campaign", "discount_type", "discount_value", "bonus_quota", "scope", "plan_id",
+		"payment_methods", "min_amount", "first_purchase_only", "start_time", "end_time",
+		"max_uses", "max_uses_per_user", "creem_discount_code", "enabled",
+	).Updates(coupon).Error
+}
+
+func DeleteCouponById(id int) error {
+	return DB.Delete(&Coupon{}, "id = ?", id).Error
+}
+
+// ValidateCoupon 校验 coupon 规则（有效期、适用范围、门槛）
+func ValidateCoupon(coupon *Coupon, order CouponOrder) error {
+	if coupon == nil {
+		return ErrCouponNotFound
+	}
+	if !coupon.Enabled {
+		return ErrCouponDisabled
+	}
+	now := common.GetTimestamp()
+	if coupon.StartTime > 0 && now < coupon.StartTime {
+		return ErrCouponNotStarted
+	}
+	if coupon.EndTime > 0 && now > coupon.EndTime {
+		return ErrCouponExpired
+	}
+	switch coupon.Scope {
+	case CouponScopeTopUp, CouponScopeSubscription:
+		if coupon.Scope != order.OrderType {
+			return ErrCouponScopeMismatch
+		}
+	}
+	if coupon.PlanId > 0 && (order.OrderType != CouponOrderTypeSubscription || order.PlanId != coupon.PlanId) {
+		return ErrCouponPlanMismatch
+	}
+	if !coupon.allowsPaymentMethod(order.PaymentMethod) {
+		return ErrCouponPaymentMismatch
+	}
+	if coupon.MinAmount > 0 && order.Money < coupon.MinAmount {
+		return ErrCouponMinAmount
+	}
+	return nil
+}
+
+// QuoteCoupon 计算优惠券对订单的优惠金额，不校验使用次数
+func QuoteCoupon(coupon *Coupon, order CouponOrder) *CouponQuote {
+	quote := &CouponQuote{
+		Coupon:        coupon,
+		Code:          coupon.Code,
+		OriginalMoney: order.Money,
+		FinalMoney:    order.Money,
+	}
+	discount := 0.0
+	switch coupon.DiscountType {
+	case CouponDiscountTypePercent:
+		discount = order.Money * math.Min(coupon.DiscountValue, 100) / 100
+	case CouponDiscountTypeFixed:
+		discount = coupon.DiscountValue
+	}
+	discount = roundMoney(discount)
+	if maxDiscount := roundMoney(order.Money - couponMinPayMoney); discount > maxDiscount {
+		discount = math.Max(maxDiscount, 0)
+	}
+	quote.DiscountMoney = discount
+	quote.FinalMoney = roundMoney(order.Money - discount)
+	if order.OrderType == CouponOrderTypeTopUp {
+		quote.BonusQuota = coupon.BonusQuota
+	}
+	return quote
+}
+
+func checkCouponUsageTx(tx *gorm.DB, coupon *Coupon, userId int) error {
+	holdSince := common.GetTimestamp() - couponPendingHoldSeconds
+	activeQuery := func() *gorm.DB {
+		return tx.Model(&CouponRedemption{}).Where("coupon_id = ?", coupon.Id).
+			Where("status = ? OR (status = ? AND create_time >= ?)", CouponRedemptionStatusSuccess, CouponRedemptionStatusPending, holdSince)
+	}
+	if coupon.MaxUses > 0 {
+		var used int64
+		if err := activeQuery().Count(&used).Error; err != nil {
+			return err
+		}
+		if used >= int64(coupon.MaxUses) {
+			return ErrCouponUsageExhausted
+		}
+	}
+	if coupon.MaxUsesPerUser > 0 {
+		var used int64
+		if err := activeQuery().Where("user_id = ?", userId).Count(&used).Error; err != nil {
+			return err
+		}
+		if used >= int64(coupon.MaxUsesPerUser) {
+			return ErrCouponUserLimitReached
+		}
+	}
+	if coupon.FirstPurchaseOnly {
+		// 充值与订阅购买都算作已付费
+		var paid int64
+		if err := tx.Model(&TopUp{}).Where("user_id = ? AND status = ?", userId, common.TopUpStatusSuccess).Count(&paid).Error; err != nil {
+			return err
+		}
+		if paid == 0 {
+			if err := tx.Model(&SubscriptionOrder{}).Where("user_id = ? AND status = ?", userId, common.TopUpStatusSuccess).Count(&paid).Error; err != nil {
+				return err
+			}
+		}
+		if paid > 0 {
+			return ErrCouponFirstPurchaseOnly
+		}
+	}
+	return nil
+}
+
+// PrepareCoupon 根据优惠码校验并试算订单优惠，code 为空时返回 nil
+func PrepareCoupon(code string, order CouponOrder) (*CouponQuote, error) {
+	if strings.TrimSpace(code) == "" {
+		return nil, nil
+	}
+	coupon, err := GetCouponByCode(code)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateCoupon(coupon, order); err != nil {
+		return nil, err
+	}
+	if err := checkCouponUsageTx(DB, coupon, order.UserId); err != nil {
+		return nil, err
+	}
+	return QuoteCoupon(coupon, order), nil
+}
+
+// ReserveCoupon 为订单占用优惠券名额，在行锁内复核使用上限，避免并发超发
+func ReserveCoupon(quote *CouponQuote, order CouponOrder, tradeNo string) error {
+	if quote == nil || quote.Coupon == nil {
+		return nil
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var coupon Coupon
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", quote.Coupon.Id).First(&coupon).Error; err != nil {
+			return ErrCouponNotFound
+		}
+		if err := checkCouponUsageTx(tx, &coupon, order.UserId); err != nil {
+			return err
+		}
+		redemption := &CouponRedemption{
+			CouponId:      coupon.Id,
+			Code:          coupon.Code,
+			Campaign:      coupon.Campaign,
+			UserId:        order.UserId,
+			TradeNo:       tradeNo,
+			OrderType:     order.OrderType,
+			PlanId:        order.PlanId,
+			PaymentMethod: order.PaymentMethod,
+			OriginalMoney: quote.OriginalMoney,
+			DiscountMoney: quote.DiscountMoney,
+			FinalMoney:    quote.FinalMoney,
+			BonusQuota:    quote.BonusQuota,
+			Status:        CouponRedemptionStatusPending,
+			CreateTime:    common.GetTimestamp(),
+		}
+		return tx.Create(redemption).Error
+	})
+}
+
+// completeCouponRedemptionTx 在订单支付成功的事务中核销优惠券并发放赠送额度，返回核销记录（无优惠券时为 nil）
+func completeCouponRedemptionTx(tx *gorm.DB, tradeNo string) (*CouponRedemption, error) {
+	var redemption CouponRedemption
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("trade_no = ?", tradeNo).First(&redemption).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	// 支付已完成时即使占用已取消也照常核销，保证用户拿到下单时承诺的优惠
+	if redemption.Status == CouponRedemptionStatusSuccess {
+		return nil, nil
+	}
+	// 带状态条件更新，同一订单的回调并发到达时只核销一次
+	result := tx.Model(&redemption).Where("status <> ?", CouponRedemptionStatusSuccess).
+		Updates(map[string]interface{}{"status": CouponRedemptionStatusSuccess, "complete_time": common.GetTimestamp()})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	redemption.Status = CouponRedemptionStatusSuccess
+	if err := tx.Model(&Coupon{}).Where("id = ?", redemption.CouponId).
+		Update("used_count", gorm.Expr("used_count + ?", 1)).Error; err != nil {
+		return nil, err
+	}
+	if redemption.BonusQuota > 0 {
+		if err := tx.Model(&User{}).Where("id = ?", redemption.UserId).
+			Update("quota", gorm.Expr("quota + ?", redemption.BonusQuota)).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &redemption, nil
+}
+
+// cancelCouponRedemptionTx 释放未支付订单占用的优惠券名额
+func cancelCouponRedemptionTx(tx *gorm.DB, tradeNo string) error {
+	return tx.Model(&CouponRedemption{}).
+		Where("trade_no = ? AND status = ?", tradeNo, CouponRedemptionStatusPending).
+		Update("status", CouponRedemptionStatusCancelled).Error
+}
+
+func CancelCouponRedemption(tradeNo string) error {
+	return cancelCouponRedemptionTx(DB, tradeNo)
+}
+
+// finishCouponRedemption 核销事务提交后同步用户额度缓存并记录赠送日志
+func finishCouponRedemption(redemption *CouponRedemption) {
+	if redemption == nil || redemption.BonusQuota <= 0 {
+		return
+	}
+	if err := cacheIncrUserQuota(redemption.UserId, redemption.BonusQuota); err != nil {
+		common.SysLog(fmt.Sprintf("failed to update user quota cache after coupon bonus: user_id=%d, error=%v", redemption.UserId, err))
+	}
+	RecordLog(redemption.UserId, LogTypeTopup, fmt.Sprintf("优惠券 %s 赠送额度: %s", redemption.Code, logger.LogQuota(int(redemption.BonusQuota))))
+}
+
+func GetCouponRedemptions(couponId int, startIdx int, num int) (redemptions []*CouponRedemption, total int64, err error) {
+	query := DB.Model(&CouponRedemption{}).Where("coupon_id = ?", couponId)
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("id desc").Limit(num).Offset(startIdx).Find(&redemptions).Error
+	return redemptions, total, err
+}
+
+// CouponCampaignReportItem 活动维度的优惠券核销统计
+type CouponCampaignReportItem struct {
+	Campaign      string  `json:"campaign"`
+	Redemptions   int64   `json:"redemptions"`
+	Users         int64   `json:"users"`
+	OriginalMoney float64 `json:"original_money"`
+	DiscountMoney float64 `json:"discount_money"`
+	FinalMoney    float64 `json:"final_money"`
+	BonusQuota    int64   `json:"bonus_quota"`
+}
+
+// GetCouponCampaignReport 统计时间范围内已支付的优惠券核销情况，按活动分组
+func GetCouponCampaignReport(startTime int64, endTime int64) (items []*CouponCampaignReportItem, err error) {
+	query := DB.Model(&CouponRedemption{}).
+		Select("campaign, count(*) as redemptions, count(distinct user_id) as users, "+
+			"sum(original_money) as original_money, sum(discount_money) as discount_money, "+
+			"sum(final_money) as final_money, sum(bonus_quota) as bonus_quota").
+		Where("status = ?", CouponRedemptionStatusSuccess)
+	if startTime > 0 {
+		query = query.Where("complete_time >= ?", startTime)
+	}
+	if endTime > 0 {
+		query = query.Where("complete_time <= ?", endTime)
+	}
+	err = query.Group("campaign").Order("redemptions desc").Scan(&items).Error
+	return items, err
+}
@@ -0,0 +1,199 @@
+package model
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupCouponTest(t *testing.T) *User {
+	t.Helper()
+	truncateTables(t)
+	require.NoError(t, DB.AutoMigrate(&Coupon{}, &CouponRedemption{}))
+	t.Cleanup(func() {
+		DB.Exec("DELETE FROM coupons")
+		DB.Exec("DELETE FROM coupon_redemptions")
+	})
+	user := &User{Username: "coupon_user", Password: "password", Quota: 0, AffCode: "cp01"}
+	require.NoError(t, DB.Create(user).Error)
+	return user
+}
+
+func TestQuoteCouponDiscounts(t *testing.T) {
+	order := CouponOrder{OrderType: CouponOrderTypeTopUp, Money: 50}
+
+	quote := QuoteCoupon(&Coupon{Code: "P20", DiscountType: CouponDiscountTypePercent, DiscountValue: 20, BonusQuota: 100}, order)
+	assert.Equal(t, 10.0, quote.DiscountMoney)
+	assert.Equal(t, 40.0, quote.FinalMoney)
+	assert.EqualValues(t, 100, quote.BonusQuota)
+	assert.Equal(t, 20.0, quote.DiscountPercent())
+
+	// 固定减免超过订单金额时保留最低支付金额
+	quote = QuoteCoupon(&Coupon{Code: "F100", DiscountType: CouponDiscountTypeFixed, DiscountValue: 100}, order)
+	assert.Equal(t, 0.01, quote.FinalMoney)
+
+	// 订阅订单不发放赠送额度
+	quote = QuoteCoupon(&Coupon{Code: "B", BonusQuota: 100}, CouponOrder{OrderType: CouponOrderTypeSubscription, Money: 10})
+	assert.EqualValues(t, 0, quote.BonusQuota)
+	assert.Equal(t, 10.0, quote.FinalMoney)
+}
+
+func TestCouponRestrictions(t *testing.T) {
+	now := common.GetTimestamp()
+	coupon := &Coupon{
+		Code:           "PLAN",
+		Enabled:        true,
+		Scope:          CouponScopeSubscription,
+		PlanId:         7,
+		PaymentMethods: "alipay, stripe",
+		MinAmount:      10,
+		EndTime:        now + 3600,
+	}
+	order := CouponOrder{OrderType: CouponOrderTypeSubscription, PlanId: 7, PaymentMethod: "stripe", Money: 20}
+	assert.NoError(t, ValidateCoupon(coupon, order))
+
+	topUp := order
+	topUp.OrderType = CouponOrderTypeTopUp
+	assert.ErrorIs(t, ValidateCoupon(coupon, topUp), ErrCouponScopeMismatch)
+
+	otherPlan := order
+	otherPlan.PlanId = 8
+	assert.ErrorIs(t, ValidateCoupon(coupon, otherPlan), ErrCouponPlanMismatch)
+
+	otherMethod := order
+	otherMethod.PaymentMethod = "wxpay"
+	assert.ErrorIs(t, ValidateCoupon(coupon, otherMethod), ErrCouponPaymentMismatch)
+
+	cheap := order
+	cheap.Money = 5
+	assert.ErrorIs(t, ValidateCoupon(coupon, cheap), ErrCouponMinAmount)
+
+	coupon.EndTime = now - 1
+	assert.ErrorIs(t, ValidateCoupon(coupon, order), ErrCouponExpired)
+}
+
+func TestCouponRedemptionLifecycle(t *testing.T) {
+	user := setupCouponTest(t)
+	coupon := &Coupon{
+		Code:              "welcome",
+		Campaign:          "launch",
+		DiscountType:      CouponDiscountTypePercent,
+		DiscountValue:     10,
+		BonusQuota:        1000,
+		Scope:             CouponScopeTopUp,
+		FirstPurchaseOnly: true,
+		MaxUsesPerUser:    1,
+		Enabled:           true,
+	}
+	require.NoError(t, coupon.Insert())
+	assert.Equal(t, "WELCOME", coupon.Code)
+
+	order := CouponOrder{UserId: user.Id, OrderType: CouponOrderTypeTopUp, PaymentMethod: PaymentMethodWaffo, Money: 10}
+	quote, err := PrepareCoupon("welcome", order)
+	require.NoError(t, err)
+	assert.Equal(t, 9.0, quote.FinalMoney)
+
+	tradeNo := "coupon-trade-1"
+	require.NoError(t, ReserveCoupon(quote, order, tradeNo))
+	require.NoError(t, DB.Create(&TopUp{
+		UserId:        user.Id,
+		Amount:        1,
+		Money:         quote.FinalMoney,
+		TradeNo:       tradeNo,
+		PaymentMethod: PaymentMethodWaffo,
+		Status:        common.TopUpStatusPending,
+	}).Error)
+
+	// 待支付订单占用个人名额
+	_, err = PrepareCoupon("welcome", order)
+	assert.ErrorIs(t, err, ErrCouponUserLimitReached)
+
+	require.NoError(t, RechargeWaffo(tradeNo, "127.0.0.1"))
+
+	quota, err := GetUserQuota(user.Id, true)
+	require.NoError(t, err)
+	assert.EqualValues(t, int(common.QuotaPerUnit)+1000, quota)
+
+	saved, err := GetCouponById(coupon.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 1, saved.UsedCount)
+
+	report, err := GetCouponCampaignReport(0, 0)
+	require.NoError(t, err)
+	require.Len(t, report, 1)
+	assert.Equal(t, "launch", report[0].Campaign)
+	assert.EqualValues(t, 1, report[0].Redemptions)
+	assert.InDelta(t, 1.0, report[0].DiscountMoney, 0.001)
+
+	// 已有成功充值记录，首购券不可再用
+	require.NoError(t, DB.Model(&Coupon{}).Where("id = ?", coupon.Id).Update("max_uses_per_user", 0).Error)
+	_, err = PrepareCoupon("welcome", order)
+	assert.ErrorIs(t, err, ErrCouponFirstPurchaseOnly)
+}
+
+func TestCancelCouponRedemptionReleasesQuota(t *testing.T) {
+	user := setupCouponTest(t)
+	coupon := &Coupon{Code: "ONCE", BonusQuota: 10, MaxUses: 1, Enabled: true, Scope: CouponScopeAll}
+	require.NoError(t, coupon.Insert())
+
+	order := CouponOrder{UserId: user.Id, OrderType: CouponOrderTypeTopUp, Money: 5}
+	quote, err := PrepareCoupon("ONCE", order)
+	require.NoError(t, err)
+	require.NoError(t, ReserveCoupon(quote, order, "coupon-trade-2"))
+
+	_, err = PrepareCoupon("ONCE", order)
+	assert.ErrorIs(t, err, ErrCouponUsageExhausted)
+
+	require.NoError(t, CancelCouponRedemption("coupon-trade-2"))
+	_, err = PrepareCoupon("ONCE", order)
+	assert.NoError(t, err)
+}
+
+func TestReserveCouponConcurrent(t *testing.T) {
+	user := setupCouponTest(t)
+	coupon := &Coupon{Code: "RUSH", BonusQuota: 10, MaxUses: 3, Enabled: true, Scope: CouponScopeAll}
+	require.NoError(t, coupon.Insert())
+
+	order := CouponOrder{UserId: user.Id, OrderType: CouponOrderTypeTopUp, Money: 5}
+	quote, err := PrepareCoupon("RUSH", order)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	var reserved atomic.Int32
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := ReserveCoupon(quote, order, fmt.Sprintf("coupon-rush-%d", i)); err == nil {
+				reserved.Add(1)
+			} else {
+				assert.ErrorIs(t, err, ErrCouponUsageExhausted)
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.EqualValues(t, 3, reserved.Load())
+
+	var count int64
+	require.NoError(t, DB.Model(&CouponRedemption{}).Where("coupon_id = ?", coupon.Id).Count(&count).Error)
+	assert.EqualValues(t, 3, count)
+}
+
+func TestFirstPurchaseCouponRejectsSubscriptionBuyer(t *testing.T) {
+	user := setupCouponTest(t)
+	require.NoError(t, (&Coupon{Code: "FIRST", DiscountType: CouponDiscountTypePercent, DiscountValue: 10, FirstPurchaseOnly: true, Enabled: true, Scope: CouponScopeAll}).Insert())
+
+	order := CouponOrder{UserId: user.Id, OrderType: CouponOrderTypeTopUp, Money: 10}
+	_, err := PrepareCoupon("FIRST", order)
+	require.NoError(t, err)
+
+	require.NoError(t, DB.Create(&SubscriptionOrder{UserId: user.Id, PlanId: 1, Money: 5, TradeNo: "sub-paid-1", Status: common.TopUpStatusSuccess}).Error)
+	_, err = PrepareCoupon("FIRST", order)
+	assert.ErrorIs(t, err, ErrCouponFirstPurchaseOnly)
+}
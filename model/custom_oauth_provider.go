@@ -36,6 +36,12 @@ var supportedAccessPolicyOps = map[string]struct{}{
 	"not_exists":   {},
 }
 
+// Custom provider protocols
+const (
+	CustomOAuthProtocolOAuth2 = "oauth2"
+	CustomOAuthProtocolSAML   = "saml"
+)
+
 // CustomOAuthProvider stores configuration for custom OAuth providers
 type CustomOAuthProvider struct {
 	Id                    int    `json:"id" gorm:"primaryKey"`
@@ -62,6 +68,13 @@ type CustomOAuthProvider struct {
 	AccessPolicy        string `json:"access_policy" gorm:"type:text"`                 // JSON policy for access control based on user info
 	AccessDeniedMessage string `json:"access_denied_message" gorm:"type:varchar(512)"` // Custom error message template when access is denied
 
+	// SAML 2.0 options (only used when Protocol is "saml")
+	Protocol           string `json:"protocol" gorm:"type:varchar(16);default:'oauth2'"` // "oauth2" or "saml"
+	SamlIdpMetadataUrl string `json:"saml_idp_metadata_url" gorm:"type:varchar(512)"`    // IdP metadata URL (fetched when metadata XML is empty)
+	SamlIdpMetadata    string `json:"saml_idp_metadata" gorm:"type:text"`                // IdP metadata XML, including signing certificates
+	SamlGroupField     string `json:"saml_group_field" gorm:"type:varchar(128)"`         // Attribute mapped to the user group
+	SamlDefaultGroup   string `json:"saml_default_group" gorm:"type:varchar(64)"`        // Group for just-in-time provisioned users
+
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -70,6 +83,11 @@ func (CustomOAuthProvider) TableName() string {
 	return "custom_oauth_providers"
 }
 
+// IsSAML returns true if the provider uses SAML 2.0 instead of OAuth2/OIDC
+func (p *CustomOAuthProvider) IsSAML() bool {
+	return p.Protocol == CustomOAuthProtocolSAML
+}
+
 // GetAllCustomOAuthProviders returns all custom OAuth providers
 func GetAllCustomOAuthProviders() ([]*CustomOAuthProvider, error) {
 	var providers []*CustomOAuthProvider
@@ -162,6 +180,11 @@ func validateCustomOAuthProvider(provider *CustomOAuthProvider) error {
 	}
 	provider.Slug = slug
 
+	if provider.IsSAML() {
+		return validateSAMLProvider(provider)
+	}
+	provider.Protocol = CustomOAuthProtocolOAuth2
+
 	if provider.ClientId == "" {
 		return errors.New("client ID is required")
 	}
@@ -204,6 +227,36 @@ func validateCustomOAuthProvider(provider *CustomOAuthProvider) error {
 	return nil
 }
 
+// validateSAMLProvider validates SAML specific fields; IdP metadata must already be resolved to XML
+func validateSAMLProvider(provider *CustomOAuthProvider) error {
+	if strings.TrimSpace(provider.SamlIdpMetadata) == "" {
+		return errors.New("SAML IdP metadata is required")
+	}
+	// Attribute names; "NameID" refers to the subject NameID of the assertion
+	if provider.UserIdField == "" {
+		provider.UserIdField = "NameID"
+	}
+	if provider.UsernameField == "" {
+		provider.UsernameField = "uid"
+	}
+	if provider.DisplayNameField == "" {
+		provider.DisplayNameField = "displayName"
+	}
+	if provider.EmailField == "" {
+		provider.EmailField = "email"
+	}
+	if strings.TrimSpace(provider.AccessPolicy) != "" {
+		var policy accessPolicyPayload
+		if err := common.UnmarshalJsonStr(provider.AccessPolicy, &policy); err != nil {
+			return errors.New("access_policy must be valid JSON")
+		}
+		if err := validateAccessPolicyPayload(&policy); err != nil {
+			return fmt.Errorf("access_policy is invalid: %w", err)
+		}
+	}
+	return nil
+}
+
 func validateAccessPolicyPayload(policy *accessPolicyPayload) error {
 	if policy == nil {
 		return errors.New("policy is nil")
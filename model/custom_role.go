@@ -0,0 +1,137 @@
+package model
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+// 自定义角色：为普通用户授予部分管理权限（如客服、财务、运维），
+// 权限格式与管理密钥作用域一致（<资源>:<read|write>），管理员与超级管理员不受其限制
+
+var (
+	ErrCustomRoleNameEmpty = errors.New("角色名称不能为空")
+	ErrCustomRoleNotFound  = errors.New("角色不存在")
+)
+
+type CustomRole struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name" gorm:"type:varchar(64);uniqueIndex"`
+	Description string `json:"description" gorm:"type:varchar(255)"`
+	Permissions string `json:"permissions" gorm:"type:varchar(512)"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime int64  `json:"updated_time" gorm:"bigint"`
+}
+
+func (role *CustomRole) BeforeCreate(tx *gorm.DB) error {
+	now := common.GetTimestamp()
+	if role.CreatedTime == 0 {
+		role.CreatedTime = now
+	}
+	role.UpdatedTime = now
+	return nil
+}
+
+// GetPermissions 返回角色的权限列表
+func (role *CustomRole) GetPermissions() []string {
+	if role.Permissions == "" {
+		return []string{}
+	}
+	return strings.Split(role.Permissions, ",")
+}
+
+// HasPermission 判断角色是否拥有资源的指定权限，write 权限包含 read
+func (role *CustomRole) HasPermission(resource string, action string) bool {
+	key := ManagementKey{Scopes: role.Permissions}
+	return key.HasScope(resource, action)
+}
+
+// Normalize 校验名称并规范化权限列表
+func (role *CustomRole) Normalize(permissions []string) error {
+	role.Name = strings.TrimSpace(role.Name)
+	if role.Name == "" {
+		return ErrCustomRoleNameEmpty
+	}
+	normalized, err := NormalizeManagementScopes(permissions)
+	if err != nil {
+		return err
+	}
+	role.Permissions = normalized
+	return nil
+}
+
+func (role *CustomRole) Insert() error {
+	return DB.Create(role).Error
+}
+
+func (role *CustomRole) Update() error {
+	role.UpdatedTime = common.GetTimestamp()
+	return DB.Model(role).Select("name", "description", "permissions", "updated_time").Updates(role).Error
+}
+
+func GetAllCustomRoles() ([]*CustomRole, error) {
+	var roles []*CustomRole
+	err := DB.Order("id asc").Find(&roles).Error
+	return roles, err
+}
+
+func GetCustomRoleById(id int) (*CustomRole, error) {
+	role := CustomRole{}
+	if err := DB.First(&role, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCustomRoleNotFound
+		}
+		return nil, err
+	}
+	return &role, nil
+}
+
+// DeleteCustomRoleById 删除角色并撤销所有用户的该角色分配
+func DeleteCustomRoleById(id int) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&CustomRole{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrCustomRoleNotFound
+		}
+		return tx.Model(&User{}).Where("custom_role_id = ?", id).Update("custom_role_id", 0).Error
+	})
+}
+
+// SetUserCustomRole 为用户分配自定义角色，roleId 为 0 表示撤销
+func SetUserCustomRole(userId int, roleId int) error {
+	if roleId != 0 {
+		if _, err := GetCustomRoleById(roleId); err != nil {
+			return err
+		}
+	}
+	result := DB.Model(&User{}).Where("id = ?", userId).Update("custom_role_id", roleId)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("用户不存在")
+	}
+	return nil
+}
+
+// GetUserCustomRole 返回用户当前分配的自定义角色，未分配时返回 nil
+func GetUserCustomRole(userId int) (*CustomRole, error) {
+	var roleId int
+	if err := DB.Model(&User{}).Where("id = ?", userId).Select("custom_role_id").Scan(&roleId).Error; err != nil {
+		return nil, err
+	}
+	if roleId == 0 {
+		return nil, nil
+	}
+	role, err := GetCustomRoleById(roleId)
+	if errors.Is(err, ErrCustomRoleNotFound) {
+		return nil, nil
+	}
+	return role, err
+}
@@ -0,0 +1,114 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+// 终端用户：使用同一令牌的下游应用用户，通过请求中的 user / safety_identifier 字段或配置的请求头识别。
+// 终端用户不落库，限流与每日额度按 令牌 + 终端用户标识 计数，用量统计基于消费日志聚合
+
+const (
+	EndUserIdMaxLength         = 64
+	endUserDailySpendKeyPrefix = "end_user_daily_spend:"
+)
+
+// NormalizeEndUserId 去除首尾空白并截断到日志字段允许的长度
+func NormalizeEndUserId(id string) string {
+	id = strings.TrimSpace(id)
+	if len(id) > EndUserIdMaxLength {
+		id = id[:EndUserIdMaxLength]
+	}
+	return id
+}
+
+// IsEndUserBlocked 判断终端用户是否在令牌的黑名单中（逗号或换行分隔）
+func IsEndUserBlocked(blockedEndUsers string, endUserId string) bool {
+	if blockedEndUsers == "" || endUserId == "" {
+		return false
+	}
+	for _, item := range strings.FieldsFunc(blockedEndUsers, func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r'
+	}) {
+		if strings.TrimSpace(item) == endUserId {
+			return true
+		}
+	}
+	return false
+}
+
+func endUserDailySpendKey(tokenId int, endUserId string) (string, int64) {
+	now := time.Now()
+	nextDay := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+	return fmt.Sprintf("%s%d:%s:%s", endUserDailySpendKeyPrefix, tokenId, now.Format("20060102"), endUserId), nextDay.Unix()
+}
+
+// GetEndUserDailySpend 返回终端用户当天在该令牌下已消费的额度
+func GetEndUserDailySpend(tokenId int, endUserId string) int {
+	key, _ := endUserDailySpendKey(tokenId, endUserId)
+	return getSpendCounter(key)
+}
+
+// AddEndUserDailySpend 累加终端用户当天的消费额度（delta 可为负，用于退款），返回累加后的值
+func AddEndUserDailySpend(tokenId int, endUserId string, delta int) (int, error) {
+	key, expiresAt := endUserDailySpendKey(tokenId, endUserId)
+	return addSpendCounter(key, delta, expiresAt)
+}
+
+// ReserveEndUserDailySpend 在每日额度 limit 内原子地占用终端用户当天的 delta 额度，超出额度时不占用并返回 false
+func ReserveEndUserDailySpend(tokenId int, endUserId string, delta int, limit int) (bool, error) {
+	key, expiresAt := endUserDailySpendKey(tokenId, endUserId)
+	return reserveSpendCounter(key, delta, limit, expiresAt)
+}
+
+// EndUserUsage 按终端用户汇总的用量
+type EndUserUsage struct {
+	EndUserId        string `json:"end_user_id" gorm:"column:end_user_id"`
+	Requests         int64  `json:"requests" gorm:"column:requests"`
+	Quota            int64  `json:"quota" gorm:"column:quota"`
+	PromptTokens     int64  `json:"prompt_tokens" gorm:"column:prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens" gorm:"column:completion_tokens"`
+	LastUsedAt       int64  `json:"last_used_at" gorm:"column:last_used_at"`
+}
+
+// GetEndUserUsage 按终端用户汇总消费日志，按消费额度降序分页返回；userId 为 0 时统计全部用户
+func GetEndUserUsage(userId int, tokenId int, startTimestamp int64, endTimestamp int64, endUserId string, startIdx int, num int) ([]*EndUserUsage, int64, error) {
+	tx := LOG_DB.Table("logs").Where("type = ? AND end_user_id <> ''", LogTypeConsume)
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if tokenId != 0 {
+		tx = tx.Where("token_id = ?", tokenId)
+	}
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	if endUserId != "" {
+		tx = tx.Where("end_user_id = ?", endUserId)
+	}
+
+	var total int64
+	if err := tx.Session(&gorm.Session{}).Distinct("end_user_id").Count(&total).Error; err != nil {
+		common.SysError("failed to count end user usage: " + err.Error())
+		return nil, 0, errors.New("查询终端用户用量失败")
+	}
+	var items []*EndUserUsage
+	err := tx.Select("end_user_id, COUNT(*) AS requests, COALESCE(SUM(quota), 0) AS quota, " +
+		"COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens, COALESCE(SUM(completion_tokens), 0) AS completion_tokens, " +
+		"MAX(created_at) AS last_used_at").
+		Group("end_user_id").Order("quota DESC, end_user_id").Limit(num).Offset(startIdx).Scan(&items).Error
+	if err != nil {
+		common.SysError("failed to query end user usage: " + err.Error())
+		return nil, 0, errors.New("查询终端用户用量失败")
+	}
+	return items, total, nil
+}
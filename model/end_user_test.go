@@ -0,0 +1,74 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetEndUserUsage(t *testing.T) {
+	truncateTables(t)
+
+	now := common.GetTimestamp()
+	logs := []*Log{
+		{UserId: 1, TokenId: 1, Type: LogTypeConsume, CreatedAt: now - 10, Quota: 100, PromptTokens: 10, CompletionTokens: 5, EndUserId: "alice"},
+		{UserId: 1, TokenId: 1, Type: LogTypeConsume, CreatedAt: now, Quota: 300, PromptTokens: 30, CompletionTokens: 15, EndUserId: "alice"},
+		{UserId: 1, TokenId: 2, Type: LogTypeConsume, CreatedAt: now, Quota: 200, EndUserId: "bob"},
+		{UserId: 1, TokenId: 1, Type: LogTypeError, CreatedAt: now, EndUserId: "carol"},
+		{UserId: 1, TokenId: 1, Type: LogTypeConsume, CreatedAt: now, Quota: 50},
+		{UserId: 2, TokenId: 3, Type: LogTypeConsume, CreatedAt: now, Quota: 900, EndUserId: "alice"},
+	}
+	require.NoError(t, LOG_DB.Create(&logs).Error)
+
+	items, total, err := GetEndUserUsage(1, 0, 0, 0, "", 0, 10)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, total)
+	require.Len(t, items, 2)
+	assert.Equal(t, "alice", items[0].EndUserId)
+	assert.EqualValues(t, 2, items[0].Requests)
+	assert.EqualValues(t, 400, items[0].Quota)
+	assert.EqualValues(t, 40, items[0].PromptTokens)
+	assert.EqualValues(t, 20, items[0].CompletionTokens)
+	assert.Equal(t, now, items[0].LastUsedAt)
+	assert.Equal(t, "bob", items[1].EndUserId)
+
+	items, total, err = GetEndUserUsage(1, 2, 0, 0, "", 0, 10)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, total)
+	require.Len(t, items, 1)
+	assert.Equal(t, "bob", items[0].EndUserId)
+
+	items, _, err = GetEndUserUsage(0, 0, 0, 0, "alice", 0, 10)
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.EqualValues(t, 1300, items[0].Quota)
+}
+
+func TestEndUserDailySpendAndBlocklist(t *testing.T) {
+	endUserId := "spend-" + common.GetRandomString(8)
+	assert.Equal(t, 0, GetEndUserDailySpend(1, endUserId))
+	spent, err := AddEndUserDailySpend(1, endUserId, 500)
+	require.NoError(t, err)
+	assert.Equal(t, 500, spent)
+	_, err = AddEndUserDailySpend(1, endUserId, -200)
+	require.NoError(t, err)
+	assert.Equal(t, 300, GetEndUserDailySpend(1, endUserId))
+	assert.Equal(t, 0, GetEndUserDailySpend(2, endUserId))
+
+	// 占用超出每日额度时不累计
+	ok, err := ReserveEndUserDailySpend(1, endUserId, 700, 1000)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = ReserveEndUserDailySpend(1, endUserId, 1, 1000)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 1000, GetEndUserDailySpend(1, endUserId))
+
+	assert.True(t, IsEndUserBlocked("alice, bob\r\ncarol", "bob"))
+	assert.True(t, IsEndUserBlocked("alice, bob\r\ncarol", "carol"))
+	assert.False(t, IsEndUserBlocked("alice, bob", "bo"))
+	assert.False(t, IsEndUserBlocked("", "alice"))
+}
@@ -0,0 +1,231 @@
+package model
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/samber/hot"
+)
+
+// 临时令牌：由父令牌签发的短期令牌，供浏览器、移动端等无法安全保存长期密钥的客户端使用。
+// 令牌本身携带签名的声明（父令牌、有效期、可用模型、消费上限、终端用户），校验时无需查库登记，
+// 请求按父令牌计费；父令牌被禁用、过期或更换密钥后，其签发的临时令牌随之失效
+
+const (
+	EphemeralTokenPrefix = "ek-"
+
+	EphemeralTokenDefaultTTL = 600
+	EphemeralTokenMaxTTL     = 3600
+
+	ephemeralTokenJtiLength         = 24
+	ephemeralTokenFingerprintLength = 16
+	ephemeralTokenSpendKeyPrefix    = "ephemeral_token_spend:"
+)
+
+var ErrEphemeralTokenInvalid = errors.New("无效的临时令牌")
+
+// 父令牌 id 到存储密钥的进程内映射，校验临时令牌时据此走令牌缓存，避免每个请求都按 id 查库。
+// 存储密钥可能是明文，因此不写入 Redis
+var (
+	ephemeralParentKeyCacheOnce sync.Once
+	ephemeralParentKeyCache     *hot.HotCache[int, string]
+)
+
+func getEphemeralParentKeyCache() *hot.HotCache[int, string] {
+	ephemeralParentKeyCacheOnce.Do(func() {
+		ephemeralParentKeyCache = hot.NewHotCache[int, string](hot.LRU, 10000).
+			WithTTL(EphemeralTokenMaxTTL * time.Second).
+			WithJanitor().
+			Build()
+	})
+	return ephemeralParentKeyCache
+}
+
+type EphemeralTokenClaims struct {
+	Jti            string   `json:"jti"`
+	TokenId        int      `json:"tid"`
+	UserId         int      `json:"uid"`
+	IssuedAt       int64    `json:"iat"`
+	ExpiresAt      int64    `json:"exp"`
+	Models         []string `json:"models,omitempty"`
+	MaxSpend       int      `json:"max_spend,omitempty"`
+	EndUserId      string   `json:"user,omitempty"`
+	KeyFingerprint string   `json:"kfp"`
+	// 默认沿用父令牌的 IP 白名单；签发时显式指定后可从任意 IP 使用（如浏览器直连、上游回调）
+	AllowAnyIp bool `json:"any_ip,omitempty"`
+	// 与签发方临时令牌共享消费上限时，为签发方的 jti 与过期时间，消费计入签发方的计数
+	BudgetJti       string `json:"bjti,omitempty"`
+	BudgetExpiresAt int64  `json:"bexp,omitempty"`
+}
+
+// SpendCounter 返回消费计数所用的 jti 及计数的保留期限
+func (claims *EphemeralTokenClaims) SpendCounter() (string, int64) {
+	if claims.BudgetJti != "" {
+		return claims.BudgetJti, claims.BudgetExpiresAt
+	}
+	return claims.Jti, claims.ExpiresAt
+}
+
+// IsEphemeralTokenKey 判断客户端提交的密钥是否为临时令牌
+func IsEphemeralTokenKey(key string) bool {
+	return strings.HasPrefix(key, EphemeralTokenPrefix)
+}
+
+// ephemeralTokenFingerprint 绑定父令牌的密钥，完整密钥与哈希存储形式得到相同结果，更换密钥后旧的临时令牌失效
+func ephemeralTokenFingerprint(key string) string {
+	return TokenCacheId(key)[:ephemeralTokenFingerprintLength]
+}
+
+// matchEphemeralTokenFingerprint 校验临时令牌绑定的密钥，父令牌轮换后的宽限期内同样接受由旧密钥签发的临时令牌
+func matchEphemeralTokenFingerprint(parent *Token, fingerprint string) bool {
+	if hmac.Equal([]byte(fingerprint), []byte(ephemeralTokenFingerprint(parent.Key))) {
+		return true
+	}
+	return parent.PreviousKey != "" && parent.PreviousKeyExpiresTime >= common.GetTimestamp() &&
+		hmac.Equal([]byte(fingerprint), []byte(ephemeralTokenFingerprint(parent.PreviousKey)))
+}
+
+func signEphemeralPayload(payload string) string {
+	return common.GenerateHMAC("ephemeral:" + payload)
+}
+
+// MintEphemeralToken 为父令牌签发临时令牌，ttl 为有效期（秒），maxSpend 为额度上限（0 表示仅受父令牌额度限制），
+// allowAnyIp 为 true 时不受父令牌 IP 白名单限制
+func MintEphemeralToken(parent *Token, ttl int64, models []string, maxSpend int, endUserId string, allowAnyIp bool) (string, *EphemeralTokenClaims, error) {
+	return mintEphemeralToken(parent, ttl, models, maxSpend, endUserId, allowAnyIp, "", 0)
+}
+
+// MintSharedBudgetEphemeralToken 签发与已有临时令牌共享消费上限的临时令牌，消费计入 budgetJti 的计数，
+// 两者合计不超过 maxSpend
+func MintSharedBudgetEphemeralToken(parent *Token, ttl int64, models []string, maxSpend int, endUserId string, allowAnyIp bool, budgetJti string, budgetExpiresAt int64) (string, *EphemeralTokenClaims, error) {
+	return mintEphemeralToken(parent, ttl, models, maxSpend, endUserId, allowAnyIp, budgetJti, budgetExpiresAt)
+}
+
+func mintEphemeralToken(parent *Token, ttl int64, models []string, maxSpend int, endUserId string, allowAnyIp bool, budgetJti string, budgetExpiresAt int64) (string, *EphemeralTokenClaims, error) {
+	if parent == nil || parent.Id == 0 {
+		return "", nil, errors.New("父令牌无效")
+	}
+	jti, err := common.GenerateRandomCharsKey(ephemeralTokenJtiLength)
+	if err != nil {
+		return "", nil, err
+	}
+	now := common.GetTimestamp()
+	expiresAt := now + ttl
+	// 临时令牌不得比父令牌活得更久
+	if parent.ExpiredTime != -1 && parent.ExpiredTime < expiresAt {
+		expiresAt = parent.ExpiredTime
+	}
+	claims := &EphemeralTokenClaims{
+		Jti:            jti,
+		TokenId:        parent.Id,
+		UserId:         parent.UserId,
+		IssuedAt:       now,
+		ExpiresAt:      expiresAt,
+		Models:         models,
+		MaxSpend:       maxSpend,
+		EndUserId:      endUserId,
+		KeyFingerprint: ephemeralTokenFingerprint(parent.Key),
+		AllowAnyIp:     allowAnyIp,
+	}
+	if budgetJti != "" {
+		claims.BudgetJti = budgetJti
+		claims.BudgetExpiresAt = budgetExpiresAt
+	}
+	data, err := common.Marshal(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return EphemeralTokenPrefix + payload + "." + signEphemeralPayload(payload), claims, nil
+}
+
+// ParseEphemeralToken 校验临时令牌的签名与有效期并返回其声明，不检查父令牌状态
+func ParseEphemeralToken(key string) (*EphemeralTokenClaims, error) {
+	body, ok := strings.CutPrefix(key, EphemeralTokenPrefix)
+	if !ok {
+		return nil, ErrEphemeralTokenInvalid
+	}
+	dot := strings.LastIndex(body, ".")
+	if dot <= 0 {
+		return nil, ErrEphemeralTokenInvalid
+	}
+	payload, signature := body[:dot], body[dot+1:]
+	if !hmac.Equal([]byte(signature), []byte(signEphemeralPayload(payload))) {
+		return nil, ErrEphemeralTokenInvalid
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrEphemeralTokenInvalid
+	}
+	claims := &EphemeralTokenClaims{}
+	if err := common.Unmarshal(data, claims); err != nil || claims.Jti == "" || claims.TokenId == 0 {
+		return nil, ErrEphemeralTokenInvalid
+	}
+	if claims.ExpiresAt < common.GetTimestamp() {
+		return nil, errors.New("临时令牌已过期")
+	}
+	return claims, nil
+}
+
+// ValidateEphemeralToken 校验临时令牌并加载其父令牌，父令牌须仍可用且密钥未更换
+func ValidateEphemeralToken(key string) (*EphemeralTokenClaims, *Token, error) {
+	claims, err := ParseEphemeralToken(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	parent, err := getEphemeralParentToken(claims.TokenId, false)
+	if err == nil && !matchEphemeralTokenFingerprint(parent, claims.KeyFingerprint) {
+		// 缓存中的父令牌可能早于密钥轮换，以数据库为准再校验一次
+		parent, err = getEphemeralParentToken(claims.TokenId, true)
+	}
+	if err != nil {
+		return nil, nil, ErrEphemeralTokenInvalid
+	}
+	if parent.UserId != claims.UserId || !matchEphemeralTokenFingerprint(parent, claims.KeyFingerprint) {
+		return nil, nil, ErrEphemeralTokenInvalid
+	}
+	if err := checkTokenAvailable(parent, key); err != nil {
+		return nil, nil, err
+	}
+	return claims, parent, nil
+}
+
+// getEphemeralParentToken 加载临时令牌的父令牌，优先按已知的存储密钥读取令牌缓存
+func getEphemeralParentToken(tokenId int, fromDB bool) (*Token, error) {
+	cache := getEphemeralParentKeyCache()
+	if !fromDB {
+		if key, found, err := cache.Get(tokenId); err == nil && found {
+			if parent, err := GetTokenByStoredKey(key); err == nil && parent.Id == tokenId {
+				return parent, nil
+			}
+		}
+	}
+	parent, err := GetTokenById(tokenId)
+	if err != nil {
+		return nil, err
+	}
+	cache.Set(tokenId, parent.Key)
+	return parent, nil
+}
+
+// GetEphemeralTokenSpend 返回临时令牌已消费的额度
+func GetEphemeralTokenSpend(jti string) int {
+	return getSpendCounter(ephemeralTokenSpendKeyPrefix + jti)
+}
+
+// AddEphemeralTokenSpend 累加临时令牌已消费的额度（delta 可为负，用于退款），返回累加后的值；
+// 计数保留到临时令牌过期后再清理
+func AddEphemeralTokenSpend(jti string, delta int, expiresAt int64) (int, error) {
+	return addSpendCounter(ephemeralTokenSpendKeyPrefix+jti, delta, expiresAt+60)
+}
+
+// ReserveEphemeralTokenSpend 在消费上限 limit 内原子地占用 delta 额度，超出上限时不占用并返回 false
+func ReserveEphemeralTokenSpend(jti string, delta int, limit int, expiresAt int64) (bool, error) {
+	return reserveSpendCounter(ephemeralTokenSpendKeyPrefix+jti, delta, limit, expiresAt+60)
+}
@@ -0,0 +1,105 @@
+package model
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEphemeralTokenValidation(t *testing.T) {
+	truncateTables(t)
+	initCol()
+
+	parent := &Token{UserId: 1, Name: "parent", Status: common.TokenStatusEnabled, ExpiredTime: -1, UnlimitedQuota: true}
+	parent.SetKey("ephemeralparentkey0123456789ephemeralparentkey01")
+	require.NoError(t, parent.Insert())
+
+	key, claims, err := MintEphemeralToken(parent, 600, []string{"gpt-4o-realtime-preview"}, 5000, "end-user-1", false)
+	require.NoError(t, err)
+	assert.True(t, IsEphemeralTokenKey(key))
+	assert.Equal(t, parent.Id, claims.TokenId)
+
+	parsed, found, err := ValidateEphemeralToken(key)
+	require.NoError(t, err)
+	assert.Equal(t, parent.Id, found.Id)
+	assert.Equal(t, claims.Jti, parsed.Jti)
+	assert.Equal(t, []string{"gpt-4o-realtime-preview"}, parsed.Models)
+	assert.Equal(t, 5000, parsed.MaxSpend)
+	assert.Equal(t, "end-user-1", parsed.EndUserId)
+
+	// 篡改声明或签名均无法通过校验
+	dot := strings.LastIndex(key, ".")
+	_, _, err = ValidateEphemeralToken(replaceCharAt(key, 10))
+	assert.ErrorIs(t, err, ErrEphemeralTokenInvalid)
+	_, _, err = ValidateEphemeralToken(replaceCharAt(key, dot+1))
+	assert.ErrorIs(t, err, ErrEphemeralTokenInvalid)
+
+	expired, _, err := MintEphemeralToken(parent, -1, nil, 0, "", false)
+	require.NoError(t, err)
+	_, _, err = ValidateEphemeralToken(expired)
+	assert.Error(t, err)
+
+	// 父令牌禁用后临时令牌随之失效
+	require.NoError(t, DB.Model(parent).Update("status", common.TokenStatusDisabled).Error)
+	_, _, err = ValidateEphemeralToken(key)
+	assert.Error(t, err)
+
+	// 父令牌更换密钥后旧的临时令牌失效
+	require.NoError(t, DB.Model(parent).Updates(map[string]interface{}{
+		"status": common.TokenStatusEnabled,
+		"key":    "rotatedparentkey0123456789rotatedparentkey012345",
+	}).Error)
+	_, _, err = ValidateEphemeralToken(key)
+	assert.ErrorIs(t, err, ErrEphemeralTokenInvalid)
+}
+
+func replaceCharAt(s string, i int) string {
+	replacement := "0"
+	if s[i] == '0' {
+		replacement = "1"
+	}
+	return s[:i] + replacement + s[i+1:]
+}
+
+func TestEphemeralTokenSpend(t *testing.T) {
+	jti := "spend-test-" + common.GetRandomString(8)
+	expiresAt := common.GetTimestamp() + 600
+
+	assert.Equal(t, 0, GetEphemeralTokenSpend(jti))
+	spent, err := AddEphemeralTokenSpend(jti, 300, expiresAt)
+	require.NoError(t, err)
+	assert.Equal(t, 300, spent)
+	spent, err = AddEphemeralTokenSpend(jti, -100, expiresAt)
+	require.NoError(t, err)
+	assert.Equal(t, 200, spent)
+	assert.Equal(t, 200, GetEphemeralTokenSpend(jti))
+}
+
+func TestReserveEphemeralTokenSpendConcurrent(t *testing.T) {
+	jti := "reserve-test-" + common.GetRandomString(8)
+	expiresAt := common.GetTimestamp() + 600
+
+	// 20 个并发请求各占用 100，上限 1000 时恰好 10 个成功
+	var reserved atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := ReserveEphemeralTokenSpend(jti, 100, 1000, expiresAt)
+			assert.NoError(t, err)
+			if ok {
+				reserved.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, 10, reserved.Load())
+	assert.Equal(t, 1000, GetEphemeralTokenSpend(jti))
+}
@@ -0,0 +1,212 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Experiment 流量切分实验：命中 Model 且分组匹配的请求按粘性键哈希分桶，
+// 落入实验组的请求改用实验组的模型或渠道，其余请求为对照组（control）保持不变。
+// Arms 为 JSON 数组，见 ExperimentArm；Groups 为逗号分隔的分组，留空表示全部分组
+type Experiment struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name" gorm:"size:64;not null"`
+	Description string `json:"description,omitempty" gorm:"type:varchar(255)"`
+	Status      int    `json:"status" gorm:"default:1;index"`
+	Model       string `json:"model" gorm:"size:128;not null;index"`
+	Groups      string `json:"groups" gorm:"type:text"`
+	StickyBy    string `json:"sticky_by" gorm:"size:16;default:'token'"`
+	Arms        string `json:"arms" gorm:"type:text;not null"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime int64  `json:"updated_time" gorm:"bigint"`
+}
+
+// ExperimentArm 实验组，Weight 为分到该组的流量百分比，未分配的流量属于对照组
+type ExperimentArm struct {
+	Name      string `json:"name"`
+	Weight    int    `json:"weight"`
+	Model     string `json:"model,omitempty"`
+	ChannelId int    `json:"channel_id,omitempty"`
+}
+
+const (
+	ExperimentStatusRunning = 1
+	ExperimentStatusStopped = 2
+
+	ExperimentStickyByToken   = "token"
+	ExperimentStickyByEndUser = "end_user"
+	ExperimentStickyByUser    = "user"
+
+	ExperimentControlArm = "control"
+)
+
+var ErrExperimentNotFound = errors.New("experiment not found")
+
+// ExperimentAssignment 请求所属的实验与分组，记录在请求上下文中，消费日志写入时累计用量
+type ExperimentAssignment struct {
+	ExperimentId     int    `json:"id"`
+	Arm              string `json:"arm"`
+	OriginModel      string `json:"origin_model"`
+	Quota            int    `json:"-"`
+	PromptTokens     int    `json:"-"`
+	CompletionTokens int    `json:"-"`
+	IsStream         bool   `json:"-"`
+	FirstTokenMs     int64  `json:"-"`
+}
+
+// ExperimentResult 实验请求的结果，一个请求一行，用于按组统计延迟、错误率、花费与反馈评分
+type ExperimentResult struct {
+	Id               int      `json:"id"`
+	ExperimentId     int      `json:"experiment_id" gorm:"index:idx_experiment_results_arm,priority:1"`
+	Arm              string   `json:"arm" gorm:"size:64;index:idx_experiment_results_arm,priority:2"`
+	RequestId        string   `json:"request_id" gorm:"type:varchar(64);index"`
+	UserId           int      `json:"user_id" gorm:"index"`
+	TokenId          int      `json:"token_id"`
+	EndUserId        string   `json:"end_user_id,omitempty" gorm:"type:varchar(64);default:''"`
+	ModelName        string   `json:"model_name" gorm:"size:128"`
+	ChannelId        int      `json:"channel_id"`
+	Success          bool     `json:"success"`
+	LatencyMs        int64    `json:"latency_ms"`
+	IsStream         bool     `json:"is_stream"`
+	FirstTokenMs     int64    `json:"first_token_ms"` // 流式请求的首字延迟，非流式为 0
+	Quota            int      `json:"quota"`
+	PromptTokens     int      `json:"prompt_tokens"`
+	CompletionTokens int      `json:"completion_tokens"`
+	FeedbackScore    *float64 `json:"feedback_score"`
+	CreatedAt        int64    `json:"created_at" gorm:"bigint;index"`
+}
+
+// ExperimentArmReport 单个实验组的统计
+type ExperimentArmReport struct {
+	Arm              string   `json:"arm"`
+	Requests         int64    `json:"requests"`
+	Errors           int64    `json:"errors"`
+	ErrorRate        float64  `json:"error_rate" gorm:"-"`
+	AvgLatencyMs     float64  `json:"avg_latency_ms"`
+	StreamRequests   int64    `json:"stream_requests"`
+	AvgFirstTokenMs  *float64 `json:"avg_first_token_ms"` // 仅统计流式请求
+	TotalQuota       int64    `json:"total_quota"`
+	AvgQuota         float64  `json:"avg_quota" gorm:"-"`
+	PromptTokens     int64    `json:"prompt_tokens"`
+	CompletionTokens int64    `json:"completion_tokens"`
+	FeedbackCount    int64    `json:"feedback_count"`
+	AvgFeedbackScore *float64 `json:"avg_feedback_score"`
+}
+
+func (e *Experiment) Insert() error {
+	now := common.GetTimestamp()
+	e.CreatedTime = now
+	e.UpdatedTime = now
+	return DB.Create(e).Error
+}
+
+func (e *Experiment) Update() error {
+	e.UpdatedTime = common.GetTimestamp()
+	return DB.Save(e).Error
+}
+
+func GetAllExperiments() ([]*Experiment, error) {
+	var experiments []*Experiment
+	err := DB.Order("id DESC").Find(&experiments).Error
+	return experiments, err
+}
+
+// GetRunningExperiments 按 id 顺序返回运行中的实验，同一请求命中多个实验时取最早创建的
+func GetRunningExperiments() ([]*Experiment, error) {
+	var experiments []*Experiment
+	err := DB.Where("status = ?", ExperimentStatusRunning).Order("id ASC").Find(&experiments).Error
+	return experiments, err
+}
+
+func GetExperimentById(id int) (*Experiment, error) {
+	var experiment Experiment
+	err := DB.First(&experiment, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrExperimentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &experiment, nil
+}
+
+func DeleteExperimentById(id int) error {
+	return DB.Delete(&Experiment{}, id).Error
+}
+
+func InsertExperimentResult(result *ExperimentResult) error {
+	result.CreatedAt = common.GetTimestamp()
+	return LOG_DB.Create(result).Error
+}
+
+// UpdateExperimentFeedback 记录用户对请求的反馈评分，仅能评价本人的请求
+func UpdateExperimentFeedback(requestId string, userId int, score float64) error {
+	result := LOG_DB.Model(&ExperimentResult{}).
+		Where("request_id = ? AND user_id = ?", requestId, userId).
+		Update("feedback_score", score)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrExperimentNotFound
+	}
+	return nil
+}
+
+// GetExperimentReport 按实验组汇总结果，startTime/endTime 为 0 时不限制
+func GetExperimentReport(experimentId int, startTime int64, endTime int64) ([]*ExperimentArmReport, error) {
+	var reports []*ExperimentArmReport
+	query := LOG_DB.Model(&ExperimentResult{}).
+		Select("arm, COUNT(*) AS requests, "+
+			"SUM(CASE WHEN success THEN 0 ELSE 1 END) AS errors, "+
+			"AVG(latency_ms) AS avg_latency_ms, "+
+			"SUM(CASE WHEN is_stream THEN 1 ELSE 0 END) AS stream_requests, "+
+			"AVG(CASE WHEN is_stream AND first_token_ms > 0 THEN first_token_ms END) AS avg_first_token_ms, "+
+			"SUM(quota) AS total_quota, "+
+			"SUM(prompt_tokens) AS prompt_tokens, "+
+			"SUM(completion_tokens) AS completion_tokens, "+
+			"COUNT(feedback_score) AS feedback_count, "+
+			"AVG(feedback_score) AS avg_feedback_score").
+		Where("experiment_id = ?", experimentId)
+	if startTime > 0 {
+		query = query.Where("created_at >= ?", startTime)
+	}
+	if endTime > 0 {
+		query = query.Where("created_at <= ?", endTime)
+	}
+	if err := query.Group("arm").Order("arm ASC").Scan(&reports).Error; err != nil {
+		return nil, err
+	}
+	for _, report := range reports {
+		if report.Requests > 0 {
+			report.ErrorRate = float64(report.Errors) / float64(report.Requests)
+			report.AvgQuota = float64(report.TotalQuota) / float64(report.Requests)
+		}
+	}
+	return reports, nil
+}
+
+// accumulateExperimentUsage 累计实验请求的花费与用量，请求结束时写入 ExperimentResult
+func accumulateExperimentUsage(c *gin.Context, params RecordConsumeLogParams) {
+	if c == nil {
+		return
+	}
+	assignment, ok := common.GetContextKeyType[*ExperimentAssignment](c, constant.ContextKeyExperiment)
+	if !ok || assignment == nil {
+		return
+	}
+	assignment.Quota += params.Quota
+	assignment.PromptTokens += params.PromptTokens
+	assignment.CompletionTokens += params.CompletionTokens
+	if params.IsStream {
+		assignment.IsStream = true
+		if frt, ok := params.Other["frt"].(float64); ok && frt > 0 && assignment.FirstTokenMs == 0 {
+			assignment.FirstTokenMs = int64(frt)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+const (
+	MarginGroupByChannel = "channel"
+	MarginGroupByModel   = "model"
+	MarginGroupByGroup   = "group"
+)
+
+// MarginReportItem 收入/成本/毛利统计行
+type MarginReportItem struct {
+	Key          string  `json:"key"`
+	ChannelId    int     `json:"channel_id,omitempty"`
+	ChannelName  string  `json:"channel_name,omitempty"`
+	Requests     int64   `json:"requests"`
+	Revenue      int64   `json:"revenue"`
+	UpstreamCost int64   `json:"upstream_cost"`
+	Margin       int64   `json:"margin"`
+	MarginRate   float64 `json:"margin_rate"`
+}
+
+type marginAggRow struct {
+	Key          string `gorm:"column:group_key"`
+	Requests     int64  `gorm:"column:requests"`
+	Revenue      int64  `gorm:"column:revenue"`
+	UpstreamCost int64  `gorm:"column:upstream_cost"`
+}
+
+// GetMarginReport 按渠道、模型或分组汇总消费日志中的计费额度与上游成本
+func GetMarginReport(groupBy string, startTimestamp int64, endTimestamp int64, channel int, modelName string, group string) ([]*MarginReportItem, error) {
+	var keyCol string
+	switch groupBy {
+	case MarginGroupByChannel, "":
+		groupBy = MarginGroupByChannel
+		keyCol = "channel_id"
+	case MarginGroupByModel:
+		keyCol = "model_name"
+	case MarginGroupByGroup:
+		keyCol = logGroupCol
+	default:
+		return nil, errors.New("不支持的统计维度")
+	}
+
+	tx := LOG_DB.Table("logs").
+		Select(keyCol+" AS group_key, COUNT(*) AS requests, COALESCE(SUM(quota), 0) AS revenue, COALESCE(SUM(upstream_cost), 0) AS upstream_cost").
+		Where("type = ?", LogTypeConsume)
+	if startTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", startTimestamp)
+	}
+	if endTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", endTimestamp)
+	}
+	if channel != 0 {
+		tx = tx.Where("channel_id = ?", channel)
+	}
+	if modelName != "" {
+		tx = tx.Where("model_name = ?", modelName)
+	}
+	if group != "" {
+		tx = tx.Where(logGroupCol+" = ?", group)
+	}
+
+	var rows []marginAggRow
+	if err := tx.Group(keyCol).Order("revenue DESC").Scan(&rows).Error; err != nil {
+		common.SysError("failed to query margin report: " + err.Error())
+		return nil, errors.New("查询毛利统计失败")
+	}
+
+	items := make([]*MarginReportItem, 0, len(rows))
+	for _, row := range rows {
+		item := &MarginReportItem{
+			Key:          row.Key,
+			Requests:     row.Requests,
+			Revenue:      row.Revenue,
+			UpstreamCost: row.UpstreamCost,
+			Margin:       row.Revenue - row.UpstreamCost,
+		}
+		if row.Revenue > 0 {
+			item.MarginRate = float64(item.Margin) / float64(row.Revenue)
+		}
+		if groupBy == MarginGroupByChannel {
+			item.ChannelId = common.String2Int(row.Key)
+			if item.ChannelId != 0 {
+				if cacheChannel, err := CacheGetChannel(item.ChannelId); err == nil {
+					item.ChannelName = cacheChannel.Name
+				}
+			}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
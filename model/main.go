@@ -288,6 +288,19 @@ func migrateDB() error {
 		&CustomOAuthProvider{},
 		&UserOAuthBinding{},
 		&OssImage{},
+		&PostpaidAccount{},
+		&PostpaidStatement{},
+		&PostpaidPayment{},
+		&Coupon{},
+		&CouponRedemption{},
+		&RedemptionCampaign{},
+		&QuotaBucket{},
+		&ManagementKey{},
+		&CustomRole{},
+		&UserSession{},
+		&StoredResponse{},
+		&PromptTemplate{},
+		&Experiment{},
 	)
 	if err != nil {
 		return err
@@ -338,6 +351,19 @@ func migrateDBFast() error {
 		{&CustomOAuthProvider{}, "CustomOAuthProvider"},
 		{&UserOAuthBinding{}, "UserOAuthBinding"},
 		{&OssImage{}, "OssImage"},
+		{&PostpaidAccount{}, "PostpaidAccount"},
+		{&PostpaidStatement{}, "PostpaidStatement"},
+		{&PostpaidPayment{}, "PostpaidPayment"},
+		{&Coupon{}, "Coupon"},
+		{&CouponRedemption{}, "CouponRedemption"},
+		{&RedemptionCampaign{}, "RedemptionCampaign"},
+		{&QuotaBucket{}, "QuotaBucket"},
+		{&ManagementKey{}, "ManagementKey"},
+		{&CustomRole{}, "CustomRole"},
+		{&UserSession{}, "UserSession"},
+		{&StoredResponse{}, "StoredResponse"},
+		{&PromptTemplate{}, "PromptTemplate"},
+		{&Experiment{}, "Experiment"},
 	}
 	// 动态计算migration数量，确保errChan缓冲区足够大
 	errChan := make(chan error, len(migrations))
@@ -377,7 +403,7 @@ func migrateDBFast() error {
 
 func migrateLOGDB() error {
 	var err error
-	if err = LOG_DB.AutoMigrate(&Log{}); err != nil {
+	if err = LOG_DB.AutoMigrate(&Log{}, &ExperimentResult{}); err != nil {
 		return err
 	}
 	return nil
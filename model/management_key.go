@@ -0,0 +1,227 @@
+package model
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+// 管理密钥：用于自动化调用 /api 管理接口，按作用域授权，替代拥有完整权限的 User.AccessToken
+
+const (
+	ManagementKeyPrefix = "mk-"
+
+	ManagementKeyStatusEnabled  = 1
+	ManagementKeyStatusDisabled = 2
+
+	managementKeyRandomLength = 48
+	managementKeyPrefixLength = 11
+	// managementKeyTouchInterval 最近使用时间的最小更新间隔（秒），避免每次请求都写库
+	managementKeyTouchInterval = 60
+)
+
+// 作用域资源，格式为 <资源>:<read|write>，write 包含 read
+const (
+	ManagementScopeChannels = "channels"
+	ManagementScopeModels   = "models"
+	ManagementScopeLogs     = "logs"
+	ManagementScopeTokens   = "tokens"
+	ManagementScopeBilling  = "billing"
+	ManagementScopeUsers    = "users"
+
+	ManagementScopeActionRead  = "read"
+	ManagementScopeActionWrite = "write"
+)
+
+var managementScopeResources = []string{
+	ManagementScopeChannels,
+	ManagementScopeModels,
+	ManagementScopeLogs,
+	ManagementScopeTokens,
+	ManagementScopeBilling,
+	ManagementScopeUsers,
+}
+
+var (
+	ErrManagementKeyInvalid   = errors.New("管理密钥无效")
+	ErrManagementKeyDisabled  = errors.New("管理密钥已被禁用")
+	ErrManagementKeyExpired   = errors.New("管理密钥已过期")
+	ErrManagementKeyScopeBad  = errors.New("管理密钥作用域无效")
+	ErrManagementKeyNoScope   = errors.New("管理密钥至少需要一个作用域")
+	ErrManagementKeyNameEmpty = errors.New("管理密钥名称不能为空")
+)
+
+type ManagementKey struct {
+	Id           int     `json:"id"`
+	UserId       int     `json:"user_id" gorm:"index"`
+	Name         string  `json:"name" gorm:"type:varchar(64)"`
+	KeyHash      string  `json:"-" gorm:"type:char(64);uniqueIndex"`
+	KeyPrefix    string  `json:"key_prefix" gorm:"type:varchar(16)"`
+	Scopes       string  `json:"scopes" gorm:"type:varchar(512)"`
+	Status       int     `json:"status" gorm:"default:1"`
+	ExpiredTime  int64   `json:"expired_time" gorm:"bigint;default:-1"` // -1 表示永不过期
+	AllowIps     *string `json:"allow_ips" gorm:"default:''"`
+	CreatedTime  int64   `json:"created_time" gorm:"bigint"`
+	LastUsedTime int64   `json:"last_used_time" gorm:"bigint"`
+	LastUsedIp   string  `json:"last_used_ip" gorm:"type:varchar(64)"`
+}
+
+func (key *ManagementKey) BeforeCreate(tx *gorm.DB) error {
+	if key.CreatedTime == 0 {
+		key.CreatedTime = common.GetTimestamp()
+	}
+	return nil
+}
+
+// IsManagementKey 判断 Authorization 中的凭据是否为管理密钥
+func IsManagementKey(key string) bool {
+	return strings.HasPrefix(strings.TrimPrefix(key, "Bearer "), ManagementKeyPrefix)
+}
+
+// ParseManagementScope 解析形如 channels:read 的作用域
+func ParseManagementScope(scope string) (resource string, action string, ok bool) {
+	resource, action, ok = strings.Cut(strings.TrimSpace(scope), ":")
+	if !ok || (action != ManagementScopeActionRead && action != ManagementScopeActionWrite) {
+		return "", "", false
+	}
+	for _, r := range managementScopeResources {
+		if r == resource {
+			return resource, action, true
+		}
+	}
+	return "", "", false
+}
+
+// NormalizeManagementScopes 校验并去重作用域，返回逗号分隔的存储形式
+func NormalizeManagementScopes(scopes []string) (string, error) {
+	normalized := make([]string, 0, len(scopes))
+	seen := make(map[string]bool, len(scopes))
+	for _, scope := range scopes {
+		resource, action, ok := ParseManagementScope(scope)
+		if !ok {
+			return "", ErrManagementKeyScopeBad
+		}
+		scope = resource + ":" + action
+		if seen[scope] {
+			continue
+		}
+		seen[scope] = true
+		normalized = append(normalized, scope)
+	}
+	if len(normalized) == 0 {
+		return "", ErrManagementKeyNoScope
+	}
+	return strings.Join(normalized, ","), nil
+}
+
+// GetScopes 返回密钥的作用域列表
+func (key *ManagementKey) GetScopes() []string {
+	if key.Scopes == "" {
+		return []string{}
+	}
+	return strings.Split(key.Scopes, ",")
+}
+
+// HasScope 判断密钥是否拥有资源的指定权限，write 权限包含 read
+func (key *ManagementKey) HasScope(resource string, action string) bool {
+	for _, scope := range key.GetScopes() {
+		r, a, ok := ParseManagementScope(scope)
+		if !ok || r != resource {
+			continue
+		}
+		if a == action || a == ManagementScopeActionWrite {
+			return true
+		}
+	}
+	return false
+}
+
+// GetIpLimits 返回 IP 白名单，格式与令牌的 allow_ips 一致
+func (key *ManagementKey) GetIpLimits() []string {
+	token := Token{AllowIps: key.AllowIps}
+	return token.GetIpLimits()
+}
+
+// GenerateManagementKey 生成新的管理密钥，返回仅展示一次的明文密钥
+func (key *ManagementKey) GenerateManagementKey() (string, error) {
+	random, err := common.GenerateRandomCharsKey(managementKeyRandomLength)
+	if err != nil {
+		return "", err
+	}
+	plaintext := ManagementKeyPrefix + random
+	key.KeyHash = common.GenerateHMAC(plaintext)
+	key.KeyPrefix = plaintext[:managementKeyPrefixLength]
+	return plaintext, nil
+}
+
+func (key *ManagementKey) Insert() error {
+	return DB.Create(key).Error
+}
+
+// Update 仅更新可编辑字段，密钥本身不可修改
+func (key *ManagementKey) Update() error {
+	return DB.Model(key).Select("name", "scopes", "status", "expired_time", "allow_ips").Updates(key).Error
+}
+
+func GetUserManagementKeys(userId int) ([]*ManagementKey, error) {
+	var keys []*ManagementKey
+	err := DB.Where("user_id = ?", userId).Order("id desc").Find(&keys).Error
+	return keys, err
+}
+
+func GetManagementKeyByIdAndUserId(id int, userId int) (*ManagementKey, error) {
+	if id == 0 || userId == 0 {
+		return nil, errors.New("id 或 userId 为空！")
+	}
+	key := ManagementKey{}
+	err := DB.Where("id = ? and user_id = ?", id, userId).First(&key).Error
+	return &key, err
+}
+
+func DeleteManagementKeyById(id int, userId int) error {
+	result := DB.Where("id = ? and user_id = ?", id, userId).Delete(&ManagementKey{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ValidateManagementKey 校验管理密钥的状态与有效期，IP 白名单与作用域由调用方按请求校验
+func ValidateManagementKey(plaintext string) (*ManagementKey, error) {
+	plaintext = strings.TrimPrefix(plaintext, "Bearer ")
+	if !strings.HasPrefix(plaintext, ManagementKeyPrefix) {
+		return nil, ErrManagementKeyInvalid
+	}
+	key := ManagementKey{}
+	if err := DB.Where("key_hash = ?", common.GenerateHMAC(plaintext)).First(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrManagementKeyInvalid
+		}
+		return nil, err
+	}
+	if key.Status != ManagementKeyStatusEnabled {
+		return nil, ErrManagementKeyDisabled
+	}
+	if key.ExpiredTime != -1 && key.ExpiredTime < common.GetTimestamp() {
+		return nil, ErrManagementKeyExpired
+	}
+	return &key, nil
+}
+
+// TouchManagementKey 记录最近使用时间与来源 IP，同一密钥在间隔内只写一次
+func TouchManagementKey(key *ManagementKey, ip string) error {
+	now := common.GetTimestamp()
+	if now-key.LastUsedTime < managementKeyTouchInterval && key.LastUsedIp == ip {
+		return nil
+	}
+	return DB.Model(&ManagementKey{}).Where("id = ?", key.Id).Updates(map[string]interface{}{
+		"last_used_time": now,
+		"last_used_ip":   ip,
+	}).Error
+}
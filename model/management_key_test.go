@@ -0,0 +1,65 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManagementKeyValidateAndScopes(t *testing.T) {
+	truncateTables(t)
+	require.NoError(t, DB.AutoMigrate(&ManagementKey{}))
+	t.Cleanup(func() { DB.Exec("DELETE FROM management_keys") })
+
+	scopes, err := NormalizeManagementScopes([]string{"channels:read", "logs:write", "channels:read"})
+	require.NoError(t, err)
+	assert.Equal(t, "channels:read,logs:write", scopes)
+	_, err = NormalizeManagementScopes([]string{"options:write"})
+	assert.ErrorIs(t, err, ErrManagementKeyScopeBad)
+	_, err = NormalizeManagementScopes(nil)
+	assert.ErrorIs(t, err, ErrManagementKeyNoScope)
+
+	key := &ManagementKey{UserId: 1, Name: "ci", Scopes: scopes, Status: ManagementKeyStatusEnabled, ExpiredTime: -1}
+	plaintext, err := key.GenerateManagementKey()
+	require.NoError(t, err)
+	require.NoError(t, key.Insert())
+	assert.True(t, IsManagementKey("Bearer "+plaintext))
+	assert.NotContains(t, key.KeyHash, plaintext)
+
+	found, err := ValidateManagementKey("Bearer " + plaintext)
+	require.NoError(t, err)
+	assert.Equal(t, key.Id, found.Id)
+	assert.True(t, found.HasScope(ManagementScopeChannels, ManagementScopeActionRead))
+	assert.False(t, found.HasScope(ManagementScopeChannels, ManagementScopeActionWrite))
+	// write 权限包含 read
+	assert.True(t, found.HasScope(ManagementScopeLogs, ManagementScopeActionRead))
+	assert.False(t, found.HasScope(ManagementScopeTokens, ManagementScopeActionRead))
+
+	_, err = ValidateManagementKey(ManagementKeyPrefix + "unknown")
+	assert.ErrorIs(t, err, ErrManagementKeyInvalid)
+
+	require.NoError(t, TouchManagementKey(found, "10.0.0.1"))
+	reloaded, err := GetManagementKeyByIdAndUserId(key.Id, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.1", reloaded.LastUsedIp)
+	assert.NotZero(t, reloaded.LastUsedTime)
+
+	reloaded.ExpiredTime = common.GetTimestamp() - 1
+	require.NoError(t, reloaded.Update())
+	_, err = ValidateManagementKey(plaintext)
+	assert.ErrorIs(t, err, ErrManagementKeyExpired)
+
+	reloaded.ExpiredTime = -1
+	reloaded.Status = ManagementKeyStatusDisabled
+	require.NoError(t, reloaded.Update())
+	_, err = ValidateManagementKey(plaintext)
+	assert.ErrorIs(t, err, ErrManagementKeyDisabled)
+
+	assert.Error(t, DeleteManagementKeyById(key.Id, 2))
+	require.NoError(t, DeleteManagementKeyById(key.Id, 1))
+	_, err = ValidateManagementKey(plaintext)
+	assert.ErrorIs(t, err, ErrManagementKeyInvalid)
+}
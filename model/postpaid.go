@@ -0,0 +1,518 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/pkg/cachex"
+	"github.com/samber/hot"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Postpaid account status
+const (
+	PostpaidStatusActive    = "active"
+	PostpaidStatusOverdue   = "overdue"
+	PostpaidStatusThrottled = "throttled"
+	PostpaidStatusSuspended = "suspended"
+)
+
+// Postpaid statement status
+const (
+	PostpaidStatementOpen = "open"
+	PostpaidStatementPaid = "paid"
+)
+
+const postpaidAccountCacheNamespace = "new-api:postpaid_account:v1"
+
+var (
+	ErrPostpaidAccountNotFound   = errors.New("postpaid account not found")
+	ErrPostpaidStatementNotFound = errors.New("postpaid statement not found")
+	ErrPostpaidStatementPaid     = errors.New("postpaid statement already paid")
+)
+
+var (
+	postpaidAccountCacheOnce sync.Once
+	postpaidAccountCache     *cachex.HybridCache[PostpaidAccount]
+)
+
+// PostpaidAccount 后付费账户：允许用户余额透支到 -CreditLimit，按账期出账
+type PostpaidAccount struct {
+	Id     int `json:"id"`
+	UserId int `json:"user_id" gorm:"uniqueIndex"`
+
+	Enabled bool `json:"enabled" gorm:"default:true"`
+	// 信用额度（额度单位），用户余额最多可透支到 -CreditLimit
+	CreditLimit int64 `json:"credit_limit" gorm:"type:bigint;not null;default:0"`
+	// 已出账未结清的金额（额度单位），占用信用额度
+	OutstandingAmount int64 `json:"outstanding_amount" gorm:"type:bigint;not null;default:0"`
+
+	// 账期长度（天）与付款期限（天，如 net-30）
+	CycleDays       int `json:"cycle_days" gorm:"type:int;not null;default:30"`
+	PaymentTermDays int `json:"payment_term_days" gorm:"type:int;not null;default:30"`
+
+	CycleStartTime int64 `json:"cycle_start_time" gorm:"bigint"`
+	CycleEndTime   int64 `json:"cycle_end_time" gorm:"bigint;index"`
+
+	Status       string `json:"status" gorm:"type:varchar(32);index;default:'active'"`
+	OverdueSince int64  `json:"overdue_since" gorm:"bigint;default:0"`
+	Remark       string `json:"remark" gorm:"type:varchar(255);default:''"`
+
+	CreatedAt int64 `json:"created_at" gorm:"bigint"`
+	UpdatedAt int64 `json:"updated_at" gorm:"bigint"`
+}
+
+func (a *PostpaidAccount) BeforeCreate(tx *gorm.DB) error {
+	now := common.GetTimestamp()
+	a.CreatedAt = now
+	a.UpdatedAt = now
+	return nil
+}
+
+func (a *PostpaidAccount) BeforeUpdate(tx *gorm.DB) error {
+	a.UpdatedAt = common.GetTimestamp()
+	return nil
+}
+
+// IsActive 账户是否启用后付费
+func (a *PostpaidAccount) IsActive() bool {
+	return a != nil && a.Id > 0 && a.Enabled
+}
+
+// AvailableCredit 返回当前仍可透支的信用额度（已扣除未结清账单）
+func (a *PostpaidAccount) AvailableCredit() int64 {
+	if !a.IsActive() || a.Status == PostpaidStatusSuspended {
+		return 0
+	}
+	available := a.CreditLimit - a.OutstandingAmount
+	if available < 0 {
+		return 0
+	}
+	return available
+}
+
+// PostpaidStatement 后付费账单：账期结束时将透支余额转为应付款
+type PostpaidStatement struct {
+	Id     int `json:"id"`
+	UserId int `json:"user_id" gorm:"index;index:idx_postpaid_statement_user_status,priority:1"`
+
+	CycleStartTime int64 `json:"cycle_start_time" gorm:"bigint"`
+	CycleEndTime   int64 `json:"cycle_end_time" gorm:"bigint"`
+
+	// 本账期消耗（额度单位）与已付款金额
+	AmountDue  int64 `json:"amount_due" gorm:"type:bigint;not null;default:0"`
+	AmountPaid int64 `json:"amount_paid" gorm:"type:bigint;not null;default:0"`
+
+	DueTime int64  `json:"due_time" gorm:"bigint;index"`
+	Status  string `json:"status" gorm:"type:varchar(32);index;index:idx_postpaid_statement_user_status,priority:2"`
+	PaidAt  int64  `json:"paid_at" gorm:"bigint;default:0"`
+
+	CreatedAt int64 `json:"created_at" gorm:"bigint"`
+	UpdatedAt int64 `json:"updated_at" gorm:"bigint"`
+}
+
+func (s *PostpaidStatement) BeforeCreate(tx *gorm.DB) error {
+	now := common.GetTimestamp()
+	s.CreatedAt = now
+	s.UpdatedAt = now
+	return nil
+}
+
+func (s *PostpaidStatement) BeforeUpdate(tx *gorm.DB) error {
+	s.UpdatedAt = common.GetTimestamp()
+	return nil
+}
+
+// Remaining 返回账单剩余应付金额
+func (s *PostpaidStatement) Remaining() int64 {
+	remaining := s.AmountDue - s.AmountPaid
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// PostpaidPayment 管理员登记的线下付款记录
+type PostpaidPayment struct {
+	Id          int    `json:"id"`
+	StatementId int    `json:"statement_id" gorm:"index"`
+	UserId      int    `json:"user_id" gorm:"index"`
+	Amount      int64  `json:"amount" gorm:"type:bigint;not null"`
+	Method      string `json:"method" gorm:"type:varchar(64);default:''"`
+	Reference   string `json:"reference" gorm:"type:varchar(128);default:''"`
+	Remark      string `json:"remark" gorm:"type:varchar(255);default:''"`
+	OperatorId  int    `json:"operator_id"`
+	CreatedAt   int64  `json:"created_at" gorm:"bigint"`
+}
+
+func (p *PostpaidPayment) BeforeCreate(tx *gorm.DB) error {
+	p.CreatedAt = common.GetTimestamp()
+	return nil
+}
+
+func postpaidAccountCacheTTL() time.Duration {
+	ttlSeconds := common.GetEnvOrDefault("POSTPAID_ACCOUNT_CACHE_TTL", 60)
+	if ttlSeconds <= 0 {
+		ttlSeconds = 60
+	}
+	return time.Duration(ttlSeconds) * time.Second
+}
+
+func getPostpaidAccountCache() *cachex.HybridCache[PostpaidAccount] {
+	postpaidAccountCacheOnce.Do(func() {
+		ttl := postpaidAccountCacheTTL()
+		postpaidAccountCache = cachex.NewHybridCache[PostpaidAccount](cachex.HybridCacheConfig[PostpaidAccount]{
+			Namespace: cachex.Namespace(postpaidAccountCacheNamespace),
+			Redis:     common.RDB,
+			RedisEnabled: func() bool {
+				return common.RedisEnabled && common.RDB != nil
+			},
+			RedisCodec: cachex.JSONCodec[PostpaidAccount]{},
+			Memory: func() *hot.HotCache[string, PostpaidAccount] {
+				return hot.NewHotCache[string, PostpaidAccount](hot.LRU, 10000).
+					WithTTL(ttl).
+					WithJanitor().
+					Build()
+			},
+		})
+	})
+	return postpaidAccountCache
+}
+
+func InvalidatePostpaidAccountCache(userId int) {
+	if userId <= 0 {
+		return
+	}
+	_, _ = getPostpaidAccountCache().DeleteMany([]string{strconv.Itoa(userId)})
+}
+
+// GetPostpaidAccountByUserId 从数据库读取用户的后付费账户
+func GetPostpaidAccountByUserId(userId int) (*PostpaidAccount, error) {
+	if userId <= 0 {
+		return nil, errors.New("invalid user id")
+	}
+	var account PostpaidAccount
+	if err := DB.Where("user_id = ?", userId).First(&account).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPostpaidAccountNotFound
+		}
+		return nil, err
+	}
+	return &account, nil
+}
+
+// GetPostpaidAccountCached 带缓存读取后付费账户；用户未开通时返回 Id 为 0 的空账户
+func GetPostpaidAccountCached(userId int) (*PostpaidAccount, error) {
+	if userId <= 0 {
+		return &PostpaidAccount{}, nil
+	}
+	key := strconv.Itoa(userId)
+	cache := getPostpaidAccountCache()
+	if cached, found, err := cache.Get(key); err == nil && found {
+		return &cached, nil
+	}
+	account, err := GetPostpaidAccountByUserId(userId)
+	if err != nil {
+		if !errors.Is(err, ErrPostpaidAccountNotFound) {
+			return nil, err
+		}
+		account = &PostpaidAccount{UserId: userId}
+	}
+	_ = cache.SetWithTTL(key, *account, postpaidAccountCacheTTL())
+	return account, nil
+}
+
+// GetUserQuotaWithCredit 返回用户余额与后付费可用信用额度，额度检查应以二者之和为准
+func GetUserQuotaWithCredit(userId int) (userQuota int, availableCredit int, err error) {
+	userQuota, err = GetUserQuota(userId, false)
+	if err != nil {
+		return 0, 0, err
+	}
+	account, err := GetPostpaidAccountCached(userId)
+	if err != nil {
+		return 0, 0, err
+	}
+	return userQuota, int(account.AvailableCredit()), nil
+}
+
+func GetAllPostpaidAccounts(startIdx int, num int) ([]*PostpaidAccount, int64, error) {
+	var accounts []*PostpaidAccount
+	var total int64
+	if err := DB.Model(&PostpaidAccount{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := DB.Order("id desc").Limit(num).Offset(startIdx).Find(&accounts).Error; err != nil {
+		return nil, 0, err
+	}
+	return accounts, total, nil
+}
+
+// UpsertPostpaidAccount 创建或更新用户的后付费配置；新开通时从当前时间开始第一个账期
+func UpsertPostpaidAccount(userId int, enabled bool, creditLimit int64, cycleDays int, paymentTermDays int, remark string) (*PostpaidAccount, error) {
+	if userId <= 0 {
+		return nil, errors.New("invalid user id")
+	}
+	if creditLimit < 0 {
+		return nil, errors.New("信用额度不能为负数")
+	}
+	if cycleDays <= 0 {
+		cycleDays = 30
+	}
+	if paymentTermDays < 0 {
+		paymentTermDays = 0
+	}
+	account, err := GetPostpaidAccountByUserId(userId)
+	if err != nil && !errors.Is(err, ErrPostpaidAccountNotFound) {
+		return nil, err
+	}
+	if account == nil {
+		now := common.GetTimestamp()
+		account = &PostpaidAccount{
+			UserId:         userId,
+			Status:         PostpaidStatusActive,
+			CycleStartTime: now,
+			CycleEndTime:   now + int64(cycleDays)*86400,
+		}
+	}
+	account.Enabled = enabled
+	account.CreditLimit = creditLimit
+	account.CycleDays = cycleDays
+	account.PaymentTermDays = paymentTermDays
+	account.Remark = remark
+	if account.Id == 0 {
+		err = DB.Create(account).Error
+	} else {
+		err = DB.Save(account).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+	InvalidatePostpaidAccountCache(userId)
+	return account, nil
+}
+
+// ClosePostpaidCycle 关闭用户当前账期：将透支余额转为账单并把运行余额重置为 0。
+// 批量更新中尚未落库的余额增量在同一事务中先行写入，避免按过期余额出账
+func ClosePostpaidCycle(userId int) (*PostpaidStatement, error) {
+	var statement *PostpaidStatement
+	var settled int64
+	now := common.GetTimestamp()
+	pendingQuota := takeBatchUpdateRecord(BatchUpdateTypeUserQuota, userId)
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var account PostpaidAccount
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", userId).First(&account).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrPostpaidAccountNotFound
+			}
+			return err
+		}
+		if pendingQuota != 0 {
+			if err := tx.Model(&User{}).Where("id = ?", userId).
+				Update("quota", gorm.Expr("quota + ?", pendingQuota)).Error; err != nil {
+				return err
+			}
+		}
+		var quota int64
+		if err := tx.Model(&User{}).Where("id = ?", userId).Select("quota").Find(&quota).Error; err != nil {
+			return err
+		}
+		amountDue := int64(0)
+		if quota < 0 {
+			amountDue = -quota
+		}
+		cycleEnd := account.CycleEndTime
+		if cycleEnd <= 0 || cycleEnd > now {
+			cycleEnd = now
+		}
+		statement = &PostpaidStatement{
+			UserId:         userId,
+			CycleStartTime: account.CycleStartTime,
+			CycleEndTime:   cycleEnd,
+			AmountDue:      amountDue,
+			DueTime:        cycleEnd + int64(account.PaymentTermDays)*86400,
+			Status:         PostpaidStatementOpen,
+		}
+		if amountDue == 0 {
+			statement.Status = PostpaidStatementPaid
+			statement.PaidAt = now
+		}
+		if err := tx.Create(statement).Error; err != nil {
+			return err
+		}
+		if amountDue > 0 {
+			if err := tx.Model(&User{}).Where("id = ?", userId).
+				Update("quota", gorm.Expr("quota + ?", amountDue)).Error; err != nil {
+				return err
+			}
+			settled = amountDue
+		}
+		cycleDays := account.CycleDays
+		if cycleDays <= 0 {
+			cycleDays = 30
+		}
+		return tx.Model(&PostpaidAccount{}).Where("id = ?", account.Id).Updates(map[string]interface{}{
+			"cycle_start_time":   cycleEnd,
+			"cycle_end_time":     cycleEnd + int64(cycleDays)*86400,
+			"outstanding_amount": gorm.Expr("outstanding_amount + ?", amountDue),
+			"updated_at":         now,
+		}).Error
+	})
+	if err != nil {
+		if pendingQuota != 0 {
+			addNewRecord(BatchUpdateTypeUserQuota, userId, pendingQuota)
+		}
+		return nil, err
+	}
+	if settled > 0 {
+		if err := cacheIncrUserQuota(userId, settled); err != nil {
+			common.SysLog(fmt.Sprintf("failed to update user quota cache after postpaid close: user_id=%d, error=%v", userId, err))
+		}
+	}
+	InvalidatePostpaidAccountCache(userId)
+	return statement, nil
+}
+
+// GetDuePostpaidAccounts 按 id 顺序返回 afterId 之后账期已结束、需要出账的账户（仅含 id 与 user_id）
+func GetDuePostpaidAccounts(afterId int, limit int) ([]*PostpaidAccount, error) {
+	if limit <= 0 {
+		limit = 200
+	}
+	var accounts []*PostpaidAccount
+	err := DB.Model(&PostpaidAccount{}).
+		Select("id, user_id").
+		Where("enabled = ? AND cycle_end_time > 0 AND cycle_end_time <= ? AND id > ?", true, common.GetTimestamp(), afterId).
+		Order("id asc").
+		Limit(limit).
+		Find(&accounts).Error
+	return accounts, err
+}
+
+// RefreshPostpaidOverdueStatus 根据最早逾期未付账单的逾期天数更新账户状态，返回状态发生变化的账户
+func RefreshPostpaidOverdueStatus(throttleAfterDays int, suspendAfterDays int) ([]*PostpaidAccount, error) {
+	now := common.GetTimestamp()
+	var accounts []*PostpaidAccount
+	if err := DB.Where("enabled = ?", true).Find(&accounts).Error; err != nil {
+		return nil, err
+	}
+	changed := make([]*PostpaidAccount, 0)
+	for _, account := range accounts {
+		var earliestDue int64
+		if err := DB.Model(&PostpaidStatement{}).
+			Where("user_id = ? AND status = ? AND due_time <= ?", account.UserId, PostpaidStatementOpen, now).
+			Select("COALESCE(MIN(due_time), 0)").
+			Scan(&earliestDue).Error; err != nil {
+			return changed, err
+		}
+		status := PostpaidStatusActive
+		var overdueSince int64
+		if earliestDue > 0 {
+			overdueSince = earliestDue
+			overdueDays := int((now - earliestDue) / 86400)
+			switch {
+			case suspendAfterDays > 0 && overdueDays >= suspendAfterDays:
+				status = PostpaidStatusSuspended
+			case throttleAfterDays > 0 && overdueDays >= throttleAfterDays:
+				status = PostpaidStatusThrottled
+			default:
+				status = PostpaidStatusOverdue
+			}
+		}
+		if status == account.Status && overdueSince == account.OverdueSince {
+			continue
+		}
+		if err := DB.Model(&PostpaidAccount{}).Where("id = ?", account.Id).Updates(map[string]interface{}{
+			"status":        status,
+			"overdue_since": overdueSince,
+			"updated_at":    now,
+		}).Error; err != nil {
+			return changed, err
+		}
+		InvalidatePostpaidAccountCache(account.UserId)
+		if status != account.Status {
+			account.Status = status
+			account.OverdueSince = overdueSince
+			changed = append(changed, account)
+		}
+	}
+	return changed, nil
+}
+
+func GetPostpaidStatements(userId int, status string, startIdx int, num int) ([]*PostpaidStatement, int64, error) {
+	var statements []*PostpaidStatement
+	var total int64
+	query := DB.Model(&PostpaidStatement{})
+	if userId > 0 {
+		query = query.Where("user_id = ?", userId)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := query.Order("id desc").Limit(num).Offset(startIdx).Find(&statements).Error; err != nil {
+		return nil, 0, err
+	}
+	return statements, total, nil
+}
+
+func GetPostpaidPaymentsByStatementId(statementId int) ([]*PostpaidPayment, error) {
+	var payments []*PostpaidPayment
+	err := DB.Where("statement_id = ?", statementId).Order("id desc").Find(&payments).Error
+	return payments, err
+}
+
+// RecordPostpaidPayment 登记一笔线下付款，付清后账单置为已付并释放占用的信用额度
+func RecordPostpaidPayment(statementId int, amount int64, method string, reference string, remark string, operatorId int) (*PostpaidStatement, error) {
+	if amount <= 0 {
+		return nil, errors.New("付款金额必须大于 0")
+	}
+	var statement PostpaidStatement
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", statementId).First(&statement).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrPostpaidStatementNotFound
+			}
+			return err
+		}
+		if statement.Status == PostpaidStatementPaid {
+			return ErrPostpaidStatementPaid
+		}
+		remaining := statement.Remaining()
+		if amount > remaining {
+			return fmt.Errorf("付款金额超过账单剩余应付金额 %d", remaining)
+		}
+		payment := &PostpaidPayment{
+			StatementId: statement.Id,
+			UserId:      statement.UserId,
+			Amount:      amount,
+			Method:      method,
+			Reference:   reference,
+			Remark:      remark,
+			OperatorId:  operatorId,
+		}
+		if err := tx.Create(payment).Error; err != nil {
+			return err
+		}
+		statement.AmountPaid += amount
+		if statement.Remaining() == 0 {
+			statement.Status = PostpaidStatementPaid
+			statement.PaidAt = common.GetTimestamp()
+		}
+		if err := tx.Save(&statement).Error; err != nil {
+			return err
+		}
+		return tx.Model(&PostpaidAccount{}).Where("user_id = ?", statement.UserId).
+			Update("outstanding_amount", gorm.Expr("CASE WHEN outstanding_amount > ? THEN outstanding_amount - ? ELSE 0 END", amount, amount)).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	InvalidatePostpaidAccountCache(statement.UserId)
+	return &statement, nil
+}
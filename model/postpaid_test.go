@@ -0,0 +1,140 @@
+package model
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupPostpaidTest(t *testing.T) *User {
+	t.Helper()
+	truncateTables(t)
+	require.NoError(t, DB.AutoMigrate(&PostpaidAccount{}, &PostpaidStatement{}, &PostpaidPayment{}))
+	t.Cleanup(func() {
+		DB.Exec("DELETE FROM postpaid_accounts")
+		DB.Exec("DELETE FROM postpaid_statements")
+		DB.Exec("DELETE FROM postpaid_payments")
+	})
+	user := &User{Username: "postpaid_user", Password: "password", Quota: 0, AffCode: "pp01"}
+	require.NoError(t, DB.Create(user).Error)
+	return user
+}
+
+func TestPostpaidCycleCloseAndPayment(t *testing.T) {
+	user := setupPostpaidTest(t)
+
+	account, err := UpsertPostpaidAccount(user.Id, true, 10000, 30, 30, "")
+	require.NoError(t, err)
+	assert.EqualValues(t, 10000, account.AvailableCredit())
+
+	// 用户透支 4000
+	require.NoError(t, DB.Model(&User{}).Where("id = ?", user.Id).Update("quota", -4000).Error)
+
+	statement, err := ClosePostpaidCycle(user.Id)
+	require.NoError(t, err)
+	assert.EqualValues(t, 4000, statement.AmountDue)
+	assert.Equal(t, PostpaidStatementOpen, statement.Status)
+
+	quota, err := GetUserQuota(user.Id, true)
+	require.NoError(t, err)
+	assert.Equal(t, 0, quota)
+
+	account, err = GetPostpaidAccountByUserId(user.Id)
+	require.NoError(t, err)
+	assert.EqualValues(t, 4000, account.OutstandingAmount)
+	assert.EqualValues(t, 6000, account.AvailableCredit())
+
+	_, err = RecordPostpaidPayment(statement.Id, 5000, "bank", "", "", 1)
+	assert.Error(t, err)
+
+	statement, err = RecordPostpaidPayment(statement.Id, 4000, "bank", "INV-1", "", 1)
+	require.NoError(t, err)
+	assert.Equal(t, PostpaidStatementPaid, statement.Status)
+
+	account, err = GetPostpaidAccountByUserId(user.Id)
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, account.OutstandingAmount)
+
+	_, err = RecordPostpaidPayment(statement.Id, 1, "bank", "", "", 1)
+	assert.ErrorIs(t, err, ErrPostpaidStatementPaid)
+}
+
+func TestRecordPostpaidPaymentConcurrent(t *testing.T) {
+	user := setupPostpaidTest(t)
+	_, err := UpsertPostpaidAccount(user.Id, true, 10000, 30, 30, "")
+	require.NoError(t, err)
+	require.NoError(t, DB.Model(&User{}).Where("id = ?", user.Id).Update("quota", -4000).Error)
+	statement, err := ClosePostpaidCycle(user.Id)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	var paid atomic.Int32
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := RecordPostpaidPayment(statement.Id, 4000, "bank", "", "", 1); err == nil {
+				paid.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, 1, paid.Load())
+
+	var total int64
+	require.NoError(t, DB.Model(&PostpaidPayment{}).Where("statement_id = ?", statement.Id).
+		Select("COALESCE(SUM(amount), 0)").Scan(&total).Error)
+	assert.EqualValues(t, 4000, total)
+	account, err := GetPostpaidAccountByUserId(user.Id)
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, account.OutstandingAmount)
+}
+
+func TestRefreshPostpaidOverdueStatus(t *testing.T) {
+	user := setupPostpaidTest(t)
+
+	_, err := UpsertPostpaidAccount(user.Id, true, 10000, 30, 0, "")
+	require.NoError(t, err)
+	require.NoError(t, DB.Create(&PostpaidStatement{
+		UserId:    user.Id,
+		AmountDue: 100,
+		DueTime:   GetDBTimestamp() - 10*86400,
+		Status:    PostpaidStatementOpen,
+	}).Error)
+
+	changed, err := RefreshPostpaidOverdueStatus(7, 15)
+	require.NoError(t, err)
+	require.Len(t, changed, 1)
+	assert.Equal(t, PostpaidStatusThrottled, changed[0].Status)
+
+	changed, err = RefreshPostpaidOverdueStatus(3, 5)
+	require.NoError(t, err)
+	require.Len(t, changed, 1)
+	assert.Equal(t, PostpaidStatusSuspended, changed[0].Status)
+
+	account, err := GetPostpaidAccountByUserId(user.Id)
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, account.AvailableCredit())
+}
+
+func TestClosePostpaidCycleAppliesPendingBatchQuota(t *testing.T) {
+	user := setupPostpaidTest(t)
+
+	_, err := UpsertPostpaidAccount(user.Id, true, 10000, 30, 30, "")
+	require.NoError(t, err)
+	require.NoError(t, DB.Model(&User{}).Where("id = ?", user.Id).Update("quota", -1000).Error)
+	// 尚未落库的批量扣费也应计入本期账单
+	addNewRecord(BatchUpdateTypeUserQuota, user.Id, -500)
+
+	statement, err := ClosePostpaidCycle(user.Id)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1500, statement.AmountDue)
+	assert.Equal(t, 0, takeBatchUpdateRecord(BatchUpdateTypeUserQuota, user.Id))
+
+	quota, err := GetUserQuota(user.Id, true)
+	require.NoError(t, err)
+	assert.Equal(t, 0, quota)
+}
@@ -0,0 +1,171 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/samber/hot"
+	"gorm.io/gorm"
+)
+
+// PromptTemplate 提示词模板，同名模板的每个版本一行，版本创建后内容不可修改。
+// UserId 为 0 表示管理员维护的全局模板，所有用户可引用；用户模板仅本人可引用，且优先于同名全局模板。
+// Messages 为 JSON 数组 [{"role":"system","content":"..."}]，content 中的 {{name}} 在请求时替换为变量值；
+// Variables 为变量默认值（JSON 对象）。请求未指定版本时使用 Active 版本，没有 Active 版本时使用最新版本
+type PromptTemplate struct {
+	Id          int    `json:"id"`
+	UserId      int    `json:"user_id" gorm:"uniqueIndex:uk_prompt_template_version;index"`
+	Name        string `json:"name" gorm:"size:64;not null;uniqueIndex:uk_prompt_template_version"`
+	Version     int    `json:"version" gorm:"not null;uniqueIndex:uk_prompt_template_version"`
+	Description string `json:"description,omitempty" gorm:"type:varchar(255)"`
+	Messages    string `json:"messages" gorm:"type:text;not null"`
+	Variables   string `json:"variables,omitempty" gorm:"type:text"`
+	Active      bool   `json:"active" gorm:"default:false"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+}
+
+var ErrPromptTemplateNotFound = errors.New("prompt template not found")
+
+// 请求引用模板时的解析结果缓存（含未找到的结果），模板变更时清空本实例缓存，其他实例在 TTL 后生效
+const promptTemplateCacheTTL = 30 * time.Second
+
+var (
+	promptTemplateCacheOnce sync.Once
+	promptTemplateCache     *hot.HotCache[string, *PromptTemplate]
+)
+
+func getPromptTemplateCache() *hot.HotCache[string, *PromptTemplate] {
+	promptTemplateCacheOnce.Do(func() {
+		promptTemplateCache = hot.NewHotCache[string, *PromptTemplate](hot.LRU, 10000).
+			WithTTL(promptTemplateCacheTTL).
+			WithJanitor().
+			Build()
+	})
+	return promptTemplateCache
+}
+
+// invalidatePromptTemplateCache 全局模板会影响所有用户的解析结果，因此整体清空
+func invalidatePromptTemplateCache() {
+	getPromptTemplateCache().Purge()
+}
+
+// InsertNewVersion 以 (UserId, Name) 下的最大版本号 +1 作为新版本写入
+func (t *PromptTemplate) InsertNewVersion() error {
+	defer invalidatePromptTemplateCache()
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var maxVersion int
+		if err := tx.Model(&PromptTemplate{}).
+			Where("user_id = ? AND name = ?", t.UserId, t.Name).
+			Select("COALESCE(MAX(version), 0)").Scan(&maxVersion).Error; err != nil {
+			return err
+		}
+		t.Id = 0
+		t.Version = maxVersion + 1
+		t.Active = false
+		t.CreatedTime = common.GetTimestamp()
+		return tx.Create(t).Error
+	})
+}
+
+// GetPromptTemplates 获取模板版本列表，name 为空时返回全部模板
+func GetPromptTemplates(userId int, name string) ([]*PromptTemplate, error) {
+	var templates []*PromptTemplate
+	query := DB.Where("user_id = ?", userId)
+	if name != "" {
+		query = query.Where("name = ?", name)
+	}
+	err := query.Order("name ASC").Order("version DESC").Find(&templates).Error
+	return templates, err
+}
+
+func GetPromptTemplateById(id int, userId int) (*PromptTemplate, error) {
+	var template PromptTemplate
+	err := DB.Where("id = ? AND user_id = ?", id, userId).First(&template).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrPromptTemplateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+// ActivatePromptTemplate 将指定版本设为同名模板的默认版本
+func ActivatePromptTemplate(id int, userId int) (*PromptTemplate, error) {
+	template, err := GetPromptTemplateById(id, userId)
+	if err != nil {
+		return nil, err
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&PromptTemplate{}).
+			Where("user_id = ? AND name = ? AND id <> ?", userId, template.Name, id).
+			Update("active", false).Error; err != nil {
+			return err
+		}
+		return tx.Model(&PromptTemplate{}).Where("id = ?", id).Update("active", true).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	invalidatePromptTemplateCache()
+	template.Active = true
+	return template, nil
+}
+
+func DeletePromptTemplate(id int, userId int) error {
+	result := DB.Where("id = ? AND user_id = ?", id, userId).Delete(&PromptTemplate{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPromptTemplateNotFound
+	}
+	invalidatePromptTemplateCache()
+	return nil
+}
+
+// ResolvePromptTemplate 按用户模板、全局模板的顺序查找；version 为 0 时取默认版本。结果经缓存，调用方不得修改返回的模板
+func ResolvePromptTemplate(userId int, name string, version int) (*PromptTemplate, error) {
+	cache := getPromptTemplateCache()
+	key := fmt.Sprintf("%d:%d:%s", userId, version, name)
+	if template, found, err := cache.Get(key); err == nil && found {
+		if template == nil {
+			return nil, ErrPromptTemplateNotFound
+		}
+		return template, nil
+	}
+	template, err := resolvePromptTemplate(userId, name, version)
+	if err != nil && !errors.Is(err, ErrPromptTemplateNotFound) {
+		return nil, err
+	}
+	cache.Set(key, template)
+	return template, err
+}
+
+func resolvePromptTemplate(userId int, name string, version int) (*PromptTemplate, error) {
+	owners := []int{userId}
+	if userId != 0 {
+		owners = append(owners, 0)
+	}
+	for _, owner := range owners {
+		var template PromptTemplate
+		query := DB.Where("user_id = ? AND name = ?", owner, name)
+		if version > 0 {
+			query = query.Where("version = ?", version)
+		} else {
+			query = query.Order("active DESC").Order("version DESC")
+		}
+		err := query.First(&template).Error
+		if err == nil {
+			return &template, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+	return nil, ErrPromptTemplateNotFound
+}
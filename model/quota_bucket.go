@@ -0,0 +1,257 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	QuotaBucketStatusActive  = "active"
+	QuotaBucketStatusExpired = "expired"
+)
+
+const (
+	QuotaBucketSourceRedemption = "redemption"
+	QuotaBucketSourceCheckin    = "checkin"
+	QuotaBucketSourceAffiliate  = "affiliate"
+)
+
+// QuotaBucket 带有效期的额度，发放时计入 User.Quota，钱包消费时优先从最早到期的额度中扣减，
+// 到期后扣回未使用的部分
+type QuotaBucket struct {
+	Id            int    `json:"id"`
+	UserId        int    `json:"user_id" gorm:"index;index:idx_quota_bucket_user_status,priority:1"`
+	Amount        int64  `json:"amount" gorm:"type:bigint;not null;default:0"`
+	Remaining     int64  `json:"remaining" gorm:"type:bigint;not null;default:0"`
+	ExpiredAmount int64  `json:"expired_amount" gorm:"type:bigint;not null;default:0"` // 到期时实际扣回的额度
+	Source        string `json:"source" gorm:"type:varchar(32);default:''"`
+	SourceId      int    `json:"source_id" gorm:"type:int;default:0"`
+	ExpireTime    int64  `json:"expire_time" gorm:"type:bigint;index"`
+	Status        string `json:"status" gorm:"type:varchar(16);index:idx_quota_bucket_user_status,priority:2"`
+	CreatedAt     int64  `json:"created_at" gorm:"bigint"`
+	UpdatedAt     int64  `json:"updated_at" gorm:"bigint"`
+}
+
+func (b *QuotaBucket) BeforeCreate(tx *gorm.DB) error {
+	now := common.GetTimestamp()
+	b.CreatedAt = now
+	b.UpdatedAt = now
+	return nil
+}
+
+func (b *QuotaBucket) BeforeUpdate(tx *gorm.DB) error {
+	b.UpdatedAt = common.GetTimestamp()
+	return nil
+}
+
+// GrantQuotaBucketTx 在事务中为用户发放一笔带有效期的额度
+func GrantQuotaBucketTx(tx *gorm.DB, userId int, amount int64, source string, sourceId int, expireTime int64) (*QuotaBucket, error) {
+	if userId <= 0 || amount <= 0 {
+		return nil, errors.New("invalid quota bucket")
+	}
+	if expireTime <= common.GetTimestamp() {
+		return nil, errors.New("过期时间必须晚于当前时间")
+	}
+	bucket := &QuotaBucket{
+		UserId:     userId,
+		Amount:     amount,
+		Remaining:  amount,
+		Source:     source,
+		SourceId:   sourceId,
+		ExpireTime: expireTime,
+		Status:     QuotaBucketStatusActive,
+	}
+	if err := tx.Create(bucket).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", amount)).Error; err != nil {
+		return nil, err
+	}
+	return bucket, nil
+}
+
+// GrantExpiringQuota 发放限时额度；expireDays <= 0 时作为永久额度直接计入余额
+func GrantExpiringQuota(userId int, quota int, expireDays int, source string, sourceId int) error {
+	if quota <= 0 {
+		return nil
+	}
+	if expireDays <= 0 {
+		return IncreaseUserQuota(userId, quota, true)
+	}
+	expireTime := time.Now().AddDate(0, 0, expireDays).Unix()
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		_, err := GrantQuotaBucketTx(tx, userId, int64(quota), source, sourceId, expireTime)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := invalidateUserCache(userId); err != nil {
+		common.SysLog(fmt.Sprintf("failed to invalidate user cache after granting quota bucket: user_id=%d, error=%v", userId, err))
+	}
+	return nil
+}
+
+// ConsumeQuotaBuckets 按到期时间由近到远从用户的限时额度中扣减 amount，
+// 限时额度不足的部分视为消耗永久额度，返回实际从限时额度中扣减的数量
+func ConsumeQuotaBuckets(userId int, amount int64) (consumed int64, err error) {
+	if userId <= 0 || amount <= 0 {
+		return 0, nil
+	}
+	now := common.GetTimestamp()
+	var count int64
+	if err := DB.Model(&QuotaBucket{}).
+		Where("user_id = ? AND status = ? AND remaining > 0 AND expire_time > ?", userId, QuotaBucketStatusActive, now).
+		Count(&count).Error; err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		var buckets []QuotaBucket
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND status = ? AND remaining > 0 AND expire_time > ?", userId, QuotaBucketStatusActive, now).
+			Order("expire_time asc, id asc").Find(&buckets).Error; err != nil {
+			return err
+		}
+		left := amount
+		for i := range buckets {
+			if left <= 0 {
+				break
+			}
+			drawn, err := drawQuotaBucketTx(tx, &buckets[i], left)
+			if err != nil {
+				return err
+			}
+			left -= drawn
+			consumed += drawn
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return consumed, nil
+}
+
+// drawQuotaBucketTx 从单个限时额度中扣减不超过 left 的数量；扣减带 remaining 条件，
+// 行锁不可用（如 SQLite）或读到的剩余额度已过期时，重新读取剩余额度后再扣，保证 remaining 不会变为负数
+func drawQuotaBucketTx(tx *gorm.DB, bucket *QuotaBucket, left int64) (int64, error) {
+	remaining := bucket.Remaining
+	for remaining > 0 {
+		draw := remaining
+		if draw > left {
+			draw = left
+		}
+		result := tx.Model(bucket).Where("status = ? AND remaining >= ?", QuotaBucketStatusActive, draw).
+			Update("remaining", gorm.Expr("remaining - ?", draw))
+		if result.Error != nil {
+			return 0, result.Error
+		}
+		if result.RowsAffected > 0 {
+			return draw, nil
+		}
+		var current QuotaBucket
+		if err := tx.Select("remaining", "status").Where("id = ?", bucket.Id).First(&current).Error; err != nil {
+			return 0, err
+		}
+		if current.Status != QuotaBucketStatusActive {
+			return 0, nil
+		}
+		remaining = current.Remaining
+	}
+	return 0, nil
+}
+
+// GetActiveQuotaBuckets 返回用户尚未到期且有剩余的限时额度，按到期时间排序
+func GetActiveQuotaBuckets(userId int) ([]QuotaBucket, error) {
+	var buckets []QuotaBucket
+	err := DB.Where("user_id = ? AND status = ? AND remaining > 0", userId, QuotaBucketStatusActive).
+		Order("expire_time asc, id asc").Find(&buckets).Error
+	return buckets, err
+}
+
+// expireQuotaBucket 将到期额度从用户余额中扣回，扣回金额不超过当前余额。
+// 状态变更与余额扣减均带条件，并发处理同一额度时只会扣回一次
+func expireQuotaBucket(bucketId int) (userId int, expired int64, err error) {
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		var bucket QuotaBucket
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", bucketId).First(&bucket).Error; err != nil {
+			return err
+		}
+		if bucket.Status != QuotaBucketStatusActive {
+			return nil
+		}
+		var user User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "quota").Where("id = ?", bucket.UserId).First(&user).Error; err != nil {
+			return err
+		}
+		amount := bucket.Remaining
+		if amount > int64(user.Quota) {
+			amount = int64(user.Quota)
+		}
+		if amount < 0 {
+			amount = 0
+		}
+		result := tx.Model(&bucket).Where("status = ? AND remaining = ?", QuotaBucketStatusActive, bucket.Remaining).
+			Updates(map[string]interface{}{
+				"remaining":      0,
+				"expired_amount": amount,
+				"status":         QuotaBucketStatusExpired,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("quota bucket changed concurrently, retry later")
+		}
+		if amount > 0 {
+			result = tx.Model(&User{}).Where("id = ? AND quota >= ?", bucket.UserId, amount).
+				Update("quota", gorm.Expr("quota - ?", amount))
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errors.New("user quota changed concurrently, retry later")
+			}
+		}
+		userId = bucket.UserId
+		expired = amount
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return userId, expired, nil
+}
+
+// ExpireDueQuotaBuckets 处理已到期的额度，返回本次处理的数量
+func ExpireDueQuotaBuckets(limit int) (int, error) {
+	var ids []int
+	if err := DB.Model(&QuotaBucket{}).
+		Where("status = ? AND expire_time <= ?", QuotaBucketStatusActive, common.GetTimestamp()).
+		Order("expire_time asc").Limit(limit).Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		userId, expired, err := expireQuotaBucket(id)
+		if err != nil {
+			return 0, err
+		}
+		if expired > 0 {
+			if err := invalidateUserCache(userId); err != nil {
+				common.SysLog(fmt.Sprintf("failed to invalidate user cache after quota expiry: user_id=%d, error=%v", userId, err))
+			}
+			RecordLog(userId, LogTypeSystem, fmt.Sprintf("限时额度已过期，扣除 %s", logger.LogQuota(int(expired))))
+		}
+	}
+	return len(ids), nil
+}
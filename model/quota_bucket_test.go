@@ -0,0 +1,175 @@
+package model
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func setupQuotaBucketTest(t *testing.T) *User {
+	t.Helper()
+	truncateTables(t)
+	require.NoError(t, DB.AutoMigrate(&QuotaBucket{}, &Checkin{}))
+	t.Cleanup(func() {
+		DB.Exec("DELETE FROM quota_buckets")
+		DB.Exec("DELETE FROM checkins")
+	})
+	user := &User{Username: "bucket_user", Password: "password", Quota: 1000, AffCode: "qb01", Group: "default"}
+	require.NoError(t, DB.Create(user).Error)
+	return user
+}
+
+func TestConsumeQuotaBucketsSoonestFirst(t *testing.T) {
+	user := setupQuotaBucketTest(t)
+	now := common.GetTimestamp()
+
+	var late, soon *QuotaBucket
+	require.NoError(t, DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if late, err = GrantQuotaBucketTx(tx, user.Id, 300, QuotaBucketSourceRedemption, 0, now+7200); err != nil {
+			return err
+		}
+		soon, err = GrantQuotaBucketTx(tx, user.Id, 200, QuotaBucketSourceCheckin, 0, now+3600)
+		return err
+	}))
+
+	consumed, err := ConsumeQuotaBuckets(user.Id, 250)
+	require.NoError(t, err)
+	assert.EqualValues(t, 250, consumed)
+
+	buckets, err := GetActiveQuotaBuckets(user.Id)
+	require.NoError(t, err)
+	require.Len(t, buckets, 1)
+	assert.Equal(t, late.Id, buckets[0].Id)
+	assert.EqualValues(t, 250, buckets[0].Remaining)
+
+	var drained QuotaBucket
+	require.NoError(t, DB.First(&drained, soon.Id).Error)
+	assert.EqualValues(t, 0, drained.Remaining)
+
+	// 限时额度不足的部分由永久额度承担
+	consumed, err = ConsumeQuotaBuckets(user.Id, 1000)
+	require.NoError(t, err)
+	assert.EqualValues(t, 250, consumed)
+
+	// 已被消耗完的额度到期时不再扣回
+	require.NoError(t, DB.Model(&QuotaBucket{}).Where("user_id = ?", user.Id).Update("expire_time", now-1).Error)
+	_, err = ExpireDueQuotaBuckets(10)
+	require.NoError(t, err)
+	quota, err := GetUserQuota(user.Id, true)
+	require.NoError(t, err)
+	assert.Equal(t, 1500, quota)
+}
+
+func TestConsumeQuotaBucketsConcurrent(t *testing.T) {
+	user := setupQuotaBucketTest(t)
+	now := common.GetTimestamp()
+	require.NoError(t, DB.Transaction(func(tx *gorm.DB) error {
+		if _, err := GrantQuotaBucketTx(tx, user.Id, 300, QuotaBucketSourceRedemption, 0, now+7200); err != nil {
+			return err
+		}
+		_, err := GrantQuotaBucketTx(tx, user.Id, 200, QuotaBucketSourceCheckin, 0, now+3600)
+		return err
+	}))
+
+	var wg sync.WaitGroup
+	var total atomic.Int64
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			consumed, err := ConsumeQuotaBuckets(user.Id, 50)
+			assert.NoError(t, err)
+			total.Add(consumed)
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, 500, total.Load())
+
+	var buckets []QuotaBucket
+	require.NoError(t, DB.Where("user_id = ?", user.Id).Find(&buckets).Error)
+	for _, bucket := range buckets {
+		assert.EqualValues(t, 0, bucket.Remaining)
+	}
+}
+
+func TestDrawQuotaBucketRechecksStaleRemaining(t *testing.T) {
+	user := setupQuotaBucketTest(t)
+	var bucket *QuotaBucket
+	require.NoError(t, DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		bucket, err = GrantQuotaBucketTx(tx, user.Id, 300, QuotaBucketSourceRedemption, 0, common.GetTimestamp()+3600)
+		return err
+	}))
+	// 模拟另一笔结算在读取之后扣减了同一额度
+	require.NoError(t, DB.Model(&QuotaBucket{}).Where("id = ?", bucket.Id).Update("remaining", 100).Error)
+
+	drawn, err := drawQuotaBucketTx(DB, bucket, 250)
+	require.NoError(t, err)
+	assert.EqualValues(t, 100, drawn)
+
+	var saved QuotaBucket
+	require.NoError(t, DB.First(&saved, bucket.Id).Error)
+	assert.EqualValues(t, 0, saved.Remaining)
+}
+
+func TestExpireQuotaBucketRecordsLeftover(t *testing.T) {
+	user := setupQuotaBucketTest(t)
+
+	var bucket *QuotaBucket
+	require.NoError(t, DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		bucket, err = GrantQuotaBucketTx(tx, user.Id, 400, QuotaBucketSourceAffiliate, 0, common.GetTimestamp()+3600)
+		return err
+	}))
+	_, err := ConsumeQuotaBuckets(user.Id, 100)
+	require.NoError(t, err)
+	require.NoError(t, DB.Model(&QuotaBucket{}).Where("id = ?", bucket.Id).Update("expire_time", common.GetTimestamp()-1).Error)
+
+	n, err := ExpireDueQuotaBuckets(10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	var saved QuotaBucket
+	require.NoError(t, DB.First(&saved, bucket.Id).Error)
+	assert.Equal(t, QuotaBucketStatusExpired, saved.Status)
+	assert.EqualValues(t, 300, saved.ExpiredAmount)
+	assert.EqualValues(t, 0, saved.Remaining)
+
+	quota, err := GetUserQuota(user.Id, true)
+	require.NoError(t, err)
+	assert.Equal(t, 1100, quota)
+}
+
+func TestCheckinGrantsExpiringQuota(t *testing.T) {
+	user := setupQuotaBucketTest(t)
+
+	setting := operation_setting.GetCheckinSetting()
+	original := *setting
+	t.Cleanup(func() { *setting = original })
+	setting.Enabled = true
+	setting.MinQuota = 500
+	setting.MaxQuota = 500
+	setting.QuotaExpireDays = 3
+
+	checkin, err := UserCheckin(user.Id)
+	require.NoError(t, err)
+
+	buckets, err := GetActiveQuotaBuckets(user.Id)
+	require.NoError(t, err)
+	require.Len(t, buckets, 1)
+	assert.Equal(t, QuotaBucketSourceCheckin, buckets[0].Source)
+	assert.Equal(t, checkin.Id, buckets[0].SourceId)
+	assert.EqualValues(t, 500, buckets[0].Remaining)
+
+	quota, err := GetUserQuota(user.Id, true)
+	require.NoError(t, err)
+	assert.Equal(t, 1500, quota)
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/QuantumNous/new-api/logger"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // ErrRedeemFailed is returned when redemption fails due to database error
@@ -27,6 +28,7 @@ type Redemption struct {
 	UsedUserId   int            `json:"used_user_id"`
 	DeletedAt    gorm.DeletedAt `gorm:"index"`
 	ExpiredTime  int64          `json:"expired_time" gorm:"bigint"` // 过期时间，0 表示不过期
+	CampaignId   int            `json:"campaign_id" gorm:"index;default:0"`
 }
 
 func GetAllRedemptions(startIdx int, num int) (redemptions []*Redemption, total int64, err error) {
@@ -123,6 +125,8 @@ func Redeem(key string, userId int) (quota int, err error) {
 		return 0, errors.New("无效的 user id")
 	}
 	redemption := &Redemption{}
+	var campaign *RedemptionCampaign
+	var newGroup string
 
 	keyCol := "`key`"
 	if common.UsingPostgreSQL {
@@ -140,7 +144,16 @@ func Redeem(key string, userId int) (quota int, err error) {
 		if redemption.ExpiredTime != 0 && redemption.ExpiredTime < common.GetTimestamp() {
 			return errors.New("该兑换码已过期")
 		}
-		err = tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", redemption.Quota)).Error
+		if redemption.CampaignId > 0 {
+			campaign = &RedemptionCampaign{}
+			// 锁定活动行，使同一活动的兑换串行执行，每人兑换次数上限的检查与写入不会被并发绕过
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(campaign, "id = ?", redemption.CampaignId).Error; err != nil {
+				return err
+			}
+			newGroup, err = redeemCampaignRewardTx(tx, campaign, redemption, userId)
+		} else {
+			err = tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", redemption.Quota)).Error
+		}
 		if err != nil {
 			return err
 		}
@@ -151,11 +164,26 @@ func Redeem(key string, userId int) (quota int, err error) {
 		return err
 	})
 	if err != nil {
+		if errors.Is(err, ErrRedemptionCampaignLimitReached) {
+			return 0, err
+		}
 		common.SysError("redemption failed: " + err.Error())
 		return 0, ErrRedeemFailed
 	}
-	RecordLog(userId, LogTypeTopup, fmt.Sprintf("通过兑换码充值 %s，兑换码ID %d", logger.LogQuota(redemption.Quota), redemption.Id))
-	return redemption.Quota, nil
+	if campaign == nil {
+		RecordLog(userId, LogTypeTopup, fmt.Sprintf("通过兑换码充值 %s，兑换码ID %d", logger.LogQuota(redemption.Quota), redemption.Id))
+		return redemption.Quota, nil
+	}
+	if newGroup != "" {
+		_ = UpdateUserGroupCache(userId, newGroup)
+	}
+	RecordLog(userId, LogTypeTopup, fmt.Sprintf("通过活动「%s」兑换码获得 %s，兑换码ID %d", campaign.Name, describeCampaignReward(campaign, redemption), redemption.Id))
+	switch campaign.RewardType {
+	case RedemptionRewardQuota, RedemptionRewardExpiringQuota:
+		return redemption.Quota, nil
+	default:
+		return 0, nil
+	}
 }
 
 func (redemption *Redemption) Insert() error {
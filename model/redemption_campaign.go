@@ -0,0 +1,258 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+
+	"gorm.io/gorm"
+)
+
+const (
+	RedemptionRewardQuota         = "quota"          // 永久额度
+	RedemptionRewardExpiringQuota = "expiring_quota" // 限时额度，N 天后过期
+	RedemptionRewardSubscription  = "subscription"   // 赠送订阅套餐 N 天
+	RedemptionRewardGroup         = "group"          // 调整用户分组
+)
+
+const (
+	// redemptionKeyLength 与 Redemption.Key 的 char(32) 保持一致
+	redemptionKeyLength         = 32
+	RedemptionCampaignMaxPrefix = 16
+)
+
+var ErrRedemptionCampaignLimitReached = errors.New("已达到该活动的兑换次数上限")
+
+// RedemptionCampaign 兑换码活动，同一活动下的兑换码共享奖励配置
+type RedemptionCampaign struct {
+	Id     int    `json:"id"`
+	Name   string `json:"name" gorm:"type:varchar(64);index"`
+	Prefix string `json:"prefix" gorm:"type:varchar(16);default:''"`
+
+	RewardType      string `json:"reward_type" gorm:"type:varchar(32);not null;default:'quota'"`
+	Quota           int    `json:"quota" gorm:"default:0"`
+	QuotaExpireDays int    `json:"quota_expire_days" gorm:"default:0"` // 限时额度的有效天数
+	PlanId          int    `json:"plan_id" gorm:"default:0"`
+	PlanDays        int    `json:"plan_days" gorm:"default:0"` // 订阅天数（0 = 按套餐时长）
+	Group           string `json:"group" gorm:"type:varchar(64);default:''"`
+
+	MaxRedemptionsPerUser int `json:"max_redemptions_per_user" gorm:"default:0"` // 每用户可兑换次数（0 = 不限）
+
+	CodeCount   int   `json:"code_count" gorm:"default:0"`
+	ExpiredTime int64 `json:"expired_time" gorm:"bigint"` // 兑换码过期时间，0 表示不过期
+	CreatedBy   int   `json:"created_by" gorm:"default:0"`
+	CreatedTime int64 `json:"created_time" gorm:"bigint"`
+}
+
+// RedemptionCampaignStats 活动兑换统计
+type RedemptionCampaignStats struct {
+	Total      int64 `json:"total"`
+	Redeemed   int64 `json:"redeemed"`
+	Unredeemed int64 `json:"unredeemed"`
+	Expired    int64 `json:"expired"`
+	Disabled   int64 `json:"disabled"`
+	Users      int64 `json:"users"`
+}
+
+type RedemptionCampaignSummary struct {
+	*RedemptionCampaign
+	Stats RedemptionCampaignStats `json:"stats"`
+}
+
+// ValidateReward 校验奖励配置
+func (campaign *RedemptionCampaign) ValidateReward() error {
+	switch campaign.RewardType {
+	case RedemptionRewardQuota:
+		if campaign.Quota <= 0 {
+			return errors.New("额度必须大于 0")
+		}
+	case RedemptionRewardExpiringQuota:
+		if campaign.Quota <= 0 || campaign.QuotaExpireDays <= 0 {
+			return errors.New("限时额度需要设置额度与有效天数")
+		}
+	case RedemptionRewardSubscription:
+		if campaign.PlanId <= 0 || campaign.PlanDays < 0 {
+			return errors.New("请选择有效的订阅套餐")
+		}
+		if _, err := GetSubscriptionPlanById(campaign.PlanId); err != nil {
+			return err
+		}
+	case RedemptionRewardGroup:
+		if strings.TrimSpace(campaign.Group) == "" {
+			return errors.New("请设置目标分组")
+		}
+	default:
+		return errors.New("无效的奖励类型")
+	}
+	return nil
+}
+
+func generateCampaignRedemptionKey(prefix string) string {
+	return prefix + common.GetRandomString(redemptionKeyLength-len(prefix))
+}
+
+// CreateRedemptionCampaign 创建活动并批量生成兑换码
+func CreateRedemptionCampaign(campaign *RedemptionCampaign, count int) error {
+	campaign.Prefix = strings.ToUpper(strings.TrimSpace(campaign.Prefix))
+	if len(campaign.Prefix) > RedemptionCampaignMaxPrefix {
+		return fmt.Errorf("前缀长度不能超过 %d", RedemptionCampaignMaxPrefix)
+	}
+	if err := campaign.ValidateReward(); err != nil {
+		return err
+	}
+	now := common.GetTimestamp()
+	campaign.CodeCount = count
+	campaign.CreatedTime = now
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(campaign).Error; err != nil {
+			return err
+		}
+		redemptions := make([]*Redemption, 0, count)
+		for i := 0; i < count; i++ {
+			redemptions = append(redemptions, &Redemption{
+				UserId:      campaign.CreatedBy,
+				Name:        campaign.Name,
+				Key:         generateCampaignRedemptionKey(campaign.Prefix),
+				Status:      common.RedemptionCodeStatusEnabled,
+				Quota:       campaign.Quota,
+				CreatedTime: now,
+				ExpiredTime: campaign.ExpiredTime,
+				CampaignId:  campaign.Id,
+			})
+		}
+		return tx.CreateInBatches(redemptions, 500).Error
+	})
+}
+
+func GetRedemptionCampaignById(id int) (*RedemptionCampaign, error) {
+	var campaign RedemptionCampaign
+	if err := DB.First(&campaign, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &campaign, nil
+}
+
+// UpdateRedemptionCampaign 更新活动名称、每用户上限与过期时间，奖励内容创建后不可修改
+func UpdateRedemptionCampaign(campaign *RedemptionCampaign) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(campaign).Select("name", "max_redemptions_per_user", "expired_time").Updates(campaign).Error; err != nil {
+			return err
+		}
+		return tx.Model(&Redemption{}).
+			Where("campaign_id = ? AND status = ?", campaign.Id, common.RedemptionCodeStatusEnabled).
+			Updates(map[string]interface{}{"name": campaign.Name, "expired_time": campaign.ExpiredTime}).Error
+	})
+}
+
+func GetRedemptionCampaignStats(campaignId int) (RedemptionCampaignStats, error) {
+	var stats RedemptionCampaignStats
+	now := common.GetTimestamp()
+	base := func() *gorm.DB {
+		return DB.Model(&Redemption{}).Where("campaign_id = ?", campaignId)
+	}
+	if err := base().Count(&stats.Total).Error; err != nil {
+		return stats, err
+	}
+	if err := base().Where("status = ?", common.RedemptionCodeStatusUsed).Count(&stats.Redeemed).Error; err != nil {
+		return stats, err
+	}
+	if err := base().Where("status = ?", common.RedemptionCodeStatusDisabled).Count(&stats.Disabled).Error; err != nil {
+		return stats, err
+	}
+	if err := base().Where("status = ? AND expired_time != 0 AND expired_time < ?", common.RedemptionCodeStatusEnabled, now).Count(&stats.Expired).Error; err != nil {
+		return stats, err
+	}
+	if err := base().Where("status = ?", common.RedemptionCodeStatusUsed).Distinct("used_user_id").Count(&stats.Users).Error; err != nil {
+		return stats, err
+	}
+	stats.Unredeemed = stats.Total - stats.Redeemed - stats.Disabled - stats.Expired
+	return stats, nil
+}
+
+func GetRedemptionCampaigns(startIdx int, num int) (summaries []*RedemptionCampaignSummary, total int64, err error) {
+	var campaigns []*RedemptionCampaign
+	if err = DB.Model(&RedemptionCampaign{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err = DB.Order("id desc").Limit(num).Offset(startIdx).Find(&campaigns).Error; err != nil {
+		return nil, 0, err
+	}
+	summaries = make([]*RedemptionCampaignSummary, 0, len(campaigns))
+	for _, campaign := range campaigns {
+		stats, err := GetRedemptionCampaignStats(campaign.Id)
+		if err != nil {
+			return nil, 0, err
+		}
+		summaries = append(summaries, &RedemptionCampaignSummary{RedemptionCampaign: campaign, Stats: stats})
+	}
+	return summaries, total, nil
+}
+
+func GetRedemptionsByCampaignId(campaignId int) (redemptions []*Redemption, err error) {
+	err = DB.Where("campaign_id = ?", campaignId).Order("id asc").Find(&redemptions).Error
+	return redemptions, err
+}
+
+// redeemCampaignRewardTx 在兑换事务中发放活动奖励，返回需要在事务外同步的分组（为空表示无变化）。
+// 调用方需已对 campaign 行加锁
+func redeemCampaignRewardTx(tx *gorm.DB, campaign *RedemptionCampaign, redemption *Redemption, userId int) (string, error) {
+	if campaign.MaxRedemptionsPerUser > 0 {
+		var used int64
+		if err := tx.Model(&Redemption{}).
+			Where("campaign_id = ? AND used_user_id = ? AND status = ?", campaign.Id, userId, common.RedemptionCodeStatusUsed).
+			Count(&used).Error; err != nil {
+			return "", err
+		}
+		if used >= int64(campaign.MaxRedemptionsPerUser) {
+			return "", ErrRedemptionCampaignLimitReached
+		}
+	}
+	switch campaign.RewardType {
+	case RedemptionRewardExpiringQuota:
+		expireTime := time.Now().AddDate(0, 0, campaign.QuotaExpireDays).Unix()
+		_, err := GrantQuotaBucketTx(tx, userId, int64(campaign.Quota), QuotaBucketSourceRedemption, redemption.Id, expireTime)
+		return "", err
+	case RedemptionRewardSubscription:
+		plan, err := GetSubscriptionPlanById(campaign.PlanId)
+		if err != nil {
+			return "", err
+		}
+		grantPlan := *plan
+		if campaign.PlanDays > 0 {
+			grantPlan.DurationUnit = SubscriptionDurationDay
+			grantPlan.DurationValue = campaign.PlanDays
+		}
+		if _, err := CreateUserSubscriptionFromPlanTx(tx, userId, &grantPlan, "redemption"); err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(plan.UpgradeGroup), nil
+	case RedemptionRewardGroup:
+		if err := tx.Model(&User{}).Where("id = ?", userId).Update("group", campaign.Group).Error; err != nil {
+			return "", err
+		}
+		return campaign.Group, nil
+	default:
+		return "", tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", redemption.Quota)).Error
+	}
+}
+
+// describeCampaignReward 返回用于日志的奖励描述
+func describeCampaignReward(campaign *RedemptionCampaign, redemption *Redemption) string {
+	switch campaign.RewardType {
+	case RedemptionRewardExpiringQuota:
+		return fmt.Sprintf("限时额度 %s（%d 天有效）", logger.LogQuota(redemption.Quota), campaign.QuotaExpireDays)
+	case RedemptionRewardSubscription:
+		if campaign.PlanDays > 0 {
+			return fmt.Sprintf("订阅套餐 #%d（%d 天）", campaign.PlanId, campaign.PlanDays)
+		}
+		return fmt.Sprintf("订阅套餐 #%d", campaign.PlanId)
+	case RedemptionRewardGroup:
+		return fmt.Sprintf("用户分组 %s", campaign.Group)
+	default:
+		return logger.LogQuota(redemption.Quota)
+	}
+}
@@ -0,0 +1,149 @@
+package model
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func setupRedemptionCampaignTest(t *testing.T) *User {
+	t.Helper()
+	truncateTables(t)
+	require.NoError(t, DB.AutoMigrate(&Redemption{}, &RedemptionCampaign{}, &QuotaBucket{}))
+	t.Cleanup(func() {
+		DB.Exec("DELETE FROM redemptions")
+		DB.Exec("DELETE FROM redemption_campaigns")
+		DB.Exec("DELETE FROM quota_buckets")
+	})
+	user := &User{Username: "campaign_user", Password: "password", Quota: 0, AffCode: "rc01", Group: "default"}
+	require.NoError(t, DB.Create(user).Error)
+	return user
+}
+
+func TestRedemptionCampaignExpiringQuota(t *testing.T) {
+	user := setupRedemptionCampaignTest(t)
+
+	campaign := &RedemptionCampaign{
+		Name:                  "spring",
+		Prefix:                "spring-",
+		RewardType:            RedemptionRewardExpiringQuota,
+		Quota:                 500,
+		QuotaExpireDays:       7,
+		MaxRedemptionsPerUser: 1,
+	}
+	require.NoError(t, CreateRedemptionCampaign(campaign, 3))
+
+	redemptions, err := GetRedemptionsByCampaignId(campaign.Id)
+	require.NoError(t, err)
+	require.Len(t, redemptions, 3)
+	for _, redemption := range redemptions {
+		assert.True(t, strings.HasPrefix(redemption.Key, "SPRING-"))
+		assert.Len(t, redemption.Key, redemptionKeyLength)
+	}
+
+	quota, err := Redeem(redemptions[0].Key, user.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 500, quota)
+
+	var buckets []QuotaBucket
+	require.NoError(t, DB.Where("user_id = ?", user.Id).Find(&buckets).Error)
+	require.Len(t, buckets, 1)
+	assert.EqualValues(t, 500, buckets[0].Remaining)
+	assert.Equal(t, QuotaBucketStatusActive, buckets[0].Status)
+
+	_, err = Redeem(redemptions[1].Key, user.Id)
+	assert.ErrorIs(t, err, ErrRedemptionCampaignLimitReached)
+
+	stats, err := GetRedemptionCampaignStats(campaign.Id)
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, stats.Total)
+	assert.EqualValues(t, 1, stats.Redeemed)
+	assert.EqualValues(t, 2, stats.Unredeemed)
+	assert.EqualValues(t, 1, stats.Users)
+}
+
+func TestRedemptionCampaignPerUserLimitConcurrent(t *testing.T) {
+	user := setupRedemptionCampaignTest(t)
+
+	campaign := &RedemptionCampaign{Name: "flash", RewardType: RedemptionRewardQuota, Quota: 100, MaxRedemptionsPerUser: 2}
+	require.NoError(t, CreateRedemptionCampaign(campaign, 6))
+	redemptions, err := GetRedemptionsByCampaignId(campaign.Id)
+	require.NoError(t, err)
+	require.Len(t, redemptions, 6)
+
+	var wg sync.WaitGroup
+	var succeeded, limited atomic.Int32
+	for _, redemption := range redemptions {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			_, err := Redeem(key, user.Id)
+			switch {
+			case err == nil:
+				succeeded.Add(1)
+			case errors.Is(err, ErrRedemptionCampaignLimitReached):
+				limited.Add(1)
+			default:
+				t.Errorf("unexpected redeem error: %v", err)
+			}
+		}(redemption.Key)
+	}
+	wg.Wait()
+	assert.EqualValues(t, 2, succeeded.Load())
+	assert.EqualValues(t, 4, limited.Load())
+
+	quota, err := GetUserQuota(user.Id, true)
+	require.NoError(t, err)
+	assert.Equal(t, 200, quota)
+}
+
+func TestRedemptionCampaignGroupReward(t *testing.T) {
+	user := setupRedemptionCampaignTest(t)
+
+	campaign := &RedemptionCampaign{Name: "vip", RewardType: RedemptionRewardGroup, Group: "vip"}
+	require.NoError(t, CreateRedemptionCampaign(campaign, 1))
+	redemptions, err := GetRedemptionsByCampaignId(campaign.Id)
+	require.NoError(t, err)
+
+	quota, err := Redeem(redemptions[0].Key, user.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 0, quota)
+
+	var saved User
+	require.NoError(t, DB.First(&saved, user.Id).Error)
+	assert.Equal(t, "vip", saved.Group)
+}
+
+func TestExpireDueQuotaBuckets(t *testing.T) {
+	user := setupRedemptionCampaignTest(t)
+
+	var bucket *QuotaBucket
+	require.NoError(t, DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		bucket, err = GrantQuotaBucketTx(tx, user.Id, 300, QuotaBucketSourceRedemption, 0, common.GetTimestamp()+3600)
+		return err
+	}))
+	require.NoError(t, DB.Model(&QuotaBucket{}).Where("id = ?", bucket.Id).Update("expire_time", common.GetTimestamp()-1).Error)
+	// 用户已消耗部分余额，过期扣回不应使余额为负
+	require.NoError(t, DB.Model(&User{}).Where("id = ?", user.Id).Update("quota", 200).Error)
+
+	n, err := ExpireDueQuotaBuckets(10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	quota, err := GetUserQuota(user.Id, true)
+	require.NoError(t, err)
+	assert.Equal(t, 0, quota)
+
+	var saved QuotaBucket
+	require.NoError(t, DB.First(&saved, bucket.Id).Error)
+	assert.Equal(t, QuotaBucketStatusExpired, saved.Status)
+}
@@ -0,0 +1,104 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// 额度消费计数：启用 Redis 时使用 INCRBY，否则使用进程内计数（仅在单实例部署下准确）。
+// 用于临时令牌消费上限、终端用户每日额度等无需落库的短期累计
+
+var spendCounterStore = struct {
+	sync.Mutex
+	spend   map[string]int
+	expires map[string]int64
+}{spend: map[string]int{}, expires: map[string]int64{}}
+
+func getSpendCounter(key string) int {
+	if common.RedisEnabled {
+		value, err := common.RedisGet(key)
+		if err != nil {
+			return 0
+		}
+		spend, _ := strconv.Atoi(value)
+		return spend
+	}
+	spendCounterStore.Lock()
+	defer spendCounterStore.Unlock()
+	if spendCounterStore.expires[key] < common.GetTimestamp() {
+		return 0
+	}
+	return spendCounterStore.spend[key]
+}
+
+// addSpendCounter 累加计数（delta 可为负）并返回累加后的值，计数在 expiresAt 之后清理
+func addSpendCounter(key string, delta int, expiresAt int64) (int, error) {
+	ttl := expiresAt - common.GetTimestamp()
+	if ttl < 60 {
+		ttl = 60
+	}
+	if common.RedisEnabled {
+		ctx := context.Background()
+		txn := common.RDB.TxPipeline()
+		incr := txn.IncrBy(ctx, key, int64(delta))
+		txn.Expire(ctx, key, time.Duration(ttl)*time.Second)
+		if _, err := txn.Exec(ctx); err != nil {
+			return 0, fmt.Errorf("failed to update spend counter: %w", err)
+		}
+		return int(incr.Val()), nil
+	}
+	spendCounterStore.Lock()
+	defer spendCounterStore.Unlock()
+	return addSpendCounterLocked(key, delta, ttl), nil
+}
+
+// reserveSpendCounter 原子地占用 delta 额度：累加后超过 limit 时撤销本次累加并返回 false。
+// Redis 下先 INCRBY 再比较，并发请求各自看到包含对方占用的结果，不会同时越过上限
+func reserveSpendCounter(key string, delta int, limit int, expiresAt int64) (bool, error) {
+	if common.RedisEnabled {
+		spend, err := addSpendCounter(key, delta, expiresAt)
+		if err != nil {
+			return false, err
+		}
+		if spend > limit {
+			if _, err := addSpendCounter(key, -delta, expiresAt); err != nil {
+				common.SysLog(fmt.Sprintf("failed to roll back spend counter %s: %s", key, err.Error()))
+			}
+			return false, nil
+		}
+		return true, nil
+	}
+	ttl := expiresAt - common.GetTimestamp()
+	if ttl < 60 {
+		ttl = 60
+	}
+	spendCounterStore.Lock()
+	defer spendCounterStore.Unlock()
+	spend := spendCounterStore.spend[key]
+	if spendCounterStore.expires[key] < common.GetTimestamp() {
+		spend = 0
+	}
+	if spend+delta > limit {
+		return false, nil
+	}
+	addSpendCounterLocked(key, delta, ttl)
+	return true, nil
+}
+
+func addSpendCounterLocked(key string, delta int, ttl int64) int {
+	now := common.GetTimestamp()
+	for id, expires := range spendCounterStore.expires {
+		if expires < now {
+			delete(spendCounterStore.spend, id)
+			delete(spendCounterStore.expires, id)
+		}
+	}
+	spendCounterStore.spend[key] += delta
+	spendCounterStore.expires[key] = now + ttl
+	return spendCounterStore.spend[key]
+}
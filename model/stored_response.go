@@ -0,0 +1,92 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+// 网关侧保存的 Responses API 响应：按响应 ID 与所属令牌保存本轮输入、最终响应与上一轮响应 ID，
+// 完整上下文沿 previous_response_id 链还原，使对话链不依赖上游账号的存储，切换渠道后仍可继续
+
+var ErrStoredResponseNotFound = errors.New("response not found")
+
+type StoredResponse struct {
+	Id                 int       `json:"id"`
+	ResponseId         string    `json:"response_id" gorm:"type:varchar(128);uniqueIndex"`
+	UserId             int       `json:"user_id" gorm:"index"`
+	TokenId            int       `json:"token_id" gorm:"index"`
+	Model              string    `json:"model" gorm:"type:varchar(255)"`
+	PreviousResponseId string    `json:"previous_response_id" gorm:"type:varchar(128);default:''"` // 网关展开过的上一轮响应，为空表示对话起点
+	InputItems         JSONValue `json:"input_items" gorm:"type:json"`                             // 本轮请求的输入项，不含历史
+	Response           JSONValue `json:"response" gorm:"type:json"`                                // 最终的 response 对象
+	CreatedTime        int64     `json:"created_time" gorm:"bigint"`
+	ExpiresTime        int64     `json:"expires_time" gorm:"bigint;index"`
+}
+
+// CreateStoredResponse 保存响应，同一令牌下同一响应 ID 重复保存时覆盖旧记录；
+// ancestorIds 为对话链上的历史响应，其过期时间顺延到与本响应一致，避免链条中途断开
+func CreateStoredResponse(stored *StoredResponse, ancestorIds []string) error {
+	if stored.CreatedTime == 0 {
+		stored.CreatedTime = common.GetTimestamp()
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("response_id = ? AND token_id = ?", stored.ResponseId, stored.TokenId).Delete(&StoredResponse{}).Error; err != nil {
+			return err
+		}
+		if len(ancestorIds) > 0 {
+			err := tx.Model(&StoredResponse{}).
+				Where("response_id IN ? AND token_id = ? AND expires_time < ?", ancestorIds, stored.TokenId, stored.ExpiresTime).
+				Update("expires_time", stored.ExpiresTime).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Create(stored).Error
+	})
+}
+
+// DeleteExpiredStoredResponses 删除已过期的响应，每次最多 limit 条，返回删除条数
+func DeleteExpiredStoredResponses(limit int) (int, error) {
+	var ids []int
+	if err := DB.Model(&StoredResponse{}).Where("expires_time < ?", common.GetTimestamp()).
+		Order("id").Limit(limit).Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	result := DB.Where("id IN ?", ids).Delete(&StoredResponse{})
+	return int(result.RowsAffected), result.Error
+}
+
+// GetStoredResponse 获取令牌名下未过期的响应，不存在、已过期或属于其他令牌时返回 ErrStoredResponseNotFound
+func GetStoredResponse(responseId string, tokenId int) (*StoredResponse, error) {
+	stored := StoredResponse{}
+	err := DB.Where("response_id = ? AND token_id = ?", responseId, tokenId).First(&stored).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrStoredResponseNotFound
+		}
+		return nil, err
+	}
+	if stored.ExpiresTime < common.GetTimestamp() {
+		DB.Delete(&stored)
+		return nil, ErrStoredResponseNotFound
+	}
+	return &stored, nil
+}
+
+// DeleteStoredResponse 删除令牌名下的响应
+func DeleteStoredResponse(responseId string, tokenId int) error {
+	result := DB.Where("response_id = ? AND token_id = ?", responseId, tokenId).Delete(&StoredResponse{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrStoredResponseNotFound
+	}
+	return nil
+}
@@ -14,7 +14,8 @@ import (
 type Token struct {
 	Id                 int            `json:"id"`
 	UserId             int            `json:"user_id" gorm:"index"`
-	Key                string         `json:"key" gorm:"type:char(48);uniqueIndex"`
+	Key                string         `json:"key" gorm:"type:char(48);uniqueIndex"`          // 哈希存储的令牌为 HashTokenKey 的结果
+	KeyPrefix          string         `json:"key_prefix" gorm:"type:varchar(16);default:''"` // 哈希存储的令牌保留的明文前缀，用于展示
 	Status             int            `json:"status" gorm:"default:1"`
 	Name               string         `json:"name" gorm:"index" `
 	CreatedTime        int64          `json:"created_time" gorm:"bigint"`
@@ -29,12 +30,46 @@ type Token struct {
 	Group              string         `json:"group" gorm:"default:''"`
 	CrossGroupRetry    bool           `json:"cross_group_retry"` // 跨分组重试，仅auto分组有效
 	DeletedAt          gorm.DeletedAt `gorm:"index"`
+
+	// 密钥轮换：旧密钥（与 Key 相同的存储形式）在宽限期结束前仍可使用
+	PreviousKey            string `json:"-" gorm:"type:char(48);index;default:''"`
+	PreviousKeyExpiresTime int64  `json:"previous_key_expires_time" gorm:"bigint;default:0"`
+	RotationInterval       int64  `json:"rotation_interval" gorm:"bigint;default:0"` // 自动轮换间隔（秒），0 表示不自动轮换
+	LastRotatedTime        int64  `json:"last_rotated_time" gorm:"bigint;default:0"`
+	UsingPreviousKey       bool   `json:"-" gorm:"-"` // 本次请求使用的是宽限期内的旧密钥
+
+	// 终端用户限制：同一令牌下按终端用户标识（OpenAI user / safety_identifier 等）分别限流，0 表示不限制
+	EndUserRPM        int    `json:"end_user_rpm" gorm:"default:0"`
+	EndUserDailyQuota int    `json:"end_user_daily_quota" gorm:"default:0"`
+	BlockedEndUsers   string `json:"blocked_end_users" gorm:"type:text"` // 逗号或换行分隔
+
+	// MCP 网关访问控制：允许访问的服务器与工具，逗号或换行分隔，形如 server、server/tool 或 server/*；为空时不允许访问 MCP 网关
+	McpAllowlist string `json:"mcp_allowlist" gorm:"type:text"`
 }
 
 func (token *Token) Clean() {
 	token.Key = ""
 }
 
+// IsHashed 令牌是否以哈希形式存储（完整密钥仅在创建时可见）
+func (token *Token) IsHashed() bool {
+	return IsHashedTokenKey(token.Key)
+}
+
+// SetKey 设置新令牌的密钥，开启哈希存储时仅保存前缀与 keyed hash
+func (token *Token) SetKey(key string) {
+	if !operation_setting.GetTokenSetting().HashNewTokens {
+		token.Key = key
+		token.KeyPrefix = ""
+		return
+	}
+	token.Key = HashTokenKey(key)
+	token.KeyPrefix = key
+	if len(key) > tokenKeyPrefixLength {
+		token.KeyPrefix = key[:tokenKeyPrefixLength]
+	}
+}
+
 func MaskTokenKey(key string) string {
 	if key == "" {
 		return ""
@@ -48,11 +83,18 @@ func MaskTokenKey(key string) string {
 	return key[:4] + "**********" + key[len(key)-4:]
 }
 
+// GetFullKey 返回完整密钥，哈希存储的令牌返回空字符串
 func (token *Token) GetFullKey() string {
+	if token.IsHashed() {
+		return ""
+	}
 	return token.Key
 }
 
 func (token *Token) GetMaskedKey() string {
+	if token.IsHashed() {
+		return token.KeyPrefix + "**********"
+	}
 	return MaskTokenKey(token.Key)
 }
 
@@ -166,7 +208,12 @@ func SearchUserTokens(userId int, keyword string, token string, offset int, limi
 		if err != nil {
 			return nil, 0, err
 		}
-		baseQuery = baseQuery.Where(commonKeyCol+" LIKE ? ESCAPE '!'", tokenPattern)
+		if strings.Contains(token, "%") {
+			baseQuery = baseQuery.Where(commonKeyCol+" LIKE ? ESCAPE '!'", tokenPattern)
+		} else {
+			// 精确搜索同时匹配哈希存储的令牌
+			baseQuery = baseQuery.Where("("+commonKeyCol+" LIKE ? ESCAPE '!' OR "+commonKeyCol+" = ?)", tokenPattern, HashTokenKey(token))
+		}
 	}
 
 	// 先查匹配总数（用于分页，受 maxTokens 上限保护，避免全表 COUNT）
@@ -191,40 +238,7 @@ func ValidateUserToken(key string) (token *Token, err error) {
 	}
 	token, err = GetTokenByKey(key, false)
 	if err == nil {
-		if token.Status == common.TokenStatusExhausted {
-			keyPrefix := key[:3]
-			keySuffix := key[len(key)-3:]
-			return token, errors.New("该令牌额度已用尽 TokenStatusExhausted[sk-" + keyPrefix + "***" + keySuffix + "]")
-		} else if token.Status == common.TokenStatusExpired {
-			return token, errors.New("该令牌已过期")
-		}
-		if token.Status != common.TokenStatusEnabled {
-			return token, errors.New("该令牌状态不可用")
-		}
-		if token.ExpiredTime != -1 && token.ExpiredTime < common.GetTimestamp() {
-			if !common.RedisEnabled {
-				token.Status = common.TokenStatusExpired
-				err := token.SelectUpdate()
-				if err != nil {
-					common.SysLog("failed to update token status" + err.Error())
-				}
-			}
-			return token, errors.New("该令牌已过期")
-		}
-		if !token.UnlimitedQuota && token.RemainQuota <= 0 {
-			if !common.RedisEnabled {
-				// in this case, we can make sure the token is exhausted
-				token.Status = common.TokenStatusExhausted
-				err := token.SelectUpdate()
-				if err != nil {
-					common.SysLog("failed to update token status" + err.Error())
-				}
-			}
-			keyPrefix := key[:3]
-			keySuffix := key[len(key)-3:]
-			return token, fmt.Errorf("[sk-%s***%s] 该令牌额度已用尽 !token.UnlimitedQuota && token.RemainQuota = %d", keyPrefix, keySuffix, token.RemainQuota)
-		}
-		return token, nil
+		return token, checkTokenAvailable(token, key)
 	}
 	common.SysLog("ValidateUserToken: failed to get token: " + err.Error())
 	if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -234,6 +248,44 @@ func ValidateUserToken(key string) (token *Token, err error) {
 	}
 }
 
+// checkTokenAvailable 检查令牌状态、有效期与剩余额度，key 仅用于错误信息中的脱敏展示
+func checkTokenAvailable(token *Token, key string) error {
+	if token.Status == common.TokenStatusExhausted {
+		keyPrefix := key[:3]
+		keySuffix := key[len(key)-3:]
+		return errors.New("该令牌额度已用尽 TokenStatusExhausted[sk-" + keyPrefix + "***" + keySuffix + "]")
+	} else if token.Status == common.TokenStatusExpired {
+		return errors.New("该令牌已过期")
+	}
+	if token.Status != common.TokenStatusEnabled {
+		return errors.New("该令牌状态不可用")
+	}
+	if token.ExpiredTime != -1 && token.ExpiredTime < common.GetTimestamp() {
+		if !common.RedisEnabled {
+			token.Status = common.TokenStatusExpired
+			err := token.SelectUpdate()
+			if err != nil {
+				common.SysLog("failed to update token status" + err.Error())
+			}
+		}
+		return errors.New("该令牌已过期")
+	}
+	if !token.UnlimitedQuota && token.RemainQuota <= 0 {
+		if !common.RedisEnabled {
+			// in this case, we can make sure the token is exhausted
+			token.Status = common.TokenStatusExhausted
+			err := token.SelectUpdate()
+			if err != nil {
+				common.SysLog("failed to update token status" + err.Error())
+			}
+		}
+		keyPrefix := key[:3]
+		keySuffix := key[len(key)-3:]
+		return fmt.Errorf("[sk-%s***%s] 该令牌额度已用尽 !token.UnlimitedQuota && token.RemainQuota = %d", keyPrefix, keySuffix, token.RemainQuota)
+	}
+	return nil
+}
+
 func GetTokenByIds(id int, userId int) (*Token, error) {
 	if id == 0 || userId == 0 {
 		return nil, errors.New("id 或 userId 为空！")
@@ -261,7 +313,12 @@ func GetTokenById(id int) (*Token, error) {
 	return &token, err
 }
 
+// GetTokenByKey 按完整密钥查找令牌，兼容明文与哈希存储；返回的令牌 Key 为传入的完整密钥
 func GetTokenByKey(key string, fromDB bool) (token *Token, err error) {
+	// 不接受哈希形式的输入，避免泄露的哈希值被直接当作令牌使用
+	if IsHashedTokenKey(key) {
+		return nil, gorm.ErrRecordNotFound
+	}
 	defer func() {
 		// Update Redis cache asynchronously on successful DB read
 		if shouldUpdateRedis(fromDB, err) && token != nil {
@@ -281,10 +338,38 @@ func GetTokenByKey(key string, fromDB bool) (token *Token, err error) {
 		// Don't return error - fall through to DB
 	}
 	fromDB = true
-	err = DB.Where(commonKeyCol+" = ?", key).First(&token).Error
+	err = DB.Where(commonKeyCol+" IN ?", []string{key, HashTokenKey(key)}).First(&token).Error
+	if err == nil {
+		token.Key = key
+		return token, nil
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// 轮换宽限期内的旧密钥，返回的令牌 Key 为当前密钥的存储形式，后续缓存与计费均按当前密钥处理
+		if previous, prevErr := getTokenByPreviousKey(key); prevErr == nil {
+			return previous, nil
+		}
+	}
 	return token, err
 }
 
+// GetTokenByStoredKey 按服务端上下文中保存的令牌密钥查找令牌，同时接受完整密钥与哈希存储形式。
+// 仅供计费等内部流程使用，不得用于校验客户端提交的密钥
+func GetTokenByStoredKey(key string) (*Token, error) {
+	if !IsHashedTokenKey(key) {
+		return GetTokenByKey(key, false)
+	}
+	if common.RedisEnabled {
+		if token, err := cacheGetTokenByKey(key); err == nil {
+			return token, nil
+		}
+	}
+	token := &Token{}
+	if err := DB.Where(commonKeyCol+" = ?", key).First(token).Error; err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
 func (token *Token) Insert() error {
 	var err error
 	err = DB.Create(token).Error
@@ -304,7 +389,8 @@ func (token *Token) Update() (err error) {
 		}
 	}()
 	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota",
-		"model_limits_enabled", "model_limits", "allow_ips", "group", "cross_group_retry").Updates(token).Error
+		"model_limits_enabled", "model_limits", "allow_ips", "group", "cross_group_retry", "rotation_interval",
+		"end_user_rpm", "end_user_daily_quota", "blocked_end_users", "mcp_allowlist").Updates(token).Error
 	return err
 }
 
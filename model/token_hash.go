@@ -0,0 +1,45 @@
+package model
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+const (
+	// hashedTokenKeyPrefix 标记 key 列中存储的是哈希而非明文密钥，明文密钥不会包含该字符
+	hashedTokenKeyPrefix = "#"
+	tokenKeyPrefixLength = 8
+)
+
+// tokenKeyMAC 计算令牌密钥的 keyed hash（HMAC-SHA256，密钥为 CRYPTO_SECRET），
+// 与令牌缓存使用的 common.GenerateHMAC 结果一致，因此修改 CRYPTO_SECRET 会使哈希令牌失效
+func tokenKeyMAC(key string) []byte {
+	h := hmac.New(sha256.New, []byte(common.CryptoSecret))
+	h.Write([]byte(key))
+	return h.Sum(nil)
+}
+
+// HashTokenKey 返回哈希存储时写入 key 列的值，长度 44，可放入 char(48)
+func HashTokenKey(key string) string {
+	return hashedTokenKeyPrefix + base64.RawURLEncoding.EncodeToString(tokenKeyMAC(key))
+}
+
+// IsHashedTokenKey 判断 key 是否为 HashTokenKey 的结果
+func IsHashedTokenKey(key string) bool {
+	return strings.HasPrefix(key, hashedTokenKeyPrefix)
+}
+
+// TokenCacheId 返回令牌在 Redis 中的标识，完整密钥与其哈希存储形式得到相同的结果
+func TokenCacheId(key string) string {
+	if IsHashedTokenKey(key) {
+		if raw, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(key, hashedTokenKeyPrefix)); err == nil {
+			return hex.EncodeToString(raw)
+		}
+	}
+	return common.GenerateHMAC(key)
+}
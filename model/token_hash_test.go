@@ -0,0 +1,55 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashedTokenLookup(t *testing.T) {
+	truncateTables(t)
+	initCol()
+	setting := operation_setting.GetTokenSetting()
+	original := *setting
+	t.Cleanup(func() { *setting = original })
+
+	fullKey := "abcdefghijklmnopqrstuvwxyz0123456789ABCDEFGHIJKL"
+
+	setting.HashNewTokens = true
+	token := &Token{UserId: 1, Name: "hashed", Status: 1, ExpiredTime: -1, UnlimitedQuota: true}
+	token.SetKey(fullKey)
+	require.NoError(t, token.Insert())
+
+	assert.True(t, token.IsHashed())
+	assert.LessOrEqual(t, len(token.Key), 48)
+	assert.Equal(t, "abcdefgh", token.KeyPrefix)
+	assert.Empty(t, token.GetFullKey())
+	assert.Equal(t, "abcdefgh**********", token.GetMaskedKey())
+	assert.Equal(t, TokenCacheId(fullKey), TokenCacheId(token.Key))
+
+	found, err := ValidateUserToken(fullKey)
+	require.NoError(t, err)
+	assert.Equal(t, token.Id, found.Id)
+	assert.Equal(t, fullKey, found.Key)
+
+	// 数据库中的哈希值不能直接作为令牌使用
+	_, err = GetTokenByKey(token.Key, true)
+	assert.Error(t, err)
+
+	// 关闭哈希存储后，旧令牌继续可用，新令牌以明文存储
+	setting.HashNewTokens = false
+	legacy := &Token{UserId: 1, Name: "legacy", Status: 1, ExpiredTime: -1, UnlimitedQuota: true}
+	legacy.SetKey("legacykey0123456789legacykey0123456789legacykey")
+	require.NoError(t, legacy.Insert())
+	assert.False(t, legacy.IsHashed())
+
+	found, err = GetTokenByKey(fullKey, true)
+	require.NoError(t, err)
+	assert.Equal(t, token.Id, found.Id)
+	found, err = GetTokenByKey(legacy.Key, true)
+	require.NoError(t, err)
+	assert.Equal(t, legacy.Id, found.Id)
+}
@@ -0,0 +1,118 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// 令牌密钥轮换：为同一条令牌记录生成新密钥，额度、模型限制、分组等保持不变；
+// 旧密钥在宽限期内仍可使用（请求会在日志中标记），宽限期结束后由后台任务清除
+
+const (
+	TokenRotationMaxGracePeriod = 30 * 24 * 3600 // 宽限期上限（30 天）
+	TokenRotationMinInterval    = 3600           // 自动轮换间隔下限（1 小时）
+)
+
+var ErrTokenRotationConflict = errors.New("令牌密钥已被更新，请刷新后重试")
+
+// getTokenByPreviousKey 按宽限期内的旧密钥查找令牌
+func getTokenByPreviousKey(key string) (*Token, error) {
+	token := &Token{}
+	err := DB.Where("previous_key IN ? AND previous_key_expires_time >= ?",
+		[]string{key, HashTokenKey(key)}, common.GetTimestamp()).First(token).Error
+	if err != nil {
+		return nil, err
+	}
+	token.UsingPreviousKey = true
+	return token, nil
+}
+
+// RotateTokenKey 为令牌生成新密钥并返回新的完整密钥，token 须为从数据库读取的记录（Key 为存储形式）。
+// 新密钥沿用当前的存储形式（明文或哈希）；旧密钥在 gracePeriod 秒内仍可使用，为 0 时立即失效。
+// 宽限期内再次轮换时，更早的旧密钥立即失效
+func RotateTokenKey(token *Token, gracePeriod int64) (string, error) {
+	if gracePeriod < 0 || gracePeriod > TokenRotationMaxGracePeriod {
+		return "", errors.New("宽限期超出允许范围")
+	}
+	key, err := common.GenerateKey()
+	if err != nil {
+		return "", err
+	}
+	oldKey := token.Key
+	newKey := key
+	keyPrefix := ""
+	if token.IsHashed() {
+		newKey = HashTokenKey(key)
+		keyPrefix = key[:tokenKeyPrefixLength]
+	}
+	now := common.GetTimestamp()
+	previousKey := ""
+	previousKeyExpiresTime := int64(0)
+	if gracePeriod > 0 {
+		previousKey = oldKey
+		previousKeyExpiresTime = now + gracePeriod
+	}
+	// 以旧密钥为条件更新，避免并发轮换互相覆盖
+	result := DB.Model(&Token{}).Where(&Token{Id: token.Id, Key: oldKey}).Updates(map[string]interface{}{
+		"key":                       newKey,
+		"key_prefix":                keyPrefix,
+		"previous_key":              previousKey,
+		"previous_key_expires_time": previousKeyExpiresTime,
+		"last_rotated_time":         now,
+	})
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		return "", ErrTokenRotationConflict
+	}
+	if common.RedisEnabled {
+		if err := cacheDeleteToken(oldKey); err != nil {
+			common.SysLog("failed to delete rotated token cache: " + err.Error())
+		}
+	}
+	token.Key = newKey
+	token.KeyPrefix = keyPrefix
+	token.PreviousKey = previousKey
+	token.PreviousKeyExpiresTime = previousKeyExpiresTime
+	token.LastRotatedTime = now
+	return key, nil
+}
+
+// GetTokensDueForRotation 返回已到自动轮换时间的启用令牌，未轮换过的令牌从创建时间起算。
+// 哈希存储的令牌无法再次查看密钥，不参与自动轮换，在查询中排除以免占满批次
+func GetTokensDueForRotation(limit int) ([]*Token, error) {
+	var tokens []*Token
+	err := DB.Where("rotation_interval > 0 AND status = ?", common.TokenStatusEnabled).
+		Where(commonKeyCol+" NOT LIKE ?", hashedTokenKeyPrefix+"%").
+		Where("(CASE WHEN last_rotated_time > created_time THEN last_rotated_time ELSE created_time END) + rotation_interval <= ?", common.GetTimestamp()).
+		Order("id").Limit(limit).Find(&tokens).Error
+	return tokens, err
+}
+
+// ExpirePreviousTokenKeys 清除宽限期已结束的旧密钥，返回被清除的令牌（PreviousKeyExpiresTime 保留为原过期时间）
+func ExpirePreviousTokenKeys(limit int) ([]*Token, error) {
+	var tokens []*Token
+	err := DB.Where("previous_key <> '' AND previous_key_expires_time > 0 AND previous_key_expires_time < ?", common.GetTimestamp()).
+		Order("id").Limit(limit).Find(&tokens).Error
+	if err != nil {
+		return nil, err
+	}
+	expired := make([]*Token, 0, len(tokens))
+	for _, token := range tokens {
+		result := DB.Model(&Token{}).
+			Where("id = ? AND previous_key = ?", token.Id, token.PreviousKey).
+			Updates(map[string]interface{}{
+				"previous_key":              "",
+				"previous_key_expires_time": 0,
+			})
+		if result.Error != nil {
+			return expired, result.Error
+		}
+		if result.RowsAffected > 0 {
+			expired = append(expired, token)
+		}
+	}
+	return expired, nil
+}
@@ -0,0 +1,123 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotateTokenKeyWithGracePeriod(t *testing.T) {
+	truncateTables(t)
+	initCol()
+
+	oldKey := "rotationoldkey0123456789rotationoldkey0123456789"
+	token := &Token{UserId: 1, Name: "rotating", Status: common.TokenStatusEnabled, ExpiredTime: -1, RemainQuota: 100}
+	token.SetKey(oldKey)
+	require.NoError(t, token.Insert())
+
+	stored, err := GetTokenById(token.Id)
+	require.NoError(t, err)
+	newKey, err := RotateTokenKey(stored, 3600)
+	require.NoError(t, err)
+	assert.NotEqual(t, oldKey, newKey)
+	assert.Greater(t, stored.PreviousKeyExpiresTime, common.GetTimestamp())
+
+	// 新旧密钥指向同一条令牌记录，旧密钥的请求带有标记
+	found, err := ValidateUserToken(newKey)
+	require.NoError(t, err)
+	assert.Equal(t, token.Id, found.Id)
+	assert.False(t, found.UsingPreviousKey)
+	found, err = ValidateUserToken(oldKey)
+	require.NoError(t, err)
+	assert.Equal(t, token.Id, found.Id)
+	assert.Equal(t, 100, found.RemainQuota)
+	assert.True(t, found.UsingPreviousKey)
+	assert.Equal(t, newKey, found.Key)
+
+	// 旧密钥签发的临时令牌在宽限期内仍然有效
+	previous := *stored
+	previous.Key = oldKey
+	ephemeral, _, err := MintEphemeralToken(&previous, 600, nil, 0, "", false)
+	require.NoError(t, err)
+	_, _, err = ValidateEphemeralToken(ephemeral)
+	require.NoError(t, err)
+
+	// 宽限期结束后旧密钥被清除
+	require.NoError(t, DB.Model(&Token{}).Where("id = ?", token.Id).Update("previous_key_expires_time", common.GetTimestamp()-1).Error)
+	_, err = ValidateUserToken(oldKey)
+	assert.Error(t, err)
+	expired, err := ExpirePreviousTokenKeys(10)
+	require.NoError(t, err)
+	require.Len(t, expired, 1)
+	assert.Equal(t, token.Id, expired[0].Id)
+	expired, err = ExpirePreviousTokenKeys(10)
+	require.NoError(t, err)
+	assert.Empty(t, expired)
+
+	// 并发轮换以旧密钥为条件，过期的记录无法再次轮换
+	_, err = RotateTokenKey(stored, 0)
+	require.NoError(t, err)
+	stale := *stored
+	stale.Key = newKey
+	_, err = RotateTokenKey(&stale, 0)
+	assert.ErrorIs(t, err, ErrTokenRotationConflict)
+	_, err = ValidateUserToken(newKey)
+	assert.Error(t, err)
+}
+
+func TestRotateHashedTokenKeepsHashedStorage(t *testing.T) {
+	truncateTables(t)
+	initCol()
+	setting := operation_setting.GetTokenSetting()
+	original := *setting
+	t.Cleanup(func() { *setting = original })
+	setting.HashNewTokens = true
+
+	oldKey := "hashedrotation0123456789hashedrotation0123456789"
+	token := &Token{UserId: 1, Name: "hashed", Status: common.TokenStatusEnabled, ExpiredTime: -1, UnlimitedQuota: true}
+	token.SetKey(oldKey)
+	require.NoError(t, token.Insert())
+
+	stored, err := GetTokenById(token.Id)
+	require.NoError(t, err)
+	newKey, err := RotateTokenKey(stored, 60)
+	require.NoError(t, err)
+	assert.True(t, stored.IsHashed())
+	assert.Equal(t, newKey[:tokenKeyPrefixLength], stored.KeyPrefix)
+
+	found, err := ValidateUserToken(oldKey)
+	require.NoError(t, err)
+	assert.True(t, found.UsingPreviousKey)
+	_, err = ValidateUserToken(newKey)
+	require.NoError(t, err)
+}
+
+func TestGetTokensDueForRotation(t *testing.T) {
+	truncateTables(t)
+	initCol()
+
+	now := common.GetTimestamp()
+	due := &Token{UserId: 1, Name: "due", Status: common.TokenStatusEnabled, ExpiredTime: -1,
+		CreatedTime: now - 7200, RotationInterval: 3600}
+	due.SetKey("rotationduekey0123456789rotationduekey0123456789")
+	require.NoError(t, due.Insert())
+	recent := &Token{UserId: 1, Name: "recent", Status: common.TokenStatusEnabled, ExpiredTime: -1,
+		CreatedTime: now - 7200, LastRotatedTime: now - 60, RotationInterval: 3600}
+	recent.SetKey("rotationrecent0123456789rotationrecent0123456789")
+	require.NoError(t, recent.Insert())
+	manual := &Token{UserId: 1, Name: "manual", Status: common.TokenStatusEnabled, ExpiredTime: -1, CreatedTime: now - 7200}
+	manual.SetKey("rotationmanual0123456789rotationmanual0123456789")
+	require.NoError(t, manual.Insert())
+	hashed := &Token{UserId: 1, Name: "hashed", Status: common.TokenStatusEnabled, ExpiredTime: -1,
+		CreatedTime: now - 7200, RotationInterval: 3600, Key: hashedTokenKeyPrefix + "rotationhashed0123456789rotationhashed01"}
+	require.NoError(t, hashed.Insert())
+
+	tokens, err := GetTokensDueForRotation(10)
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	assert.Equal(t, due.Id, tokens[0].Id)
+}
@@ -91,7 +91,10 @@ func UpdatePendingTopUpStatus(tradeNo string, expectedPaymentMethod string, targ
 		}
 
 		topUp.Status = targetStatus
-		return tx.Save(topUp).Error
+		if err := tx.Save(topUp).Error; err != nil {
+			return err
+		}
+		return cancelCouponRedemptionTx(tx, tradeNo)
 	})
 }
 
@@ -101,6 +104,7 @@ func Recharge(referenceId string, customerId string, callerIp string) (err error
 	}
 
 	var quota float64
+	var couponRedemption *CouponRedemption
 	topUp := &TopUp{}
 
 	refCol := "`trade_no`"
@@ -135,7 +139,8 @@ func Recharge(referenceId string, customerId string, callerIp string) (err error
 			return err
 		}
 
-		return nil
+		couponRedemption, err = completeCouponRedemptionTx(tx, topUp.TradeNo)
+		return err
 	})
 
 	if err != nil {
@@ -144,6 +149,7 @@ func Recharge(referenceId string, customerId string, callerIp string) (err error
 	}
 
 	RecordTopupLog(topUp.UserId, fmt.Sprintf("使用在线充值成功，充值金额: %v，支付金额：%d", logger.FormatQuota(int(quota)), topUp.Amount), callerIp, topUp.PaymentMethod, PaymentMethodStripe)
+	finishCouponRedemption(couponRedemption)
 
 	return nil
 }
@@ -320,6 +326,7 @@ func ManualCompleteTopUp(tradeNo string, callerIp string) error {
 	var quotaToAdd int
 	var payMoney float64
 	var paymentMethod string
+	var couponRedemption *CouponRedemption
 
 	err := DB.Transaction(func(tx *gorm.DB) error {
 		topUp := &TopUp{}
@@ -364,6 +371,12 @@ func ManualCompleteTopUp(tradeNo string, callerIp string) error {
 			return err
 		}
 
+		var err error
+		couponRedemption, err = completeCouponRedemptionTx(tx, topUp.TradeNo)
+		if err != nil {
+			return err
+		}
+
 		userId = topUp.UserId
 		payMoney = topUp.Money
 		paymentMethod = topUp.PaymentMethod
@@ -376,6 +389,7 @@ func ManualCompleteTopUp(tradeNo string, callerIp string) error {
 
 	// 事务外记录日志，避免阻塞
 	RecordTopupLog(userId, fmt.Sprintf("管理员补单成功，充值金额: %v，支付金额：%f", logger.FormatQuota(quotaToAdd), payMoney), callerIp, paymentMethod, "admin")
+	finishCouponRedemption(couponRedemption)
 	return nil
 }
 func RechargeCreem(referenceId string, customerEmail string, customerName string, callerIp string) (err error) {
@@ -384,6 +398,7 @@ func RechargeCreem(referenceId string, customerEmail string, customerName string
 	}
 
 	var quota int64
+	var couponRedemption *CouponRedemption
 	topUp := &TopUp{}
 
 	refCol := "`trade_no`"
@@ -440,7 +455,8 @@ func RechargeCreem(referenceId string, customerEmail string, customerName string
 			return err
 		}
 
-		return nil
+		couponRedemption, err = completeCouponRedemptionTx(tx, topUp.TradeNo)
+		return err
 	})
 
 	if err != nil {
@@ -449,6 +465,70 @@ func RechargeCreem(referenceId string, customerEmail string, customerName string
 	}
 
 	RecordTopupLog(topUp.UserId, fmt.Sprintf("使用Creem充值成功，充值额度: %v，支付金额：%.2f", quota, topUp.Money), callerIp, topUp.PaymentMethod, PaymentMethodCreem)
+	finishCouponRedemption(couponRedemption)
+
+	return nil
+}
+
+// RechargeEpay 易支付回调入账：在同一事务中标记订单成功、增加额度并核销优惠券
+func RechargeEpay(tradeNo string, callerIp string) (err error) {
+	if tradeNo == "" {
+		return errors.New("未提供支付单号")
+	}
+
+	var quotaToAdd int
+	var couponRedemption *CouponRedemption
+	topUp := &TopUp{}
+
+	refCol := "`trade_no`"
+	if common.UsingPostgreSQL {
+		refCol = `"trade_no"`
+	}
+
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Set("gorm:query_option", "FOR UPDATE").Where(refCol+" = ?", tradeNo).First(topUp).Error
+		if err != nil {
+			return errors.New("充值订单不存在")
+		}
+
+		if topUp.Status == common.TopUpStatusSuccess {
+			return nil // 幂等：已成功直接返回
+		}
+
+		if topUp.Status != common.TopUpStatusPending {
+			return errors.New("充值订单状态错误")
+		}
+
+		dAmount := decimal.NewFromInt(topUp.Amount)
+		dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
+		quotaToAdd = int(dAmount.Mul(dQuotaPerUnit).IntPart())
+
+		topUp.CompleteTime = common.GetTimestamp()
+		topUp.Status = common.TopUpStatusSuccess
+		if err := tx.Save(topUp).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&User{}).Where("id = ?", topUp.UserId).Update("quota", gorm.Expr("quota + ?", quotaToAdd)).Error; err != nil {
+			return err
+		}
+
+		couponRedemption, err = completeCouponRedemptionTx(tx, topUp.TradeNo)
+		return err
+	})
+
+	if err != nil {
+		common.SysError("epay topup failed: " + err.Error())
+		return errors.New("充值失败，请稍后重试")
+	}
+
+	if quotaToAdd > 0 {
+		if err := cacheIncrUserQuota(topUp.UserId, int64(quotaToAdd)); err != nil {
+			common.SysLog(fmt.Sprintf("failed to update user quota cache after epay topup: user_id=%d, error=%v", topUp.UserId, err))
+		}
+		RecordTopupLog(topUp.UserId, fmt.Sprintf("使用在线充值成功，充值金额: %v，支付金额：%f", logger.LogQuota(quotaToAdd), topUp.Money), callerIp, topUp.PaymentMethod, "epay")
+	}
+	finishCouponRedemption(couponRedemption)
 
 	return nil
 }
@@ -459,6 +539,7 @@ func RechargeWaffo(tradeNo string, callerIp string) (err error) {
 	}
 
 	var quotaToAdd int
+	var couponRedemption *CouponRedemption
 	topUp := &TopUp{}
 
 	refCol := "`trade_no`"
@@ -501,7 +582,8 @@ func RechargeWaffo(tradeNo string, callerIp string) (err error) {
 			return err
 		}
 
-		return nil
+		couponRedemption, err = completeCouponRedemptionTx(tx, topUp.TradeNo)
+		return err
 	})
 
 	if err != nil {
@@ -512,6 +594,7 @@ func RechargeWaffo(tradeNo string, callerIp string) (err error) {
 	if quotaToAdd > 0 {
 		RecordTopupLog(topUp.UserId, fmt.Sprintf("Waffo充值成功，充值额度: %v，支付金额: %.2f", logger.FormatQuota(quotaToAdd), topUp.Money), callerIp, topUp.PaymentMethod, PaymentMethodWaffo)
 	}
+	finishCouponRedemption(couponRedemption)
 
 	return nil
 }
@@ -522,6 +605,7 @@ func RechargeWaffoPancake(tradeNo string) (err error) {
 	}
 
 	var quotaToAdd int
+	var couponRedemption *CouponRedemption
 	topUp := &TopUp{}
 
 	refCol := "`trade_no`"
@@ -562,7 +646,8 @@ func RechargeWaffoPancake(tradeNo string) (err error) {
 			return err
 		}
 
-		return nil
+		couponRedemption, err = completeCouponRedemptionTx(tx, topUp.TradeNo)
+		return err
 	})
 
 	if err != nil {
@@ -573,6 +658,7 @@ func RechargeWaffoPancake(tradeNo string) (err error) {
 	if quotaToAdd > 0 {
 		RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("Waffo Pancake充值成功，充值额度: %v，支付金额: %.2f", logger.FormatQuota(quotaToAdd), topUp.Money))
 	}
+	finishCouponRedemption(couponRedemption)
 
 	return nil
 }
@@ -7,10 +7,12 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 
 	"github.com/bytedance/gopkg/util/gopool"
 	"gorm.io/gorm"
@@ -50,6 +52,7 @@ type User struct {
 	Setting          string         `json:"setting" gorm:"type:text;column:setting"`
 	Remark           string         `json:"remark,omitempty" gorm:"type:varchar(255)" validate:"max=255"`
 	StripeCustomer   string         `json:"stripe_customer" gorm:"type:varchar(64);column:stripe_customer;index"`
+	CustomRoleId     int            `json:"custom_role_id" gorm:"type:int;default:0;index"` // 自定义角色，仅对普通用户生效
 }
 
 func (user *User) ToBaseUser() *UserBase {
@@ -363,14 +366,23 @@ func (user *User) TransferAffQuotaToQuota(quota int) error {
 		return errors.New("邀请额度不足！")
 	}
 
-	// 更新用户额度
+	// 更新用户额度，配置了有效期时划转的额度作为限时额度发放
+	expireDays := operation_setting.GetQuotaSetting().AffQuotaExpireDays
 	user.AffQuota -= quota
-	user.Quota += quota
+	if expireDays <= 0 {
+		user.Quota += quota
+	}
 
 	// 保存用户状态
 	if err := tx.Save(user).Error; err != nil {
 		return err
 	}
+	if expireDays > 0 {
+		expireTime := time.Now().AddDate(0, 0, expireDays).Unix()
+		if _, err := GrantQuotaBucketTx(tx, user.Id, int64(quota), QuotaBucketSourceAffiliate, 0, expireTime); err != nil {
+			return err
+		}
+	}
 
 	// 提交事务
 	return tx.Commit().Error
@@ -420,7 +432,7 @@ func (user *User) Insert(inviterId int) error {
 	}
 	if inviterId != 0 {
 		if common.QuotaForInvitee > 0 {
-			_ = IncreaseUserQuota(user.Id, common.QuotaForInvitee, true)
+			_ = GrantExpiringQuota(user.Id, common.QuotaForInvitee, operation_setting.GetQuotaSetting().AffQuotaExpireDays, QuotaBucketSourceAffiliate, inviterId)
 			RecordLog(user.Id, LogTypeSystem, fmt.Sprintf("使用邀请码赠送 %s", logger.LogQuota(common.QuotaForInvitee)))
 		}
 		if common.QuotaForInviter > 0 {
@@ -481,7 +493,7 @@ func (user *User) FinalizeOAuthUserCreation(inviterId int) {
 	}
 	if inviterId != 0 {
 		if common.QuotaForInvitee > 0 {
-			_ = IncreaseUserQuota(user.Id, common.QuotaForInvitee, true)
+			_ = GrantExpiringQuota(user.Id, common.QuotaForInvitee, operation_setting.GetQuotaSetting().AffQuotaExpireDays, QuotaBucketSourceAffiliate, inviterId)
 			RecordLog(user.Id, LogTypeSystem, fmt.Sprintf("使用邀请码赠送 %s", logger.LogQuota(common.QuotaForInvitee)))
 		}
 		if common.QuotaForInviter > 0 {
@@ -709,7 +721,20 @@ func ResetUserPasswordByEmail(email string, password string) error {
 		return err
 	}
 	err = DB.Model(&User{}).Where("email = ?", email).Update("password", hashedPassword).Error
-	return err
+	if err != nil {
+		return err
+	}
+	// 重置密码后吊销该邮箱下用户的全部登录会话，并清除会话缓存
+	var userIds []int
+	if err := DB.Model(&User{}).Where("email = ?", email).Pluck("id", &userIds).Error; err != nil {
+		return err
+	}
+	for _, userId := range userIds {
+		if err := RevokeUserSessions(userId, 0); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func IsAdmin(userId int) bool {
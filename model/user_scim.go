@@ -0,0 +1,86 @@
+package model
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+// SCIM 用户同步所需的数据访问，状态与分组变更会同步刷新用户缓存，确保 GetUserCache 立即可见
+
+// SearchScimUsers 按用户名精确匹配（为空时不过滤）分页查询用户
+func SearchScimUsers(username string, offset int, limit int) ([]*User, int64, error) {
+	var users []*User
+	var total int64
+	query := DB.Model(&User{})
+	if username != "" {
+		query = query.Where("username = ?", username)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := query.Omit("password").Order("id asc").Offset(offset).Limit(limit).Find(&users).Error
+	return users, total, err
+}
+
+// GetUsersByGroup 返回属于指定分组的用户
+func GetUsersByGroup(group string) ([]*User, error) {
+	var users []*User
+	err := DB.Select("id", "username", "display_name").
+		Where(&User{Group: group}).Order("id asc").Find(&users).Error
+	return users, err
+}
+
+// UpdateUserStatus 更新用户状态；禁用时同时吊销其登录会话、禁用其所有已启用的令牌并清理令牌缓存
+func UpdateUserStatus(userId int, status int) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).Where("id = ?", userId).Update("status", status)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if status != common.UserStatusDisabled {
+			return nil
+		}
+		if err := tx.Where("user_id = ?", userId).Delete(&UserSession{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&Token{}).
+			Where("user_id = ? AND status = ?", userId, common.TokenStatusEnabled).
+			Update("status", common.TokenStatusDisabled).Error
+	})
+	if err != nil {
+		return err
+	}
+	if status == common.UserStatusDisabled {
+		if err := InvalidateUserTokensCache(userId); err != nil {
+			common.SysLog(fmt.Sprintf("failed to invalidate tokens cache for user %d: %s", userId, err.Error()))
+		}
+	}
+	return updateUserStatusCache(userId, status == common.UserStatusEnabled)
+}
+
+// UpdateUserGroup 更新用户分组并刷新缓存
+func UpdateUserGroup(userId int, group string) error {
+	if err := DB.Model(&User{}).Where("id = ?", userId).Update("group", group).Error; err != nil {
+		return err
+	}
+	return updateUserGroupCache(userId, group)
+}
+
+// UpdateScimProfile 更新 IdP 同步的资料字段（用户名、显示名称、邮箱）并刷新缓存
+func (user *User) UpdateScimProfile() error {
+	updates := map[string]interface{}{
+		"username":     user.Username,
+		"display_name": user.DisplayName,
+		"email":        user.Email,
+	}
+	if err := DB.Model(&User{}).Where("id = ?", user.Id).Updates(updates).Error; err != nil {
+		return err
+	}
+	return updateUserCache(*user)
+}
@@ -0,0 +1,244 @@
+package model
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/pkg/cachex"
+
+	"github.com/samber/hot"
+	"gorm.io/gorm"
+)
+
+// 登录会话的服务端登记：cookie 会话中只保存随机会话 ID（sid），服务端保存其 HMAC 及设备、IP、最近活跃时间，
+// 吊销会话即删除记录，持有该 cookie 的请求在下一次鉴权时被拒绝
+
+const (
+	UserSessionMaxAge        = 2592000 // 与 cookie 会话有效期一致（30 天）
+	userSessionIdLength      = 48
+	userSessionTouchInterval = 60
+
+	userSessionCacheNamespace = "new-api:user_session:v1"
+	// 会话校验结果的缓存时间；未启用 Redis 的多节点部署中，吊销最多延迟该时长在其他节点生效
+	userSessionCacheTTL = 30 * time.Second
+)
+
+var (
+	userSessionCacheOnce sync.Once
+	userSessionCache     *cachex.HybridCache[UserSession]
+)
+
+var ErrUserSessionInvalid = errors.New("登录会话已失效，请重新登录")
+
+type UserSession struct {
+	Id           int    `json:"id"`
+	UserId       int    `json:"user_id" gorm:"index"`
+	SessionHash  string `json:"-" gorm:"type:char(64);uniqueIndex"`
+	Device       string `json:"device" gorm:"type:varchar(64)"`
+	Ip           string `json:"ip" gorm:"type:varchar(64)"`
+	UserAgent    string `json:"user_agent" gorm:"type:varchar(512)"`
+	CreatedTime  int64  `json:"created_time" gorm:"bigint"`
+	LastSeenTime int64  `json:"last_seen_time" gorm:"bigint"`
+	ExpiresTime  int64  `json:"expires_time" gorm:"bigint;index"`
+}
+
+// CreateUserSession 登记新的登录会话，返回写入 cookie 的会话 ID
+func CreateUserSession(userId int, ip string, userAgent string) (string, *UserSession, error) {
+	sid, err := common.GenerateRandomCharsKey(userSessionIdLength)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(userAgent) > 512 {
+		userAgent = userAgent[:512]
+	}
+	now := common.GetTimestamp()
+	session := UserSession{
+		UserId:       userId,
+		SessionHash:  common.GenerateHMAC(sid),
+		Device:       parseSessionDevice(userAgent),
+		Ip:           ip,
+		UserAgent:    userAgent,
+		CreatedTime:  now,
+		LastSeenTime: now,
+		ExpiresTime:  now + UserSessionMaxAge,
+	}
+	// 顺带清理该用户已过期的会话
+	if err := DB.Where("user_id = ? AND expires_time < ?", userId, now).Delete(&UserSession{}).Error; err != nil {
+		return "", nil, err
+	}
+	if err := DB.Create(&session).Error; err != nil {
+		return "", nil, err
+	}
+	return sid, &session, nil
+}
+
+func getUserSessionCache() *cachex.HybridCache[UserSession] {
+	userSessionCacheOnce.Do(func() {
+		userSessionCache = cachex.NewHybridCache[UserSession](cachex.HybridCacheConfig[UserSession]{
+			Namespace: cachex.Namespace(userSessionCacheNamespace),
+			Redis:     common.RDB,
+			RedisEnabled: func() bool {
+				return common.RedisEnabled && common.RDB != nil
+			},
+			RedisCodec: cachex.JSONCodec[UserSession]{},
+			Memory: func() *hot.HotCache[string, UserSession] {
+				return hot.NewHotCache[string, UserSession](hot.LRU, 10000).
+					WithTTL(userSessionCacheTTL).
+					WithJanitor().
+					Build()
+			},
+		})
+	})
+	return userSessionCache
+}
+
+// invalidateUserSessionCache 吊销会话后清除其校验缓存
+func invalidateUserSessionCache(hashes ...string) {
+	if len(hashes) == 0 {
+		return
+	}
+	_, _ = getUserSessionCache().DeleteMany(hashes)
+}
+
+// ValidateUserSession 校验会话 ID 是否仍然有效，已吊销或已过期时返回 ErrUserSessionInvalid。
+// 有效会话缓存 userSessionCacheTTL，避免每个请求都查询数据库
+func ValidateUserSession(sid string) (*UserSession, error) {
+	hash := common.GenerateHMAC(sid)
+	now := common.GetTimestamp()
+	cache := getUserSessionCache()
+	if cached, found, err := cache.Get(hash); err == nil && found && cached.ExpiresTime >= now {
+		cached.SessionHash = hash
+		return &cached, nil
+	}
+	session := UserSession{}
+	if err := DB.Where("session_hash = ?", hash).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserSessionInvalid
+		}
+		return nil, err
+	}
+	if session.ExpiresTime < now {
+		DB.Delete(&session)
+		return nil, ErrUserSessionInvalid
+	}
+	_ = cache.SetWithTTL(hash, session, userSessionCacheTTL)
+	return &session, nil
+}
+
+// TouchUserSession 记录最近活跃时间与 IP，同一会话每个间隔最多写一次数据库
+func TouchUserSession(session *UserSession, ip string) error {
+	now := common.GetTimestamp()
+	if now-session.LastSeenTime < userSessionTouchInterval {
+		return nil
+	}
+	if err := DB.Model(&UserSession{}).Where("id = ?", session.Id).Updates(map[string]interface{}{
+		"last_seen_time": now,
+		"ip":             ip,
+	}).Error; err != nil {
+		return err
+	}
+	session.LastSeenTime = now
+	session.Ip = ip
+	if session.SessionHash != "" {
+		_ = getUserSessionCache().SetWithTTL(session.SessionHash, *session, userSessionCacheTTL)
+	}
+	return nil
+}
+
+// GetUserSessions 返回用户未过期的登录会话，最近活跃的在前
+func GetUserSessions(userId int) ([]*UserSession, error) {
+	var sessions []*UserSession
+	err := DB.Where("user_id = ? AND expires_time >= ?", userId, common.GetTimestamp()).
+		Order("last_seen_time desc").Find(&sessions).Error
+	return sessions, err
+}
+
+// DeleteUserSessionById 吊销用户的指定会话
+func DeleteUserSessionById(id int, userId int) error {
+	var hashes []string
+	if err := DB.Model(&UserSession{}).Where("id = ? AND user_id = ?", id, userId).Pluck("session_hash", &hashes).Error; err != nil {
+		return err
+	}
+	result := DB.Where("id = ? AND user_id = ?", id, userId).Delete(&UserSession{})
+	if result.Error != nil {
+		return result.Error
+	}
+	invalidateUserSessionCache(hashes...)
+	if result.RowsAffected == 0 {
+		return errors.New("会话不存在")
+	}
+	return nil
+}
+
+// DeleteUserSessionBySid 吊销 cookie 中会话 ID 对应的会话，用于退出登录
+func DeleteUserSessionBySid(sid string) error {
+	hash := common.GenerateHMAC(sid)
+	if err := DB.Where("session_hash = ?", hash).Delete(&UserSession{}).Error; err != nil {
+		return err
+	}
+	invalidateUserSessionCache(hash)
+	return nil
+}
+
+// RevokeUserSessions 吊销用户的全部会话，exceptId 不为 0 时保留该会话（通常为当前会话）
+func RevokeUserSessions(userId int, exceptId int) error {
+	query := func() *gorm.DB {
+		query := DB.Where("user_id = ?", userId)
+		if exceptId != 0 {
+			query = query.Where("id <> ?", exceptId)
+		}
+		return query
+	}
+	var hashes []string
+	if err := query().Model(&UserSession{}).Pluck("session_hash", &hashes).Error; err != nil {
+		return err
+	}
+	if err := query().Delete(&UserSession{}).Error; err != nil {
+		return err
+	}
+	invalidateUserSessionCache(hashes...)
+	return nil
+}
+
+// parseSessionDevice 从 User-Agent 粗略识别浏览器与操作系统，用于会话列表展示
+func parseSessionDevice(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	os := ""
+	switch {
+	case strings.Contains(ua, "iphone") || strings.Contains(ua, "ipad"):
+		os = "iOS"
+	case strings.Contains(ua, "android"):
+		os = "Android"
+	case strings.Contains(ua, "windows"):
+		os = "Windows"
+	case strings.Contains(ua, "mac os") || strings.Contains(ua, "macintosh"):
+		os = "macOS"
+	case strings.Contains(ua, "linux"):
+		os = "Linux"
+	}
+	browser := ""
+	switch {
+	case strings.Contains(ua, "edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "opr/") || strings.Contains(ua, "opera"):
+		browser = "Opera"
+	case strings.Contains(ua, "firefox/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "chrome/") || strings.Contains(ua, "crios/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "safari/"):
+		browser = "Safari"
+	}
+	switch {
+	case browser != "" && os != "":
+		return browser + " on " + os
+	case browser != "":
+		return browser
+	case os != "":
+		return os
+	}
+	return "Unknown"
+}
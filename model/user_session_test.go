@@ -0,0 +1,27 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResetUserPasswordRevokesCachedSessions(t *testing.T) {
+	truncateTables(t)
+	require.NoError(t, DB.AutoMigrate(&UserSession{}))
+	t.Cleanup(func() { DB.Exec("DELETE FROM user_sessions") })
+
+	user := &User{Username: "session_user", Password: "password", Email: "session@example.com", AffCode: "us01"}
+	require.NoError(t, DB.Create(user).Error)
+	sid, _, err := CreateUserSession(user.Id, "127.0.0.1", "")
+	require.NoError(t, err)
+
+	// 先校验一次，使会话进入缓存
+	_, err = ValidateUserSession(sid)
+	require.NoError(t, err)
+
+	require.NoError(t, ResetUserPasswordByEmail(user.Email, "new-password"))
+	_, err = ValidateUserSession(sid)
+	assert.Error(t, err)
+}
@@ -55,6 +55,15 @@ func addNewRecord(type_ int, id int, value int) {
 	}
 }
 
+// takeBatchUpdateRecord 取出并清除某条尚未落库的增量，由调用方在自己的事务中写入
+func takeBatchUpdateRecord(type_ int, id int) int {
+	batchUpdateLocks[type_].Lock()
+	defer batchUpdateLocks[type_].Unlock()
+	value := batchUpdateStores[type_][id]
+	delete(batchUpdateStores[type_], id)
+	return value
+}
+
 func batchUpdate() {
 	// check if there's any data to update
 	hasData := false
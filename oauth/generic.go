@@ -91,6 +91,10 @@ func (p *GenericOAuthProvider) ExchangeToken(ctx context.Context, code string, c
 	if code == "" {
 		return nil, NewOAuthError(i18n.MsgOAuthInvalidCode, nil)
 	}
+	if p.config.IsSAML() {
+		// SAML: the one-time code issued by the ACS is redeemed in GetUserInfo
+		return &OAuthToken{AccessToken: code}, nil
+	}
 
 	logger.LogDebug(ctx, "[OAuth-Generic-%s] ExchangeToken: code=%s...", p.config.Slug, code[:min(len(code), 10)])
 
@@ -200,6 +204,9 @@ func (p *GenericOAuthProvider) ExchangeToken(ctx context.Context, code string, c
 }
 
 func (p *GenericOAuthProvider) GetUserInfo(ctx context.Context, token *OAuthToken) (*OAuthUser, error) {
+	if p.config.IsSAML() {
+		return redeemSAMLCode(token.AccessToken)
+	}
 	logger.LogDebug(ctx, "[OAuth-Generic-%s] GetUserInfo: fetching user info from %s", p.config.Slug, p.config.UserInfoEndpoint)
 
 	req, err := http.NewRequestWithContext(ctx, "GET", p.config.UserInfoEndpoint, nil)
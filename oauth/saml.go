@@ -0,0 +1,351 @@
+package oauth
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/crewjam/saml"
+)
+
+// SAML 2.0 SP support for custom providers with protocol "saml".
+//
+// Login flow (reuses the OAuth callback page and binding logic):
+//  1. The frontend opens /api/saml/{slug}/login?state=... like an OAuth authorization endpoint
+//  2. We redirect to the IdP with an AuthnRequest, remembering its ID under a random RelayState
+//  3. The IdP posts the signed response to /api/saml/{slug}/acs, where it is validated
+//  4. The mapped user is stored under a one-time code and the browser is sent to /oauth/{slug}?code=...&state=...
+//  5. The frontend calls /api/oauth/{slug}, and ExchangeToken/GetUserInfo redeem the one-time code
+//
+// Pending requests and codes are kept in Redis when enabled (the IdP posts cross-site, so the
+// SameSite=Strict session cookie is not available at the ACS), otherwise in memory.
+
+const (
+	samlRequestTTL = 10 * time.Minute
+	samlCodeTTL    = 2 * time.Minute
+
+	// SAMLNameIDField maps a provider field to the subject NameID instead of an attribute
+	SAMLNameIDField = "NameID"
+)
+
+var (
+	errSAMLRequestExpired = errors.New("SAML login request expired or unknown, please try again")
+	errSAMLMetadataNoIdP  = errors.New("SAML metadata does not contain an IdP SSO descriptor")
+)
+
+type samlPendingRequest struct {
+	RequestId string `json:"request_id"`
+	State     string `json:"state"`
+}
+
+type samlStoreEntry struct {
+	value    string
+	expireAt time.Time
+}
+
+var samlMemoryStore sync.Map
+
+// samlStorePut saves a short-lived value shared between the login, ACS and callback requests
+func samlStorePut(key string, value any, ttl time.Duration) error {
+	data, err := common.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if common.RedisEnabled {
+		return common.RedisSet("saml:"+key, string(data), ttl)
+	}
+	samlMemoryStore.Range(func(k, v any) bool {
+		if time.Now().After(v.(samlStoreEntry).expireAt) {
+			samlMemoryStore.Delete(k)
+		}
+		return true
+	})
+	samlMemoryStore.Store(key, samlStoreEntry{value: string(data), expireAt: time.Now().Add(ttl)})
+	return nil
+}
+
+// samlStoreTake loads and deletes a value so that it can only be used once
+func samlStoreTake(key string, value any) error {
+	if key == "" {
+		return errSAMLRequestExpired
+	}
+	var data string
+	if common.RedisEnabled {
+		ctx := context.Background()
+		val, err := common.RDB.Get(ctx, "saml:"+key).Result()
+		if err != nil {
+			return errSAMLRequestExpired
+		}
+		// 删除成功的请求才可使用，防止并发重放
+		if deleted, err := common.RDB.Del(ctx, "saml:"+key).Result(); err != nil || deleted == 0 {
+			return errSAMLRequestExpired
+		}
+		data = val
+	} else {
+		entry, ok := samlMemoryStore.LoadAndDelete(key)
+		if !ok || time.Now().After(entry.(samlStoreEntry).expireAt) {
+			return errSAMLRequestExpired
+		}
+		data = entry.(samlStoreEntry).value
+	}
+	return common.UnmarshalJsonStr(data, value)
+}
+
+// ParseSAMLIdPMetadata parses IdP metadata XML, accepting either an EntityDescriptor
+// or an EntitiesDescriptor that contains one IdP
+func ParseSAMLIdPMetadata(data []byte) (*saml.EntityDescriptor, error) {
+	var entity saml.EntityDescriptor
+	if err := xml.Unmarshal(data, &entity); err == nil && len(entity.IDPSSODescriptors) > 0 {
+		return &entity, nil
+	}
+	var entities saml.EntitiesDescriptor
+	if err := xml.Unmarshal(data, &entities); err != nil {
+		return nil, fmt.Errorf("invalid SAML metadata: %w", err)
+	}
+	for i := range entities.EntityDescriptors {
+		if len(entities.EntityDescriptors[i].IDPSSODescriptors) > 0 {
+			return &entities.EntityDescriptors[i], nil
+		}
+	}
+	return nil, errSAMLMetadataNoIdP
+}
+
+// FetchSAMLIdPMetadata downloads IdP metadata from its URL and validates it
+func FetchSAMLIdPMetadata(ctx context.Context, metadataURL string) (string, error) {
+	parsed, err := url.Parse(strings.TrimSpace(metadataURL))
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return "", errors.New("SAML metadata URL is invalid, only http/https is supported")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, parsed.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	client := http.Client{Timeout: 20 * time.Second}
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch SAML metadata: %s", res.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if _, err := ParseSAMLIdPMetadata(data); err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// SAMLServiceURL returns an absolute URL under /api/saml/{slug}
+func SAMLServiceURL(slug string, endpoint string) string {
+	return fmt.Sprintf("%s/api/saml/%s/%s", strings.TrimRight(system_setting.ServerAddress, "/"), slug, endpoint)
+}
+
+// newSAMLServiceProvider builds the SP for a provider; the metadata URL doubles as SP entity ID
+func newSAMLServiceProvider(config *model.CustomOAuthProvider) (*saml.ServiceProvider, error) {
+	if !config.IsSAML() {
+		return nil, errors.New("provider is not a SAML provider")
+	}
+	idpMetadata, err := ParseSAMLIdPMetadata([]byte(config.SamlIdpMetadata))
+	if err != nil {
+		return nil, err
+	}
+	metadataURL, err := url.Parse(SAMLServiceURL(config.Slug, "metadata"))
+	if err != nil {
+		return nil, err
+	}
+	acsURL, err := url.Parse(SAMLServiceURL(config.Slug, "acs"))
+	if err != nil {
+		return nil, err
+	}
+	return &saml.ServiceProvider{
+		EntityID:          metadataURL.String(),
+		MetadataURL:       *metadataURL,
+		AcsURL:            *acsURL,
+		IDPMetadata:       idpMetadata,
+		AuthnNameIDFormat: saml.UnspecifiedNameIDFormat,
+	}, nil
+}
+
+// SAMLMetadata returns the SP metadata XML to register at the IdP
+func SAMLMetadata(config *model.CustomOAuthProvider) ([]byte, error) {
+	sp, err := newSAMLServiceProvider(config)
+	if err != nil {
+		return nil, err
+	}
+	return xml.MarshalIndent(sp.Metadata(), "", "  ")
+}
+
+// StartSAMLLogin creates an AuthnRequest and returns the IdP redirect URL
+func StartSAMLLogin(config *model.CustomOAuthProvider, state string) (string, error) {
+	sp, err := newSAMLServiceProvider(config)
+	if err != nil {
+		return "", err
+	}
+	request, err := sp.MakeAuthenticationRequest(sp.GetSSOBindingLocation(saml.HTTPRedirectBinding), saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		return "", err
+	}
+	relayState := common.GetRandomString(32)
+	if err := samlStorePut(relayState, samlPendingRequest{RequestId: request.ID, State: state}, samlRequestTTL); err != nil {
+		return "", err
+	}
+	redirect, err := request.Redirect(relayState, sp)
+	if err != nil {
+		return "", err
+	}
+	return redirect.String(), nil
+}
+
+// HandleSAMLResponse validates the IdP response posted to the ACS (signature, issuer, audience,
+// destination, validity window and InResponseTo) and stores the mapped user under a one-time code.
+// state is the OAuth state of the login request, returned whenever the request could be matched
+func HandleSAMLResponse(ctx context.Context, config *model.CustomOAuthProvider, req *http.Request) (state string, code string, err error) {
+	if err := req.ParseForm(); err != nil {
+		return "", "", err
+	}
+	var pending samlPendingRequest
+	if err := samlStoreTake(req.PostForm.Get("RelayState"), &pending); err != nil {
+		return "", "", err
+	}
+	sp, err := newSAMLServiceProvider(config)
+	if err != nil {
+		return pending.State, "", err
+	}
+	assertion, err := sp.ParseResponse(req, []string{pending.RequestId})
+	if err != nil {
+		var invalid *saml.InvalidResponseError
+		if errors.As(err, &invalid) {
+			logger.LogError(ctx, fmt.Sprintf("[SAML-%s] invalid response: %v", config.Slug, invalid.PrivateErr))
+		} else {
+			logger.LogError(ctx, fmt.Sprintf("[SAML-%s] invalid response: %v", config.Slug, err))
+		}
+		return pending.State, "", errors.New("SAML response validation failed")
+	}
+	oauthUser, err := samlAssertionToUser(ctx, config, assertion)
+	if err != nil {
+		return pending.State, "", err
+	}
+	code = common.GetRandomString(32)
+	if err := samlStorePut(code, oauthUser, samlCodeTTL); err != nil {
+		return pending.State, "", err
+	}
+	return pending.State, code, nil
+}
+
+// samlAttributes collects assertion attributes by Name and FriendlyName
+func samlAttributes(assertion *saml.Assertion) map[string][]string {
+	attributes := make(map[string][]string)
+	if assertion.Subject != nil && assertion.Subject.NameID != nil {
+		attributes[SAMLNameIDField] = []string{assertion.Subject.NameID.Value}
+	}
+	for _, statement := range assertion.AttributeStatements {
+		for _, attribute := range statement.Attributes {
+			values := make([]string, 0, len(attribute.Values))
+			for _, value := range attribute.Values {
+				values = append(values, strings.TrimSpace(value.Value))
+			}
+			attributes[attribute.Name] = append(attributes[attribute.Name], values...)
+			if attribute.FriendlyName != "" && attribute.FriendlyName != attribute.Name {
+				attributes[attribute.FriendlyName] = append(attributes[attribute.FriendlyName], values...)
+			}
+		}
+	}
+	return attributes
+}
+
+func firstSAMLAttribute(attributes map[string][]string, field string) string {
+	for _, value := range attributes[field] {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// samlAssertionToUser maps assertion attributes to an OAuthUser and applies the access policy
+func samlAssertionToUser(ctx context.Context, config *model.CustomOAuthProvider, assertion *saml.Assertion) (*OAuthUser, error) {
+	attributes := samlAttributes(assertion)
+	userId := firstSAMLAttribute(attributes, config.UserIdField)
+	if userId == "" {
+		logger.LogError(ctx, fmt.Sprintf("[SAML-%s] empty user ID (field: %s)", config.Slug, config.UserIdField))
+		return nil, NewOAuthError(i18n.MsgOAuthUserInfoEmpty, map[string]any{"Provider": config.Name})
+	}
+
+	// 访问策略与 OAuth 一致，单值属性按字符串、多值属性按数组参与匹配
+	if policyRaw := strings.TrimSpace(config.AccessPolicy); policyRaw != "" {
+		body := make(map[string]any, len(attributes))
+		for name, values := range attributes {
+			if len(values) == 1 {
+				body[name] = values[0]
+			} else {
+				body[name] = values
+			}
+		}
+		bodyBytes, err := common.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		policy, err := parseAccessPolicy(policyRaw)
+		if err != nil {
+			logger.LogError(ctx, fmt.Sprintf("[SAML-%s] invalid access policy: %s", config.Slug, err.Error()))
+			return nil, NewOAuthErrorWithRaw(i18n.MsgOAuthGetUserErr, nil, "invalid access policy configuration")
+		}
+		if allowed, failure := evaluateAccessPolicy(string(bodyBytes), policy); !allowed {
+			return nil, &AccessDeniedError{Message: renderAccessDeniedMessage(config.AccessDeniedMessage, config.Name, string(bodyBytes), failure)}
+		}
+	}
+
+	extra := map[string]any{
+		"provider": config.Slug,
+	}
+	if config.SamlGroupField != "" {
+		// group 为首个命中的分组，groups 为全部命中的分组，登录时用户当前分组在其中则保持不变
+		var groups []string
+		for _, group := range attributes[config.SamlGroupField] {
+			if ratio_setting.ContainsGroupRatio(group) {
+				groups = append(groups, group)
+			}
+		}
+		if len(groups) > 0 {
+			extra["group"] = groups[0]
+			extra["groups"] = groups
+		}
+	}
+	if config.SamlDefaultGroup != "" && ratio_setting.ContainsGroupRatio(config.SamlDefaultGroup) {
+		extra["default_group"] = config.SamlDefaultGroup
+	}
+
+	return &OAuthUser{
+		ProviderUserID: userId,
+		Username:       firstSAMLAttribute(attributes, config.UsernameField),
+		DisplayName:    firstSAMLAttribute(attributes, config.DisplayNameField),
+		Email:          firstSAMLAttribute(attributes, config.EmailField),
+		Extra:          extra,
+	}, nil
+}
+
+// redeemSAMLCode returns the user stored by HandleSAMLResponse, each code can only be used once
+func redeemSAMLCode(code string) (*OAuthUser, error) {
+	var user OAuthUser
+	if err := samlStoreTake(code, &user); err != nil {
+		return nil, NewOAuthError(i18n.MsgOAuthInvalidCode, nil)
+	}
+	return &user, nil
+}
@@ -0,0 +1,156 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/xml"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/crewjam/saml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testSAMLServiceProviders struct {
+	metadata *saml.EntityDescriptor
+}
+
+func (p *testSAMLServiceProviders) GetServiceProvider(r *http.Request, serviceProviderID string) (*saml.EntityDescriptor, error) {
+	return p.metadata, nil
+}
+
+func newTestSAMLIdP(t *testing.T) (*saml.IdentityProvider, *testSAMLServiceProviders) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	providers := &testSAMLServiceProviders{}
+	idp := &saml.IdentityProvider{
+		Key:                     key,
+		Signer:                  key,
+		Certificate:             cert,
+		MetadataURL:             url.URL{Scheme: "https", Host: "idp.example.com", Path: "/metadata"},
+		SSOURL:                  url.URL{Scheme: "https", Host: "idp.example.com", Path: "/sso"},
+		ServiceProviderProvider: providers,
+	}
+	return idp, providers
+}
+
+// samlLoginRoundTrip runs the SP login and IdP assertion steps, returning the ACS form values
+func samlLoginRoundTrip(t *testing.T, idp *saml.IdentityProvider, config *model.CustomOAuthProvider, state string, session *saml.Session) url.Values {
+	t.Helper()
+	redirect, err := StartSAMLLogin(config, state)
+	require.NoError(t, err)
+	idpReq, err := saml.NewIdpAuthnRequest(idp, httptest.NewRequest(http.MethodGet, redirect, nil))
+	require.NoError(t, err)
+	require.NoError(t, idpReq.Validate())
+	require.NoError(t, saml.DefaultAssertionMaker{}.MakeAssertion(idpReq, session))
+	form, err := idpReq.PostBinding()
+	require.NoError(t, err)
+	assert.Equal(t, SAMLServiceURL(config.Slug, "acs"), form.URL)
+	return url.Values{"SAMLResponse": {form.SAMLResponse}, "RelayState": {form.RelayState}}
+}
+
+func postSAMLResponse(t *testing.T, config *model.CustomOAuthProvider, values url.Values) (string, string, error) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, SAMLServiceURL(config.Slug, "acs"), strings.NewReader(values.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return HandleSAMLResponse(context.Background(), config, req)
+}
+
+func TestSAMLLoginFlow(t *testing.T) {
+	oldServerAddress := system_setting.ServerAddress
+	oldRedisEnabled := common.RedisEnabled
+	system_setting.ServerAddress = "https://api.example.com"
+	common.RedisEnabled = false
+	t.Cleanup(func() {
+		system_setting.ServerAddress = oldServerAddress
+		common.RedisEnabled = oldRedisEnabled
+	})
+
+	idp, providers := newTestSAMLIdP(t)
+	idpMetadata, err := xml.Marshal(idp.Metadata())
+	require.NoError(t, err)
+	config := &model.CustomOAuthProvider{
+		Id:               1,
+		Name:             "Corp",
+		Slug:             "corp",
+		Enabled:          true,
+		Protocol:         model.CustomOAuthProtocolSAML,
+		SamlIdpMetadata:  string(idpMetadata),
+		UserIdField:      SAMLNameIDField,
+		UsernameField:    "uid",
+		EmailField:       "mail",
+		SamlGroupField:   "eduPersonAffiliation",
+		SamlDefaultGroup: "default",
+	}
+	spMetadata, err := SAMLMetadata(config)
+	require.NoError(t, err)
+	providers.metadata = &saml.EntityDescriptor{}
+	require.NoError(t, xml.Unmarshal(spMetadata, providers.metadata))
+
+	session := &saml.Session{
+		ID:        "session-1",
+		NameID:    "alice-id",
+		UserName:  "alice",
+		UserEmail: "alice@example.com",
+		Groups:    []string{"staff", "vip"},
+	}
+	values := samlLoginRoundTrip(t, idp, config, "state-1", session)
+	state, code, err := postSAMLResponse(t, config, values)
+	require.NoError(t, err)
+	assert.Equal(t, "state-1", state)
+
+	provider := NewGenericOAuthProvider(config)
+	token, err := provider.ExchangeToken(context.Background(), code, nil)
+	require.NoError(t, err)
+	user, err := provider.GetUserInfo(context.Background(), token)
+	require.NoError(t, err)
+	assert.Equal(t, "alice-id", user.ProviderUserID)
+	assert.Equal(t, "alice", user.Username)
+	assert.Equal(t, "alice@example.com", user.Email)
+	assert.Equal(t, "vip", user.Extra["group"])
+	assert.Equal(t, []any{"vip"}, user.Extra["groups"])
+	assert.Equal(t, "default", user.Extra["default_group"])
+
+	// 一次性 code 与 RelayState 均不可重放
+	_, err = provider.GetUserInfo(context.Background(), token)
+	assert.Error(t, err)
+	_, _, err = postSAMLResponse(t, config, values)
+	assert.Error(t, err)
+
+	// 篡改断言后签名校验失败
+	values = samlLoginRoundTrip(t, idp, config, "state-2", session)
+	raw, err := base64.StdEncoding.DecodeString(values.Get("SAMLResponse"))
+	require.NoError(t, err)
+	tampered := strings.ReplaceAll(string(raw), "alice-id", "mallory")
+	require.NotEqual(t, string(raw), tampered)
+	values.Set("SAMLResponse", base64.StdEncoding.EncodeToString([]byte(tampered)))
+	state, code, err = postSAMLResponse(t, config, values)
+	assert.Error(t, err)
+	assert.Equal(t, "state-2", state)
+	assert.Empty(t, code)
+}
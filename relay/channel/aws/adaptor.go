@@ -33,9 +33,16 @@ type Adaptor struct {
 	IsNova     bool
 }
 
-func (a *Adaptor) ConvertGeminiRequest(*gin.Context, *relaycommon.RelayInfo, *dto.GeminiChatRequest) (any, error) {
-	//TODO implement me
-	return nil, errors.New("not implemented")
+func (a *Adaptor) ConvertGeminiRequest(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeminiChatRequest) (any, error) {
+	if isNovaModel(info.UpstreamModelName) {
+		return nil, errors.New("gemini format is not supported for nova models")
+	}
+	claudeReq, err := claude.RequestGemini2ClaudeMessage(c, request, info.UpstreamModelName, info.IsStream)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert gemini request to claude request")
+	}
+	info.UpstreamModelName = claudeReq.Model
+	return claudeReq, nil
 }
 
 func (a *Adaptor) ConvertClaudeRequest(c *gin.Context, info *relaycommon.RelayInfo, request *dto.ClaudeRequest) (any, error) {
@@ -141,8 +148,15 @@ func (a *Adaptor) ConvertEmbeddingRequest(c *gin.Context, info *relaycommon.Rela
 }
 
 func (a *Adaptor) ConvertOpenAIResponsesRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.OpenAIResponsesRequest) (any, error) {
-	// TODO implement me
-	return nil, errors.New("not implemented")
+	if isNovaModel(request.Model) {
+		return nil, errors.New("responses api is not supported for nova models")
+	}
+	claudeReq, err := claude.RequestResponses2ClaudeMessage(c, request)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert responses request to claude request")
+	}
+	info.UpstreamModelName = claudeReq.Model
+	return claudeReq, nil
 }
 
 func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (any, error) {
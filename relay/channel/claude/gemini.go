@@ -0,0 +1,443 @@
+package claude
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// geminiFunctionDeclaration Gemini 函数声明，参数可能是 OpenAPI 子集（parameters）或 JSON Schema（parametersJsonSchema）
+type geminiFunctionDeclaration struct {
+	Name                 string `json:"name"`
+	Description          string `json:"description"`
+	Parameters           any    `json:"parameters"`
+	ParametersJsonSchema any    `json:"parametersJsonSchema"`
+}
+
+// geminiPendingToolCall 流式输出时缓存的工具调用，Gemini 的 functionCall 需要完整参数后一次性输出
+type geminiPendingToolCall struct {
+	name      string
+	arguments strings.Builder
+}
+
+// RequestGemini2ClaudeMessage 将 Gemini generateContent 请求转换为 Claude Messages 请求
+func RequestGemini2ClaudeMessage(c *gin.Context, request *dto.GeminiChatRequest, model string, stream bool) (*dto.ClaudeRequest, error) {
+	config := request.GenerationConfig
+	claudeRequest := dto.ClaudeRequest{
+		Model:         model,
+		Temperature:   config.Temperature,
+		TopP:          config.TopP,
+		StopSequences: config.StopSequences,
+	}
+	if config.TopK != nil && *config.TopK > 0 {
+		claudeRequest.TopK = common.GetPointer(int(*config.TopK))
+	}
+	if config.MaxOutputTokens != nil && *config.MaxOutputTokens > 0 {
+		claudeRequest.MaxTokens = common.GetPointer(*config.MaxOutputTokens)
+	} else {
+		claudeRequest.MaxTokens = common.GetPointer(uint(model_setting.GetClaudeSettings().GetDefaultMaxTokens(model)))
+	}
+	if stream {
+		claudeRequest.Stream = common.GetPointer(true)
+	}
+
+	tools, err := convertGeminiTools(request.GetTools())
+	if err != nil {
+		return nil, err
+	}
+	if len(tools) > 0 {
+		claudeRequest.Tools = tools
+	}
+	if request.ToolConfig != nil && request.ToolConfig.FunctionCallingConfig != nil {
+		claudeRequest.ToolChoice = convertGeminiFunctionCallingConfig(request.ToolConfig.FunctionCallingConfig)
+	}
+
+	applyClaudeThinkingModelSuffix(&claudeRequest, model)
+	if claudeRequest.Thinking == nil && config.ThinkingConfig != nil {
+		if thinking := claudeThinkingForGeminiConfig(config.ThinkingConfig); thinking != nil {
+			// 思考预算必须小于 max_tokens
+			if uint(*thinking.BudgetTokens) >= *claudeRequest.MaxTokens {
+				claudeRequest.MaxTokens = common.GetPointer(uint(*thinking.BudgetTokens) + *claudeRequest.MaxTokens)
+			}
+			claudeRequest.Thinking = thinking
+			claudeRequest.Temperature = nil
+			claudeRequest.TopP = nil
+			claudeRequest.TopK = nil
+		}
+	}
+
+	if request.SystemInstructions != nil {
+		var systemMessages []dto.ClaudeMediaMessage
+		for _, part := range request.SystemInstructions.Parts {
+			if part.Text != "" {
+				systemMessages = append(systemMessages, dto.ClaudeMediaMessage{Type: "text", Text: common.GetPointer(part.Text)})
+			}
+		}
+		if len(systemMessages) > 0 {
+			claudeRequest.System = systemMessages
+		}
+	}
+
+	// Gemini 的 functionResponse 按函数名与 functionCall 对应，这里为每次调用生成 tool_use id 并按顺序配对
+	pendingToolUseIds := make(map[string][]string)
+	toolUseCount := 0
+	messages := &claudeMessagesBuilder{}
+	for _, content := range request.Contents {
+		role := "user"
+		if content.Role == "model" {
+			role = "assistant"
+		}
+		var blocks []dto.ClaudeMediaMessage
+		var thinking strings.Builder
+		for _, part := range content.Parts {
+			switch {
+			case part.Thought:
+				// 只有携带签名的思考内容才能回传给 Claude，签名可能位于单独的 part 中
+				thinking.WriteString(part.Text)
+				if signature := geminiThoughtSignature(part); signature != "" {
+					blocks = append(blocks, dto.ClaudeMediaMessage{
+						Type:      "thinking",
+						Thinking:  common.GetPointer(thinking.String()),
+						Signature: signature,
+					})
+					thinking.Reset()
+				}
+			case part.FunctionCall != nil:
+				toolUseCount++
+				id := fmt.Sprintf("toolu_gemini_%d", toolUseCount)
+				name := part.FunctionCall.FunctionName
+				pendingToolUseIds[name] = append(pendingToolUseIds[name], id)
+				input := part.FunctionCall.Arguments
+				if input == nil {
+					input = map[string]any{}
+				}
+				blocks = append(blocks, dto.ClaudeMediaMessage{Type: "tool_use", Id: id, Name: name, Input: input})
+			case part.FunctionResponse != nil:
+				name := part.FunctionResponse.Name
+				ids := pendingToolUseIds[name]
+				if len(ids) == 0 {
+					return nil, fmt.Errorf("functionResponse %s has no matching functionCall", name)
+				}
+				pendingToolUseIds[name] = ids[1:]
+				output, _ := common.Marshal(part.FunctionResponse.Response)
+				blocks = append(blocks, dto.ClaudeMediaMessage{Type: "tool_result", ToolUseId: ids[0], Content: string(output)})
+			case part.InlineData != nil:
+				block, err := convertGeminiMedia(part.InlineData.MimeType, &dto.ClaudeMessageSource{
+					Type:      "base64",
+					MediaType: part.InlineData.MimeType,
+					Data:      part.InlineData.Data,
+				})
+				if err != nil {
+					return nil, err
+				}
+				blocks = append(blocks, block)
+			case part.FileData != nil:
+				if !strings.HasPrefix(part.FileData.FileUri, "http") {
+					return nil, fmt.Errorf("fileData uri %s is not supported by this channel", part.FileData.FileUri)
+				}
+				source, err := getClaudeBase64Source(c, part.FileData.FileUri, "formatting file for Claude")
+				if err != nil {
+					return nil, err
+				}
+				mimeType := part.FileData.MimeType
+				if mimeType == "" {
+					mimeType = source.MediaType
+				}
+				block, err := convertGeminiMedia(mimeType, source)
+				if err != nil {
+					return nil, err
+				}
+				blocks = append(blocks, block)
+			case part.Text != "":
+				blocks = append(blocks, dto.ClaudeMediaMessage{Type: "text", Text: common.GetPointer(part.Text)})
+			}
+		}
+		messages.append(role, blocks...)
+	}
+
+	if len(messages.messages) > 0 && messages.messages[0].Role != "user" {
+		// fix: first message is assistant, add user message
+		messages.messages = append([]dto.ClaudeMessage{{
+			Role:    "user",
+			Content: []dto.ClaudeMediaMessage{{Type: "text", Text: common.GetPointer("...")}},
+		}}, messages.messages...)
+	}
+	claudeRequest.Messages = messages.messages
+	return &claudeRequest, nil
+}
+
+func geminiThoughtSignature(part dto.GeminiPart) string {
+	if len(part.ThoughtSignature) == 0 {
+		return ""
+	}
+	var signature string
+	if err := common.Unmarshal(part.ThoughtSignature, &signature); err != nil {
+		return ""
+	}
+	return signature
+}
+
+// convertGeminiMedia 按 MIME 类型将 Gemini 的媒体数据转换为 Claude 的 image / document 内容块
+func convertGeminiMedia(mimeType string, source *dto.ClaudeMessageSource) (dto.ClaudeMediaMessage, error) {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return dto.ClaudeMediaMessage{Type: "image", Source: source}, nil
+	case mimeType == "application/pdf":
+		return dto.ClaudeMediaMessage{Type: "document", Source: source}, nil
+	}
+	return dto.ClaudeMediaMessage{}, fmt.Errorf("media type %s is not supported by this channel", mimeType)
+}
+
+// convertGeminiTools 转换 Gemini 工具定义，支持 functionDeclarations 与 googleSearch
+func convertGeminiTools(geminiTools []dto.GeminiChatTool) ([]any, error) {
+	claudeTools := make([]any, 0, len(geminiTools))
+	for _, tool := range geminiTools {
+		if tool.FunctionDeclarations != nil {
+			declarations, err := common.Any2Type[[]geminiFunctionDeclaration](tool.FunctionDeclarations)
+			if err != nil {
+				return nil, fmt.Errorf("invalid functionDeclarations: %w", err)
+			}
+			for _, declaration := range declarations {
+				schema := declaration.ParametersJsonSchema
+				if schema == nil {
+					schema = normalizeGeminiSchema(declaration.Parameters)
+				}
+				inputSchema, ok := schema.(map[string]any)
+				if !ok {
+					inputSchema = map[string]any{"type": "object", "properties": map[string]any{}}
+				}
+				claudeTools = append(claudeTools, &dto.Tool{
+					Name:        declaration.Name,
+					Description: declaration.Description,
+					InputSchema: inputSchema,
+				})
+			}
+		}
+		if tool.GoogleSearch != nil || tool.GoogleSearchRetrieval != nil {
+			claudeTools = append(claudeTools, &dto.ClaudeWebSearchTool{
+				Type: "web_search_20250305",
+				Name: "web_search",
+			})
+		}
+		if tool.CodeExecution != nil {
+			return nil, errors.New("codeExecution tool is not supported by this channel")
+		}
+		if tool.URLContext != nil {
+			return nil, errors.New("urlContext tool is not supported by this channel")
+		}
+	}
+	return claudeTools, nil
+}
+
+// normalizeGeminiSchema Gemini 的 OpenAPI 子集使用大写类型名（OBJECT、STRING），转换为 JSON Schema 的小写形式
+func normalizeGeminiSchema(schema any) any {
+	switch v := schema.(type) {
+	case map[string]any:
+		normalized := make(map[string]any, len(v))
+		for key, value := range v {
+			if key == "type" {
+				if typeName, ok := value.(string); ok {
+					normalized[key] = strings.ToLower(typeName)
+					continue
+				}
+			}
+			normalized[key] = normalizeGeminiSchema(value)
+		}
+		return normalized
+	case []any:
+		normalized := make([]any, len(v))
+		for i, value := range v {
+			normalized[i] = normalizeGeminiSchema(value)
+		}
+		return normalized
+	}
+	return schema
+}
+
+func convertGeminiFunctionCallingConfig(config *dto.FunctionCallingConfig) *dto.ClaudeToolChoice {
+	switch strings.ToUpper(string(config.Mode)) {
+	case "ANY", "VALIDATED":
+		if len(config.AllowedFunctionNames) == 1 {
+			return &dto.ClaudeToolChoice{Type: "tool", Name: config.AllowedFunctionNames[0]}
+		}
+		return &dto.ClaudeToolChoice{Type: "any"}
+	case "NONE":
+		return &dto.ClaudeToolChoice{Type: "none"}
+	case "AUTO":
+		return &dto.ClaudeToolChoice{Type: "auto"}
+	}
+	return nil
+}
+
+// claudeThinkingForGeminiConfig 将 Gemini 的 thinkingBudget / thinkingLevel 映射为 Claude 的思考预算
+func claudeThinkingForGeminiConfig(config *dto.GeminiThinkingConfig) *dto.Thinking {
+	if config.ThinkingBudget != nil {
+		budget := *config.ThinkingBudget
+		switch {
+		case budget == 0:
+			return nil
+		case budget < 0:
+			// -1 表示动态思考
+			return claudeThinkingForEffort("medium")
+		case budget < 1024:
+			// Claude 的思考预算最少 1024
+			budget = 1024
+		}
+		return &dto.Thinking{Type: "enabled", BudgetTokens: common.GetPointer(budget)}
+	}
+	return claudeThinkingForEffort(strings.ToLower(config.ThinkingLevel))
+}
+
+func geminiFinishReasonFromClaude(stopReason string) string {
+	switch stopReason {
+	case "max_tokens":
+		return "MAX_TOKENS"
+	case "refusal":
+		return "SAFETY"
+	}
+	return "STOP"
+}
+
+// claudeUsage2GeminiUsage Gemini 的 promptTokenCount 包含缓存命中的 token
+func claudeUsage2GeminiUsage(usage *dto.Usage) dto.GeminiUsageMetadata {
+	if usage == nil {
+		return dto.GeminiUsageMetadata{}
+	}
+	promptTokens := usage.PromptTokens + usage.PromptTokensDetails.CachedTokens + usage.PromptTokensDetails.CachedCreationTokens
+	return dto.GeminiUsageMetadata{
+		PromptTokenCount:        promptTokens,
+		CandidatesTokenCount:    usage.CompletionTokens,
+		TotalTokenCount:         promptTokens + usage.CompletionTokens,
+		CachedContentTokenCount: usage.PromptTokensDetails.CachedTokens,
+	}
+}
+
+func newGeminiChunk(parts []dto.GeminiPart, finishReason *string, usage *dto.Usage) *dto.GeminiChatResponse {
+	return &dto.GeminiChatResponse{
+		Candidates: []dto.GeminiChatCandidate{{
+			Content:       dto.GeminiChatContent{Role: "model", Parts: parts},
+			FinishReason:  finishReason,
+			Index:         0,
+			SafetyRatings: []dto.GeminiChatSafetyRating{},
+		}},
+		UsageMetadata: claudeUsage2GeminiUsage(usage),
+	}
+}
+
+func geminiThoughtSignaturePart(signature string) dto.GeminiPart {
+	data, _ := common.Marshal(signature)
+	return dto.GeminiPart{Thought: true, ThoughtSignature: data}
+}
+
+// claudeBlocks2GeminiParts 将 Claude 内容块转换为 Gemini parts，思考内容以 thought part 输出并携带签名以便回传
+func claudeBlocks2GeminiParts(blocks []dto.ClaudeMediaMessage) []dto.GeminiPart {
+	parts := make([]dto.GeminiPart, 0, len(blocks))
+	for _, block := range blocks {
+		switch block.Type {
+		case "text":
+			if text := block.GetText(); text != "" {
+				parts = append(parts, dto.GeminiPart{Text: text})
+			}
+		case "thinking":
+			part := geminiThoughtSignaturePart(block.Signature)
+			if block.Thinking != nil {
+				part.Text = *block.Thinking
+			}
+			parts = append(parts, part)
+		case "tool_use":
+			args := block.Input
+			if args == nil {
+				args = map[string]any{}
+			}
+			parts = append(parts, dto.GeminiPart{FunctionCall: &dto.FunctionCall{FunctionName: block.Name, Arguments: args}})
+		}
+	}
+	return parts
+}
+
+// ResponseClaude2Gemini 将 Claude 非流式响应转换为 Gemini generateContent 响应
+func ResponseClaude2Gemini(claudeResponse *dto.ClaudeResponse, usage *dto.Usage) *dto.GeminiChatResponse {
+	finishReason := geminiFinishReasonFromClaude(claudeResponse.StopReason)
+	return newGeminiChunk(claudeBlocks2GeminiParts(claudeResponse.Content), &finishReason, usage)
+}
+
+// streamResponseClaude2Gemini 将 Claude 流事件转换为 Gemini 流式响应，工具调用在内容块结束时完整输出
+func streamResponseClaude2Gemini(c *gin.Context, claudeInfo *ClaudeResponseInfo, claudeResponse *dto.ClaudeResponse) {
+	var parts []dto.GeminiPart
+	var finishReason *string
+	switch claudeResponse.Type {
+	case "content_block_start":
+		block := claudeResponse.ContentBlock
+		if block == nil {
+			return
+		}
+		switch block.Type {
+		case "text":
+			if text := block.GetText(); text != "" {
+				parts = append(parts, dto.GeminiPart{Text: text})
+			}
+		case "tool_use":
+			if claudeInfo.geminiToolCalls == nil {
+				claudeInfo.geminiToolCalls = make(map[int]*geminiPendingToolCall)
+			}
+			claudeInfo.geminiToolCalls[claudeResponse.GetIndex()] = &geminiPendingToolCall{name: block.Name}
+		}
+	case "content_block_delta":
+		delta := claudeResponse.Delta
+		if delta == nil {
+			return
+		}
+		switch delta.Type {
+		case "text_delta":
+			if text := delta.GetText(); text != "" {
+				parts = append(parts, dto.GeminiPart{Text: text})
+			}
+		case "thinking_delta":
+			if delta.Thinking != nil && *delta.Thinking != "" {
+				parts = append(parts, dto.GeminiPart{Text: *delta.Thinking, Thought: true})
+			}
+		case "signature_delta":
+			parts = append(parts, geminiThoughtSignaturePart(delta.Signature))
+		case "input_json_delta":
+			if toolCall, ok := claudeInfo.geminiToolCalls[claudeResponse.GetIndex()]; ok && delta.PartialJson != nil {
+				toolCall.arguments.WriteString(*delta.PartialJson)
+			}
+		}
+	case "content_block_stop":
+		toolCall, ok := claudeInfo.geminiToolCalls[claudeResponse.GetIndex()]
+		if !ok {
+			return
+		}
+		delete(claudeInfo.geminiToolCalls, claudeResponse.GetIndex())
+		args := make(map[string]any)
+		if arguments := strings.TrimSpace(toolCall.arguments.String()); arguments != "" {
+			if err := common.UnmarshalJsonStr(arguments, &args); err != nil {
+				args = map[string]any{"arguments": arguments}
+			}
+		}
+		parts = append(parts, dto.GeminiPart{FunctionCall: &dto.FunctionCall{FunctionName: toolCall.name, Arguments: args}})
+	case "message_delta":
+		stopReason := ""
+		if claudeResponse.Delta != nil && claudeResponse.Delta.StopReason != nil {
+			stopReason = *claudeResponse.Delta.StopReason
+		}
+		finishReason = common.GetPointer(geminiFinishReasonFromClaude(stopReason))
+	}
+	if len(parts) == 0 && finishReason == nil {
+		return
+	}
+	if parts == nil {
+		parts = []dto.GeminiPart{}
+	}
+	if err := helper.ObjectData(c, newGeminiChunk(parts, finishReason, claudeInfo.Usage)); err != nil {
+		logger.LogError(c, "send_stream_response_failed: "+err.Error())
+	}
+}
@@ -0,0 +1,173 @@
+package claude
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestRequestGemini2ClaudeMessage(t *testing.T) {
+	var request dto.GeminiChatRequest
+	require.NoError(t, common.UnmarshalJsonStr(`{
+		"systemInstruction":{"parts":[{"text":"be brief"}]},
+		"contents":[
+			{"role":"user","parts":[{"text":"weather in paris and rome?"}]},
+			{"role":"model","parts":[
+				{"text":"need tool","thought":true,"thoughtSignature":"sig_1"},
+				{"functionCall":{"name":"get_weather","args":{"city":"paris"}}},
+				{"functionCall":{"name":"get_weather","args":{"city":"rome"}}}
+			]},
+			{"role":"user","parts":[
+				{"functionResponse":{"name":"get_weather","response":{"result":"sunny"}}},
+				{"functionResponse":{"name":"get_weather","response":{"result":"rainy"}}}
+			]}
+		],
+		"tools":[{"functionDeclarations":[{"name":"get_weather","parameters":{"type":"OBJECT","properties":{"city":{"type":"STRING"}}}}]},{"googleSearch":{}}],
+		"toolConfig":{"functionCallingConfig":{"mode":"ANY","allowedFunctionNames":["get_weather"]}},
+		"generationConfig":{"maxOutputTokens":1024,"temperature":0.5,"thinkingConfig":{"thinkingBudget":2000}}
+	}`, &request))
+
+	claudeRequest, err := RequestGemini2ClaudeMessage(nil, &request, "claude-sonnet-4-5", true)
+	require.NoError(t, err)
+
+	assert.Equal(t, "claude-sonnet-4-5", claudeRequest.Model)
+	assert.True(t, *claudeRequest.Stream)
+	system := claudeRequest.System.([]dto.ClaudeMediaMessage)
+	require.Len(t, system, 1)
+	assert.Equal(t, "be brief", system[0].GetText())
+
+	// 思考预算必须小于 max_tokens，开启思考后不能指定 temperature
+	require.NotNil(t, claudeRequest.Thinking)
+	assert.Equal(t, 2000, *claudeRequest.Thinking.BudgetTokens)
+	assert.Greater(t, *claudeRequest.MaxTokens, uint(2000))
+	assert.Nil(t, claudeRequest.Temperature)
+
+	require.Len(t, claudeRequest.Messages, 3)
+	assistant := claudeRequest.Messages[1].Content.([]dto.ClaudeMediaMessage)
+	require.Len(t, assistant, 3)
+	assert.Equal(t, "thinking", assistant[0].Type)
+	assert.Equal(t, "sig_1", assistant[0].Signature)
+	assert.Equal(t, "tool_use", assistant[1].Type)
+	assert.Equal(t, map[string]any{"city": "paris"}, assistant[1].Input)
+	// 同名函数的多次调用按顺序与 functionResponse 配对
+	user := claudeRequest.Messages[2].Content.([]dto.ClaudeMediaMessage)
+	require.Len(t, user, 2)
+	assert.Equal(t, assistant[1].Id, user[0].ToolUseId)
+	assert.Equal(t, assistant[2].Id, user[1].ToolUseId)
+	assert.NotEqual(t, user[0].ToolUseId, user[1].ToolUseId)
+	assert.Equal(t, `{"result":"rainy"}`, user[1].Content)
+
+	tools := claudeRequest.Tools.([]any)
+	require.Len(t, tools, 2)
+	tool := tools[0].(*dto.Tool)
+	assert.Equal(t, "object", tool.InputSchema["type"])
+	assert.Equal(t, "string", gjson.Get(mustMarshal(t, tool.InputSchema), "properties.city.type").String())
+	assert.Equal(t, "web_search", tools[1].(*dto.ClaudeWebSearchTool).Name)
+	toolChoice := claudeRequest.ToolChoice.(*dto.ClaudeToolChoice)
+	assert.Equal(t, "tool", toolChoice.Type)
+	assert.Equal(t, "get_weather", toolChoice.Name)
+
+	_, err = RequestGemini2ClaudeMessage(nil, &dto.GeminiChatRequest{Contents: []dto.GeminiChatContent{{
+		Role:  "user",
+		Parts: []dto.GeminiPart{{FunctionResponse: &dto.GeminiFunctionResponse{Name: "unknown"}}},
+	}}}, "claude", false)
+	assert.Error(t, err)
+}
+
+func mustMarshal(t *testing.T, v any) string {
+	data, err := common.Marshal(v)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func newGeminiTestContext(stream bool) (*gin.Context, *httptest.ResponseRecorder, *relaycommon.RelayInfo) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1beta/models/claude-sonnet-4-5:generateContent", nil)
+	info := &relaycommon.RelayInfo{
+		RelayFormat:     types.RelayFormatGemini,
+		IsStream:        stream,
+		OriginModelName: "claude-sonnet-4-5",
+	}
+	return c, recorder, info
+}
+
+func TestClaudeStreamToGeminiChunks(t *testing.T) {
+	c, recorder, info := newGeminiTestContext(true)
+	claudeInfo := &ClaudeResponseInfo{Usage: &dto.Usage{}}
+	events := []string{
+		`{"type":"message_start","message":{"id":"msg_1","model":"claude-sonnet-4-5","usage":{"input_tokens":10,"cache_read_input_tokens":100,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"let me think"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"sig_1"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"Hello"}}`,
+		`{"type":"content_block_stop","index":1}`,
+		`{"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{}}}`,
+		`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"{\"city\":"}}`,
+		`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"\"paris\"}"}}`,
+		`{"type":"content_block_stop","index":2}`,
+		`{"type":"message_delta","delta":{"stop_reason":"max_tokens"},"usage":{"output_tokens":30}}`,
+		`{"type":"message_stop"}`,
+	}
+	for _, event := range events {
+		require.Nil(t, HandleStreamResponseData(c, info, claudeInfo, event))
+	}
+	HandleStreamFinalResponse(c, info, claudeInfo)
+
+	var payloads []string
+	for _, line := range strings.Split(recorder.Body.String(), "\n") {
+		if strings.HasPrefix(line, "data: ") {
+			payloads = append(payloads, strings.TrimPrefix(line, "data: "))
+		}
+	}
+	require.Len(t, payloads, 5)
+	assert.Equal(t, "let me think", gjson.Get(payloads[0], "candidates.0.content.parts.0.text").String())
+	assert.True(t, gjson.Get(payloads[0], "candidates.0.content.parts.0.thought").Bool())
+	assert.Equal(t, "sig_1", gjson.Get(payloads[1], "candidates.0.content.parts.0.thoughtSignature").String())
+	assert.Equal(t, "Hello", gjson.Get(payloads[2], "candidates.0.content.parts.0.text").String())
+	assert.Equal(t, "get_weather", gjson.Get(payloads[3], "candidates.0.content.parts.0.functionCall.name").String())
+	assert.Equal(t, "paris", gjson.Get(payloads[3], "candidates.0.content.parts.0.functionCall.args.city").String())
+
+	final := payloads[4]
+	assert.Equal(t, "MAX_TOKENS", gjson.Get(final, "candidates.0.finishReason").String())
+	// Gemini 的 promptTokenCount 包含缓存 token
+	assert.EqualValues(t, 110, gjson.Get(final, "usageMetadata.promptTokenCount").Int())
+	assert.EqualValues(t, 100, gjson.Get(final, "usageMetadata.cachedContentTokenCount").Int())
+	assert.EqualValues(t, 30, gjson.Get(final, "usageMetadata.candidatesTokenCount").Int())
+	assert.NotContains(t, recorder.Body.String(), "[DONE]")
+
+	// 计费用量保持 Claude 语义
+	assert.Equal(t, 10, claudeInfo.Usage.PromptTokens)
+}
+
+func TestClaudeResponseToGemini(t *testing.T) {
+	c, recorder, info := newGeminiTestContext(false)
+	claudeInfo := &ClaudeResponseInfo{Usage: &dto.Usage{}}
+	data := []byte(`{"id":"msg_1","type":"message","role":"assistant","model":"claude-sonnet-4-5","stop_reason":"tool_use",
+		"content":[{"type":"text","text":"checking"},{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{"city":"paris"}}],
+		"usage":{"input_tokens":10,"cache_read_input_tokens":5,"output_tokens":7}}`)
+
+	require.Nil(t, HandleClaudeResponseData(c, info, claudeInfo, nil, data))
+
+	body := recorder.Body.String()
+	assert.Equal(t, "model", gjson.Get(body, "candidates.0.content.role").String())
+	assert.Equal(t, "checking", gjson.Get(body, "candidates.0.content.parts.0.text").String())
+	assert.Equal(t, "get_weather", gjson.Get(body, "candidates.0.content.parts.1.functionCall.name").String())
+	assert.Equal(t, "STOP", gjson.Get(body, "candidates.0.finishReason").String())
+	assert.EqualValues(t, 15, gjson.Get(body, "usageMetadata.promptTokenCount").Int())
+	assert.EqualValues(t, 22, gjson.Get(body, "usageMetadata.totalTokenCount").Int())
+}
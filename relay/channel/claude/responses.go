@@ -0,0 +1,489 @@
+package claude
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// responsesInputItem Responses API input 数组中的输入项，兼容 message / function_call / function_call_output / reasoning
+type responsesInputItem struct {
+	Type             string                              `json:"type"`
+	Role             string                              `json:"role"`
+	Content          json.RawMessage                     `json:"content"`
+	CallId           string                              `json:"call_id"`
+	Name             string                              `json:"name"`
+	Arguments        string                              `json:"arguments"`
+	Output           json.RawMessage                     `json:"output"`
+	Summary          []dto.ResponsesReasoningSummaryPart `json:"summary"`
+	EncryptedContent string                              `json:"encrypted_content"`
+}
+
+type responsesContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	Refusal  string `json:"refusal"`
+	ImageUrl any    `json:"image_url"`
+	FileId   string `json:"file_id"`
+	FileData string `json:"file_data"`
+	FileUrl  string `json:"file_url"`
+	Filename string `json:"filename"`
+}
+
+type responsesTool struct {
+	Type              string          `json:"type"`
+	Name              string          `json:"name"`
+	Description       string          `json:"description"`
+	Parameters        map[string]any  `json:"parameters"`
+	SearchContextSize string          `json:"search_context_size"`
+	UserLocation      json.RawMessage `json:"user_location"`
+}
+
+// claudeMessagesBuilder 按顺序累积 Claude 消息，相邻同角色的内容块合并到同一条消息中
+type claudeMessagesBuilder struct {
+	messages []dto.ClaudeMessage
+}
+
+func (b *claudeMessagesBuilder) append(role string, blocks ...dto.ClaudeMediaMessage) {
+	if len(blocks) == 0 {
+		return
+	}
+	if n := len(b.messages); n > 0 && b.messages[n-1].Role == role {
+		b.messages[n-1].Content = append(b.messages[n-1].Content.([]dto.ClaudeMediaMessage), blocks...)
+		return
+	}
+	b.messages = append(b.messages, dto.ClaudeMessage{Role: role, Content: blocks})
+}
+
+// RequestResponses2ClaudeMessage 将 OpenAI Responses API 请求转换为 Claude Messages 请求
+func RequestResponses2ClaudeMessage(c *gin.Context, request dto.OpenAIResponsesRequest) (*dto.ClaudeRequest, error) {
+	if request.PreviousResponseID != "" {
+		return nil, errors.New("previous_response_id is not supported by this channel, please send the full conversation in input")
+	}
+
+	claudeRequest := dto.ClaudeRequest{
+		Model:       request.Model,
+		Temperature: request.Temperature,
+		TopP:        request.TopP,
+	}
+	if request.MaxOutputTokens != nil && *request.MaxOutputTokens > 0 {
+		claudeRequest.MaxTokens = common.GetPointer(*request.MaxOutputTokens)
+	} else {
+		claudeRequest.MaxTokens = common.GetPointer(uint(model_setting.GetClaudeSettings().GetDefaultMaxTokens(request.Model)))
+	}
+	if request.Stream != nil && *request.Stream {
+		claudeRequest.Stream = common.GetPointer(true)
+	}
+	if common.GetJsonType(request.User) == "string" {
+		var user string
+		_ = common.Unmarshal(request.User, &user)
+		if user != "" {
+			claudeRequest.Metadata, _ = common.Marshal(map[string]string{"user_id": user})
+		}
+	}
+
+	tools, err := convertResponsesTools(request.Tools)
+	if err != nil {
+		return nil, err
+	}
+	if len(tools) > 0 {
+		claudeRequest.Tools = tools
+	}
+	if len(request.ToolChoice) > 0 || len(request.ParallelToolCalls) > 0 {
+		var parallelToolCalls *bool
+		if len(request.ParallelToolCalls) > 0 {
+			var parallel bool
+			if err := common.Unmarshal(request.ParallelToolCalls, &parallel); err == nil {
+				parallelToolCalls = &parallel
+			}
+		}
+		if toolChoice := mapToolChoice(normalizeResponsesToolChoice(request.ToolChoice), parallelToolCalls); toolChoice != nil {
+			claudeRequest.ToolChoice = toolChoice
+		}
+	}
+
+	applyClaudeThinkingModelSuffix(&claudeRequest, request.Model)
+	if request.Reasoning != nil {
+		if thinking := claudeThinkingForEffort(request.Reasoning.Effort); thinking != nil {
+			// 思考预算必须小于 max_tokens
+			if uint(*thinking.BudgetTokens) >= *claudeRequest.MaxTokens {
+				claudeRequest.MaxTokens = common.GetPointer(uint(*thinking.BudgetTokens) + *claudeRequest.MaxTokens)
+			}
+			claudeRequest.Thinking = thinking
+			claudeRequest.Temperature = nil
+			claudeRequest.TopP = nil
+		}
+	}
+
+	var systemMessages []dto.ClaudeMediaMessage
+	if common.GetJsonType(request.Instructions) == "string" {
+		var instructions string
+		_ = common.Unmarshal(request.Instructions, &instructions)
+		if instructions != "" {
+			systemMessages = append(systemMessages, dto.ClaudeMediaMessage{Type: "text", Text: common.GetPointer(instructions)})
+		}
+	}
+
+	var items []responsesInputItem
+	switch common.GetJsonType(request.Input) {
+	case "string":
+		var input string
+		_ = common.Unmarshal(request.Input, &input)
+		content, _ := common.Marshal(input)
+		items = []responsesInputItem{{Type: "message", Role: "user", Content: content}}
+	case "array":
+		if err := common.Unmarshal(request.Input, &items); err != nil {
+			return nil, fmt.Errorf("invalid input: %w", err)
+		}
+	}
+
+	messages := &claudeMessagesBuilder{}
+	for _, item := range items {
+		if item.Type == "" && item.Role != "" {
+			item.Type = "message"
+		}
+		switch item.Type {
+		case "message":
+			blocks, err := convertResponsesContent(c, item.Content)
+			if err != nil {
+				return nil, err
+			}
+			switch item.Role {
+			case "system", "developer":
+				for _, block := range blocks {
+					if block.Type == "text" {
+						systemMessages = append(systemMessages, block)
+					}
+				}
+			case "assistant":
+				messages.append("assistant", blocks...)
+			default:
+				messages.append("user", blocks...)
+			}
+		case "function_call":
+			input := make(map[string]any)
+			if strings.TrimSpace(item.Arguments) != "" {
+				if err := common.UnmarshalJsonStr(item.Arguments, &input); err != nil {
+					return nil, fmt.Errorf("invalid arguments of function_call %s: %w", item.CallId, err)
+				}
+			}
+			messages.append("assistant", dto.ClaudeMediaMessage{
+				Type:  "tool_use",
+				Id:    item.CallId,
+				Name:  item.Name,
+				Input: input,
+			})
+		case "function_call_output":
+			toolResult := dto.ClaudeMediaMessage{
+				Type:      "tool_result",
+				ToolUseId: item.CallId,
+			}
+			if common.GetJsonType(item.Output) == "string" {
+				var output string
+				_ = common.Unmarshal(item.Output, &output)
+				toolResult.Content = output
+			} else {
+				blocks, err := convertResponsesContent(c, item.Output)
+				if err != nil {
+					return nil, err
+				}
+				toolResult.Content = blocks
+			}
+			messages.append("user", toolResult)
+		case "reasoning":
+			// 只有携带签名（encrypted_content）的推理项才能回传给 Claude，其余推理项直接丢弃
+			if item.EncryptedContent == "" {
+				continue
+			}
+			var thinking strings.Builder
+			for _, part := range item.Summary {
+				thinking.WriteString(part.Text)
+			}
+			messages.append("assistant", dto.ClaudeMediaMessage{
+				Type:      "thinking",
+				Thinking:  common.GetPointer(thinking.String()),
+				Signature: item.EncryptedContent,
+			})
+		default:
+			return nil, fmt.Errorf("unsupported input item type: %s", item.Type)
+		}
+	}
+
+	if len(messages.messages) > 0 && messages.messages[0].Role != "user" {
+		// fix: first message is assistant, add user message
+		messages.messages = append([]dto.ClaudeMessage{{
+			Role:    "user",
+			Content: []dto.ClaudeMediaMessage{{Type: "text", Text: common.GetPointer("...")}},
+		}}, messages.messages...)
+	}
+	if len(systemMessages) > 0 {
+		claudeRequest.System = systemMessages
+	}
+	claudeRequest.Messages = messages.messages
+	return &claudeRequest, nil
+}
+
+// convertResponsesContent 将 Responses 消息内容（字符串或内容数组）转换为 Claude 内容块
+func convertResponsesContent(c *gin.Context, content json.RawMessage) ([]dto.ClaudeMediaMessage, error) {
+	switch common.GetJsonType(content) {
+	case "string":
+		var text string
+		_ = common.Unmarshal(content, &text)
+		if text == "" {
+			return nil, nil
+		}
+		return []dto.ClaudeMediaMessage{{Type: "text", Text: common.GetPointer(text)}}, nil
+	case "array":
+	default:
+		return nil, nil
+	}
+
+	var parts []responsesContentPart
+	if err := common.Unmarshal(content, &parts); err != nil {
+		return nil, fmt.Errorf("invalid message content: %w", err)
+	}
+	blocks := make([]dto.ClaudeMediaMessage, 0, len(parts))
+	for _, part := range parts {
+		switch part.Type {
+		case "input_text", "output_text", "text":
+			if part.Text != "" {
+				blocks = append(blocks, dto.ClaudeMediaMessage{Type: "text", Text: common.GetPointer(part.Text)})
+			}
+		case "refusal":
+			if part.Refusal != "" {
+				blocks = append(blocks, dto.ClaudeMediaMessage{Type: "text", Text: common.GetPointer(part.Refusal)})
+			}
+		case "input_image":
+			var imageUrl string
+			switch v := part.ImageUrl.(type) {
+			case string:
+				imageUrl = v
+			case map[string]any:
+				imageUrl, _ = v["url"].(string)
+			}
+			if imageUrl == "" {
+				return nil, errors.New("input_image without image_url is not supported by this channel")
+			}
+			source, err := getClaudeBase64Source(c, imageUrl, "formatting image for Claude")
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, dto.ClaudeMediaMessage{Type: "image", Source: source})
+		case "input_file":
+			fileUrl := part.FileData
+			if fileUrl == "" {
+				fileUrl = part.FileUrl
+			}
+			if fileUrl == "" {
+				return nil, errors.New("input_file without file_data or file_url is not supported by this channel")
+			}
+			source, err := getClaudeBase64Source(c, fileUrl, "formatting file for Claude")
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, dto.ClaudeMediaMessage{Type: "document", Source: source})
+		default:
+			return nil, fmt.Errorf("unsupported content type: %s", part.Type)
+		}
+	}
+	return blocks, nil
+}
+
+func getClaudeBase64Source(c *gin.Context, url string, reason string) (*dto.ClaudeMessageSource, error) {
+	var source *types.FileSource
+	if strings.HasPrefix(url, "http") {
+		source = types.NewURLFileSource(url)
+	} else {
+		source = types.NewBase64FileSource(url, "")
+	}
+	base64Data, mimeType, err := service.GetBase64Data(c, source, reason)
+	if err != nil {
+		return nil, fmt.Errorf("get file data failed: %s", err.Error())
+	}
+	return &dto.ClaudeMessageSource{
+		Type:      "base64",
+		MediaType: mimeType,
+		Data:      base64Data,
+	}, nil
+}
+
+// convertResponsesTools 转换 Responses 工具定义，支持 function 与 web_search
+func convertResponsesTools(rawTools json.RawMessage) ([]any, error) {
+	if common.GetJsonType(rawTools) != "array" {
+		return nil, nil
+	}
+	var tools []responsesTool
+	if err := common.Unmarshal(rawTools, &tools); err != nil {
+		return nil, fmt.Errorf("invalid tools: %w", err)
+	}
+	claudeTools := make([]any, 0, len(tools))
+	for _, tool := range tools {
+		switch tool.Type {
+		case "function":
+			inputSchema := tool.Parameters
+			if inputSchema == nil {
+				inputSchema = map[string]any{"type": "object", "properties": map[string]any{}}
+			}
+			claudeTools = append(claudeTools, &dto.Tool{
+				Name:        tool.Name,
+				Description: tool.Description,
+				InputSchema: inputSchema,
+			})
+		case "web_search", "web_search_preview":
+			webSearchTool := &dto.ClaudeWebSearchTool{
+				Type: "web_search_20250305",
+				Name: "web_search",
+			}
+			switch tool.SearchContextSize {
+			case "low":
+				webSearchTool.MaxUses = WebSearchMaxUsesLow
+			case "medium":
+				webSearchTool.MaxUses = WebSearchMaxUsesMedium
+			case "high":
+				webSearchTool.MaxUses = WebSearchMaxUsesHigh
+			}
+			if len(tool.UserLocation) > 0 {
+				var userLocation dto.ClaudeWebSearchUserLocation
+				if err := common.Unmarshal(tool.UserLocation, &userLocation); err == nil {
+					userLocation.Type = "approximate"
+					webSearchTool.UserLocation = &userLocation
+				}
+			}
+			claudeTools = append(claudeTools, webSearchTool)
+		default:
+			return nil, fmt.Errorf("unsupported tool type: %s", tool.Type)
+		}
+	}
+	return claudeTools, nil
+}
+
+// normalizeResponsesToolChoice 将 Responses 的 tool_choice 转为 Chat Completions 形式，供 mapToolChoice 使用
+func normalizeResponsesToolChoice(rawToolChoice json.RawMessage) any {
+	var toolChoice any
+	if len(rawToolChoice) == 0 || common.Unmarshal(rawToolChoice, &toolChoice) != nil {
+		return nil
+	}
+	if choice, ok := toolChoice.(map[string]any); ok && choice["type"] == "function" {
+		if name, ok := choice["name"].(string); ok {
+			return map[string]any{"type": "function", "function": map[string]any{"name": name}}
+		}
+	}
+	return toolChoice
+}
+
+// responsesBuilder 懒加载 Responses 输出组装器
+func (claudeInfo *ClaudeResponseInfo) responsesBuilder(c *gin.Context, info *relaycommon.RelayInfo) *helper.ResponsesBuilder {
+	if claudeInfo.ResponsesBuilder == nil {
+		claudeInfo.ResponsesBuilder = helper.NewResponsesBuilder(c, info, info.OriginModelName)
+	}
+	return claudeInfo.ResponsesBuilder
+}
+
+// responsesIncompleteReason 将 Claude 的 stop_reason 映射为 Responses 的 incomplete_details.reason
+func responsesIncompleteReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens":
+		return "max_output_tokens"
+	case "refusal":
+		return "content_filter"
+	}
+	return ""
+}
+
+// claudeUsage2ResponsesUsage Claude 的 input_tokens 不含缓存 token，Responses 的 input_tokens 需要包含
+func claudeUsage2ResponsesUsage(usage *dto.Usage) *dto.Usage {
+	if usage == nil {
+		usage = &dto.Usage{}
+	}
+	cachedTokens := usage.PromptTokensDetails.CachedTokens
+	inputTokens := usage.PromptTokens + cachedTokens + usage.PromptTokensDetails.CachedCreationTokens
+	return helper.NewResponsesUsage(inputTokens, cachedTokens, usage.CompletionTokens, 0)
+}
+
+// streamResponseClaude2Responses 将 Claude SSE 事件转换为 Responses 的 response.* 事件
+func streamResponseClaude2Responses(c *gin.Context, info *relaycommon.RelayInfo, claudeInfo *ClaudeResponseInfo, claudeResponse *dto.ClaudeResponse) {
+	builder := claudeInfo.responsesBuilder(c, info)
+	switch claudeResponse.Type {
+	case "message_start":
+		builder.Start()
+	case "content_block_start":
+		block := claudeResponse.ContentBlock
+		if block == nil {
+			return
+		}
+		switch block.Type {
+		case "text":
+			builder.StartMessage()
+			builder.AppendText(block.GetText())
+		case "thinking":
+			builder.StartReasoning()
+		case "tool_use":
+			builder.StartFunctionCall(block.Id, block.Name)
+		}
+	case "content_block_delta":
+		delta := claudeResponse.Delta
+		if delta == nil {
+			return
+		}
+		switch delta.Type {
+		case "text_delta":
+			builder.AppendText(delta.GetText())
+		case "thinking_delta":
+			if delta.Thinking != nil {
+				builder.AppendReasoning(*delta.Thinking)
+			}
+		case "signature_delta":
+			builder.SetReasoningEncryptedContent(delta.Signature)
+		case "input_json_delta":
+			if delta.PartialJson != nil {
+				builder.AppendFunctionArguments(*delta.PartialJson)
+			}
+		}
+	case "content_block_stop":
+		builder.FinishItem()
+	case "message_delta":
+		if claudeResponse.Delta != nil && claudeResponse.Delta.StopReason != nil {
+			builder.SetIncompleteReason(responsesIncompleteReason(*claudeResponse.Delta.StopReason))
+		}
+	}
+}
+
+// ResponseClaude2Responses 将 Claude 非流式响应转换为 Responses 响应
+func ResponseClaude2Responses(c *gin.Context, info *relaycommon.RelayInfo, claudeInfo *ClaudeResponseInfo, claudeResponse *dto.ClaudeResponse) *dto.OpenAIResponsesResponse {
+	builder := claudeInfo.responsesBuilder(c, info)
+	for _, block := range claudeResponse.Content {
+		switch block.Type {
+		case "text":
+			builder.StartMessage()
+			builder.AppendText(block.GetText())
+		case "thinking":
+			builder.StartReasoning()
+			if block.Thinking != nil {
+				builder.AppendReasoning(*block.Thinking)
+			}
+			builder.SetReasoningEncryptedContent(block.Signature)
+		case "tool_use":
+			builder.StartFunctionCall(block.Id, block.Name)
+			if block.Input != nil {
+				arguments, _ := common.Marshal(block.Input)
+				builder.AppendFunctionArguments(string(arguments))
+			}
+		default:
+			continue
+		}
+		builder.FinishItem()
+	}
+	builder.SetIncompleteReason(responsesIncompleteReason(claudeResponse.StopReason))
+	return builder.Finish(claudeUsage2ResponsesUsage(claudeInfo.Usage))
+}
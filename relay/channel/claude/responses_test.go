@@ -0,0 +1,181 @@
+package claude
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestRequestResponses2ClaudeMessage(t *testing.T) {
+	request := dto.OpenAIResponsesRequest{
+		Model:           "claude-sonnet-4-5",
+		Instructions:    []byte(`"be brief"`),
+		MaxOutputTokens: func() *uint { v := uint(1024); return &v }(),
+		Reasoning:       &dto.Reasoning{Effort: "low"},
+		Input: []byte(`[
+			{"role":"developer","content":"answer in english"},
+			{"role":"user","content":[{"type":"input_text","text":"weather in paris?"}]},
+			{"type":"reasoning","summary":[{"type":"summary_text","text":"need tool"}],"encrypted_content":"sig_1"},
+			{"type":"function_call","call_id":"toolu_1","name":"get_weather","arguments":"{\"city\":\"paris\"}"},
+			{"type":"function_call_output","call_id":"toolu_1","output":"sunny"},
+			{"type":"reasoning","summary":[]},
+			{"type":"message","role":"user","content":"thanks"}
+		]`),
+		Tools:             []byte(`[{"type":"function","name":"get_weather","parameters":{"type":"object","properties":{"city":{"type":"string"}}}},{"type":"web_search_preview","search_context_size":"low"}]`),
+		ToolChoice:        []byte(`{"type":"function","name":"get_weather"}`),
+		ParallelToolCalls: []byte(`false`),
+	}
+
+	claudeRequest, err := RequestResponses2ClaudeMessage(nil, request)
+	require.NoError(t, err)
+
+	system := claudeRequest.System.([]dto.ClaudeMediaMessage)
+	require.Len(t, system, 2)
+	assert.Equal(t, "be brief", system[0].GetText())
+	assert.Equal(t, "answer in english", system[1].GetText())
+
+	// 思考预算必须小于 max_tokens
+	require.NotNil(t, claudeRequest.Thinking)
+	assert.Equal(t, 1280, *claudeRequest.Thinking.BudgetTokens)
+	assert.Greater(t, *claudeRequest.MaxTokens, uint(1280))
+
+	require.Len(t, claudeRequest.Messages, 3)
+	assert.Equal(t, "user", claudeRequest.Messages[0].Role)
+	assistant := claudeRequest.Messages[1].Content.([]dto.ClaudeMediaMessage)
+	require.Len(t, assistant, 2)
+	assert.Equal(t, "thinking", assistant[0].Type)
+	assert.Equal(t, "need tool", *assistant[0].Thinking)
+	assert.Equal(t, "sig_1", assistant[0].Signature)
+	assert.Equal(t, "tool_use", assistant[1].Type)
+	assert.Equal(t, map[string]any{"city": "paris"}, assistant[1].Input)
+	// 工具结果与后续用户消息合并为同一条 user 消息
+	user := claudeRequest.Messages[2].Content.([]dto.ClaudeMediaMessage)
+	require.Len(t, user, 2)
+	assert.Equal(t, "tool_result", user[0].Type)
+	assert.Equal(t, "toolu_1", user[0].ToolUseId)
+	assert.Equal(t, "sunny", user[0].Content)
+	assert.Equal(t, "thanks", user[1].GetText())
+
+	tools := claudeRequest.Tools.([]any)
+	require.Len(t, tools, 2)
+	assert.Equal(t, "get_weather", tools[0].(*dto.Tool).Name)
+	assert.Equal(t, WebSearchMaxUsesLow, tools[1].(*dto.ClaudeWebSearchTool).MaxUses)
+	toolChoice := claudeRequest.ToolChoice.(*dto.ClaudeToolChoice)
+	assert.Equal(t, "tool", toolChoice.Type)
+	assert.Equal(t, "get_weather", toolChoice.Name)
+	assert.True(t, toolChoice.DisableParallelToolUse)
+
+	_, err = RequestResponses2ClaudeMessage(nil, dto.OpenAIResponsesRequest{Model: "claude", Tools: []byte(`[{"type":"file_search"}]`)})
+	assert.Error(t, err)
+	_, err = RequestResponses2ClaudeMessage(nil, dto.OpenAIResponsesRequest{Model: "claude", PreviousResponseID: "resp_1"})
+	assert.Error(t, err)
+}
+
+func newResponsesTestContext(stream bool) (*gin.Context, *httptest.ResponseRecorder, *relaycommon.RelayInfo) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/responses", nil)
+	info := &relaycommon.RelayInfo{
+		RelayFormat:     types.RelayFormatOpenAIResponses,
+		IsStream:        stream,
+		OriginModelName: "claude-sonnet-4-5",
+		Request:         &dto.OpenAIResponsesRequest{Model: "claude-sonnet-4-5", Instructions: []byte(`"be brief"`)},
+	}
+	return c, recorder, info
+}
+
+func TestClaudeStreamToResponsesEvents(t *testing.T) {
+	c, recorder, info := newResponsesTestContext(true)
+	claudeInfo := &ClaudeResponseInfo{Usage: &dto.Usage{}}
+	events := []string{
+		`{"type":"message_start","message":{"id":"msg_1","model":"claude-sonnet-4-5","usage":{"input_tokens":10,"cache_read_input_tokens":100,"cache_creation_input_tokens":20,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"let me think"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"sig_1"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"Hello"}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":" world"}}`,
+		`{"type":"content_block_stop","index":1}`,
+		`{"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{}}}`,
+		`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"{\"city\":"}}`,
+		`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"\"paris\"}"}}`,
+		`{"type":"content_block_stop","index":2}`,
+		`{"type":"message_delta","delta":{"stop_reason":"max_tokens"},"usage":{"output_tokens":30}}`,
+		`{"type":"message_stop"}`,
+	}
+	for _, event := range events {
+		require.Nil(t, HandleStreamResponseData(c, info, claudeInfo, event))
+	}
+	HandleStreamFinalResponse(c, info, claudeInfo)
+
+	var eventTypes []string
+	var payloads []string
+	for _, line := range strings.Split(recorder.Body.String(), "\n") {
+		if strings.HasPrefix(line, "data: ") {
+			payload := strings.TrimPrefix(line, "data: ")
+			payloads = append(payloads, payload)
+			eventTypes = append(eventTypes, gjson.Get(payload, "type").String())
+		}
+	}
+	require.NotEmpty(t, eventTypes)
+	assert.Equal(t, "response.created", eventTypes[0])
+	assert.Contains(t, eventTypes, "response.reasoning_summary_text.delta")
+	assert.Contains(t, eventTypes, "response.output_text.delta")
+	assert.Contains(t, eventTypes, "response.function_call_arguments.done")
+	assert.Equal(t, "response.incomplete", eventTypes[len(eventTypes)-1])
+	for i, payload := range payloads {
+		assert.EqualValues(t, i, gjson.Get(payload, "sequence_number").Int())
+	}
+
+	final := payloads[len(payloads)-1]
+	assert.Equal(t, "max_output_tokens", gjson.Get(final, "response.incomplete_details.reason").String())
+	assert.Equal(t, "be brief", gjson.Get(final, "response.instructions").String())
+	assert.Equal(t, "reasoning", gjson.Get(final, "response.output.0.type").String())
+	assert.Equal(t, "sig_1", gjson.Get(final, "response.output.0.encrypted_content").String())
+	assert.Equal(t, "let me think", gjson.Get(final, "response.output.0.summary.0.text").String())
+	assert.Equal(t, "Hello world", gjson.Get(final, "response.output.1.content.0.text").String())
+	assert.Equal(t, "toolu_1", gjson.Get(final, "response.output.2.call_id").String())
+	assert.Equal(t, `{"city":"paris"}`, gjson.Get(final, "response.output.2.arguments").String())
+	// Responses 用量的 input_tokens 包含缓存 token
+	assert.EqualValues(t, 130, gjson.Get(final, "response.usage.input_tokens").Int())
+	assert.EqualValues(t, 100, gjson.Get(final, "response.usage.input_tokens_details.cached_tokens").Int())
+	assert.EqualValues(t, 30, gjson.Get(final, "response.usage.output_tokens").Int())
+
+	// 计费用量保持 Claude 语义
+	assert.Equal(t, 10, claudeInfo.Usage.PromptTokens)
+	assert.Equal(t, 100, claudeInfo.Usage.PromptTokensDetails.CachedTokens)
+	assert.Equal(t, 20, claudeInfo.Usage.PromptTokensDetails.CachedCreationTokens)
+}
+
+func TestClaudeResponseToResponses(t *testing.T) {
+	c, recorder, info := newResponsesTestContext(false)
+	claudeInfo := &ClaudeResponseInfo{Usage: &dto.Usage{}}
+	data := []byte(`{"id":"msg_1","type":"message","role":"assistant","model":"claude-sonnet-4-5","stop_reason":"tool_use",
+		"content":[{"type":"text","text":"checking"},{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{"city":"paris"}}],
+		"usage":{"input_tokens":10,"cache_read_input_tokens":5,"output_tokens":7}}`)
+
+	require.Nil(t, HandleClaudeResponseData(c, info, claudeInfo, nil, data))
+
+	body := recorder.Body.String()
+	assert.Equal(t, "response", gjson.Get(body, "object").String())
+	assert.Equal(t, "completed", gjson.Get(body, "status").String())
+	assert.Equal(t, "claude-sonnet-4-5", gjson.Get(body, "model").String())
+	assert.Equal(t, "checking", gjson.Get(body, "output.0.content.0.text").String())
+	assert.Equal(t, "function_call", gjson.Get(body, "output.1.type").String())
+	assert.Equal(t, `{"city":"paris"}`, gjson.Get(body, "output.1.arguments").String())
+	assert.EqualValues(t, 15, gjson.Get(body, "usage.input_tokens").Int())
+	assert.EqualValues(t, 22, gjson.Get(body, "usage.total_tokens").Int())
+	assert.Equal(t, 10, claudeInfo.Usage.PromptTokens)
+}
@@ -1505,6 +1505,11 @@ func GeminiChatHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.R
 			return nil, types.NewError(err, types.ErrorCodeBadResponseBody)
 		}
 		responseBody = claudeRespStr
+	case types.RelayFormatOpenAIResponses:
+		responseBody, err = common.Marshal(openai.ResponseChat2Responses(c, info, fullTextResponse))
+		if err != nil {
+			return nil, types.NewError(err, types.ErrorCodeBadResponseBody)
+		}
 	case types.RelayFormatGemini:
 		break
 	}
@@ -12,6 +12,7 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/relay/channel/openai"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/relay/helper"
 	"github.com/QuantumNous/new-api/service"
@@ -78,7 +79,7 @@ func ollamaStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http
 	var toolCallIndex int
 	start := helper.GenerateStartEmptyResponse(responseId, created, model, nil)
 	if data, err := common.Marshal(start); err == nil {
-		_ = helper.StringData(c, string(data))
+		sendOllamaStreamData(c, info, data)
 	}
 
 	for scanner.Scan() {
@@ -145,7 +146,7 @@ func ollamaStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http
 				}
 			}
 			if data, err := common.Marshal(delta); err == nil {
-				_ = helper.StringData(c, string(data))
+				sendOllamaStreamData(c, info, data)
 			}
 			continue
 		}
@@ -161,9 +162,14 @@ func ollamaStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http
 		// emit stop delta
 		if stop := helper.GenerateStopResponse(responseId, created, model, finishReason); stop != nil {
 			if data, err := common.Marshal(stop); err == nil {
-				_ = helper.StringData(c, string(data))
+				sendOllamaStreamData(c, info, data)
 			}
 		}
+		// Responses API 由 openai 包组装最终的 response.completed 事件
+		if info.RelayFormat == types.RelayFormatOpenAIResponses {
+			openai.HandleFinalResponse(c, info, "", responseId, created, model, "", usage, true)
+			break
+		}
 		// emit usage frame
 		if final := helper.GenerateFinalUsageResponse(responseId, created, model, *usage); final != nil {
 			if data, err := common.Marshal(final); err == nil {
@@ -180,6 +186,17 @@ func ollamaStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http
 	return usage, nil
 }
 
+// sendOllamaStreamData 输出一个 Chat Completions 流片段，Responses API 请求会先转换为 Responses 事件
+func sendOllamaStreamData(c *gin.Context, info *relaycommon.RelayInfo, data []byte) {
+	if info.RelayFormat == types.RelayFormatOpenAIResponses {
+		if err := openai.HandleStreamFormat(c, info, string(data), false, false); err != nil {
+			logger.LogError(c, "ollama responses stream convert error: "+err.Error())
+		}
+		return
+	}
+	_ = helper.StringData(c, string(data))
+}
+
 // non-stream handler for chat/generate
 func ollamaChatHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response) (*dto.Usage, *types.NewAPIError) {
 	body, err := io.ReadAll(resp.Body)
@@ -198,6 +215,7 @@ func ollamaChatHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.R
 		reasoningBuilder strings.Builder
 		lastChunk        ollamaChatStreamChunk
 		parsedAny        bool
+		toolCalls        []dto.ToolCallRequest
 	)
 	for _, ln := range lines {
 		ln = strings.TrimSpace(ln)
@@ -226,6 +244,9 @@ func ollamaChatHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.R
 				}
 			}
 		}
+		if ck.Message != nil {
+			toolCalls = appendOllamaToolCalls(toolCalls, ck)
+		}
 		if ck.Message != nil && ck.Message.Content != "" {
 			aggContent.WriteString(ck.Message.Content)
 		} else if ck.Response != "" {
@@ -254,6 +275,7 @@ func ollamaChatHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.R
 				}
 			}
 			aggContent.WriteString(single.Message.Content)
+			toolCalls = appendOllamaToolCalls(toolCalls, single)
 		} else {
 			aggContent.WriteString(single.Response)
 		}
@@ -287,11 +309,31 @@ func ollamaChatHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.R
 		}},
 		Usage: *usage,
 	}
-	out, _ := common.Marshal(full)
+	var out []byte
+	if info.RelayFormat == types.RelayFormatOpenAIResponses {
+		// Message.Content 为 *string 时 StringContent 无法读取，转换前改为 string
+		full.Choices[0].Message.Content = content
+		full.Choices[0].Message.SetToolCalls(toolCalls)
+		out, _ = common.Marshal(openai.ResponseChat2Responses(c, info, &full))
+	} else {
+		out, _ = common.Marshal(full)
+	}
 	service.IOCopyBytesGracefully(c, resp, out)
 	return usage, nil
 }
 
+func appendOllamaToolCalls(toolCalls []dto.ToolCallRequest, chunk ollamaChatStreamChunk) []dto.ToolCallRequest {
+	for _, tc := range chunk.Message.ToolCalls {
+		argBytes, _ := json.Marshal(tc.Function.Arguments)
+		toolCalls = append(toolCalls, dto.ToolCallRequest{
+			ID:       fmt.Sprintf("call_%d", len(toolCalls)),
+			Type:     "function",
+			Function: dto.FunctionRequest{Name: tc.Function.Name, Arguments: string(argBytes)},
+		})
+	}
+	return toolCalls
+}
+
 func contentPtr(s string) *string {
 	if s == "" {
 		return nil
@@ -29,6 +29,8 @@ func HandleStreamFormat(c *gin.Context, info *relaycommon.RelayInfo, data string
 		return handleClaudeFormat(c, data, info)
 	case types.RelayFormatGemini:
 		return handleGeminiFormat(c, data, info)
+	case types.RelayFormatOpenAIResponses:
+		return handleResponsesFormat(c, data, info)
 	}
 	return nil
 }
@@ -250,6 +252,9 @@ func HandleFinalResponse(c *gin.Context, info *relaycommon.RelayInfo, lastStream
 		// 发送最终的 Gemini 响应
 		c.Render(-1, common.CustomEvent{Data: "data: " + string(geminiResponseStr)})
 		_ = helper.FlushWriter(c)
+
+	case types.RelayFormatOpenAIResponses:
+		handleResponsesFinalResponse(c, info, lastStreamData, usage)
 	}
 }
 
@@ -15,6 +15,7 @@ import (
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
 )
 
 func OaiResponsesHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response) (*dto.Usage, *types.NewAPIError) {
@@ -42,6 +43,7 @@ func OaiResponsesHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http
 
 	// 写入新的 response body
 	service.IOCopyBytesGracefully(c, resp, responseBody)
+	helper.SetResponsesResult(c, responseBody)
 
 	// compute usage
 	usage := dto.Usage{}
@@ -86,8 +88,13 @@ func OaiResponsesStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp
 		if err := common.UnmarshalJsonStr(data, &streamResponse); err == nil {
 			sendResponsesStreamData(c, streamResponse, data)
 			switch streamResponse.Type {
+			case "response.incomplete":
+				if streamResponse.Response != nil {
+					helper.SetResponsesResult(c, []byte(gjson.Get(data, "response").Raw))
+				}
 			case "response.completed":
 				if streamResponse.Response != nil {
+					helper.SetResponsesResult(c, []byte(gjson.Get(data, "response").Raw))
 					if streamResponse.Response.Usage != nil {
 						if streamResponse.Response.Usage.InputTokens != 0 {
 							usage.PromptTokens = streamResponse.Response.Usage.InputTokens
@@ -0,0 +1,160 @@
+package openai
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 上游只支持 Chat Completions（Gemini、Ollama 等）时，将其 Chat Completions 输出转换为 Responses API 输出
+
+const responsesViaChatStateKey = "responses_via_chat_state"
+
+type responsesViaChatState struct {
+	builder *helper.ResponsesBuilder
+	// 同一个流片段中可能包含多个交错的工具调用参数，缓存完整后再按顺序输出为 function_call 项
+	toolCalls       []*dto.ToolCallResponse
+	toolCallByIndex map[int]*dto.ToolCallResponse
+}
+
+func getResponsesViaChatState(c *gin.Context, info *relaycommon.RelayInfo) *responsesViaChatState {
+	if v, ok := c.Get(responsesViaChatStateKey); ok {
+		if state, ok := v.(*responsesViaChatState); ok {
+			return state
+		}
+	}
+	state := &responsesViaChatState{
+		builder:         helper.NewResponsesBuilder(c, info, info.OriginModelName),
+		toolCallByIndex: make(map[int]*dto.ToolCallResponse),
+	}
+	c.Set(responsesViaChatStateKey, state)
+	return state
+}
+
+func (s *responsesViaChatState) flushToolCalls() {
+	for _, toolCall := range s.toolCalls {
+		s.builder.StartFunctionCall(toolCall.ID, toolCall.Function.Name)
+		s.builder.AppendFunctionArguments(toolCall.Function.Arguments)
+		s.builder.FinishItem()
+	}
+	s.toolCalls = nil
+	s.toolCallByIndex = make(map[int]*dto.ToolCallResponse)
+}
+
+func (s *responsesViaChatState) addToolCallDelta(toolCall dto.ToolCallResponse) {
+	index := len(s.toolCalls)
+	if toolCall.Index != nil {
+		index = *toolCall.Index
+	} else if toolCall.ID == "" && index > 0 {
+		index--
+	}
+	if pending, ok := s.toolCallByIndex[index]; ok && (toolCall.ID == "" || toolCall.ID == pending.ID) {
+		if pending.Function.Name == "" {
+			pending.Function.Name = toolCall.Function.Name
+		}
+		pending.Function.Arguments += toolCall.Function.Arguments
+		return
+	}
+	pending := &dto.ToolCallResponse{ID: toolCall.ID, Function: dto.FunctionResponse{
+		Name:      toolCall.Function.Name,
+		Arguments: toolCall.Function.Arguments,
+	}}
+	s.toolCalls = append(s.toolCalls, pending)
+	s.toolCallByIndex[index] = pending
+}
+
+func (s *responsesViaChatState) handleChunk(streamResponse *dto.ChatCompletionsStreamResponse) {
+	s.builder.Start()
+	for _, choice := range streamResponse.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		if reasoning := choice.Delta.GetReasoningContent(); reasoning != "" {
+			s.flushToolCalls()
+			s.builder.AppendReasoning(reasoning)
+		}
+		if content := choice.Delta.GetContentString(); content != "" {
+			s.flushToolCalls()
+			s.builder.AppendText(content)
+		}
+		for _, toolCall := range choice.Delta.ToolCalls {
+			s.addToolCallDelta(toolCall)
+		}
+		if choice.FinishReason != nil {
+			s.builder.SetIncompleteReason(chatFinishReason2ResponsesIncompleteReason(*choice.FinishReason))
+		}
+	}
+}
+
+func handleResponsesFormat(c *gin.Context, data string, info *relaycommon.RelayInfo) error {
+	var streamResponse dto.ChatCompletionsStreamResponse
+	if err := common.UnmarshalJsonStr(data, &streamResponse); err != nil {
+		return err
+	}
+	getResponsesViaChatState(c, info).handleChunk(&streamResponse)
+	return nil
+}
+
+func handleResponsesFinalResponse(c *gin.Context, info *relaycommon.RelayInfo, lastStreamData string, usage *dto.Usage) {
+	state := getResponsesViaChatState(c, info)
+	if lastStreamData != "" {
+		var streamResponse dto.ChatCompletionsStreamResponse
+		if err := common.UnmarshalJsonStr(lastStreamData, &streamResponse); err != nil {
+			common.SysLog("error unmarshalling stream response: " + err.Error())
+		} else {
+			state.handleChunk(&streamResponse)
+		}
+	}
+	state.flushToolCalls()
+	state.builder.Finish(chatUsage2ResponsesUsage(usage))
+}
+
+// ResponseChat2Responses 将 Chat Completions 非流式响应转换为 Responses 响应
+func ResponseChat2Responses(c *gin.Context, info *relaycommon.RelayInfo, response *dto.OpenAITextResponse) *dto.OpenAIResponsesResponse {
+	builder := helper.NewResponsesBuilder(c, info, info.OriginModelName)
+	for _, choice := range response.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		reasoning := choice.Message.ReasoningContent
+		if reasoning == "" {
+			reasoning = choice.Message.Reasoning
+		}
+		if reasoning != "" {
+			builder.AppendReasoning(reasoning)
+			builder.FinishItem()
+		}
+		if content := choice.Message.StringContent(); content != "" {
+			builder.AppendText(content)
+			builder.FinishItem()
+		}
+		for _, toolCall := range choice.Message.ParseToolCalls() {
+			builder.StartFunctionCall(toolCall.ID, toolCall.Function.Name)
+			builder.AppendFunctionArguments(toolCall.Function.Arguments)
+			builder.FinishItem()
+		}
+		builder.SetIncompleteReason(chatFinishReason2ResponsesIncompleteReason(choice.FinishReason))
+	}
+	return builder.Finish(chatUsage2ResponsesUsage(&response.Usage))
+}
+
+func chatFinishReason2ResponsesIncompleteReason(finishReason string) string {
+	switch finishReason {
+	case "length":
+		return "max_output_tokens"
+	case "content_filter":
+		return "content_filter"
+	}
+	return ""
+}
+
+func chatUsage2ResponsesUsage(usage *dto.Usage) *dto.Usage {
+	if usage == nil {
+		usage = &dto.Usage{}
+	}
+	return helper.NewResponsesUsage(usage.PromptTokens, usage.PromptTokensDetails.CachedTokens,
+		usage.CompletionTokens, usage.CompletionTokenDetails.ReasoningTokens)
+}
@@ -0,0 +1,95 @@
+package openai
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func newResponsesViaChatTestContext(stream bool) (*gin.Context, *httptest.ResponseRecorder, *relaycommon.RelayInfo) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/responses", nil)
+	info := &relaycommon.RelayInfo{
+		RelayFormat:     types.RelayFormatOpenAIResponses,
+		IsStream:        stream,
+		OriginModelName: "gemini-2.5-flash",
+		Request:         &dto.OpenAIResponsesRequest{Model: "gemini-2.5-flash"},
+	}
+	return c, recorder, info
+}
+
+func TestChatStreamToResponsesEvents(t *testing.T) {
+	c, recorder, info := newResponsesViaChatTestContext(true)
+	chunks := []string{
+		`{"id":"c1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"role":"assistant","content":""}}]}`,
+		`{"id":"c1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"reasoning_content":"thinking"}}]}`,
+		`{"id":"c1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"Checking"}}]}`,
+		// 两个工具调用的参数交错到达
+		`{"id":"c1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_a","type":"function","function":{"name":"get_weather","arguments":"{\"city\":"}},{"index":1,"id":"call_b","type":"function","function":{"name":"get_time","arguments":"{\"tz\":"}}]}}]}`,
+		`{"id":"c1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"function":{"arguments":"\"utc\"}"}},{"index":0,"function":{"arguments":"\"paris\"}"}}]}}]}`,
+	}
+	for _, chunk := range chunks {
+		require.NoError(t, HandleStreamFormat(c, info, chunk, false, false))
+	}
+	last := `{"id":"c1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{},"finish_reason":"length"}]}`
+	HandleFinalResponse(c, info, last, "c1", 0, "gemini-2.5-flash", "",
+		&dto.Usage{PromptTokens: 12, CompletionTokens: 8, PromptTokensDetails: dto.InputTokenDetails{CachedTokens: 4}}, true)
+
+	var eventTypes []string
+	var payloads []string
+	for _, line := range strings.Split(recorder.Body.String(), "\n") {
+		if strings.HasPrefix(line, "data: ") {
+			payload := strings.TrimPrefix(line, "data: ")
+			payloads = append(payloads, payload)
+			eventTypes = append(eventTypes, gjson.Get(payload, "type").String())
+		}
+	}
+	require.NotEmpty(t, eventTypes)
+	assert.Equal(t, "response.created", eventTypes[0])
+	assert.Equal(t, "response.incomplete", eventTypes[len(eventTypes)-1])
+	assert.NotContains(t, recorder.Body.String(), "[DONE]")
+	for i, payload := range payloads {
+		assert.EqualValues(t, i, gjson.Get(payload, "sequence_number").Int())
+	}
+
+	final := payloads[len(payloads)-1]
+	assert.Equal(t, "max_output_tokens", gjson.Get(final, "response.incomplete_details.reason").String())
+	assert.Equal(t, "reasoning", gjson.Get(final, "response.output.0.type").String())
+	assert.Equal(t, "Checking", gjson.Get(final, "response.output.1.content.0.text").String())
+	assert.Equal(t, "call_a", gjson.Get(final, "response.output.2.call_id").String())
+	assert.Equal(t, `{"city":"paris"}`, gjson.Get(final, "response.output.2.arguments").String())
+	assert.Equal(t, "call_b", gjson.Get(final, "response.output.3.call_id").String())
+	assert.Equal(t, `{"tz":"utc"}`, gjson.Get(final, "response.output.3.arguments").String())
+	assert.EqualValues(t, 12, gjson.Get(final, "response.usage.input_tokens").Int())
+	assert.EqualValues(t, 4, gjson.Get(final, "response.usage.input_tokens_details.cached_tokens").Int())
+	assert.EqualValues(t, 20, gjson.Get(final, "response.usage.total_tokens").Int())
+}
+
+func TestResponseChat2Responses(t *testing.T) {
+	c, _, info := newResponsesViaChatTestContext(false)
+	message := dto.Message{Role: "assistant", Content: "calling tool"}
+	message.SetToolCalls([]dto.ToolCallRequest{{ID: "call_1", Type: "function", Function: dto.FunctionRequest{Name: "get_weather", Arguments: `{"city":"paris"}`}}})
+	response := &dto.OpenAITextResponse{
+		Choices: []dto.OpenAITextResponseChoice{{Index: 0, Message: message, FinishReason: "tool_calls"}},
+		Usage:   dto.Usage{PromptTokens: 3, CompletionTokens: 2},
+	}
+
+	result := ResponseChat2Responses(c, info, response)
+	require.Len(t, result.Output, 2)
+	assert.Equal(t, `"completed"`, string(result.Status))
+	assert.Equal(t, "gemini-2.5-flash", result.Model)
+	assert.Equal(t, "function_call", result.Output[1].Type)
+	assert.Equal(t, "call_1", result.Output[1].CallId)
+}
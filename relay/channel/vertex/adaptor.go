@@ -16,6 +16,7 @@ import (
 	"github.com/QuantumNous/new-api/relay/channel/openai"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/service/openaicompat"
 	"github.com/QuantumNous/new-api/setting/model_setting"
 	"github.com/QuantumNous/new-api/setting/reasoning"
 	"github.com/QuantumNous/new-api/types"
@@ -55,6 +56,16 @@ type Adaptor struct {
 }
 
 func (a *Adaptor) ConvertGeminiRequest(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeminiChatRequest) (any, error) {
+	if a.RequestMode == RequestModeClaude {
+		claudeReq, err := claude.RequestGemini2ClaudeMessage(c, request, info.UpstreamModelName, info.IsStream)
+		if err != nil {
+			return nil, err
+		}
+		vertexClaudeReq := copyRequest(claudeReq, anthropicVersion)
+		c.Set("request_model", claudeReq.Model)
+		info.UpstreamModelName = claudeReq.Model
+		return vertexClaudeReq, nil
+	}
 	// Vertex AI does not support functionResponse.id; keep it stripped here for consistency.
 	if model_setting.GetGeminiSettings().RemoveFunctionResponseIdEnabled {
 		removeFunctionResponseID(request)
@@ -358,7 +369,31 @@ func (a *Adaptor) ConvertEmbeddingRequest(c *gin.Context, info *relaycommon.Rela
 }
 
 func (a *Adaptor) ConvertOpenAIResponsesRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.OpenAIResponsesRequest) (any, error) {
-	// TODO implement me
+	switch a.RequestMode {
+	case RequestModeClaude:
+		claudeReq, err := claude.RequestResponses2ClaudeMessage(c, request)
+		if err != nil {
+			return nil, err
+		}
+		vertexClaudeReq := copyRequest(claudeReq, anthropicVersion)
+		c.Set("request_model", claudeReq.Model)
+		info.UpstreamModelName = claudeReq.Model
+		return vertexClaudeReq, nil
+	case RequestModeGemini:
+		if strings.HasPrefix(info.UpstreamModelName, "imagen") {
+			return nil, errors.New("responses api is not supported for imagen models")
+		}
+		chatRequest, err := openaicompat.ResponsesRequestToChatCompletionsRequest(&request)
+		if err != nil {
+			return nil, err
+		}
+		geminiRequest, err := gemini.CovertOpenAI2Gemini(c, *chatRequest, info)
+		if err != nil {
+			return nil, err
+		}
+		c.Set("request_model", request.Model)
+		return geminiRequest, nil
+	}
 	return nil, errors.New("not implemented")
 }
 
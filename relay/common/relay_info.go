@@ -151,6 +151,14 @@ type RelayInfo struct {
 	UseRuntimeHeadersOverride             bool
 	ParamOverrideAudit                    []string
 
+	// 临时令牌请求按父令牌计费，以下字段用于累计其消费并校验消费上限；
+	// 终端用户每日额度同样在父令牌之下单独计数
+	EphemeralTokenId        string
+	EphemeralTokenMaxSpend  int
+	EphemeralTokenExpiresAt int64
+	EndUserId               string
+	EndUserDailyQuota       int
+
 	PriceData types.PriceData
 
 	Request dto.Request
@@ -464,6 +472,12 @@ func genBaseRelayInfo(c *gin.Context, request dto.Request) *RelayInfo {
 		TokenUnlimited: common.GetContextKeyBool(c, constant.ContextKeyTokenUnlimited),
 		TokenGroup:     tokenGroup,
 
+		EphemeralTokenId:        common.GetContextKeyString(c, constant.ContextKeyEphemeralTokenId),
+		EphemeralTokenMaxSpend:  common.GetContextKeyInt(c, constant.ContextKeyEphemeralTokenMaxSpend),
+		EphemeralTokenExpiresAt: common.GetContextKeyInt64(c, constant.ContextKeyEphemeralTokenExpiresAt),
+		EndUserId:               common.GetContextKeyString(c, constant.ContextKeyEndUserId),
+		EndUserDailyQuota:       common.GetContextKeyInt(c, constant.ContextKeyTokenEndUserDailyQuota),
+
 		isFirstResponse: true,
 		RelayMode:       relayconstant.Path2RelayMode(c.Request.URL.Path),
 		RequestURLPath:  c.Request.URL.String(),
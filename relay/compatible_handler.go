@@ -2,6 +2,7 @@ package relay
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -13,6 +14,7 @@ import (
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relay/channel"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/relay/helper"
@@ -77,13 +79,48 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 	adaptor.Init(info)
 
 	passThroughGlobal := model_setting.GetGlobalSettings().PassThroughRequestEnabled
+	passThrough := passThroughGlobal || info.ChannelSetting.PassThroughBodyEnabled
+
+	// 提示词模板、网关工具与结构化输出校验：透传模式下请求体原样发送，不处理
+	var serverTools *service.ServerToolSet
+	var structuredOutput *service.StructuredOutputValidator
+	if passThrough && info.RelayMode == relayconstant.RelayModeChatCompletions && len(request.Messages) == 0 && request.Prompt != nil {
+		// 仅引用提示词模板的请求需要网关渲染消息，透传渠道无法处理
+		return types.NewErrorWithStatusCode(errors.New("prompt templates are not supported on pass-through channels, messages is required"),
+			types.ErrorCodeInvalidRequest, http.StatusBadRequest)
+	}
+	if !passThrough && info.RelayMode == relayconstant.RelayModeChatCompletions {
+		if err = service.ApplyChatPromptTemplate(c, request); err != nil {
+			return types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+		}
+		serverTools, err = service.PrepareServerTools(request)
+		if err != nil {
+			return types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+		}
+		structuredOutput, err = service.PrepareStructuredOutput(request, info.OriginModelName, info.UsingGroup)
+		if err != nil {
+			return types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+		}
+	}
+	gatewayRounds := serverTools != nil || structuredOutput != nil
+
 	if info.RelayMode == relayconstant.RelayModeChatCompletions &&
-		!passThroughGlobal &&
-		!info.ChannelSetting.PassThroughBodyEnabled &&
+		!passThrough &&
 		service.ShouldChatCompletionsUseResponsesGlobal(info.ChannelId, info.ChannelType, info.OriginModelName) {
 		applySystemPromptIfNeeded(c, info, request)
-		usage, newApiErr := chatCompletionsViaResponses(c, info, adaptor, request)
+		var usage *dto.Usage
+		var newApiErr *types.NewAPIError
+		if gatewayRounds {
+			usage, newApiErr = relayWithGatewayRounds(c, info, request, serverTools, structuredOutput, func(roundRequest *dto.GeneralOpenAIRequest) (*dto.Usage, *types.NewAPIError) {
+				return chatCompletionsViaResponses(c, info, adaptor, roundRequest)
+			})
+		} else {
+			usage, newApiErr = chatCompletionsViaResponses(c, info, adaptor, request)
+		}
 		if newApiErr != nil {
+			if gatewayRounds {
+				settleFailedGatewayRounds(c, info, usage)
+			}
 			return newApiErr
 		}
 
@@ -98,12 +135,41 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 		return nil
 	}
 
+	var usage *dto.Usage
+	var newApiErr *types.NewAPIError
+	if gatewayRounds {
+		usage, newApiErr = relayWithGatewayRounds(c, info, request, serverTools, structuredOutput, func(roundRequest *dto.GeneralOpenAIRequest) (*dto.Usage, *types.NewAPIError) {
+			return textRelayRound(c, info, adaptor, roundRequest, false)
+		})
+	} else {
+		usage, newApiErr = textRelayRound(c, info, adaptor, request, passThrough)
+	}
+	if newApiErr != nil {
+		if gatewayRounds {
+			settleFailedGatewayRounds(c, info, usage)
+		}
+		return newApiErr
+	}
+
+	var containAudioTokens = usage.CompletionTokenDetails.AudioTokens > 0 || usage.PromptTokensDetails.AudioTokens > 0
+	var containsAudioRatios = ratio_setting.ContainsAudioRatio(info.OriginModelName) || ratio_setting.ContainsAudioCompletionRatio(info.OriginModelName)
+
+	if containAudioTokens && containsAudioRatios {
+		service.PostAudioConsumeQuota(c, info, usage, "")
+	} else {
+		postConsumeQuota(c, info, usage)
+	}
+	return nil
+}
+
+// textRelayRound 将请求发送到上游并把响应写回客户端，返回本次用量
+func textRelayRound(c *gin.Context, info *relaycommon.RelayInfo, adaptor channel.Adaptor, request *dto.GeneralOpenAIRequest, passThrough bool) (*dto.Usage, *types.NewAPIError) {
 	var requestBody io.Reader
 
-	if passThroughGlobal || info.ChannelSetting.PassThroughBodyEnabled {
+	if passThrough {
 		storage, err := common.GetBodyStorage(c)
 		if err != nil {
-			return types.NewErrorWithStatusCode(err, types.ErrorCodeReadRequestBodyFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+			return nil, types.NewErrorWithStatusCode(err, types.ErrorCodeReadRequestBodyFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
 		}
 		if common.DebugEnabled {
 			if debugBytes, bErr := storage.Bytes(); bErr == nil {
@@ -114,7 +180,7 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 	} else {
 		convertedRequest, err := adaptor.ConvertOpenAIRequest(c, info, request)
 		if err != nil {
-			return types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+			return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
 		}
 		relaycommon.AppendRequestConversionFromRequest(info, convertedRequest)
 
@@ -162,20 +228,20 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 
 		jsonData, err := common.Marshal(convertedRequest)
 		if err != nil {
-			return types.NewError(err, types.ErrorCodeJsonMarshalFailed, types.ErrOptionWithSkipRetry())
+			return nil, types.NewError(err, types.ErrorCodeJsonMarshalFailed, types.ErrOptionWithSkipRetry())
 		}
 
 		// remove disabled fields for OpenAI API
 		jsonData, err = relaycommon.RemoveDisabledFields(jsonData, info.ChannelOtherSettings, info.ChannelSetting.PassThroughBodyEnabled)
 		if err != nil {
-			return types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+			return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
 		}
 
 		// apply param override
 		if len(info.ParamOverride) > 0 {
 			jsonData, err = relaycommon.ApplyParamOverrideWithRelayInfo(jsonData, info)
 			if err != nil {
-				return newAPIErrorFromParamOverride(err)
+				return nil, newAPIErrorFromParamOverride(err)
 			}
 		}
 
@@ -187,7 +253,7 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 	var httpResp *http.Response
 	resp, err := adaptor.DoRequest(c, info, requestBody)
 	if err != nil {
-		return types.NewOpenAIError(err, types.ErrorCodeDoRequestFailed, http.StatusInternalServerError)
+		return nil, types.NewOpenAIError(err, types.ErrorCodeDoRequestFailed, http.StatusInternalServerError)
 	}
 
 	statusCodeMappingStr := c.GetString("status_code_mapping")
@@ -199,7 +265,7 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 			newApiErr := service.RelayErrorHandler(c.Request.Context(), httpResp, false)
 			// reset status code 重置状态码
 			service.ResetStatusCode(newApiErr, statusCodeMappingStr)
-			return newApiErr
+			return nil, newApiErr
 		}
 	}
 
@@ -207,18 +273,9 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 	if newApiErr != nil {
 		// reset status code 重置状态码
 		service.ResetStatusCode(newApiErr, statusCodeMappingStr)
-		return newApiErr
-	}
-
-	var containAudioTokens = usage.(*dto.Usage).CompletionTokenDetails.AudioTokens > 0 || usage.(*dto.Usage).PromptTokensDetails.AudioTokens > 0
-	var containsAudioRatios = ratio_setting.ContainsAudioRatio(info.OriginModelName) || ratio_setting.ContainsAudioCompletionRatio(info.OriginModelName)
-
-	if containAudioTokens && containsAudioRatios {
-		service.PostAudioConsumeQuota(c, info, usage.(*dto.Usage), "")
-	} else {
-		postConsumeQuota(c, info, usage.(*dto.Usage))
+		return nil, newApiErr
 	}
-	return nil
+	return usage.(*dto.Usage), nil
 }
 
 func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.Usage, extraContent ...string) {
@@ -507,6 +564,7 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 		UseTimeSeconds:   int(useTimeSeconds),
 		IsStream:         relayInfo.IsStream,
 		Group:            relayInfo.UsingGroup,
+		UpstreamCost:     service.CalculateUpstreamCost(relayInfo, quota),
 		Other:            other,
 	})
 }
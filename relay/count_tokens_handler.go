@@ -0,0 +1,105 @@
+package relay
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// CountTokensUpstreamSupported 当前渠道是否提供与请求格式对应的原生 token 计数接口
+func CountTokensUpstreamSupported(info *relaycommon.RelayInfo) bool {
+	switch info.RelayFormat {
+	case types.RelayFormatClaude:
+		return info.ChannelType == constant.ChannelTypeAnthropic
+	case types.RelayFormatGemini:
+		return info.ChannelType == constant.ChannelTypeGemini
+	}
+	return false
+}
+
+// CountTokensHelper 调用渠道上游的 token 计数接口，返回输入 token 数量，不计费
+func CountTokensHelper(c *gin.Context, info *relaycommon.RelayInfo) (int, *types.NewAPIError) {
+	info.InitChannelMeta(c)
+
+	var (
+		jsonData []byte
+		err      error
+	)
+	switch request := info.Request.(type) {
+	case *dto.ClaudeRequest:
+		countRequest, err := common.DeepCopy(request)
+		if err != nil {
+			return 0, types.NewError(err, types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
+		}
+		if err = helper.ModelMappedHelper(c, info, countRequest); err != nil {
+			return 0, types.NewError(err, types.ErrorCodeChannelModelMappedError, types.ErrOptionWithSkipRetry())
+		}
+		jsonData, err = common.Marshal(dto.NewClaudeCountTokensRequest(countRequest))
+	case *dto.GeminiChatRequest:
+		if err = helper.ModelMappedHelper(c, info, request); err != nil {
+			return 0, types.NewError(err, types.ErrorCodeChannelModelMappedError, types.ErrOptionWithSkipRetry())
+		}
+		// 带上生成配置时需要使用 generateContentRequest 形式，且必须指定模型
+		var generateContentRequest []byte
+		generateContentRequest, err = common.Marshal(request)
+		if err == nil {
+			generateContentRequest, err = sjson.SetBytes(generateContentRequest, "model", "models/"+info.UpstreamModelName)
+		}
+		if err == nil {
+			jsonData, err = sjson.SetRawBytes([]byte(`{}`), "generateContentRequest", generateContentRequest)
+		}
+	default:
+		return 0, types.NewErrorWithStatusCode(fmt.Errorf("invalid request type %T", info.Request), types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	if err != nil {
+		return 0, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+
+	adaptor := GetAdaptor(info.ApiType)
+	if adaptor == nil {
+		return 0, types.NewError(fmt.Errorf("invalid api type: %d", info.ApiType), types.ErrorCodeInvalidApiType, types.ErrOptionWithSkipRetry())
+	}
+	adaptor.Init(info)
+
+	resp, err := adaptor.DoRequest(c, info, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return 0, types.NewOpenAIError(err, types.ErrorCodeDoRequestFailed, http.StatusInternalServerError)
+	}
+	httpResp, ok := resp.(*http.Response)
+	if !ok || httpResp == nil {
+		return 0, types.NewError(fmt.Errorf("invalid response"), types.ErrorCodeBadResponse)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		newAPIError := service.RelayErrorHandler(c.Request.Context(), httpResp, false)
+		service.ResetStatusCode(newAPIError, c.GetString("status_code_mapping"))
+		return 0, newAPIError
+	}
+	defer service.CloseResponseBodyGracefully(httpResp)
+	body, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return 0, types.NewOpenAIError(err, types.ErrorCodeReadResponseBodyFailed, http.StatusInternalServerError)
+	}
+
+	path := "totalTokens"
+	if info.RelayFormat == types.RelayFormatClaude {
+		path = "input_tokens"
+	}
+	tokens := gjson.GetBytes(body, path)
+	if !tokens.Exists() {
+		return 0, types.NewOpenAIError(fmt.Errorf("token count missing in upstream response: %s", body), types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+	return int(tokens.Int()), nil
+}
@@ -0,0 +1,370 @@
+package helper
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ResponsesOutputTypeMessage      = "message"
+	ResponsesOutputTypeReasoning    = "reasoning"
+	ResponsesOutputTypeFunctionCall = "function_call"
+
+	ResponsesStatusCompleted  = "completed"
+	ResponsesStatusIncomplete = "incomplete"
+	ResponsesStatusInProgress = "in_progress"
+)
+
+// ResponsesBuilder 将非 OpenAI 上游的输出（文本、推理、函数调用）组装为 /v1/responses 的输出项。
+// 流式请求时同步发送 response.* 事件，Finish 时生成完整的响应对象；非流式请求只组装响应对象
+type ResponsesBuilder struct {
+	c        *gin.Context
+	stream   bool
+	response *dto.OpenAIResponsesResponse
+	sequence int
+	started  bool
+	output   []dto.ResponsesOutput
+	current  *responsesItemState
+
+	incompleteReason string
+}
+
+type responsesItemState struct {
+	item           dto.ResponsesOutput
+	index          int
+	text           strings.Builder
+	summaryStarted bool
+}
+
+// NewResponsesBuilder 创建响应组装器，响应中的请求参数（instructions、tools 等）从 info.Request 回填
+func NewResponsesBuilder(c *gin.Context, info *relaycommon.RelayInfo, model string) *ResponsesBuilder {
+	response := &dto.OpenAIResponsesResponse{
+		ID:                 "resp_" + common.GetRandomString(24),
+		Object:             "response",
+		CreatedAt:          int(common.GetTimestamp()),
+		Model:              model,
+		Output:             []dto.ResponsesOutput{},
+		ParallelToolCalls:  true,
+		PreviousResponseID: json.RawMessage("null"),
+		ToolChoice:         json.RawMessage(`"auto"`),
+		Tools:              []map[string]any{},
+		Temperature:        1,
+		TopP:               1,
+		Truncation:         json.RawMessage(`"disabled"`),
+		User:               json.RawMessage("null"),
+		Metadata:           json.RawMessage("{}"),
+	}
+	if request, ok := info.Request.(*dto.OpenAIResponsesRequest); ok && request != nil {
+		if common.GetJsonType(request.Instructions) == "string" {
+			_ = common.Unmarshal(request.Instructions, &response.Instructions)
+		}
+		if request.MaxOutputTokens != nil {
+			response.MaxOutputTokens = int(*request.MaxOutputTokens)
+		}
+		if request.PreviousResponseID != "" {
+			response.PreviousResponseID, _ = common.Marshal(request.PreviousResponseID)
+		}
+		if len(request.ParallelToolCalls) > 0 {
+			_ = common.Unmarshal(request.ParallelToolCalls, &response.ParallelToolCalls)
+		}
+		if len(request.ToolChoice) > 0 {
+			response.ToolChoice = request.ToolChoice
+		}
+		if tools := request.GetToolsMap(); tools != nil {
+			response.Tools = tools
+		}
+		if request.Temperature != nil {
+			response.Temperature = *request.Temperature
+		}
+		if request.TopP != nil {
+			response.TopP = *request.TopP
+		}
+		if len(request.Metadata) > 0 {
+			response.Metadata = request.Metadata
+		}
+		if len(request.User) > 0 {
+			response.User = request.User
+		}
+		response.Reasoning = request.Reasoning
+	}
+	return &ResponsesBuilder{
+		c:        c,
+		stream:   info.IsStream,
+		response: response,
+	}
+}
+
+func (b *ResponsesBuilder) emit(event dto.ResponsesStreamResponse) {
+	if !b.stream {
+		return
+	}
+	event.SequenceNumber = b.sequence
+	b.sequence++
+	data, err := common.Marshal(event)
+	if err != nil {
+		common.SysError("error marshalling responses stream event: " + err.Error())
+		return
+	}
+	ResponseChunkData(b.c, event, string(data))
+}
+
+func (b *ResponsesBuilder) snapshot(status string) *dto.OpenAIResponsesResponse {
+	response := *b.response
+	response.Status, _ = common.Marshal(status)
+	response.Output = b.output
+	if response.Output == nil {
+		response.Output = []dto.ResponsesOutput{}
+	}
+	return &response
+}
+
+// Start 发送 response.created 与 response.in_progress，重复调用无效果
+func (b *ResponsesBuilder) Start() {
+	if b.started {
+		return
+	}
+	b.started = true
+	b.emit(dto.ResponsesStreamResponse{Type: "response.created", Response: b.snapshot(ResponsesStatusInProgress)})
+	b.emit(dto.ResponsesStreamResponse{Type: "response.in_progress", Response: b.snapshot(ResponsesStatusInProgress)})
+}
+
+func (b *ResponsesBuilder) openItem(item dto.ResponsesOutput) *responsesItemState {
+	b.Start()
+	b.FinishItem()
+	item.Status = ResponsesStatusInProgress
+	state := &responsesItemState{item: item, index: len(b.output)}
+	b.current = state
+	added := state.item
+	b.emit(dto.ResponsesStreamResponse{Type: dto.ResponsesOutputTypeItemAdded, OutputIndex: common.GetPointer(state.index), Item: &added})
+	if item.Type == ResponsesOutputTypeMessage {
+		b.emit(dto.ResponsesStreamResponse{
+			Type:         "response.content_part.added",
+			ItemID:       item.ID,
+			OutputIndex:  common.GetPointer(state.index),
+			ContentIndex: common.GetPointer(0),
+			Part:         &dto.ResponsesReasoningSummaryPart{Type: "output_text"},
+		})
+	}
+	return state
+}
+
+// StartMessage 开始新的 assistant 消息项
+func (b *ResponsesBuilder) StartMessage() {
+	b.openItem(dto.ResponsesOutput{
+		Type:    ResponsesOutputTypeMessage,
+		ID:      "msg_" + common.GetRandomString(24),
+		Role:    "assistant",
+		Content: []dto.ResponsesOutputContent{},
+	})
+}
+
+// StartReasoning 开始新的推理项
+func (b *ResponsesBuilder) StartReasoning() {
+	b.openItem(dto.ResponsesOutput{
+		Type:    ResponsesOutputTypeReasoning,
+		ID:      "rs_" + common.GetRandomString(24),
+		Summary: json.RawMessage("[]"),
+	})
+}
+
+// StartFunctionCall 开始新的函数调用项
+func (b *ResponsesBuilder) StartFunctionCall(callId string, name string) {
+	if callId == "" {
+		callId = "call_" + common.GetRandomString(24)
+	}
+	b.openItem(dto.ResponsesOutput{
+		Type:   ResponsesOutputTypeFunctionCall,
+		ID:     "fc_" + common.GetRandomString(24),
+		CallId: callId,
+		Name:   name,
+	})
+}
+
+// AppendText 追加输出文本，当前不是消息项时自动开始新的消息项
+func (b *ResponsesBuilder) AppendText(delta string) {
+	if b.current == nil || b.current.item.Type != ResponsesOutputTypeMessage {
+		b.StartMessage()
+	}
+	if delta == "" {
+		return
+	}
+	b.current.text.WriteString(delta)
+	b.emit(dto.ResponsesStreamResponse{
+		Type:         "response.output_text.delta",
+		ItemID:       b.current.item.ID,
+		OutputIndex:  common.GetPointer(b.current.index),
+		ContentIndex: common.GetPointer(0),
+		Delta:        delta,
+	})
+}
+
+// AppendReasoning 追加推理摘要文本，当前不是推理项时自动开始新的推理项
+func (b *ResponsesBuilder) AppendReasoning(delta string) {
+	if b.current == nil || b.current.item.Type != ResponsesOutputTypeReasoning {
+		b.StartReasoning()
+	}
+	if delta == "" {
+		return
+	}
+	if !b.current.summaryStarted {
+		b.current.summaryStarted = true
+		b.emit(dto.ResponsesStreamResponse{
+			Type:         "response.reasoning_summary_part.added",
+			ItemID:       b.current.item.ID,
+			OutputIndex:  common.GetPointer(b.current.index),
+			SummaryIndex: common.GetPointer(0),
+			Part:         &dto.ResponsesReasoningSummaryPart{Type: "summary_text"},
+		})
+	}
+	b.current.text.WriteString(delta)
+	b.emit(dto.ResponsesStreamResponse{
+		Type:         "response.reasoning_summary_text.delta",
+		ItemID:       b.current.item.ID,
+		OutputIndex:  common.GetPointer(b.current.index),
+		SummaryIndex: common.GetPointer(0),
+		Delta:        delta,
+	})
+}
+
+// SetReasoningEncryptedContent 设置当前推理项的 encrypted_content（如 Claude thinking 签名），供下一轮请求原样回传
+func (b *ResponsesBuilder) SetReasoningEncryptedContent(content string) {
+	if b.current == nil || b.current.item.Type != ResponsesOutputTypeReasoning {
+		b.StartReasoning()
+	}
+	b.current.item.EncryptedContent = content
+}
+
+// AppendFunctionArguments 追加当前函数调用的参数 JSON 片段
+func (b *ResponsesBuilder) AppendFunctionArguments(delta string) {
+	if b.current == nil || b.current.item.Type != ResponsesOutputTypeFunctionCall || delta == "" {
+		return
+	}
+	b.current.text.WriteString(delta)
+	b.emit(dto.ResponsesStreamResponse{
+		Type:        "response.function_call_arguments.delta",
+		ItemID:      b.current.item.ID,
+		OutputIndex: common.GetPointer(b.current.index),
+		Delta:       delta,
+	})
+}
+
+// FinishItem 结束当前输出项并发送对应的 done 事件
+func (b *ResponsesBuilder) FinishItem() {
+	state := b.current
+	if state == nil {
+		return
+	}
+	b.current = nil
+	text := state.text.String()
+	outputIndex := common.GetPointer(state.index)
+	switch state.item.Type {
+	case ResponsesOutputTypeMessage:
+		b.emit(dto.ResponsesStreamResponse{
+			Type:         "response.output_text.done",
+			ItemID:       state.item.ID,
+			OutputIndex:  outputIndex,
+			ContentIndex: common.GetPointer(0),
+			Text:         text,
+		})
+		b.emit(dto.ResponsesStreamResponse{
+			Type:         "response.content_part.done",
+			ItemID:       state.item.ID,
+			OutputIndex:  outputIndex,
+			ContentIndex: common.GetPointer(0),
+			Part:         &dto.ResponsesReasoningSummaryPart{Type: "output_text", Text: text},
+		})
+		state.item.Content = []dto.ResponsesOutputContent{{Type: "output_text", Text: text, Annotations: []interface{}{}}}
+	case ResponsesOutputTypeReasoning:
+		if state.summaryStarted {
+			b.emit(dto.ResponsesStreamResponse{
+				Type:         "response.reasoning_summary_text.done",
+				ItemID:       state.item.ID,
+				OutputIndex:  outputIndex,
+				SummaryIndex: common.GetPointer(0),
+				Text:         text,
+			})
+			part := dto.ResponsesReasoningSummaryPart{Type: "summary_text", Text: text}
+			b.emit(dto.ResponsesStreamResponse{
+				Type:         "response.reasoning_summary_part.done",
+				ItemID:       state.item.ID,
+				OutputIndex:  outputIndex,
+				SummaryIndex: common.GetPointer(0),
+				Part:         &part,
+			})
+			state.item.Summary, _ = common.Marshal([]dto.ResponsesReasoningSummaryPart{part})
+		}
+	case ResponsesOutputTypeFunctionCall:
+		if strings.TrimSpace(text) == "" {
+			text = "{}"
+		}
+		state.item.Arguments = text
+		b.emit(dto.ResponsesStreamResponse{
+			Type:        "response.function_call_arguments.done",
+			ItemID:      state.item.ID,
+			OutputIndex: outputIndex,
+			Arguments:   text,
+		})
+	}
+	state.item.Status = ResponsesStatusCompleted
+	b.output = append(b.output, state.item)
+	done := state.item
+	b.emit(dto.ResponsesStreamResponse{Type: dto.ResponsesOutputTypeItemDone, OutputIndex: outputIndex, Item: &done})
+}
+
+// Output 返回已结束的输出项
+func (b *ResponsesBuilder) Output() []dto.ResponsesOutput {
+	return b.output
+}
+
+// SetIncompleteReason 设置响应未完整结束的原因（如 max_output_tokens、content_filter），为空表示正常结束
+func (b *ResponsesBuilder) SetIncompleteReason(reason string) {
+	b.incompleteReason = reason
+}
+
+// Finish 结束所有输出项并返回完整响应，设置了未完成原因时响应状态为 incomplete。
+// 流式请求同时发送 response.completed 或 response.incomplete 事件
+func (b *ResponsesBuilder) Finish(usage *dto.Usage) *dto.OpenAIResponsesResponse {
+	b.Start()
+	b.FinishItem()
+	status := ResponsesStatusCompleted
+	eventType := "response.completed"
+	if b.incompleteReason != "" {
+		status = ResponsesStatusIncomplete
+		eventType = "response.incomplete"
+	}
+	response := b.snapshot(status)
+	response.Usage = usage
+	if b.incompleteReason != "" {
+		response.IncompleteDetails = &dto.IncompleteDetails{Reason: b.incompleteReason}
+	}
+	b.emit(dto.ResponsesStreamResponse{Type: eventType, Response: response})
+	if data, err := common.Marshal(response); err == nil {
+		SetResponsesResult(b.c, data)
+	}
+	return response
+}
+
+// SetResponsesResult 记录最终的 response 对象，供网关侧保存响应使用
+func SetResponsesResult(c *gin.Context, response []byte) {
+	common.SetContextKey(c, constant.ContextKeyResponsesResult, response)
+}
+
+// NewResponsesUsage 按 Responses API 的语义生成用量：input_tokens 包含缓存命中的 token
+func NewResponsesUsage(inputTokens int, cachedTokens int, outputTokens int, reasoningTokens int) *dto.Usage {
+	return &dto.Usage{
+		InputTokens:        inputTokens,
+		OutputTokens:       outputTokens,
+		TotalTokens:        inputTokens + outputTokens,
+		InputTokensDetails: &dto.InputTokenDetails{CachedTokens: cachedTokens},
+		CompletionTokenDetails: dto.OutputTokenDetails{
+			ReasoningTokens: reasoningTokens,
+		},
+	}
+}
@@ -0,0 +1,24 @@
+package helper
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsPromptTemplateOnlyRequest(t *testing.T) {
+	assert.True(t, isPromptTemplateOnlyRequest(&dto.GeneralOpenAIRequest{Prompt: map[string]any{"id": "support-bot"}}))
+	assert.False(t, isPromptTemplateOnlyRequest(&dto.GeneralOpenAIRequest{Prompt: "hello"}))
+	assert.False(t, isPromptTemplateOnlyRequest(&dto.GeneralOpenAIRequest{Prompt: map[string]any{"version": 1}}))
+	assert.False(t, isPromptTemplateOnlyRequest(&dto.GeneralOpenAIRequest{}))
+
+	// 全局透传时请求体原样发送，模板不会被渲染
+	settings := model_setting.GetGlobalSettings()
+	original := settings.PassThroughRequestEnabled
+	settings.PassThroughRequestEnabled = true
+	t.Cleanup(func() { settings.PassThroughRequestEnabled = original })
+	assert.False(t, isPromptTemplateOnlyRequest(&dto.GeneralOpenAIRequest{Prompt: map[string]any{"id": "support-bot"}}))
+}
@@ -0,0 +1,245 @@
+package relay
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/sjson"
+)
+
+// serverToolCaptureWriter 截获单轮上游响应（已转换为 OpenAI 格式），由工具循环决定是否返回给客户端
+type serverToolCaptureWriter struct {
+	gin.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *serverToolCaptureWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *serverToolCaptureWriter) WriteHeaderNow() {}
+
+func (w *serverToolCaptureWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *serverToolCaptureWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *serverToolCaptureWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *serverToolCaptureWriter) Size() int {
+	return w.body.Len()
+}
+
+func (w *serverToolCaptureWriter) Written() bool {
+	return w.body.Len() > 0
+}
+
+func (w *serverToolCaptureWriter) Flush() {}
+
+// relayWithGatewayRounds 由网关驱动的多轮请求：每轮以非流式请求上游。
+// 网关工具：模型只调用网关工具时由网关执行并追加结果继续请求，超过最大轮数后以 tool_choice=none 要求模型直接回答；
+// 结构化输出：最终回答不符合 response_format 时追加修复提示重新请求，修复次数用尽后返回错误。
+// 各轮用量累加后返回，由调用方一次结算；返回错误时同时返回已完成轮次的用量，见 settleFailedGatewayRounds
+func relayWithGatewayRounds(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest,
+	tools *service.ServerToolSet, output *service.StructuredOutputValidator,
+	round func(request *dto.GeneralOpenAIRequest) (*dto.Usage, *types.NewAPIError)) (*dto.Usage, *types.NewAPIError) {
+	clientStream := info.IsStream
+	request.Stream = nil
+	request.StreamOptions = nil
+	defer func() {
+		info.IsStream = clientStream
+	}()
+
+	originWriter := c.Writer
+	defer func() {
+		c.Writer = originWriter
+	}()
+
+	totalUsage := &dto.Usage{}
+	var body []byte
+	var response *dto.OpenAITextResponse
+	toolRounds := 0
+	repairs := 0
+	for {
+		if tools != nil && toolRounds >= tools.MaxRounds {
+			request.ToolChoice = "none"
+		}
+		roundRequest, err := common.DeepCopy(request)
+		if err != nil {
+			return nil, types.NewError(err, types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
+		}
+		info.IsStream = false
+		capture := &serverToolCaptureWriter{ResponseWriter: originWriter}
+		c.Writer = capture
+		usage, newAPIError := round(roundRequest)
+		c.Writer = originWriter
+		if newAPIError != nil {
+			return totalUsage, newAPIError
+		}
+		if usage != nil {
+			accumulateServerToolUsage(totalUsage, usage)
+		}
+
+		body = capture.body.Bytes()
+		response = &dto.OpenAITextResponse{}
+		if err := common.Unmarshal(body, response); err != nil || len(response.Choices) == 0 {
+			// 无法解析的响应原样返回
+			response = nil
+			break
+		}
+		message := response.Choices[0].Message
+		calls := message.ParseToolCalls()
+		if tools != nil && toolRounds < tools.MaxRounds && tools.Owns(calls) {
+			toolRounds++
+			// 思考内容不回传，部分上游不接受输入消息中的 reasoning_content
+			message.ReasoningContent = ""
+			message.Reasoning = ""
+			request.Messages = append(request.Messages, message)
+			for _, call := range calls {
+				result := tools.Execute(c.Request.Context(), call)
+				logger.LogInfo(c, fmt.Sprintf("gateway tool %s executed in round %d, result length %d", call.Function.Name, toolRounds, len(result)))
+				request.Messages = append(request.Messages, dto.Message{
+					Role:       "tool",
+					Content:    result,
+					ToolCallId: call.ID,
+				})
+			}
+			continue
+		}
+
+		// 返回客户端工具调用时不校验结构化输出
+		if output == nil || len(calls) > 0 {
+			break
+		}
+		content := message.StringContent()
+		normalized, validationErrors := output.Validate(content)
+		if len(validationErrors) == 0 {
+			service.RecordStructuredOutputAttempt(c, service.StructuredOutputAttempt{ChannelId: info.ChannelId, Repairs: repairs, Passed: true})
+			if normalized != content {
+				if rewritten, err := sjson.SetBytes(body, "choices.0.message.content", normalized); err == nil {
+					body = rewritten
+					response.Choices[0].Message.SetStringContent(normalized)
+				}
+			}
+			break
+		}
+		if repairs >= output.MaxRepairAttempts {
+			service.RecordStructuredOutputAttempt(c, service.StructuredOutputAttempt{ChannelId: info.ChannelId, Repairs: repairs, Errors: validationErrors})
+			return totalUsage, service.NewStructuredOutputError(repairs, validationErrors)
+		}
+		repairs++
+		logger.LogInfo(c, fmt.Sprintf("structured output invalid, repair attempt %d: %s", repairs, strings.Join(validationErrors, "; ")))
+		request.Messages = append(request.Messages, dto.Message{Role: "assistant", Content: content}, dto.Message{
+			Role:    "user",
+			Content: output.RepairMessage(validationErrors),
+		})
+	}
+
+	if response == nil {
+		c.Data(http.StatusOK, "application/json", body)
+		return totalUsage, nil
+	}
+	if clientStream {
+		writeServerToolStreamResponse(c, info, response, totalUsage)
+		return totalUsage, nil
+	}
+	// 返回给客户端的用量为全部轮次之和
+	if withUsage, err := sjson.SetBytes(body, "usage", totalUsage); err == nil {
+		body = withUsage
+	}
+	c.Data(http.StatusOK, "application/json", body)
+	return totalUsage, nil
+}
+
+// settleFailedGatewayRounds 多轮请求中途失败时，已完成的轮次已在上游产生费用，按其用量单独扣费并记录日志。
+// 预扣费会话不结算：切换渠道重试成功时照常按新渠道的用量结算，最终失败时预扣费全额退还
+func settleFailedGatewayRounds(c *gin.Context, info *relaycommon.RelayInfo, usage *dto.Usage) {
+	if usage == nil || usage.PromptTokens+usage.CompletionTokens == 0 {
+		return
+	}
+	roundsInfo := *info
+	roundsInfo.Billing = nil
+	roundsInfo.FinalPreConsumedQuota = 0
+	postConsumeQuota(c, &roundsInfo, usage, "网关多轮请求失败，按已完成轮次计费")
+}
+
+func accumulateServerToolUsage(total *dto.Usage, usage *dto.Usage) {
+	total.PromptTokens += usage.PromptTokens
+	total.CompletionTokens += usage.CompletionTokens
+	total.TotalTokens += usage.TotalTokens
+	total.PromptCacheHitTokens += usage.PromptCacheHitTokens
+	total.PromptTokensDetails.CachedTokens += usage.PromptTokensDetails.CachedTokens
+	total.PromptTokensDetails.CachedCreationTokens += usage.PromptTokensDetails.CachedCreationTokens
+	total.PromptTokensDetails.TextTokens += usage.PromptTokensDetails.TextTokens
+	total.PromptTokensDetails.AudioTokens += usage.PromptTokensDetails.AudioTokens
+	total.PromptTokensDetails.ImageTokens += usage.PromptTokensDetails.ImageTokens
+	total.CompletionTokenDetails.TextTokens += usage.CompletionTokenDetails.TextTokens
+	total.CompletionTokenDetails.AudioTokens += usage.CompletionTokenDetails.AudioTokens
+	total.CompletionTokenDetails.ReasoningTokens += usage.CompletionTokenDetails.ReasoningTokens
+	total.ClaudeCacheCreation5mTokens += usage.ClaudeCacheCreation5mTokens
+	total.ClaudeCacheCreation1hTokens += usage.ClaudeCacheCreation1hTokens
+}
+
+// writeServerToolStreamResponse 客户端请求流式响应时，将最终一轮的完整响应拆分为 chat.completion.chunk 返回
+func writeServerToolStreamResponse(c *gin.Context, info *relaycommon.RelayInfo, response *dto.OpenAITextResponse, usage *dto.Usage) {
+	helper.SetEventStreamHeaders(c)
+	created := common.GetTimestamp()
+	if value, ok := response.Created.(float64); ok {
+		created = int64(value)
+	}
+	choice := response.Choices[0]
+	delta := dto.ChatCompletionsStreamResponseChoiceDelta{Role: "assistant"}
+	delta.SetContentString(choice.Message.StringContent())
+	if choice.Message.ReasoningContent != "" {
+		delta.ReasoningContent = &choice.Message.ReasoningContent
+	}
+	for i, call := range choice.Message.ParseToolCalls() {
+		toolCall := dto.ToolCallResponse{
+			ID:   call.ID,
+			Type: "function",
+			Function: dto.FunctionResponse{
+				Name:      call.Function.Name,
+				Arguments: call.Function.Arguments,
+			},
+		}
+		toolCall.SetIndex(i)
+		delta.ToolCalls = append(delta.ToolCalls, toolCall)
+	}
+	_ = helper.ObjectData(c, &dto.ChatCompletionsStreamResponse{
+		Id:      response.Id,
+		Object:  "chat.completion.chunk",
+		Created: created,
+		Model:   response.Model,
+		Choices: []dto.ChatCompletionsStreamResponseChoice{{Delta: delta}},
+	})
+	finishReason := choice.FinishReason
+	if finishReason == "" {
+		finishReason = constant.FinishReasonStop
+	}
+	_ = helper.ObjectData(c, helper.GenerateStopResponse(response.Id, created, response.Model, finishReason))
+	if info.ShouldIncludeUsage {
+		_ = helper.ObjectData(c, helper.GenerateFinalUsageResponse(response.Id, created, response.Model, *usage))
+	}
+	helper.Done(c)
+}
@@ -3,6 +3,7 @@ package router
 import (
 	"github.com/QuantumNous/new-api/controller"
 	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
 
 	// Import oauth package to register providers via init()
 	_ "github.com/QuantumNous/new-api/oauth"
@@ -44,6 +45,9 @@ func SetApiRouter(router *gin.Engine) {
 		apiRouter.GET("/oauth/telegram/bind", middleware.CriticalRateLimit(), controller.TelegramBind)
 		// Standard OAuth providers (GitHub, Discord, OIDC, LinuxDO) - unified route
 		apiRouter.GET("/oauth/:provider", middleware.CriticalRateLimit(), controller.HandleOAuth)
+		apiRouter.GET("/saml/:slug/metadata", controller.GetSAMLMetadata)
+		apiRouter.GET("/saml/:slug/login", middleware.CriticalRateLimit(), controller.StartSAMLLogin)
+		apiRouter.POST("/saml/:slug/acs", middleware.CriticalRateLimit(), controller.HandleSAMLACS)
 		apiRouter.GET("/ratio_config", middleware.CriticalRateLimit(), controller.GetRatioConfig)
 
 		apiRouter.POST("/stripe/webhook", controller.StripeWebhook)
@@ -75,6 +79,9 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.GET("/models", controller.GetUserModels)
 				selfRoute.PUT("/self", controller.UpdateSelf)
 				selfRoute.DELETE("/self", controller.DeleteSelf)
+				selfRoute.GET("/self/sessions", controller.GetSelfSessions)
+				selfRoute.DELETE("/self/sessions", controller.RevokeSelfOtherSessions)
+				selfRoute.DELETE("/self/sessions/:session_id", controller.RevokeSelfSession)
 				selfRoute.GET("/token", controller.GenerateAccessToken)
 				selfRoute.GET("/passkey", controller.PasskeyStatus)
 				selfRoute.POST("/passkey/register/begin", controller.PasskeyRegisterBegin)
@@ -93,6 +100,7 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.POST("/creem/pay", middleware.CriticalRateLimit(), controller.RequestCreemPay)
 				selfRoute.POST("/waffo/amount", controller.RequestWaffoAmount)
 				selfRoute.POST("/waffo/pay", middleware.CriticalRateLimit(), controller.RequestWaffoPay)
+				selfRoute.POST("/coupon/preview", controller.PreviewCoupon)
 				//selfRoute.POST("/waffo-pancake/amount", controller.RequestWaffoPancakeAmount)
 				//selfRoute.POST("/waffo-pancake/pay", middleware.CriticalRateLimit(), controller.RequestWaffoPancakePay)
 				selfRoute.POST("/aff_transfer", controller.TransferAffQuota)
@@ -105,6 +113,9 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.POST("/2fa/disable", controller.Disable2FA)
 				selfRoute.POST("/2fa/backup_codes", controller.RegenerateBackupCodes)
 
+				// Postpaid account
+				selfRoute.GET("/postpaid", controller.GetPostpaidSelf)
+
 				// Check-in routes
 				selfRoute.GET("/checkin", controller.GetCheckinStatus)
 				selfRoute.POST("/checkin", middleware.TurnstileCheck(), controller.DoCheckin)
@@ -114,12 +125,17 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.DELETE("/oauth/bindings/:provider_id", controller.UnbindCustomOAuth)
 			}
 
+			topupAdminRoute := userRoute.Group("/topup")
+			topupAdminRoute.Use(middleware.PermissionAuth(model.ManagementScopeBilling))
+			{
+				topupAdminRoute.GET("", controller.GetAllTopUps)
+				topupAdminRoute.POST("/complete", controller.AdminCompleteTopUp)
+			}
+
 			adminRoute := userRoute.Group("/")
-			adminRoute.Use(middleware.AdminAuth())
+			adminRoute.Use(middleware.PermissionAuth(model.ManagementScopeUsers))
 			{
 				adminRoute.GET("/", controller.GetAllUsers)
-				adminRoute.GET("/topup", controller.GetAllTopUps)
-				adminRoute.POST("/topup/complete", controller.AdminCompleteTopUp)
 				adminRoute.GET("/search", controller.SearchUsers)
 				adminRoute.GET("/:id/oauth/bindings", controller.GetUserOAuthBindingsByAdmin)
 				adminRoute.DELETE("/:id/oauth/bindings/:provider_id", controller.UnbindCustomOAuthByAdmin)
@@ -134,6 +150,9 @@ func SetApiRouter(router *gin.Engine) {
 				// Admin 2FA routes
 				adminRoute.GET("/2fa/stats", controller.Admin2FAStats)
 				adminRoute.DELETE("/:id/2fa", controller.AdminDisable2FA)
+				adminRoute.GET("/:id/sessions", controller.GetUserSessions)
+				adminRoute.DELETE("/:id/sessions", controller.RevokeAllUserSessions)
+				adminRoute.DELETE("/:id/sessions/:session_id", controller.RevokeUserSession)
 			}
 		}
 
@@ -149,7 +168,7 @@ func SetApiRouter(router *gin.Engine) {
 			subscriptionRoute.POST("/creem/pay", middleware.CriticalRateLimit(), controller.SubscriptionRequestCreemPay)
 		}
 		subscriptionAdminRoute := apiRouter.Group("/subscription/admin")
-		subscriptionAdminRoute.Use(middleware.AdminAuth())
+		subscriptionAdminRoute.Use(middleware.PermissionAuth(model.ManagementScopeBilling))
 		{
 			subscriptionAdminRoute.GET("/plans", controller.AdminListSubscriptionPlans)
 			subscriptionAdminRoute.POST("/plans", controller.AdminCreateSubscriptionPlan)
@@ -164,6 +183,19 @@ func SetApiRouter(router *gin.Engine) {
 			subscriptionAdminRoute.DELETE("/user_subscriptions/:id", controller.AdminDeleteUserSubscription)
 		}
 
+		// Postpaid billing (credit limits, statements, offline payments)
+		postpaidAdminRoute := apiRouter.Group("/postpaid")
+		postpaidAdminRoute.Use(middleware.PermissionAuth(model.ManagementScopeBilling))
+		{
+			postpaidAdminRoute.GET("/accounts", controller.AdminListPostpaidAccounts)
+			postpaidAdminRoute.PUT("/accounts", controller.AdminUpsertPostpaidAccount)
+			postpaidAdminRoute.GET("/accounts/:id", controller.AdminGetPostpaidAccount)
+			postpaidAdminRoute.POST("/accounts/:id/close", controller.AdminClosePostpaidCycle)
+			postpaidAdminRoute.GET("/statements", controller.AdminListPostpaidStatements)
+			postpaidAdminRoute.GET("/statements/:id/payments", controller.AdminListPostpaidPayments)
+			postpaidAdminRoute.POST("/statements/:id/payments", controller.AdminRecordPostpaidPayment)
+		}
+
 		// OSS 图片转存管理路由（管理员）
 		ossImageAdminRoute := apiRouter.Group("/oss/images")
 		ossImageAdminRoute.Use(middleware.AdminAuth())
@@ -188,6 +220,17 @@ func SetApiRouter(router *gin.Engine) {
 			optionRoute.POST("/migrate_console_setting", controller.MigrateConsoleSetting) // 用于迁移检测的旧键，下个版本会删除
 		}
 
+		// Custom role management (root only)
+		customRoleRoute := apiRouter.Group("/role")
+		customRoleRoute.Use(middleware.RootAuth())
+		{
+			customRoleRoute.GET("/", controller.GetCustomRoles)
+			customRoleRoute.POST("/", controller.AddCustomRole)
+			customRoleRoute.PUT("/:id", controller.UpdateCustomRole)
+			customRoleRoute.DELETE("/:id", controller.DeleteCustomRole)
+			customRoleRoute.PUT("/user/:id", controller.AssignUserCustomRole)
+		}
+
 		// Custom OAuth provider management (root only)
 		customOAuthRoute := apiRouter.Group("/custom-oauth-provider")
 		customOAuthRoute.Use(middleware.RootAuth())
@@ -198,6 +241,8 @@ func SetApiRouter(router *gin.Engine) {
 			customOAuthRoute.POST("/", controller.CreateCustomOAuthProvider)
 			customOAuthRoute.PUT("/:id", controller.UpdateCustomOAuthProvider)
 			customOAuthRoute.DELETE("/:id", controller.DeleteCustomOAuthProvider)
+			customOAuthRoute.POST("/saml", controller.CreateSAMLProvider)
+			customOAuthRoute.PUT("/saml/:id", controller.UpdateSAMLProvider)
 		}
 		performanceRoute := apiRouter.Group("/performance")
 		performanceRoute.Use(middleware.RootAuth())
@@ -214,7 +259,7 @@ func SetApiRouter(router *gin.Engine) {
 			ratioSyncRoute.POST("/fetch", controller.FetchUpstreamRatios)
 		}
 		channelRoute := apiRouter.Group("/channel")
-		channelRoute.Use(middleware.AdminAuth())
+		channelRoute.Use(middleware.PermissionAuth(model.ManagementScopeChannels))
 		{
 			channelRoute.GET("/", controller.GetAllChannels)
 			channelRoute.GET("/search", controller.SearchChannels)
@@ -265,6 +310,7 @@ func SetApiRouter(router *gin.Engine) {
 			tokenRoute.GET("/rpm/default", controller.GetDefaultTokenRPM)
 			tokenRoute.GET("/:id", controller.GetToken)
 			tokenRoute.POST("/:id/key", middleware.CriticalRateLimit(), middleware.DisableCache(), controller.GetTokenKey)
+			tokenRoute.POST("/:id/rotate", middleware.CriticalRateLimit(), middleware.DisableCache(), controller.RotateToken)
 			tokenRoute.POST("/", controller.AddToken)
 			tokenRoute.PUT("/rpm", controller.UpdateTokenRPM)
 			tokenRoute.PUT("/rpm/default", controller.UpdateDefaultTokenRPM)
@@ -275,6 +321,15 @@ func SetApiRouter(router *gin.Engine) {
 			tokenRoute.POST("/batch", controller.DeleteTokenBatch)
 		}
 
+		managementKeyRoute := apiRouter.Group("/management_key")
+		managementKeyRoute.Use(middleware.UserAuth())
+		{
+			managementKeyRoute.GET("/", controller.GetManagementKeys)
+			managementKeyRoute.POST("/", middleware.CriticalRateLimit(), controller.AddManagementKey)
+			managementKeyRoute.PUT("/:id", controller.UpdateManagementKey)
+			managementKeyRoute.DELETE("/:id", controller.DeleteManagementKey)
+		}
+
 		// 第三方 access token 调用：按 token 分组统计当前用户的额度汇总
 		apiRouter.GET("/token/group_quota", middleware.CriticalRateLimit(), middleware.UserAuth(), controller.GetTokenGroupQuotaSummary)
 
@@ -289,7 +344,7 @@ func SetApiRouter(router *gin.Engine) {
 		}
 
 		redemptionRoute := apiRouter.Group("/redemption")
-		redemptionRoute.Use(middleware.AdminAuth())
+		redemptionRoute.Use(middleware.PermissionAuth(model.ManagementScopeBilling))
 		{
 			redemptionRoute.GET("/", controller.GetAllRedemptions)
 			redemptionRoute.GET("/search", controller.SearchRedemptions)
@@ -298,20 +353,39 @@ func SetApiRouter(router *gin.Engine) {
 			redemptionRoute.PUT("/", controller.UpdateRedemption)
 			redemptionRoute.DELETE("/invalid", controller.DeleteInvalidRedemption)
 			redemptionRoute.DELETE("/:id", controller.DeleteRedemption)
+			redemptionRoute.GET("/campaign", controller.GetRedemptionCampaigns)
+			redemptionRoute.POST("/campaign", controller.AddRedemptionCampaign)
+			redemptionRoute.GET("/campaign/:id", controller.GetRedemptionCampaign)
+			redemptionRoute.PUT("/campaign/:id", controller.UpdateRedemptionCampaign)
+			redemptionRoute.GET("/campaign/:id/export", controller.ExportRedemptionCampaign)
+		}
+		couponRoute := apiRouter.Group("/coupon")
+		couponRoute.Use(middleware.PermissionAuth(model.ManagementScopeBilling))
+		{
+			couponRoute.GET("/", controller.GetAllCoupons)
+			couponRoute.GET("/report", controller.GetCouponCampaignReport)
+			couponRoute.GET("/:id", controller.GetCoupon)
+			couponRoute.GET("/:id/redemptions", controller.GetCouponRedemptions)
+			couponRoute.POST("/", controller.AddCoupon)
+			couponRoute.PUT("/:id", controller.UpdateCoupon)
+			couponRoute.DELETE("/:id", controller.DeleteCoupon)
 		}
 		logRoute := apiRouter.Group("/log")
-		logRoute.GET("/", middleware.AdminAuth(), controller.GetAllLogs)
-		logRoute.DELETE("/", middleware.AdminAuth(), controller.DeleteHistoryLogs)
-		logRoute.GET("/stat", middleware.AdminAuth(), controller.GetLogsStat)
+		logRoute.GET("/", middleware.PermissionAuth(model.ManagementScopeLogs), controller.GetAllLogs)
+		logRoute.DELETE("/", middleware.PermissionAuth(model.ManagementScopeLogs), controller.DeleteHistoryLogs)
+		logRoute.GET("/stat", middleware.PermissionAuth(model.ManagementScopeLogs), controller.GetLogsStat)
 		logRoute.GET("/self/stat", middleware.UserAuth(), controller.GetLogsSelfStat)
-		logRoute.GET("/channel_affinity_usage_cache", middleware.AdminAuth(), controller.GetChannelAffinityUsageCacheStats)
-		logRoute.GET("/search", middleware.AdminAuth(), controller.SearchAllLogs)
+		logRoute.GET("/channel_affinity_usage_cache", middleware.PermissionAuth(model.ManagementScopeLogs), controller.GetChannelAffinityUsageCacheStats)
+		logRoute.GET("/search", middleware.PermissionAuth(model.ManagementScopeLogs), controller.SearchAllLogs)
 		logRoute.GET("/self", middleware.UserAuth(), controller.GetUserLogs)
 		logRoute.GET("/self/search", middleware.UserAuth(), middleware.SearchRateLimit(), controller.SearchUserLogs)
-		logRoute.GET("/usage/card", middleware.AdminAuth(), controller.GetUsageCardStats)
+		logRoute.GET("/usage/card", middleware.PermissionAuth(model.ManagementScopeLogs), controller.GetUsageCardStats)
+		logRoute.GET("/margin", middleware.PermissionAuth(model.ManagementScopeLogs), controller.GetMarginReport)
+		logRoute.GET("/end_users", middleware.PermissionAuth(model.ManagementScopeLogs), controller.GetEndUserUsage)
+		logRoute.GET("/self/end_users", middleware.UserAuth(), controller.GetSelfEndUserUsage)
 
 		dataRoute := apiRouter.Group("/data")
-		dataRoute.GET("/", middleware.AdminAuth(), controller.GetAllQuotaDates)
+		dataRoute.GET("/", middleware.PermissionAuth(model.ManagementScopeLogs), controller.GetAllQuotaDates)
 		dataRoute.GET("/self", middleware.UserAuth(), controller.GetUserQuotaDates)
 
 		logRoute.Use(middleware.CORS(), middleware.CriticalRateLimit())
@@ -319,13 +393,13 @@ func SetApiRouter(router *gin.Engine) {
 			logRoute.GET("/token", middleware.TokenAuthReadOnly(), controller.GetLogByKey)
 		}
 		groupRoute := apiRouter.Group("/group")
-		groupRoute.Use(middleware.AdminAuth())
+		groupRoute.Use(middleware.PermissionAuth(model.ManagementScopeModels))
 		{
 			groupRoute.GET("/", controller.GetGroups)
 		}
 
 		prefillGroupRoute := apiRouter.Group("/prefill_group")
-		prefillGroupRoute.Use(middleware.AdminAuth())
+		prefillGroupRoute.Use(middleware.PermissionAuth(model.ManagementScopeModels))
 		{
 			prefillGroupRoute.GET("/", controller.GetPrefillGroups)
 			prefillGroupRoute.POST("/", controller.CreatePrefillGroup)
@@ -333,6 +407,34 @@ func SetApiRouter(router *gin.Engine) {
 			prefillGroupRoute.DELETE("/:id", controller.DeletePrefillGroup)
 		}
 
+		promptTemplateRoute := apiRouter.Group("/prompt_template")
+		promptTemplateRoute.Use(middleware.UserAuth())
+		{
+			promptTemplateRoute.GET("/", controller.GetPromptTemplates)
+			promptTemplateRoute.POST("/", controller.CreatePromptTemplate)
+			promptTemplateRoute.POST("/:id/activate", controller.ActivatePromptTemplate)
+			promptTemplateRoute.DELETE("/:id", controller.DeletePromptTemplate)
+		}
+
+		globalPromptTemplateRoute := apiRouter.Group("/prompt_template/global")
+		globalPromptTemplateRoute.Use(middleware.PermissionAuth(model.ManagementScopeModels))
+		{
+			globalPromptTemplateRoute.GET("/", controller.GetGlobalPromptTemplates)
+			globalPromptTemplateRoute.POST("/", controller.CreateGlobalPromptTemplate)
+			globalPromptTemplateRoute.POST("/:id/activate", controller.ActivateGlobalPromptTemplate)
+			globalPromptTemplateRoute.DELETE("/:id", controller.DeleteGlobalPromptTemplate)
+		}
+
+		experimentRoute := apiRouter.Group("/experiment")
+		experimentRoute.Use(middleware.PermissionAuth(model.ManagementScopeModels))
+		{
+			experimentRoute.GET("/", controller.GetAllExperiments)
+			experimentRoute.POST("/", controller.CreateExperiment)
+			experimentRoute.PUT("/", controller.UpdateExperiment)
+			experimentRoute.DELETE("/:id", controller.DeleteExperiment)
+			experimentRoute.GET("/:id/report", controller.GetExperimentReport)
+		}
+
 		mjRoute := apiRouter.Group("/mj")
 		mjRoute.GET("/self", middleware.UserAuth(), controller.GetUserMidjourney)
 		mjRoute.GET("/", middleware.AdminAuth(), controller.GetAllMidjourney)
@@ -344,7 +446,7 @@ func SetApiRouter(router *gin.Engine) {
 		}
 
 		vendorRoute := apiRouter.Group("/vendors")
-		vendorRoute.Use(middleware.AdminAuth())
+		vendorRoute.Use(middleware.PermissionAuth(model.ManagementScopeModels))
 		{
 			vendorRoute.GET("/", controller.GetAllVendors)
 			vendorRoute.GET("/search", controller.SearchVendors)
@@ -355,7 +457,7 @@ func SetApiRouter(router *gin.Engine) {
 		}
 
 		modelsRoute := apiRouter.Group("/models")
-		modelsRoute.Use(middleware.AdminAuth())
+		modelsRoute.Use(middleware.PermissionAuth(model.ManagementScopeModels))
 		{
 			modelsRoute.GET("/sync_upstream/preview", controller.SyncUpstreamPreview)
 			modelsRoute.POST("/sync_upstream", controller.SyncUpstreamModels)
@@ -71,8 +71,20 @@ func SetRelayRouter(router *gin.Engine) {
 	relayV1Router.Use(middleware.SystemPerformanceCheck())
 	relayV1Router.Use(middleware.TokenAuth())
 	relayV1Router.Use(middleware.CodexClientRestriction())
+	relayV1Router.Use(middleware.PostpaidAccessControl())
 	relayV1Router.Use(middleware.TokenRPMLimit())
 	relayV1Router.Use(middleware.ModelRequestRateLimit())
+	relayV1Router.Use(middleware.EndUserLimit())
+	{
+		// 签发临时令牌，无需分发渠道
+		relayV1Router.POST("/ephemeral_tokens", controller.CreateEphemeralToken)
+		// 网关侧保存的 Responses 响应，无需分发渠道
+		relayV1Router.GET("/responses/:id", controller.GetStoredResponse)
+		relayV1Router.DELETE("/responses/:id", controller.DeleteStoredResponse)
+		relayV1Router.GET("/responses/:id/input_items", controller.ListStoredResponseInputItems)
+		// 流量切分实验的反馈评分，无需分发渠道
+		relayV1Router.POST("/feedback", controller.SubmitExperimentFeedback)
+	}
 	{
 		// WebSocket 路由（统一到 Relay）
 		wsRouter := relayV1Router.Group("")
@@ -90,6 +102,10 @@ func SetRelayRouter(router *gin.Engine) {
 		httpRouter.POST("/messages", func(c *gin.Context) {
 			controller.Relay(c, types.RelayFormatClaude)
 		})
+		// token 计数，不扣费；Gemini 的 :countTokens 由 /models/*path 处理
+		httpRouter.POST("/messages/count_tokens", func(c *gin.Context) {
+			controller.Relay(c, types.RelayFormatClaude)
+		})
 
 		// chat related routes
 		httpRouter.POST("/completions", func(c *gin.Context) {
@@ -181,20 +197,33 @@ func SetRelayRouter(router *gin.Engine) {
 	relaySunoRouter := router.Group("/suno")
 	relaySunoRouter.Use(middleware.RouteTag("relay"))
 	relaySunoRouter.Use(middleware.SystemPerformanceCheck())
-	relaySunoRouter.Use(middleware.TokenAuth(), middleware.TokenRPMLimit(), middleware.Distribute())
+	relaySunoRouter.Use(middleware.TokenAuth(), middleware.PostpaidAccessControl(), middleware.TokenRPMLimit(), middleware.Distribute())
 	{
 		relaySunoRouter.POST("/submit/:action", controller.RelayTask)
 		relaySunoRouter.POST("/fetch", controller.RelayTaskFetch)
 		relaySunoRouter.GET("/fetch/:id", controller.RelayTaskFetch)
 	}
 
+	// MCP 网关：/mcp/{server}，按令牌的 MCP 白名单访问已登记的 MCP 服务器
+	relayMcpRouter := router.Group("/mcp")
+	relayMcpRouter.Use(middleware.RouteTag("relay"))
+	relayMcpRouter.Use(middleware.SystemPerformanceCheck())
+	relayMcpRouter.Use(middleware.TokenAuth(), middleware.PostpaidAccessControl(), middleware.TokenRPMLimit(), middleware.EndUserLimit())
+	{
+		relayMcpRouter.POST("/:server", controller.RelayMcp)
+		relayMcpRouter.GET("/:server", controller.RelayMcp)
+		relayMcpRouter.DELETE("/:server", controller.RelayMcp)
+	}
+
 	relayGeminiRouter := router.Group("/v1beta")
 	relayGeminiRouter.Use(middleware.RouteTag("relay"))
 	relayGeminiRouter.Use(middleware.SystemPerformanceCheck())
 	relayGeminiRouter.Use(middleware.TokenAuth())
 	relayGeminiRouter.Use(middleware.CodexClientRestriction())
+	relayGeminiRouter.Use(middleware.PostpaidAccessControl())
 	relayGeminiRouter.Use(middleware.TokenRPMLimit())
 	relayGeminiRouter.Use(middleware.ModelRequestRateLimit())
+	relayGeminiRouter.Use(middleware.EndUserLimit())
 	relayGeminiRouter.Use(middleware.Distribute())
 	{
 		// Gemini API 路径格式: /v1beta/models/{model_name}:{action}
@@ -206,7 +235,7 @@ func SetRelayRouter(router *gin.Engine) {
 
 func registerMjRouterGroup(relayMjRouter *gin.RouterGroup) {
 	relayMjRouter.GET("/image/:id", relay.RelayMidjourneyImage)
-	relayMjRouter.Use(middleware.TokenAuth(), middleware.TokenRPMLimit(), middleware.Distribute())
+	relayMjRouter.Use(middleware.TokenAuth(), middleware.PostpaidAccessControl(), middleware.TokenRPMLimit(), middleware.Distribute())
 	{
 		relayMjRouter.POST("/submit/action", controller.RelayMidjourney)
 		relayMjRouter.POST("/submit/shorten", controller.RelayMidjourney)
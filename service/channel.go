@@ -62,6 +62,10 @@ func ShouldDisableChannel(channelType int, err *types.NewAPIError) bool {
 	if types.IsSkipRetryError(err) {
 		return false
 	}
+	// 输出不符合结构化要求属于模型能力问题，不禁用渠道
+	if err.GetErrorCode() == types.ErrorCodeStructuredOutputInvalid {
+		return false
+	}
 	if operation_setting.ShouldDisableByStatusCode(err.StatusCode) {
 		return true
 	}
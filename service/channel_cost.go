@@ -0,0 +1,15 @@
+package service
+
+import (
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+)
+
+// CalculateUpstreamCost 按渠道成本设置估算本次请求的上游成本（额度单位），渠道未配置成本时返回 0
+func CalculateUpstreamCost(relayInfo *relaycommon.RelayInfo, quota int) int {
+	if relayInfo == nil {
+		return 0
+	}
+	groupRatio := relayInfo.PriceData.GroupRatioInfo.GroupRatio
+	return model.CalculateChannelUpstreamCost(relayInfo.ChannelId, relayInfo.OriginModelName, quota, groupRatio)
+}
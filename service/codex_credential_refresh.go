@@ -51,7 +51,11 @@ func RefreshCodexChannelCredential(ctx context.Context, channelID int, opts Code
 		return nil, nil, fmt.Errorf("channel type is not Codex")
 	}
 
-	oauthKey, err := parseCodexOAuthKey(strings.TrimSpace(ch.Key))
+	rawKey, err := ch.DecryptKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	oauthKey, err := parseCodexOAuthKey(strings.TrimSpace(rawKey))
 	if err != nil {
 		return nil, nil, err
 	}
@@ -91,7 +95,7 @@ func RefreshCodexChannelCredential(ctx context.Context, channelID int, opts Code
 		return nil, nil, err
 	}
 
-	if err := model.DB.Model(&model.Channel{}).Where("id = ?", ch.Id).Update("key", string(encoded)).Error; err != nil {
+	if err := model.UpdateChannelKey(ch.Id, string(encoded)); err != nil {
 		return nil, nil, err
 	}
 
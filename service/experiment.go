@@ -0,0 +1,296 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+// 流量切分实验：命中实验模型与分组的请求按令牌、终端用户或用户做粘性哈希分桶，
+// 分到实验组的请求改用实验组的模型或渠道；请求结果写入 experiment_results，按组统计延迟、错误率、花费与反馈评分
+
+const experimentCacheTTL = 30 * time.Second
+
+type runningExperiment struct {
+	experiment *model.Experiment
+	arms       []model.ExperimentArm
+	groups     map[string]bool
+}
+
+var (
+	experimentCacheLock     sync.RWMutex
+	experimentCache         []*runningExperiment
+	experimentCacheExpireAt time.Time
+)
+
+// ParseExperimentArms 解析实验组配置
+func ParseExperimentArms(data string) ([]model.ExperimentArm, error) {
+	var arms []model.ExperimentArm
+	if err := common.UnmarshalJsonStr(data, &arms); err != nil {
+		return nil, fmt.Errorf("实验组配置格式错误：%w", err)
+	}
+	return arms, nil
+}
+
+// ValidateExperiment 校验实验配置：实验组名称唯一且不能为 control，权重之和不超过 100，
+// 每个实验组至少指定模型或渠道之一
+func ValidateExperiment(experiment *model.Experiment) error {
+	experiment.Name = strings.TrimSpace(experiment.Name)
+	experiment.Model = strings.TrimSpace(experiment.Model)
+	if experiment.Name == "" || len(experiment.Name) > 64 {
+		return errors.New("实验名称不能为空且不超过 64 个字符")
+	}
+	if len(experiment.Description) > 255 {
+		return errors.New("实验描述过长")
+	}
+	if experiment.Model == "" {
+		return errors.New("实验模型不能为空")
+	}
+	if experiment.Status == 0 {
+		experiment.Status = model.ExperimentStatusRunning
+	}
+	if experiment.Status != model.ExperimentStatusRunning && experiment.Status != model.ExperimentStatusStopped {
+		return errors.New("无效的实验状态")
+	}
+	switch experiment.StickyBy {
+	case "":
+		experiment.StickyBy = model.ExperimentStickyByToken
+	case model.ExperimentStickyByToken, model.ExperimentStickyByEndUser, model.ExperimentStickyByUser:
+	default:
+		return fmt.Errorf("不支持的粘性依据：%s", experiment.StickyBy)
+	}
+	arms, err := ParseExperimentArms(experiment.Arms)
+	if err != nil {
+		return err
+	}
+	if len(arms) == 0 {
+		return errors.New("至少需要一个实验组")
+	}
+	names := make(map[string]bool, len(arms))
+	total := 0
+	for _, arm := range arms {
+		if arm.Name == "" || arm.Name == model.ExperimentControlArm || len(arm.Name) > 64 {
+			return fmt.Errorf("无效的实验组名称：%q", arm.Name)
+		}
+		if names[arm.Name] {
+			return fmt.Errorf("实验组名称重复：%s", arm.Name)
+		}
+		names[arm.Name] = true
+		if arm.Weight <= 0 {
+			return fmt.Errorf("实验组 %s 的权重必须大于 0", arm.Name)
+		}
+		if arm.Model == "" && arm.ChannelId <= 0 {
+			return fmt.Errorf("实验组 %s 需要指定模型或渠道", arm.Name)
+		}
+		total += arm.Weight
+	}
+	if total > 100 {
+		return errors.New("实验组权重之和不能超过 100")
+	}
+	return nil
+}
+
+// InvalidateExperimentCache 实验配置变更后调用，下次请求重新加载
+func InvalidateExperimentCache() {
+	experimentCacheLock.Lock()
+	experimentCacheExpireAt = time.Time{}
+	experimentCacheLock.Unlock()
+}
+
+func getRunningExperiments() []*runningExperiment {
+	experimentCacheLock.RLock()
+	if time.Now().Before(experimentCacheExpireAt) {
+		cached := experimentCache
+		experimentCacheLock.RUnlock()
+		return cached
+	}
+	experimentCacheLock.RUnlock()
+
+	experiments, err := model.GetRunningExperiments()
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to load experiments: %s", err.Error()))
+		return nil
+	}
+	running := make([]*runningExperiment, 0, len(experiments))
+	for _, experiment := range experiments {
+		arms, err := ParseExperimentArms(experiment.Arms)
+		if err != nil {
+			common.SysLog(fmt.Sprintf("skip experiment %d: %s", experiment.Id, err.Error()))
+			continue
+		}
+		var groups map[string]bool
+		for _, group := range strings.Split(experiment.Groups, ",") {
+			if group = strings.TrimSpace(group); group != "" {
+				if groups == nil {
+					groups = make(map[string]bool)
+				}
+				groups[group] = true
+			}
+		}
+		running = append(running, &runningExperiment{experiment: experiment, arms: arms, groups: groups})
+	}
+
+	experimentCacheLock.Lock()
+	experimentCache = running
+	experimentCacheExpireAt = time.Now().Add(experimentCacheTTL)
+	experimentCacheLock.Unlock()
+	return running
+}
+
+// isExperimentRelayPath 仅对生成类请求分流，token 计数等请求保持原模型
+func isExperimentRelayPath(path string) bool {
+	switch relayconstant.Path2RelayMode(path) {
+	case relayconstant.RelayModeChatCompletions, relayconstant.RelayModeCompletions,
+		relayconstant.RelayModeResponses, relayconstant.RelayModeGemini:
+		return true
+	}
+	return strings.HasPrefix(path, "/v1/messages") && !strings.HasPrefix(path, "/v1/messages/count_tokens")
+}
+
+// experimentStickyValue 返回分桶依据，end_user 模式下请求未携带终端用户时退回到令牌
+func experimentStickyValue(c *gin.Context, stickyBy string) string {
+	switch stickyBy {
+	case model.ExperimentStickyByUser:
+		if userId := common.GetContextKeyInt(c, constant.ContextKeyUserId); userId > 0 {
+			return "user:" + strconv.Itoa(userId)
+		}
+		return ""
+	case model.ExperimentStickyByEndUser:
+		if endUserId := common.GetContextKeyString(c, constant.ContextKeyEndUserId); endUserId != "" {
+			return "end_user:" + endUserId
+		}
+	}
+	if tokenId := common.GetContextKeyInt(c, constant.ContextKeyTokenId); tokenId > 0 {
+		return "token:" + strconv.Itoa(tokenId)
+	}
+	return ""
+}
+
+// experimentBucket 将粘性键哈希到 [0, 100)，同一实验内同一键始终落在同一桶
+func experimentBucket(experimentId int, stickyValue string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(strconv.Itoa(experimentId) + ":" + stickyValue))
+	return int(h.Sum32() % 100)
+}
+
+// pickExperimentArm 按累计权重选择实验组，未命中任何实验组时返回 nil（对照组）
+func pickExperimentArm(arms []model.ExperimentArm, bucket int) *model.ExperimentArm {
+	cumulative := 0
+	for i := range arms {
+		cumulative += arms[i].Weight
+		if bucket < cumulative {
+			return &arms[i]
+		}
+	}
+	return nil
+}
+
+// AssignExperiment 为请求分配实验组并写入上下文；返回实验组配置，对照组或未命中实验时返回 nil
+func AssignExperiment(c *gin.Context, modelName string, group string) *model.ExperimentArm {
+	if c.Request == nil || c.Request.URL == nil || !isExperimentRelayPath(c.Request.URL.Path) {
+		return nil
+	}
+	for _, running := range getRunningExperiments() {
+		if running.experiment.Model != modelName {
+			continue
+		}
+		if running.groups != nil && !running.groups[group] {
+			continue
+		}
+		stickyValue := experimentStickyValue(c, running.experiment.StickyBy)
+		if stickyValue == "" {
+			continue
+		}
+		assignment := &model.ExperimentAssignment{
+			ExperimentId: running.experiment.Id,
+			Arm:          model.ExperimentControlArm,
+			OriginModel:  modelName,
+		}
+		arm := pickExperimentArm(running.arms, experimentBucket(running.experiment.Id, stickyValue))
+		if arm != nil {
+			assignment.Arm = arm.Name
+		}
+		common.SetContextKey(c, constant.ContextKeyExperiment, assignment)
+		return arm
+	}
+	return nil
+}
+
+// ClearExperimentAssignment 实验组无法提供服务时取消分配，请求按原模型处理且不计入实验
+func ClearExperimentAssignment(c *gin.Context) {
+	common.SetContextKey(c, constant.ContextKeyExperiment, (*model.ExperimentAssignment)(nil))
+}
+
+func getExperimentAssignment(c *gin.Context) *model.ExperimentAssignment {
+	assignment, ok := common.GetContextKeyType[*model.ExperimentAssignment](c, constant.ContextKeyExperiment)
+	if !ok {
+		return nil
+	}
+	return assignment
+}
+
+// RecordExperimentResult 请求结束时异步记录实验结果，花费与用量来自消费日志写入时的累计值；
+// 实验结果与消费日志同写 LOG_DB，未启用消费日志时不记录
+func RecordExperimentResult(c *gin.Context, apiErr *types.NewAPIError) {
+	assignment := getExperimentAssignment(c)
+	if assignment == nil || !common.LogConsumeEnabled {
+		return
+	}
+	var latencyMs int64
+	if startTime := common.GetContextKeyTime(c, constant.ContextKeyRequestStartTime); !startTime.IsZero() {
+		latencyMs = time.Since(startTime).Milliseconds()
+	}
+	result := &model.ExperimentResult{
+		ExperimentId:     assignment.ExperimentId,
+		Arm:              assignment.Arm,
+		RequestId:        c.GetString(common.RequestIdKey),
+		UserId:           common.GetContextKeyInt(c, constant.ContextKeyUserId),
+		TokenId:          common.GetContextKeyInt(c, constant.ContextKeyTokenId),
+		EndUserId:        common.GetContextKeyString(c, constant.ContextKeyEndUserId),
+		ModelName:        c.GetString("original_model"),
+		ChannelId:        common.GetContextKeyInt(c, constant.ContextKeyChannelId),
+		Success:          apiErr == nil,
+		LatencyMs:        latencyMs,
+		IsStream:         assignment.IsStream,
+		FirstTokenMs:     assignment.FirstTokenMs,
+		Quota:            assignment.Quota,
+		PromptTokens:     assignment.PromptTokens,
+		CompletionTokens: assignment.CompletionTokens,
+	}
+	gopool.Go(func() {
+		if err := model.InsertExperimentResult(result); err != nil {
+			common.SysLog(fmt.Sprintf("failed to record experiment result (request_id=%s): %s", result.RequestId, err.Error()))
+		}
+	})
+}
+
+// ValidateExperimentFeedbackScore 反馈评分必须是有限数值
+func ValidateExperimentFeedbackScore(score float64) error {
+	if math.IsNaN(score) || math.IsInf(score, 0) {
+		return errors.New("invalid feedback score")
+	}
+	return nil
+}
+
+// AppendExperimentInfo 将实验与实验组写入日志 other.experiment
+func AppendExperimentInfo(c *gin.Context, other map[string]interface{}) {
+	assignment := getExperimentAssignment(c)
+	if assignment == nil {
+		return
+	}
+	other["experiment"] = assignment
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupExperiments(t *testing.T) {
+	t.Helper()
+	require.NoError(t, model.DB.AutoMigrate(&model.Experiment{}))
+	require.NoError(t, model.LOG_DB.AutoMigrate(&model.ExperimentResult{}))
+	InvalidateExperimentCache()
+	t.Cleanup(func() {
+		model.DB.Exec("DELETE FROM experiments")
+		model.LOG_DB.Exec("DELETE FROM experiment_results")
+		InvalidateExperimentCache()
+	})
+}
+
+func newExperimentContext(path string, userId int, tokenId int, requestId string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, path, nil)
+	c.Set(common.RequestIdKey, requestId)
+	common.SetContextKey(c, constant.ContextKeyUserId, userId)
+	common.SetContextKey(c, constant.ContextKeyTokenId, tokenId)
+	return c
+}
+
+func TestValidateExperiment(t *testing.T) {
+	valid := &model.Experiment{Name: "sonnet-trial", Model: "gpt-5", Arms: `[{"name":"sonnet","weight":10,"model":"claude-sonnet"}]`}
+	require.NoError(t, ValidateExperiment(valid))
+	assert.Equal(t, model.ExperimentStatusRunning, valid.Status)
+	assert.Equal(t, model.ExperimentStickyByToken, valid.StickyBy)
+
+	invalidArms := []string{
+		`[]`,
+		`[{"name":"control","weight":10,"model":"a"}]`,
+		`[{"name":"a","weight":0,"model":"a"}]`,
+		`[{"name":"a","weight":10}]`,
+		`[{"name":"a","weight":60,"model":"a"},{"name":"b","weight":50,"channel_id":3}]`,
+		`[{"name":"a","weight":10,"model":"a"},{"name":"a","weight":10,"model":"b"}]`,
+	}
+	for _, arms := range invalidArms {
+		assert.Error(t, ValidateExperiment(&model.Experiment{Name: "x", Model: "gpt-5", Arms: arms}), arms)
+	}
+	assert.Error(t, ValidateExperiment(&model.Experiment{Name: "x", Model: "gpt-5", StickyBy: "ip", Arms: `[{"name":"a","weight":10,"model":"a"}]`}))
+}
+
+func TestAssignExperimentSticky(t *testing.T) {
+	setupExperiments(t)
+	experiment := &model.Experiment{Name: "sonnet-trial", Model: "gpt-5", Groups: "vip", Arms: `[{"name":"sonnet","weight":30,"model":"claude-sonnet"}]`}
+	require.NoError(t, ValidateExperiment(experiment))
+	require.NoError(t, experiment.Insert())
+
+	// 同一令牌总是分到同一组，整体比例接近权重
+	treated := 0
+	for tokenId := 1; tokenId <= 1000; tokenId++ {
+		c := newExperimentContext("/v1/chat/completions", 1, tokenId, "")
+		arm := AssignExperiment(c, "gpt-5", "vip")
+		again := AssignExperiment(newExperimentContext("/v1/chat/completions", 1, tokenId, ""), "gpt-5", "vip")
+		assert.Equal(t, arm, again)
+		assignment := getExperimentAssignment(c)
+		require.NotNil(t, assignment)
+		if arm != nil {
+			treated++
+			assert.Equal(t, "sonnet", assignment.Arm)
+			assert.Equal(t, "claude-sonnet", arm.Model)
+		} else {
+			assert.Equal(t, model.ExperimentControlArm, assignment.Arm)
+		}
+	}
+	assert.InDelta(t, 300, treated, 60)
+
+	// 其他分组、其他模型与 token 计数请求不参与实验
+	c := newExperimentContext("/v1/chat/completions", 1, 1, "")
+	assert.Nil(t, AssignExperiment(c, "gpt-5", "default"))
+	assert.Nil(t, getExperimentAssignment(c))
+	assert.Nil(t, AssignExperiment(c, "gpt-4o", "vip"))
+	c = newExperimentContext("/v1/messages/count_tokens", 1, 1, "")
+	AssignExperiment(c, "gpt-5", "vip")
+	assert.Nil(t, getExperimentAssignment(c))
+}
+
+func TestExperimentReportAndFeedback(t *testing.T) {
+	setupExperiments(t)
+	logConsumeEnabled := common.LogConsumeEnabled
+	common.LogConsumeEnabled = true
+	t.Cleanup(func() { common.LogConsumeEnabled = logConsumeEnabled })
+	record := func(requestId string, arm string, quota int, params model.RecordConsumeLogParams, apiErr *types.NewAPIError) {
+		c := newExperimentContext("/v1/chat/completions", 7, 1, requestId)
+		common.SetContextKey(c, constant.ContextKeyRequestStartTime, time.Now().Add(-200*time.Millisecond))
+		common.SetContextKey(c, constant.ContextKeyExperiment, &model.ExperimentAssignment{ExperimentId: 1, Arm: arm, OriginModel: "gpt-5"})
+		params.Quota, params.PromptTokens, params.CompletionTokens = quota, 10, 5
+		model.RecordConsumeLog(c, 7, params)
+		RecordExperimentResult(c, apiErr)
+	}
+	record("req-1", "control", 100, model.RecordConsumeLogParams{}, nil)
+	record("req-2", "control", 300, model.RecordConsumeLogParams{}, nil)
+	record("req-3", "sonnet", 50, model.RecordConsumeLogParams{IsStream: true, Other: map[string]interface{}{"frt": float64(120)}}, nil)
+	record("req-4", "sonnet", 0, model.RecordConsumeLogParams{}, types.NewError(errors.New("upstream error"), types.ErrorCodeBadResponse))
+	require.Eventually(t, func() bool {
+		var count int64
+		model.LOG_DB.Model(&model.ExperimentResult{}).Count(&count)
+		return count == 4
+	}, 2*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, model.UpdateExperimentFeedback("req-1", 7, 4))
+	require.NoError(t, model.UpdateExperimentFeedback("req-3", 7, 2))
+	assert.ErrorIs(t, model.UpdateExperimentFeedback("req-3", 8, 5), model.ErrExperimentNotFound)
+	assert.Error(t, ValidateExperimentFeedbackScore(math.NaN()))
+
+	reports, err := model.GetExperimentReport(1, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, reports, 2)
+	control, sonnet := reports[0], reports[1]
+	assert.Equal(t, "control", control.Arm)
+	assert.EqualValues(t, 2, control.Requests)
+	assert.EqualValues(t, 0, control.Errors)
+	assert.EqualValues(t, 400, control.TotalQuota)
+	assert.InDelta(t, 200, control.AvgQuota, 0.001)
+	assert.EqualValues(t, 20, control.PromptTokens)
+	assert.EqualValues(t, 1, control.FeedbackCount)
+	require.NotNil(t, control.AvgFeedbackScore)
+	assert.InDelta(t, 4, *control.AvgFeedbackScore, 0.001)
+	assert.GreaterOrEqual(t, control.AvgLatencyMs, float64(200))
+
+	assert.Equal(t, "sonnet", sonnet.Arm)
+	assert.EqualValues(t, 1, sonnet.Errors)
+	assert.InDelta(t, 0.5, sonnet.ErrorRate, 0.001)
+	assert.Nil(t, control.AvgFirstTokenMs)
+	assert.EqualValues(t, 1, sonnet.StreamRequests)
+	require.NotNil(t, sonnet.AvgFirstTokenMs)
+	assert.InDelta(t, 120, *sonnet.AvgFirstTokenMs, 0.001)
+}
+
+func TestRecordExperimentResultRespectsLogSetting(t *testing.T) {
+	setupExperiments(t)
+	logConsumeEnabled := common.LogConsumeEnabled
+	common.LogConsumeEnabled = false
+	t.Cleanup(func() { common.LogConsumeEnabled = logConsumeEnabled })
+
+	c := newExperimentContext("/v1/chat/completions", 7, 1, "req-disabled")
+	common.SetContextKey(c, constant.ContextKeyExperiment, &model.ExperimentAssignment{ExperimentId: 1, Arm: "control", OriginModel: "gpt-5"})
+	RecordExperimentResult(c, nil)
+	time.Sleep(50 * time.Millisecond)
+
+	var count int64
+	require.NoError(t, model.LOG_DB.Model(&model.ExperimentResult{}).Count(&count).Error)
+	assert.Zero(t, count)
+}
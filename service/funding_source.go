@@ -1,9 +1,13 @@
 package service
 
 import (
+	"fmt"
 	"time"
 
+	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
+
+	"github.com/bytedance/gopkg/util/gopool"
 )
 
 // ---------------------------------------------------------------------------
@@ -63,6 +67,20 @@ func (w *WalletFunding) Refund() error {
 	return model.IncreaseUserQuota(w.userId, w.consumed, false)
 }
 
+// drawQuotaBuckets 钱包实际消费后异步从用户的限时额度中扣减，优先消耗最早到期的额度。
+// 仅在最终结算时调用，quota 为本次请求的实际总消耗（而非相对预扣的差额）；预扣与退款不影响限时额度。
+// BillingSession.Settle 与 PostConsumeQuota 两条结算路径均遵循此规则。
+func drawQuotaBuckets(userId int, quota int) {
+	if quota <= 0 {
+		return
+	}
+	gopool.Go(func() {
+		if _, err := model.ConsumeQuotaBuckets(userId, int64(quota)); err != nil {
+			common.SysLog(fmt.Sprintf("failed to consume quota buckets: user_id=%d, quota=%d, error=%v", userId, quota, err))
+		}
+	})
+}
+
 // ---------------------------------------------------------------------------
 // SubscriptionFunding — 订阅资金来源实现
 // ---------------------------------------------------------------------------
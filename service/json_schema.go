@@ -0,0 +1,526 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// JSON Schema 校验：覆盖结构化输出常用的关键字（type、enum、const、properties、required、additionalProperties、
+// items、prefixItems、长度与数值范围、pattern、allOf/anyOf/oneOf/not 以及文档内 $ref），未知关键字忽略
+
+const (
+	jsonSchemaMaxErrors = 10
+	// jsonSchemaMaxSteps 单次校验最多访问的 (子 schema, 值) 组合数，防止组合关键字导致的指数级展开
+	jsonSchemaMaxSteps = 100000
+)
+
+// JSONSchemaValidator 已解析的 JSON Schema，pattern 在解析时预先编译
+type JSONSchemaValidator struct {
+	root     any
+	patterns map[string]*regexp.Regexp
+}
+
+// NewJSONSchemaValidator 解析 JSON Schema，schema 可以是原始 JSON 或已解码的对象
+func NewJSONSchemaValidator(schema any) (*JSONSchemaValidator, error) {
+	var root any
+	switch v := schema.(type) {
+	case []byte:
+		if err := common.Unmarshal(v, &root); err != nil {
+			return nil, fmt.Errorf("invalid json schema: %w", err)
+		}
+	case string:
+		if err := common.UnmarshalJsonStr(v, &root); err != nil {
+			return nil, fmt.Errorf("invalid json schema: %w", err)
+		}
+	default:
+		data, err := common.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid json schema: %w", err)
+		}
+		if err := common.Unmarshal(data, &root); err != nil {
+			return nil, fmt.Errorf("invalid json schema: %w", err)
+		}
+	}
+	switch root.(type) {
+	case map[string]any, bool:
+	default:
+		return nil, fmt.Errorf("invalid json schema: expected object")
+	}
+	validator := &JSONSchemaValidator{root: root, patterns: map[string]*regexp.Regexp{}}
+	if err := validator.compile(); err != nil {
+		return nil, fmt.Errorf("invalid json schema: %w", err)
+	}
+	return validator, nil
+}
+
+// Validate 校验已解码的 JSON 值，返回不超过 jsonSchemaMaxErrors 条错误，路径使用 JSON Pointer 表示
+func (v *JSONSchemaValidator) Validate(value any) []string {
+	ctx := &jsonSchemaValidation{root: v.root, patterns: v.patterns, budget: &jsonSchemaBudget{}}
+	ctx.validate(v.root, value, "", 0)
+	if ctx.budget.exhausted {
+		return []string{"/: schema is too complex to validate"}
+	}
+	return ctx.errors
+}
+
+type jsonSchemaNode struct {
+	path   string
+	schema any
+}
+
+// compile 遍历 schema：预编译 pattern，检查 $ref 能否解析，并拒绝不消耗输入的 $ref 循环
+// （如 {"allOf":[{"$ref":"#"}]}，校验时会在同一个值上无限展开）。
+// allOf/anyOf/oneOf/not/$ref 作用于同一个值，沿这些边出现环即为循环；properties/items 等进入子值，不构成循环
+func (v *JSONSchemaValidator) compile() error {
+	ctx := &jsonSchemaValidation{root: v.root}
+	state := map[string]int{} // 1: 正在同值展开的路径上；2: 已检查
+	queue := []jsonSchemaNode{{path: "", schema: v.root}}
+	var visit func(path string, schema any) error
+	visit = func(path string, schema any) error {
+		switch state[path] {
+		case 1:
+			return fmt.Errorf("$ref cycle at %q does not consume input", "#"+path)
+		case 2:
+			return nil
+		}
+		object, ok := schema.(map[string]any)
+		if !ok {
+			state[path] = 2
+			return nil
+		}
+		state[path] = 1
+		if pattern, ok := object["pattern"].(string); ok {
+			if _, compiled := v.patterns[pattern]; !compiled {
+				// Go 不支持的正则语法（如先行断言）不做校验
+				re, _ := regexp.Compile(pattern)
+				v.patterns[pattern] = re
+			}
+		}
+		if ref, ok := object["$ref"].(string); ok {
+			target, err := ctx.resolveRef(ref)
+			if err != nil {
+				return err
+			}
+			if err := visit(strings.TrimPrefix(ref, "#"), target); err != nil {
+				return err
+			}
+		}
+		for _, keyword := range []string{"allOf", "anyOf", "oneOf"} {
+			subs, _ := object[keyword].([]any)
+			for i, sub := range subs {
+				if err := visit(path+"/"+keyword+"/"+strconv.Itoa(i), sub); err != nil {
+					return err
+				}
+			}
+		}
+		if not, ok := object["not"]; ok {
+			if err := visit(path+"/not", not); err != nil {
+				return err
+			}
+		}
+		state[path] = 2
+
+		properties, _ := object["properties"].(map[string]any)
+		for key, sub := range properties {
+			queue = append(queue, jsonSchemaNode{path: path + "/properties/" + jsonPointerEscape(key), schema: sub})
+		}
+		if additional, ok := object["additionalProperties"].(map[string]any); ok {
+			queue = append(queue, jsonSchemaNode{path: path + "/additionalProperties", schema: additional})
+		}
+		for _, keyword := range []string{"prefixItems", "items"} {
+			switch items := object[keyword].(type) {
+			case []any:
+				for i, sub := range items {
+					queue = append(queue, jsonSchemaNode{path: path + "/" + keyword + "/" + strconv.Itoa(i), schema: sub})
+				}
+			case map[string]any:
+				queue = append(queue, jsonSchemaNode{path: path + "/" + keyword, schema: items})
+			}
+		}
+		return nil
+	}
+	for len(queue) > 0 {
+		node := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		if err := visit(node.path, node.schema); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type jsonSchemaValidation struct {
+	root     any
+	patterns map[string]*regexp.Regexp
+	budget   *jsonSchemaBudget
+	errors   []string
+}
+
+// jsonSchemaBudget 同一次校验（含 anyOf/oneOf/not 的试探）共享的步数预算
+type jsonSchemaBudget struct {
+	steps     int
+	exhausted bool
+}
+
+const jsonSchemaMaxDepth = 64
+
+func (ctx *jsonSchemaValidation) addError(path string, format string, args ...any) {
+	if len(ctx.errors) >= jsonSchemaMaxErrors {
+		return
+	}
+	if path == "" {
+		path = "/"
+	}
+	ctx.errors = append(ctx.errors, path+": "+fmt.Sprintf(format, args...))
+}
+
+// probe 在不记录错误的情况下判断值是否符合子 schema，用于 anyOf/oneOf/not
+func (ctx *jsonSchemaValidation) probe(schema any, value any, depth int) bool {
+	sub := &jsonSchemaValidation{root: ctx.root, patterns: ctx.patterns, budget: ctx.budget}
+	sub.validate(schema, value, "", depth)
+	return len(sub.errors) == 0
+}
+
+func (ctx *jsonSchemaValidation) validate(schema any, value any, path string, depth int) {
+	if ctx.budget.exhausted {
+		ctx.addError(path, "schema is too complex to validate")
+		return
+	}
+	if ctx.budget.steps++; ctx.budget.steps > jsonSchemaMaxSteps {
+		ctx.budget.exhausted = true
+		ctx.addError(path, "schema is too complex to validate")
+		return
+	}
+	if depth > jsonSchemaMaxDepth {
+		ctx.addError(path, "schema is nested too deeply")
+		return
+	}
+	switch s := schema.(type) {
+	case bool:
+		if !s {
+			ctx.addError(path, "value is not allowed")
+		}
+		return
+	case map[string]any:
+		ctx.validateObjectSchema(s, value, path, depth)
+	}
+}
+
+func (ctx *jsonSchemaValidation) validateObjectSchema(schema map[string]any, value any, path string, depth int) {
+	if ref, ok := schema["$ref"].(string); ok {
+		target, err := ctx.resolveRef(ref)
+		if err != nil {
+			ctx.addError(path, "%s", err.Error())
+			return
+		}
+		ctx.validate(target, value, path, depth+1)
+	}
+
+	if types, ok := jsonSchemaTypes(schema["type"]); ok {
+		matched := false
+		for _, t := range types {
+			if jsonValueHasType(value, t) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			ctx.addError(path, "expected %s, got %s", strings.Join(types, " or "), jsonValueTypeName(value))
+			return
+		}
+	}
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, candidate := range enum {
+			if jsonValuesEqual(candidate, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			ctx.addError(path, "value must be one of %s", jsonSchemaCompact(enum))
+		}
+	}
+	if constant, ok := schema["const"]; ok && !jsonValuesEqual(constant, value) {
+		ctx.addError(path, "value must be %s", jsonSchemaCompact(constant))
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		ctx.validateObject(schema, v, path, depth)
+	case []any:
+		ctx.validateArray(schema, v, path, depth)
+	case string:
+		ctx.validateString(schema, v, path)
+	case float64:
+		ctx.validateNumber(schema, v, path)
+	}
+
+	if allOf, ok := schema["allOf"].([]any); ok {
+		for _, sub := range allOf {
+			ctx.validate(sub, value, path, depth+1)
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]any); ok {
+		matched := false
+		for _, sub := range anyOf {
+			if ctx.probe(sub, value, depth+1) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			ctx.addError(path, "value does not match any schema in anyOf")
+		}
+	}
+	if oneOf, ok := schema["oneOf"].([]any); ok {
+		count := 0
+		for _, sub := range oneOf {
+			if ctx.probe(sub, value, depth+1) {
+				count++
+			}
+		}
+		if count != 1 {
+			ctx.addError(path, "value must match exactly one schema in oneOf, matched %d", count)
+		}
+	}
+	if not, ok := schema["not"]; ok && ctx.probe(not, value, depth+1) {
+		ctx.addError(path, "value must not match schema in not")
+	}
+}
+
+func (ctx *jsonSchemaValidation) validateObject(schema map[string]any, value map[string]any, path string, depth int) {
+	if required, ok := schema["required"].([]any); ok {
+		for _, name := range required {
+			key, _ := name.(string)
+			if _, exists := value[key]; !exists {
+				ctx.addError(path, "missing required property %q", key)
+			}
+		}
+	}
+	if count, ok := jsonSchemaInt(schema["minProperties"]); ok && len(value) < count {
+		ctx.addError(path, "expected at least %d properties", count)
+	}
+	if count, ok := jsonSchemaInt(schema["maxProperties"]); ok && len(value) > count {
+		ctx.addError(path, "expected at most %d properties", count)
+	}
+
+	properties, _ := schema["properties"].(map[string]any)
+	additional, hasAdditional := schema["additionalProperties"]
+	keys := make([]string, 0, len(value))
+	for key := range value {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		childPath := path + "/" + jsonPointerEscape(key)
+		if propertySchema, ok := properties[key]; ok {
+			ctx.validate(propertySchema, value[key], childPath, depth+1)
+			continue
+		}
+		if !hasAdditional {
+			continue
+		}
+		if allowed, ok := additional.(bool); ok {
+			if !allowed {
+				ctx.addError(path, "unexpected property %q", key)
+			}
+			continue
+		}
+		ctx.validate(additional, value[key], childPath, depth+1)
+	}
+}
+
+func (ctx *jsonSchemaValidation) validateArray(schema map[string]any, value []any, path string, depth int) {
+	if count, ok := jsonSchemaInt(schema["minItems"]); ok && len(value) < count {
+		ctx.addError(path, "expected at least %d items, got %d", count, len(value))
+	}
+	if count, ok := jsonSchemaInt(schema["maxItems"]); ok && len(value) > count {
+		ctx.addError(path, "expected at most %d items, got %d", count, len(value))
+	}
+	if unique, _ := schema["uniqueItems"].(bool); unique {
+		for i := 1; i < len(value); i++ {
+			for j := 0; j < i; j++ {
+				if jsonValuesEqual(value[i], value[j]) {
+					ctx.addError(path, "items %d and %d are equal", j, i)
+				}
+			}
+		}
+	}
+
+	start := 0
+	if prefixItems, ok := schema["prefixItems"].([]any); ok {
+		for i := 0; i < len(prefixItems) && i < len(value); i++ {
+			ctx.validate(prefixItems[i], value[i], path+"/"+strconv.Itoa(i), depth+1)
+		}
+		start = len(prefixItems)
+	}
+	items, ok := schema["items"]
+	if !ok {
+		return
+	}
+	// 旧版元组写法：items 为数组
+	if tuple, isTuple := items.([]any); isTuple {
+		for i := 0; i < len(tuple) && i < len(value); i++ {
+			ctx.validate(tuple[i], value[i], path+"/"+strconv.Itoa(i), depth+1)
+		}
+		return
+	}
+	for i := start; i < len(value); i++ {
+		ctx.validate(items, value[i], path+"/"+strconv.Itoa(i), depth+1)
+	}
+}
+
+func (ctx *jsonSchemaValidation) validateString(schema map[string]any, value string, path string) {
+	length := utf8.RuneCountInString(value)
+	if count, ok := jsonSchemaInt(schema["minLength"]); ok && length < count {
+		ctx.addError(path, "expected at least %d characters", count)
+	}
+	if count, ok := jsonSchemaInt(schema["maxLength"]); ok && length > count {
+		ctx.addError(path, "expected at most %d characters", count)
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		if re := ctx.patterns[pattern]; re != nil && !re.MatchString(value) {
+			ctx.addError(path, "value does not match pattern %q", pattern)
+		}
+	}
+}
+
+func (ctx *jsonSchemaValidation) validateNumber(schema map[string]any, value float64, path string) {
+	if limit, ok := schema["minimum"].(float64); ok && value < limit {
+		ctx.addError(path, "value must be >= %v", limit)
+	}
+	if limit, ok := schema["maximum"].(float64); ok && value > limit {
+		ctx.addError(path, "value must be <= %v", limit)
+	}
+	if limit, ok := schema["exclusiveMinimum"].(float64); ok && value <= limit {
+		ctx.addError(path, "value must be > %v", limit)
+	}
+	if limit, ok := schema["exclusiveMaximum"].(float64); ok && value >= limit {
+		ctx.addError(path, "value must be < %v", limit)
+	}
+	if divisor, ok := schema["multipleOf"].(float64); ok && divisor > 0 {
+		quotient := value / divisor
+		if math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+			ctx.addError(path, "value must be a multiple of %v", divisor)
+		}
+	}
+}
+
+// resolveRef 解析文档内引用，如 #/$defs/Item、#/definitions/Item
+func (ctx *jsonSchemaValidation) resolveRef(ref string) (any, error) {
+	if ref == "#" {
+		return ctx.root, nil
+	}
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("unsupported $ref %q", ref)
+	}
+	current := ctx.root
+	for _, token := range strings.Split(ref[2:], "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		object, ok := current.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+		if current, ok = object[token]; !ok {
+			return nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+	}
+	return current, nil
+}
+
+func jsonSchemaTypes(value any) ([]string, bool) {
+	switch t := value.(type) {
+	case string:
+		return []string{t}, true
+	case []any:
+		types := make([]string, 0, len(t))
+		for _, item := range t {
+			if name, ok := item.(string); ok {
+				types = append(types, name)
+			}
+		}
+		return types, len(types) > 0
+	}
+	return nil, false
+}
+
+func jsonValueHasType(value any, typeName string) bool {
+	switch typeName {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		number, ok := value.(float64)
+		return ok && number == math.Trunc(number)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	}
+	// 未知类型不做限制
+	return true
+}
+
+func jsonValueTypeName(value any) string {
+	switch v := value.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func jsonValuesEqual(a any, b any) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+func jsonSchemaInt(value any) (int, bool) {
+	number, ok := value.(float64)
+	if !ok || number < 0 {
+		return 0, false
+	}
+	return int(number), true
+}
+
+func jsonSchemaCompact(value any) string {
+	data, err := common.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+func jsonPointerEscape(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
@@ -55,6 +55,13 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 		other["is_model_mapped"] = true
 		other["upstream_model_name"] = relayInfo.UpstreamModelName
 	}
+	if common.GetContextKeyBool(ctx, constant.ContextKeyTokenPreviousKey) {
+		// 使用了轮换宽限期内的旧密钥
+		other["token_previous_key"] = true
+	}
+	if relayInfo.EphemeralTokenId != "" {
+		other["ephemeral_token"] = true
+	}
 
 	isSystemPromptOverwritten := common.GetContextKeyBool(ctx, constant.ContextKeySystemPromptOverride)
 	if isSystemPromptOverwritten {
@@ -75,12 +82,15 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 	}
 
 	AppendChannelAffinityAdminInfo(ctx, adminInfo)
+	AppendStructuredOutputAdminInfo(ctx, adminInfo)
 
 	other["admin_info"] = adminInfo
 	appendRequestPath(ctx, relayInfo, other)
 	appendRequestConversionChain(relayInfo, other)
 	appendBillingInfo(relayInfo, other)
 	appendParamOverrideInfo(relayInfo, other)
+	appendPromptTemplateInfo(ctx, other)
+	AppendExperimentInfo(ctx, other)
 	return other
 }
 
@@ -0,0 +1,752 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// MCP 网关：管理员以 MCP 渠道登记上游服务器（渠道名称即服务器标识），令牌通过 /mcp/:server 访问。
+// 网关按令牌白名单过滤工具、注入上游凭证，并记录、按次计费工具调用
+
+const (
+	mcpAllowlistWildcard = "*"
+	// McpModelPrefix 工具调用日志的模型名称前缀，临时令牌也以 mcp/<server> 限定可访问的服务器
+	McpModelPrefix = "mcp/"
+
+	mcpSSESessionIdleTimeout = 10 * time.Minute
+	mcpSSEResponseTimeout    = 10 * time.Minute
+	mcpSSEConnectTimeout     = 30 * time.Second
+)
+
+// mcpForwardRequestHeaders 转发给上游的 MCP 协议请求头
+var mcpForwardRequestHeaders = []string{"Accept", "Content-Type", "Mcp-Protocol-Version", "Last-Event-ID"}
+
+// McpAllowlist 令牌可访问的 MCP 服务器与工具，工具集合为 nil 表示该服务器的全部工具
+type McpAllowlist map[string]map[string]bool
+
+// ParseMcpAllowlist 解析令牌的 MCP 白名单，条目以逗号或换行分隔，形如 server、server/tool、server/* 或 *（全部服务器）
+func ParseMcpAllowlist(raw string) McpAllowlist {
+	allowlist := make(McpAllowlist)
+	entries := strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r'
+	})
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		server, tool, hasTool := strings.Cut(entry, "/")
+		server, tool = strings.TrimSpace(server), strings.TrimSpace(tool)
+		if server == "" {
+			continue
+		}
+		if !hasTool || tool == "" || tool == mcpAllowlistWildcard {
+			allowlist[server] = nil
+			continue
+		}
+		tools, exists := allowlist[server]
+		if exists && tools == nil {
+			// 已允许全部工具
+			continue
+		}
+		if tools == nil {
+			tools = make(map[string]bool)
+			allowlist[server] = tools
+		}
+		tools[tool] = true
+	}
+	return allowlist
+}
+
+func (a McpAllowlist) serverTools(server string) (map[string]bool, bool) {
+	if _, ok := a[mcpAllowlistWildcard]; ok {
+		return nil, true
+	}
+	tools, ok := a[server]
+	return tools, ok
+}
+
+// AllowServer 是否允许访问该服务器（至少一个工具）
+func (a McpAllowlist) AllowServer(server string) bool {
+	_, ok := a.serverTools(server)
+	return ok
+}
+
+// AllowTool 是否允许调用该服务器上的工具
+func (a McpAllowlist) AllowTool(server string, tool string) bool {
+	tools, ok := a.serverTools(server)
+	return ok && (tools == nil || tools[tool])
+}
+
+// AllowedTools 返回该服务器上允许调用的工具（已排序），all 为 true 表示不限制工具
+func (a McpAllowlist) AllowedTools(server string) (tools []string, all bool) {
+	allowed, ok := a.serverTools(server)
+	if !ok {
+		return nil, false
+	}
+	if allowed == nil {
+		return nil, true
+	}
+	for tool := range allowed {
+		tools = append(tools, tool)
+	}
+	sort.Strings(tools)
+	return tools, false
+}
+
+// McpServer 已登记的 MCP 上游服务器
+type McpServer struct {
+	Label     string
+	ChannelId int
+	URL       string
+	Transport dto.McpTransport
+	CallPrice float64
+	Proxy     string
+	Headers   map[string]string
+}
+
+// GetMcpServer 按服务器标识加载启用的 MCP 渠道，并准备访问上游所需的认证头
+func GetMcpServer(label string) (*McpServer, error) {
+	channel, err := model.GetEnabledMcpChannel(label)
+	if err != nil {
+		return nil, err
+	}
+	key, _, newAPIError := channel.GetNextEnabledKey()
+	if newAPIError != nil {
+		return nil, newAPIError
+	}
+	otherSettings := channel.GetOtherSettings()
+	server := &McpServer{
+		Label:     label,
+		ChannelId: channel.Id,
+		URL:       channel.GetBaseURL(),
+		Transport: otherSettings.McpTransport,
+		CallPrice: otherSettings.McpCallPrice,
+		Proxy:     channel.GetSetting().Proxy,
+		Headers:   make(map[string]string),
+	}
+	if server.Transport == "" {
+		server.Transport = dto.McpTransportStreamableHTTP
+	}
+	if key != "" {
+		server.Headers["Authorization"] = "Bearer " + key
+	}
+	// 请求头覆盖可用于 Authorization 以外的认证方式，{api_key} 替换为渠道密钥
+	for name, value := range channel.GetHeaderOverride() {
+		str, ok := value.(string)
+		if !ok {
+			continue
+		}
+		server.Headers[name] = strings.ReplaceAll(str, "{api_key}", key)
+	}
+	return server, nil
+}
+
+// httpClient MCP 连接可能长时间保持（SSE），不使用中继超时
+func (s *McpServer) httpClient() (*http.Client, error) {
+	client, err := GetHttpClientWithProxy(s.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	noTimeout := *client
+	noTimeout.Timeout = 0
+	return &noTimeout, nil
+}
+
+func (s *McpServer) newRequest(ctx context.Context, method string, targetURL string, body []byte) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = strings.NewReader(string(body))
+	}
+	req, err := http.NewRequestWithContext(ctx, method, targetURL, reader)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range s.Headers {
+		req.Header.Set(name, value)
+	}
+	return req, nil
+}
+
+// mcpSessionSignature 网关下发的会话 ID 绑定令牌与服务器，防止其他令牌冒用上游会话
+func mcpSessionSignature(server string, tokenId int, sessionId string) string {
+	return common.GenerateHMAC(fmt.Sprintf("mcp_session:%s:%d:%s", server, tokenId, sessionId))[:32]
+}
+
+// WrapMcpSessionId 将上游会话 ID 包装为绑定令牌的网关会话 ID
+func WrapMcpSessionId(server string, tokenId int, upstreamId string) string {
+	if upstreamId == "" {
+		return ""
+	}
+	return upstreamId + "." + mcpSessionSignature(server, tokenId, upstreamId)
+}
+
+// UnwrapMcpSessionId 校验网关会话 ID 并还原上游会话 ID
+func UnwrapMcpSessionId(server string, tokenId int, sessionId string) (string, bool) {
+	dot := strings.LastIndex(sessionId, ".")
+	if dot <= 0 {
+		return "", false
+	}
+	upstreamId, signature := sessionId[:dot], sessionId[dot+1:]
+	if !hmac.Equal([]byte(signature), []byte(mcpSessionSignature(server, tokenId, upstreamId))) {
+		return "", false
+	}
+	return upstreamId, true
+}
+
+// DoMcpStreamableRequest 以 streamable HTTP 传输转发客户端请求，响应由调用方负责关闭
+func DoMcpStreamableRequest(ctx context.Context, server *McpServer, method string, body []byte, header http.Header, upstreamSessionId string) (*http.Response, error) {
+	req, err := server.newRequest(ctx, method, server.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range mcpForwardRequestHeaders {
+		if value := header.Get(name); value != "" {
+			req.Header.Set(name, value)
+		}
+	}
+	if upstreamSessionId != "" {
+		req.Header.Set("Mcp-Session-Id", upstreamSessionId)
+	}
+	client, err := server.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
+// McpSSESession 旧版 HTTP+SSE 传输的上游会话：网关保持 SSE 连接，
+// 客户端仍以 streamable HTTP 方式访问，网关将上游在 SSE 上推送的响应与请求配对后同步返回。
+// 会话保存在本节点内存中，多节点部署时需要会话保持
+type McpSSESession struct {
+	id       string
+	server   string
+	tokenId  int
+	endpoint string
+	upstream *McpServer
+	client   *http.Client
+	cancel   context.CancelFunc
+
+	mu      sync.Mutex
+	pending map[string]chan []byte
+
+	lastUsed  atomic.Int64
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+var mcpSSESessions sync.Map // session id -> *McpSSESession
+
+// OpenMcpSSESession 建立到上游的 SSE 连接并等待服务器下发消息端点
+func OpenMcpSSESession(ctx context.Context, server *McpServer, tokenId int) (*McpSSESession, error) {
+	sweepMcpSSESessions()
+
+	client, err := server.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	// SSE 连接需要在本次请求结束后继续保持
+	sessionCtx, cancel := context.WithCancel(context.Background())
+	connectTimer := time.AfterFunc(mcpSSEConnectTimeout, cancel)
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+
+	req, err := server.newRequest(sessionCtx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		CloseResponseBodyGracefully(resp)
+		cancel()
+		return nil, fmt.Errorf("mcp server returned status %d for sse connection", resp.StatusCode)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	var endpoint string
+	for endpoint == "" {
+		event, data, err := readMcpSSEEvent(reader)
+		if err != nil {
+			_ = resp.Body.Close()
+			cancel()
+			return nil, fmt.Errorf("failed to read mcp endpoint event: %w", err)
+		}
+		if event == "endpoint" {
+			endpoint = strings.TrimSpace(data)
+		}
+	}
+	if !connectTimer.Stop() || ctx.Err() != nil {
+		_ = resp.Body.Close()
+		cancel()
+		return nil, errors.New("mcp sse connection timed out")
+	}
+	endpointURL, err := resolveMcpEndpoint(server.URL, endpoint)
+	if err != nil {
+		_ = resp.Body.Close()
+		cancel()
+		return nil, err
+	}
+
+	session := &McpSSESession{
+		id:       "sse-" + common.GetUUID(),
+		server:   server.Label,
+		tokenId:  tokenId,
+		endpoint: endpointURL,
+		upstream: server,
+		client:   client,
+		cancel:   cancel,
+		pending:  make(map[string]chan []byte),
+		closed:   make(chan struct{}),
+	}
+	session.touch()
+	mcpSSESessions.Store(session.id, session)
+	go session.readLoop(reader, resp.Body)
+	return session, nil
+}
+
+// resolveMcpEndpoint 消息端点可以是相对地址，但必须与服务器同源
+func resolveMcpEndpoint(baseURL string, endpoint string) (string, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid mcp endpoint %q: %w", endpoint, err)
+	}
+	resolved := base.ResolveReference(ref)
+	if resolved.Scheme != base.Scheme || resolved.Host != base.Host {
+		return "", fmt.Errorf("mcp endpoint %q is not on the server origin", endpoint)
+	}
+	return resolved.String(), nil
+}
+
+// GetMcpSSESession 查找属于该令牌与服务器的会话
+func GetMcpSSESession(sessionId string, server string, tokenId int) *McpSSESession {
+	value, ok := mcpSSESessions.Load(sessionId)
+	if !ok {
+		return nil
+	}
+	session := value.(*McpSSESession)
+	if session.server != server || session.tokenId != tokenId || session.isClosed() {
+		return nil
+	}
+	return session
+}
+
+func sweepMcpSSESessions() {
+	deadline := time.Now().Add(-mcpSSESessionIdleTimeout).Unix()
+	mcpSSESessions.Range(func(_, value any) bool {
+		session := value.(*McpSSESession)
+		if session.lastUsed.Load() < deadline {
+			session.Close()
+		}
+		return true
+	})
+}
+
+func (s *McpSSESession) Id() string {
+	return s.id
+}
+
+func (s *McpSSESession) touch() {
+	s.lastUsed.Store(time.Now().Unix())
+}
+
+func (s *McpSSESession) isClosed() bool {
+	select {
+	case <-s.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close 断开上游 SSE 连接并移除会话
+func (s *McpSSESession) Close() {
+	s.closeOnce.Do(func() {
+		mcpSSESessions.Delete(s.id)
+		s.cancel()
+		close(s.closed)
+	})
+}
+
+func (s *McpSSESession) readLoop(reader *bufio.Reader, body io.ReadCloser) {
+	defer func() {
+		_ = body.Close()
+		s.Close()
+	}()
+	for {
+		event, data, err := readMcpSSEEvent(reader)
+		if err != nil {
+			return
+		}
+		if event != "" && event != "message" {
+			continue
+		}
+		var message dto.McpJsonRpcMessage
+		if err := common.UnmarshalJsonStr(data, &message); err != nil || !message.IsResponse() {
+			// 不支持服务器主动发起的请求（sampling 等）与通知
+			continue
+		}
+		s.mu.Lock()
+		ch, ok := s.pending[mcpMessageIdKey(message.Id)]
+		s.mu.Unlock()
+		if ok {
+			select {
+			case ch <- []byte(data):
+			default:
+			}
+		}
+	}
+}
+
+func mcpMessageIdKey(id []byte) string {
+	return strings.TrimSpace(string(id))
+}
+
+// Send 将客户端消息投递到上游消息端点；调用请求会等待上游在 SSE 上返回的响应，通知返回 nil
+func (s *McpSSESession) Send(ctx context.Context, message *dto.McpJsonRpcMessage, body []byte) ([]byte, error) {
+	s.touch()
+	var ch chan []byte
+	if message.IsRequest() {
+		key := mcpMessageIdKey(message.Id)
+		ch = make(chan []byte, 1)
+		s.mu.Lock()
+		s.pending[key] = ch
+		s.mu.Unlock()
+		defer func() {
+			s.mu.Lock()
+			delete(s.pending, key)
+			s.mu.Unlock()
+		}()
+	}
+
+	req, err := s.upstream.newRequest(ctx, http.MethodPost, s.endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	CloseResponseBodyGracefully(resp)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("mcp server returned status %d", resp.StatusCode)
+	}
+	if ch == nil {
+		return nil, nil
+	}
+
+	timer := time.NewTimer(mcpSSEResponseTimeout)
+	defer timer.Stop()
+	select {
+	case data := <-ch:
+		s.touch()
+		return data, nil
+	case <-s.closed:
+		return nil, errors.New("mcp session closed by server")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C:
+		return nil, errors.New("timed out waiting for mcp server response")
+	}
+}
+
+// readMcpSSEEvent 读取一个 SSE 事件，返回事件类型与数据（多行 data 以换行连接）
+func readMcpSSEEvent(reader *bufio.Reader) (string, string, error) {
+	var event string
+	var dataLines []string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return "", "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			if event != "" || len(dataLines) > 0 {
+				return event, strings.Join(dataLines, "\n"), nil
+			}
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			dataLines = append(dataLines, value)
+		}
+	}
+}
+
+// RewriteMcpSSEStream 逐行转发上游 SSE 流，对每条 data 消息调用 rewrite，事件结束时刷新输出
+func RewriteMcpSSEStream(w io.Writer, flush func(), src io.Reader, rewrite func(data []byte) []byte) error {
+	reader := bufio.NewReader(src)
+	for {
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			content := strings.TrimRight(line, "\r\n")
+			if data, ok := strings.CutPrefix(content, "data:"); ok {
+				data = strings.TrimPrefix(data, " ")
+				line = "data: " + string(rewrite([]byte(data))) + line[len(content):]
+			}
+			if _, writeErr := io.WriteString(w, line); writeErr != nil {
+				return writeErr
+			}
+			if content == "" {
+				flush()
+			}
+		}
+		if err != nil {
+			flush()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// FilterMcpToolsListResponse 从 tools/list 响应中移除令牌无权调用的工具
+func FilterMcpToolsListResponse(message []byte, allow func(tool string) bool) []byte {
+	tools := gjson.GetBytes(message, "result.tools")
+	if !tools.IsArray() {
+		return message
+	}
+	kept := make([]string, 0)
+	for _, tool := range tools.Array() {
+		if allow(tool.Get("name").String()) {
+			kept = append(kept, tool.Raw)
+		}
+	}
+	filtered, err := sjson.SetRawBytes(message, "result.tools", []byte("["+strings.Join(kept, ",")+"]"))
+	if err != nil {
+		return message
+	}
+	return filtered
+}
+
+// mcpRelayInfo 工具调用计费复用中继的扣费逻辑（钱包、令牌、临时令牌与终端用户额度）
+func mcpRelayInfo(c *gin.Context, server *McpServer, tool string) *relaycommon.RelayInfo {
+	info := relaycommon.GenRelayInfoOpenAI(c, nil)
+	info.OriginModelName = McpModelPrefix + server.Label + "/" + tool
+	info.ChannelMeta = &relaycommon.ChannelMeta{ChannelId: server.ChannelId, ChannelType: constant.ChannelTypeMCP}
+	return info
+}
+
+// mcpGroupRatio 与模型计费一致：优先使用用户分组对令牌分组的特殊倍率
+func mcpGroupRatio(info *relaycommon.RelayInfo) float64 {
+	if ratio, ok := ratio_setting.GetGroupGroupRatio(info.UserGroup, info.UsingGroup); ok {
+		return ratio
+	}
+	return ratio_setting.GetGroupRatio(info.UsingGroup)
+}
+
+func mcpCallQuota(server *McpServer, groupRatio float64) int {
+	if server.CallPrice <= 0 {
+		return 0
+	}
+	return int(server.CallPrice * common.QuotaPerUnit * groupRatio)
+}
+
+// CheckMcpToolCallQuota 调用付费工具前检查用户、令牌与细分额度是否足够支付一次调用
+func CheckMcpToolCallQuota(c *gin.Context, server *McpServer, tool string) error {
+	info := mcpRelayInfo(c, server, tool)
+	quota := mcpCallQuota(server, mcpGroupRatio(info))
+	if quota <= 0 {
+		return nil
+	}
+	userQuota, availableCredit, err := model.GetUserQuotaWithCredit(info.UserId)
+	if err != nil {
+		return err
+	}
+	if userQuota+availableCredit < quota {
+		return fmt.Errorf("user quota is not enough, need quota: %s", logger.FormatQuota(quota))
+	}
+	if !info.TokenUnlimited && c.GetInt("token_quota") < quota {
+		return fmt.Errorf("token quota is not enough, need quota: %s", logger.FormatQuota(quota))
+	}
+	return checkScopedSpend(info, quota)
+}
+
+// SettleMcpToolCall 记录一次完成的工具调用并按渠道价格扣费，isError 为工具返回的执行失败标记
+func SettleMcpToolCall(c *gin.Context, server *McpServer, tool string, isError bool) {
+	info := mcpRelayInfo(c, server, tool)
+	groupRatio := mcpGroupRatio(info)
+	quota := mcpCallQuota(server, groupRatio)
+	if quota > 0 {
+		if err := PostConsumeQuota(info, quota, 0, true); err != nil {
+			common.SysLog("error consuming mcp tool call quota: " + err.Error())
+		}
+	}
+
+	other := map[string]interface{}{
+		"mcp_server":   server.Label,
+		"mcp_tool":     tool,
+		"mcp_is_error": isError,
+		"model_price":  server.CallPrice,
+		"group_ratio":  groupRatio,
+	}
+	if info.EphemeralTokenId != "" {
+		other["ephemeral_token"] = true
+	}
+	if info.EndUserId != "" {
+		other["end_user_id"] = info.EndUserId
+	}
+	model.RecordConsumeLog(c, info.UserId, model.RecordConsumeLogParams{
+		ChannelId:      server.ChannelId,
+		ModelName:      info.OriginModelName,
+		TokenName:      c.GetString("token_name"),
+		Quota:          quota,
+		Content:        fmt.Sprintf("MCP 工具调用，单次价格 $%.6f，分组倍率 %.2f", server.CallPrice, groupRatio),
+		TokenId:        info.TokenId,
+		UseTimeSeconds: int(time.Since(info.StartTime).Seconds()),
+		Group:          info.UsingGroup,
+		UpstreamCost:   model.CalculateChannelUpstreamCost(server.ChannelId, info.OriginModelName, quota, groupRatio),
+		Other:          other,
+	})
+	model.UpdateUserUsedQuotaAndRequestCount(info.UserId, quota)
+	model.UpdateChannelUsedQuota(server.ChannelId, quota)
+}
+
+// ResolveResponsesMcpTools 解析 Responses 请求中引用网关 MCP 服务器的 mcp 工具（未填写 server_url 与 connector_id，
+// server_label 为已登记的服务器）：改写为网关地址，附带仅可访问该服务器的临时令牌，并按令牌白名单收紧 allowed_tools。
+// 上游模型服务商据此回调网关完成工具调用，工具调用同样经过网关的鉴权、日志与计费
+func ResolveResponsesMcpTools(c *gin.Context, request *dto.OpenAIResponsesRequest) error {
+	if len(request.Tools) == 0 {
+		return nil
+	}
+	tools := gjson.ParseBytes(request.Tools)
+	if !tools.IsArray() {
+		return nil
+	}
+	var allowlist McpAllowlist
+	var parent *model.Token
+	rawTools := request.Tools
+	for i, tool := range tools.Array() {
+		if tool.Get("type").String() != "mcp" || tool.Get("server_url").String() != "" || tool.Get("connector_id").String() != "" {
+			continue
+		}
+		label := tool.Get("server_label").String()
+		if _, err := model.GetEnabledMcpChannel(label); err != nil {
+			return fmt.Errorf("mcp server %q is not registered on the gateway", label)
+		}
+		if allowlist == nil {
+			allowlist = ParseMcpAllowlist(common.GetContextKeyString(c, constant.ContextKeyTokenMcpAllowlist))
+		}
+		if !allowlist.AllowServer(label) {
+			return fmt.Errorf("token is not allowed to access mcp server %q", label)
+		}
+		if system_setting.ServerAddress == "" {
+			return errors.New("server address is not configured, gateway mcp servers are unavailable")
+		}
+		if parent == nil {
+			var err error
+			parent, err = model.GetTokenById(common.GetContextKeyInt(c, constant.ContextKeyTokenId))
+			if err != nil {
+				return err
+			}
+		}
+		key, err := mintMcpToolToken(c, parent, label)
+		if err != nil {
+			return err
+		}
+
+		path := fmt.Sprintf("%d.", i)
+		serverURL := strings.TrimRight(system_setting.ServerAddress, "/") + "/mcp/" + url.PathEscape(label)
+		if rawTools, err = sjson.SetBytes(rawTools, path+"server_url", serverURL); err != nil {
+			return err
+		}
+		if rawTools, err = sjson.SetBytes(rawTools, path+"headers.Authorization", "Bearer "+key); err != nil {
+			return err
+		}
+		if allowed, all := allowlist.AllowedTools(label); !all {
+			if rawTools, err = sjson.SetBytes(rawTools, path+"allowed_tools", intersectMcpAllowedTools(tool.Get("allowed_tools"), allowed)); err != nil {
+				return err
+			}
+		}
+	}
+	request.Tools = rawTools
+	return nil
+}
+
+// mintMcpToolToken 签发仅可访问该 MCP 服务器的临时令牌，有效期不超过当前临时令牌；
+// 当前请求使用带消费上限的临时令牌时，新令牌与其共享同一消费上限。
+// 该令牌由上游模型服务回调 MCP 网关时使用，来源 IP 不在父令牌白名单内，因此签发为不受 IP 白名单限制
+// （其权限已被限定为该 MCP 服务器及共享的消费上限）
+func mintMcpToolToken(c *gin.Context, parent *model.Token, label string) (string, error) {
+	ttl := int64(model.EphemeralTokenMaxTTL)
+	expiresAt := common.GetContextKeyInt64(c, constant.ContextKeyEphemeralTokenExpiresAt)
+	if expiresAt > 0 {
+		ttl = min(ttl, expiresAt-common.GetTimestamp())
+	}
+	if ttl <= 0 {
+		return "", errors.New("ephemeral token has expired")
+	}
+	models := []string{McpModelPrefix + label}
+	endUserId := common.GetContextKeyString(c, constant.ContextKeyEndUserId)
+	if maxSpend := common.GetContextKeyInt(c, constant.ContextKeyEphemeralTokenMaxSpend); maxSpend > 0 {
+		key, _, err := model.MintSharedBudgetEphemeralToken(parent, ttl, models, maxSpend, endUserId, true,
+			common.GetContextKeyString(c, constant.ContextKeyEphemeralTokenId), expiresAt)
+		return key, err
+	}
+	key, _, err := model.MintEphemeralToken(parent, ttl, models, 0, endUserId, true)
+	return key, err
+}
+
+// intersectMcpAllowedTools allowed_tools 可以是工具名数组或 {tool_names: [...]} 过滤器，与白名单取交集
+func intersectMcpAllowedTools(requested gjson.Result, allowed []string) []string {
+	names := requested
+	if requested.IsObject() {
+		names = requested.Get("tool_names")
+	}
+	if !names.IsArray() {
+		return allowed
+	}
+	allowedSet := make(map[string]bool, len(allowed))
+	for _, tool := range allowed {
+		allowedSet[tool] = true
+	}
+	result := make([]string, 0)
+	for _, name := range names.Array() {
+		if allowedSet[name.String()] {
+			result = append(result, name.String())
+		}
+	}
+	return result
+}
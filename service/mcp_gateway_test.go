@@ -0,0 +1,258 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestParseMcpAllowlist(t *testing.T) {
+	allowlist := ParseMcpAllowlist("github/search_issues, github/get_issue\nslack/*\n docs ,slack/post_message")
+
+	assert.True(t, allowlist.AllowServer("github"))
+	assert.True(t, allowlist.AllowTool("github", "search_issues"))
+	assert.False(t, allowlist.AllowTool("github", "delete_repo"))
+	assert.True(t, allowlist.AllowTool("slack", "anything"))
+	assert.True(t, allowlist.AllowTool("docs", "anything"))
+	assert.False(t, allowlist.AllowServer("jira"))
+
+	tools, all := allowlist.AllowedTools("github")
+	assert.False(t, all)
+	assert.Equal(t, []string{"get_issue", "search_issues"}, tools)
+	_, all = allowlist.AllowedTools("slack")
+	assert.True(t, all)
+
+	assert.False(t, ParseMcpAllowlist("").AllowServer("github"))
+	assert.True(t, ParseMcpAllowlist("*").AllowTool("jira", "create_issue"))
+}
+
+func TestFilterMcpToolsListResponse(t *testing.T) {
+	allowlist := ParseMcpAllowlist("github/search_issues")
+	allow := func(tool string) bool { return allowlist.AllowTool("github", tool) }
+	message := []byte(`{"jsonrpc":"2.0","id":1,"result":{"tools":[{"name":"search_issues","inputSchema":{"type":"object"}},{"name":"delete_repo"}],"nextCursor":"c1"}}`)
+
+	filtered := FilterMcpToolsListResponse(message, allow)
+	tools := gjson.GetBytes(filtered, "result.tools").Array()
+	require.Len(t, tools, 1)
+	assert.Equal(t, "search_issues", tools[0].Get("name").String())
+	assert.Equal(t, "c1", gjson.GetBytes(filtered, "result.nextCursor").String())
+
+	// SSE 响应逐条改写 data 消息
+	var out bytes.Buffer
+	stream := "event: message\ndata: " + string(message) + "\n\n"
+	require.NoError(t, RewriteMcpSSEStream(&out, func() {}, strings.NewReader(stream), func(data []byte) []byte {
+		return FilterMcpToolsListResponse(data, allow)
+	}))
+	assert.Contains(t, out.String(), "event: message\n")
+	assert.NotContains(t, out.String(), "delete_repo")
+}
+
+func TestMcpSessionIdBinding(t *testing.T) {
+	sessionId := WrapMcpSessionId("github", 7, "upstream-1")
+	upstreamId, ok := UnwrapMcpSessionId("github", 7, sessionId)
+	assert.True(t, ok)
+	assert.Equal(t, "upstream-1", upstreamId)
+
+	// 其他令牌或服务器不能使用该会话
+	_, ok = UnwrapMcpSessionId("github", 8, sessionId)
+	assert.False(t, ok)
+	_, ok = UnwrapMcpSessionId("slack", 7, sessionId)
+	assert.False(t, ok)
+}
+
+// newLegacySSEServer 模拟旧版 HTTP+SSE 传输的 MCP 服务器：请求的响应通过 SSE 连接推送
+func newLegacySSEServer(t *testing.T) *httptest.Server {
+	messages := make(chan string, 8)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer upstream-key", r.Header.Get("Authorization"))
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = fmt.Fprint(w, "event: endpoint\ndata: /messages?session=1\n\n")
+			w.(http.Flusher).Flush()
+			for {
+				select {
+				case message := <-messages:
+					_, _ = fmt.Fprintf(w, "event: message\ndata: %s\n\n", message)
+					w.(http.Flusher).Flush()
+				case <-r.Context().Done():
+					return
+				}
+			}
+		case http.MethodPost:
+			assert.Equal(t, "/messages", r.URL.Path)
+			body, _ := io.ReadAll(r.Body)
+			var message dto.McpJsonRpcMessage
+			require.NoError(t, common.Unmarshal(body, &message))
+			if message.IsRequest() {
+				messages <- fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":{"method":%q}}`, message.Id, message.Method)
+			}
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestMcpSSESession(t *testing.T) {
+	upstream := newLegacySSEServer(t)
+	server := &McpServer{
+		Label:     "legacy",
+		URL:       upstream.URL + "/sse",
+		Transport: dto.McpTransportSSE,
+		Headers:   map[string]string{"Authorization": "Bearer upstream-key"},
+	}
+
+	session, err := OpenMcpSSESession(context.Background(), server, 7)
+	require.NoError(t, err)
+	defer session.Close()
+	assert.Same(t, session, GetMcpSSESession(session.Id(), "legacy", 7))
+	assert.Nil(t, GetMcpSSESession(session.Id(), "legacy", 8))
+
+	message := &dto.McpJsonRpcMessage{JsonRpc: "2.0", Id: []byte(`"req-1"`), Method: "tools/list"}
+	body, err := common.Marshal(message)
+	require.NoError(t, err)
+	response, err := session.Send(context.Background(), message, body)
+	require.NoError(t, err)
+	assert.Equal(t, "req-1", gjson.GetBytes(response, "id").String())
+	assert.Equal(t, "tools/list", gjson.GetBytes(response, "result.method").String())
+
+	// 通知没有响应
+	notification := &dto.McpJsonRpcMessage{JsonRpc: "2.0", Method: "notifications/initialized"}
+	response, err = session.Send(context.Background(), notification, []byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`))
+	require.NoError(t, err)
+	assert.Nil(t, response)
+
+	session.Close()
+	assert.Nil(t, GetMcpSSESession(session.Id(), "legacy", 7))
+}
+
+func TestReadMcpSSEEvent(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader(": ping\n\nevent: endpoint\r\ndata: /a\ndata: /b\n\n"))
+	event, data, err := readMcpSSEEvent(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "endpoint", event)
+	assert.Equal(t, "/a\n/b", data)
+}
+
+func TestResolveResponsesMcpTools(t *testing.T) {
+	truncate(t)
+	seedUser(t, 1, 1000000)
+	seedToken(t, 7, 1, "sk-mcp-parent", 1000000)
+	baseURL := "https://mcp.example.com/mcp"
+	require.NoError(t, model.DB.Create(&model.Channel{
+		Id: 31, Type: constant.ChannelTypeMCP, Name: "github", Key: "ghp_test", BaseURL: &baseURL, Status: common.ChannelStatusEnabled,
+	}).Error)
+	originalAddress := system_setting.ServerAddress
+	system_setting.ServerAddress = "https://gateway.example.com/"
+	t.Cleanup(func() { system_setting.ServerAddress = originalAddress })
+
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/responses", nil)
+	common.SetContextKey(c, constant.ContextKeyTokenId, 7)
+	common.SetContextKey(c, constant.ContextKeyTokenMcpAllowlist, "github/search_issues,github/get_issue")
+
+	request := &dto.OpenAIResponsesRequest{Model: "gpt-5", Tools: []byte(`[
+		{"type":"mcp","server_label":"github","allowed_tools":["search_issues","delete_repo"],"require_approval":"never"},
+		{"type":"mcp","server_label":"external","server_url":"https://external.example.com/mcp"},
+		{"type":"function","name":"get_weather"}
+	]`)}
+	require.NoError(t, ResolveResponsesMcpTools(c, request))
+
+	tool := gjson.GetBytes(request.Tools, "0")
+	assert.Equal(t, "https://gateway.example.com/mcp/github", tool.Get("server_url").String())
+	key := strings.TrimPrefix(tool.Get("headers.Authorization").String(), "Bearer ")
+	claims, err := model.ParseEphemeralToken(key)
+	require.NoError(t, err)
+	assert.Equal(t, 7, claims.TokenId)
+	assert.Equal(t, []string{"mcp/github"}, claims.Models)
+	assert.Equal(t, `["search_issues"]`, tool.Get("allowed_tools").Raw)
+	assert.Equal(t, "never", tool.Get("require_approval").String())
+	// 其他工具保持不变
+	assert.Equal(t, "https://external.example.com/mcp", gjson.GetBytes(request.Tools, "1.server_url").String())
+	assert.False(t, gjson.GetBytes(request.Tools, "1.headers").Exists())
+
+	// 白名单不包含的服务器与未登记的服务器均拒绝
+	common.SetContextKey(c, constant.ContextKeyTokenMcpAllowlist, "slack")
+	assert.Error(t, ResolveResponsesMcpTools(c, &dto.OpenAIResponsesRequest{Tools: []byte(`[{"type":"mcp","server_label":"github"}]`)}))
+	common.SetContextKey(c, constant.ContextKeyTokenMcpAllowlist, "*")
+	assert.Error(t, ResolveResponsesMcpTools(c, &dto.OpenAIResponsesRequest{Tools: []byte(`[{"type":"mcp","server_label":"jira"}]`)}))
+}
+
+func TestSettleMcpToolCall(t *testing.T) {
+	truncate(t)
+	seedUser(t, 1, 1000000)
+	seedToken(t, 7, 1, "sk-mcp-settle", 1000000)
+
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/mcp/github", nil)
+	common.SetContextKey(c, constant.ContextKeyUserId, 1)
+	common.SetContextKey(c, constant.ContextKeyTokenId, 7)
+	common.SetContextKey(c, constant.ContextKeyTokenKey, "sk-mcp-settle")
+	common.SetContextKey(c, constant.ContextKeyUsingGroup, "default")
+	common.SetContextKey(c, constant.ContextKeyUserGroup, "default")
+	c.Set("token_quota", 1000000)
+
+	server := &McpServer{Label: "github", ChannelId: 31, CallPrice: 0.01}
+	require.NoError(t, CheckMcpToolCallQuota(c, server, "search_issues"))
+	SettleMcpToolCall(c, server, "search_issues", false)
+
+	expectedQuota := int(0.01 * common.QuotaPerUnit)
+	quota, err := model.GetUserQuota(1, true)
+	require.NoError(t, err)
+	assert.Equal(t, 1000000-expectedQuota, quota)
+
+	var log model.Log
+	require.NoError(t, model.LOG_DB.Where("user_id = ?", 1).First(&log).Error)
+	assert.Equal(t, "mcp/github/search_issues", log.ModelName)
+	assert.Equal(t, expectedQuota, log.Quota)
+	assert.Equal(t, "search_issues", gjson.Get(log.Other, "mcp_tool").String())
+
+	// 余额不足时拒绝调用
+	server.CallPrice = 1000
+	assert.Error(t, CheckMcpToolCallQuota(c, server, "search_issues"))
+}
+
+func TestMintMcpToolTokenSharesEphemeralBudget(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	parent := &model.Token{Id: 7, UserId: 1, Key: "sk-mcp-mint", ExpiredTime: -1}
+	expiresAt := common.GetTimestamp() + 300
+	common.SetContextKey(c, constant.ContextKeyEphemeralTokenId, "parent-jti")
+	common.SetContextKey(c, constant.ContextKeyEphemeralTokenMaxSpend, 5000)
+	common.SetContextKey(c, constant.ContextKeyEphemeralTokenExpiresAt, expiresAt)
+
+	key, err := mintMcpToolToken(c, parent, "github")
+	require.NoError(t, err)
+	claims, err := model.ParseEphemeralToken(key)
+	require.NoError(t, err)
+	assert.Equal(t, 5000, claims.MaxSpend)
+	assert.LessOrEqual(t, claims.ExpiresAt, expiresAt)
+	spendJti, spendExpiresAt := claims.SpendCounter()
+	assert.Equal(t, "parent-jti", spendJti)
+	assert.Equal(t, expiresAt, spendExpiresAt)
+
+	// 当前临时令牌已到期时不再签发
+	common.SetContextKey(c, constant.ContextKeyEphemeralTokenExpiresAt, common.GetTimestamp())
+	_, err = mintMcpToolToken(c, parent, "github")
+	assert.Error(t, err)
+}
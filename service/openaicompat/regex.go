@@ -31,3 +31,8 @@ func matchAnyRegex(patterns []string, s string) bool {
 	}
 	return false
 }
+
+// MatchAnyRegex 判断 s 是否匹配任一正则，无效的正则视为不匹配
+func MatchAnyRegex(patterns []string, s string) bool {
+	return matchAnyRegex(patterns, s)
+}
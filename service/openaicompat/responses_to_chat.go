@@ -1,10 +1,14 @@
 package openaicompat
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"strings"
 
+	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/dto"
+	"github.com/samber/lo"
 )
 
 func ResponsesResponseToChatCompletionsResponse(resp *dto.OpenAIResponsesResponse, id string) (*dto.OpenAITextResponse, *dto.Usage, error) {
@@ -131,3 +135,280 @@ func ExtractOutputTextFromResponses(resp *dto.OpenAIResponsesResponse) string {
 	}
 	return sb.String()
 }
+
+type responsesInputItem struct {
+	Type      string          `json:"type"`
+	Role      string          `json:"role"`
+	Content   json.RawMessage `json:"content"`
+	CallId    string          `json:"call_id"`
+	Name      string          `json:"name"`
+	Arguments string          `json:"arguments"`
+	Output    json.RawMessage `json:"output"`
+}
+
+type responsesContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	Refusal  string `json:"refusal"`
+	ImageUrl any    `json:"image_url"`
+	Detail   string `json:"detail"`
+	FileId   string `json:"file_id"`
+	FileData string `json:"file_data"`
+	FileUrl  string `json:"file_url"`
+	Filename string `json:"filename"`
+}
+
+type responsesFunctionTool struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Parameters  any    `json:"parameters"`
+}
+
+// ResponsesRequestToChatCompletionsRequest 将 Responses API 请求转换为 Chat Completions 请求，
+// 供不支持 Responses API 的上游（Gemini、Ollama 等）复用已有的 Chat Completions 转换逻辑。
+// reasoning 输入项无法回传给这类上游，会被忽略
+func ResponsesRequestToChatCompletionsRequest(req *dto.OpenAIResponsesRequest) (*dto.GeneralOpenAIRequest, error) {
+	if req == nil {
+		return nil, errors.New("request is nil")
+	}
+	if req.PreviousResponseID != "" {
+		return nil, errors.New("previous_response_id is not supported by this channel, please send the full conversation in input")
+	}
+
+	out := &dto.GeneralOpenAIRequest{
+		Model:               req.Model,
+		MaxCompletionTokens: req.MaxOutputTokens,
+		Temperature:         req.Temperature,
+		TopP:                req.TopP,
+		Metadata:            req.Metadata,
+		User:                req.User,
+		SafetyIdentifier:    req.SafetyIdentifier,
+	}
+	if req.Stream != nil && *req.Stream {
+		out.Stream = lo.ToPtr(true)
+		out.StreamOptions = &dto.StreamOptions{IncludeUsage: true}
+	}
+	if req.Reasoning != nil {
+		out.ReasoningEffort = req.Reasoning.Effort
+	}
+	if len(req.ParallelToolCalls) > 0 {
+		var parallel bool
+		if err := common.Unmarshal(req.ParallelToolCalls, &parallel); err == nil {
+			out.ParallelTooCalls = &parallel
+		}
+	}
+
+	tools, err := convertResponsesToolsToChat(req.Tools)
+	if err != nil {
+		return nil, err
+	}
+	out.Tools = tools
+	out.ToolChoice = convertResponsesToolChoiceToChat(req.ToolChoice)
+	out.ResponseFormat = convertResponsesTextToChatResponseFormat(req.Text)
+
+	messages := make([]dto.Message, 0)
+	if common.GetJsonType(req.Instructions) == "string" {
+		var instructions string
+		_ = common.Unmarshal(req.Instructions, &instructions)
+		if strings.TrimSpace(instructions) != "" {
+			messages = append(messages, dto.Message{Role: "system", Content: instructions})
+		}
+	}
+
+	var items []responsesInputItem
+	switch common.GetJsonType(req.Input) {
+	case "string":
+		var input string
+		_ = common.Unmarshal(req.Input, &input)
+		content, _ := common.Marshal(input)
+		items = []responsesInputItem{{Type: "message", Role: "user", Content: content}}
+	case "array":
+		if err := common.Unmarshal(req.Input, &items); err != nil {
+			return nil, fmt.Errorf("invalid input: %w", err)
+		}
+	}
+
+	// 记录 call_id 对应的函数名，供只按名称关联工具结果的上游（如 Ollama）使用
+	toolNames := make(map[string]string)
+	for _, item := range items {
+		if item.Type == "" && item.Role != "" {
+			item.Type = "message"
+		}
+		switch item.Type {
+		case "message":
+			role := item.Role
+			if role == "developer" {
+				role = "system"
+			}
+			msg := dto.Message{Role: role}
+			if common.GetJsonType(item.Content) == "string" {
+				var text string
+				_ = common.Unmarshal(item.Content, &text)
+				msg.SetStringContent(text)
+			} else {
+				parts, err := convertResponsesContentToChat(item.Content)
+				if err != nil {
+					return nil, err
+				}
+				msg.SetMediaContent(parts)
+			}
+			messages = append(messages, msg)
+		case "function_call":
+			toolNames[item.CallId] = item.Name
+			toolCall := dto.ToolCallRequest{
+				ID:   item.CallId,
+				Type: "function",
+				Function: dto.FunctionRequest{
+					Name:      item.Name,
+					Arguments: item.Arguments,
+				},
+			}
+			// 连续的函数调用合并到同一条 assistant 消息中
+			if n := len(messages); n > 0 && messages[n-1].Role == "assistant" {
+				toolCalls := append(messages[n-1].ParseToolCalls(), toolCall)
+				messages[n-1].SetToolCalls(toolCalls)
+				continue
+			}
+			msg := dto.Message{Role: "assistant", Content: ""}
+			msg.SetToolCalls([]dto.ToolCallRequest{toolCall})
+			messages = append(messages, msg)
+		case "function_call_output":
+			msg := dto.Message{Role: "tool", ToolCallId: item.CallId}
+			if name, ok := toolNames[item.CallId]; ok {
+				msg.Name = common.GetPointer(name)
+			}
+			if common.GetJsonType(item.Output) == "string" {
+				var output string
+				_ = common.Unmarshal(item.Output, &output)
+				msg.SetStringContent(output)
+			} else {
+				parts, err := convertResponsesContentToChat(item.Output)
+				if err != nil {
+					return nil, err
+				}
+				msg.SetMediaContent(parts)
+			}
+			messages = append(messages, msg)
+		case "reasoning":
+			continue
+		default:
+			return nil, fmt.Errorf("unsupported input item type: %s", item.Type)
+		}
+	}
+	out.Messages = messages
+	return out, nil
+}
+
+func convertResponsesContentToChat(content json.RawMessage) ([]dto.MediaContent, error) {
+	if common.GetJsonType(content) != "array" {
+		return nil, nil
+	}
+	var parts []responsesContentPart
+	if err := common.Unmarshal(content, &parts); err != nil {
+		return nil, fmt.Errorf("invalid message content: %w", err)
+	}
+	out := make([]dto.MediaContent, 0, len(parts))
+	for _, part := range parts {
+		switch part.Type {
+		case "input_text", "output_text", "text":
+			out = append(out, dto.MediaContent{Type: dto.ContentTypeText, Text: part.Text})
+		case "refusal":
+			out = append(out, dto.MediaContent{Type: dto.ContentTypeText, Text: part.Refusal})
+		case "input_image":
+			url := common.Interface2String(normalizeChatImageURLToString(part.ImageUrl))
+			if url == "" {
+				return nil, errors.New("input_image without image_url is not supported by this channel")
+			}
+			out = append(out, dto.MediaContent{
+				Type:     dto.ContentTypeImageURL,
+				ImageUrl: &dto.MessageImageUrl{Url: url, Detail: part.Detail},
+			})
+		case "input_file":
+			if part.FileData != "" {
+				out = append(out, dto.MediaContent{
+					Type: dto.ContentTypeFile,
+					File: &dto.MessageFile{FileName: part.Filename, FileData: part.FileData},
+				})
+			} else if part.FileUrl != "" {
+				// Chat Completions 没有文件 URL 字段，按图片/文件 URL 交给上游下载
+				out = append(out, dto.MediaContent{
+					Type:     dto.ContentTypeImageURL,
+					ImageUrl: &dto.MessageImageUrl{Url: part.FileUrl},
+				})
+			} else {
+				return nil, errors.New("input_file without file_data or file_url is not supported by this channel")
+			}
+		default:
+			return nil, fmt.Errorf("unsupported content type: %s", part.Type)
+		}
+	}
+	return out, nil
+}
+
+func convertResponsesToolsToChat(rawTools json.RawMessage) ([]dto.ToolCallRequest, error) {
+	if common.GetJsonType(rawTools) != "array" {
+		return nil, nil
+	}
+	var tools []responsesFunctionTool
+	if err := common.Unmarshal(rawTools, &tools); err != nil {
+		return nil, fmt.Errorf("invalid tools: %w", err)
+	}
+	out := make([]dto.ToolCallRequest, 0, len(tools))
+	for _, tool := range tools {
+		if tool.Type != "function" {
+			return nil, fmt.Errorf("unsupported tool type: %s", tool.Type)
+		}
+		out = append(out, dto.ToolCallRequest{
+			Type: "function",
+			Function: dto.FunctionRequest{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	return out, nil
+}
+
+// convertResponsesToolChoiceToChat {"type":"function","name":"x"} -> {"type":"function","function":{"name":"x"}}
+func convertResponsesToolChoiceToChat(rawToolChoice json.RawMessage) any {
+	var toolChoice any
+	if len(rawToolChoice) == 0 || common.Unmarshal(rawToolChoice, &toolChoice) != nil {
+		return nil
+	}
+	if choice, ok := toolChoice.(map[string]any); ok && choice["type"] == "function" {
+		if name, ok := choice["name"].(string); ok {
+			return map[string]any{"type": "function", "function": map[string]any{"name": name}}
+		}
+	}
+	return toolChoice
+}
+
+// convertResponsesTextToChatResponseFormat text.format -> response_format，与 convertChatResponseFormatToResponsesText 相反
+func convertResponsesTextToChatResponseFormat(rawText json.RawMessage) *dto.ResponseFormat {
+	if len(rawText) == 0 {
+		return nil
+	}
+	var text struct {
+		Format map[string]any `json:"format"`
+	}
+	if err := common.Unmarshal(rawText, &text); err != nil || text.Format == nil {
+		return nil
+	}
+	formatType, _ := text.Format["type"].(string)
+	switch formatType {
+	case "json_object":
+		return &dto.ResponseFormat{Type: formatType}
+	case "json_schema":
+		schema := make(map[string]any, len(text.Format))
+		for key, value := range text.Format {
+			if key != "type" {
+				schema[key] = value
+			}
+		}
+		jsonSchema, _ := common.Marshal(schema)
+		return &dto.ResponseFormat{Type: formatType, JsonSchema: jsonSchema}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package openaicompat
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/dto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponsesRequestToChatCompletionsRequest(t *testing.T) {
+	stream := true
+	maxOutputTokens := uint(512)
+	request := &dto.OpenAIResponsesRequest{
+		Model:           "gemini-2.5-flash",
+		Stream:          &stream,
+		Instructions:    []byte(`"be brief"`),
+		MaxOutputTokens: &maxOutputTokens,
+		Reasoning:       &dto.Reasoning{Effort: "low"},
+		Input: []byte(`[
+			{"role":"developer","content":"answer in english"},
+			{"role":"user","content":[{"type":"input_text","text":"weather in paris and rome?"},{"type":"input_image","image_url":"https://example.com/a.png"}]},
+			{"type":"reasoning","summary":[]},
+			{"type":"function_call","call_id":"call_1","name":"get_weather","arguments":"{\"city\":\"paris\"}"},
+			{"type":"function_call","call_id":"call_2","name":"get_weather","arguments":"{\"city\":\"rome\"}"},
+			{"type":"function_call_output","call_id":"call_1","output":"sunny"},
+			{"type":"function_call_output","call_id":"call_2","output":"rainy"}
+		]`),
+		Tools:      []byte(`[{"type":"function","name":"get_weather","parameters":{"type":"object","properties":{"city":{"type":"string"}}}}]`),
+		ToolChoice: []byte(`"auto"`),
+	}
+
+	chatRequest, err := ResponsesRequestToChatCompletionsRequest(request)
+	require.NoError(t, err)
+
+	assert.Equal(t, "gemini-2.5-flash", chatRequest.Model)
+	require.NotNil(t, chatRequest.StreamOptions)
+	assert.True(t, chatRequest.StreamOptions.IncludeUsage)
+	assert.Equal(t, uint(512), chatRequest.GetMaxTokens())
+	assert.Equal(t, "low", chatRequest.ReasoningEffort)
+	require.Len(t, chatRequest.Tools, 1)
+	assert.Equal(t, "get_weather", chatRequest.Tools[0].Function.Name)
+
+	messages := chatRequest.Messages
+	require.Len(t, messages, 6)
+	assert.Equal(t, "system", messages[0].Role)
+	assert.Equal(t, "be brief", messages[0].StringContent())
+	assert.Equal(t, "system", messages[1].Role)
+	assert.Equal(t, "user", messages[2].Role)
+	parts := messages[2].ParseContent()
+	require.Len(t, parts, 2)
+	assert.Equal(t, dto.ContentTypeImageURL, parts[1].Type)
+
+	// 连续的函数调用合并为一条 assistant 消息
+	assert.Equal(t, "assistant", messages[3].Role)
+	toolCalls := messages[3].ParseToolCalls()
+	require.Len(t, toolCalls, 2)
+	assert.Equal(t, "call_2", toolCalls[1].ID)
+
+	assert.Equal(t, "tool", messages[4].Role)
+	assert.Equal(t, "call_1", messages[4].ToolCallId)
+	assert.Equal(t, "sunny", messages[4].StringContent())
+	require.NotNil(t, messages[4].Name)
+	assert.Equal(t, "get_weather", *messages[4].Name)
+
+	_, err = ResponsesRequestToChatCompletionsRequest(&dto.OpenAIResponsesRequest{Model: "m", PreviousResponseID: "resp_1"})
+	assert.Error(t, err)
+	_, err = ResponsesRequestToChatCompletionsRequest(&dto.OpenAIResponsesRequest{Model: "m", Tools: []byte(`[{"type":"file_search"}]`)})
+	assert.Error(t, err)
+}
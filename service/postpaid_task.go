@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	postpaidBillingTickInterval = 5 * time.Minute
+	postpaidBillingBatchSize    = 200
+)
+
+var (
+	postpaidBillingOnce    sync.Once
+	postpaidBillingRunning atomic.Bool
+)
+
+// StartPostpaidBillingTask 启动后付费账期结算任务：到期出账并刷新逾期状态（仅 master 节点）
+func StartPostpaidBillingTask() {
+	postpaidBillingOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("postpaid billing task started: tick=%s", postpaidBillingTickInterval))
+			ticker := time.NewTicker(postpaidBillingTickInterval)
+			defer ticker.Stop()
+
+			runPostpaidBillingOnce()
+			for range ticker.C {
+				runPostpaidBillingOnce()
+			}
+		})
+	})
+}
+
+func runPostpaidBillingOnce() {
+	if !postpaidBillingRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer postpaidBillingRunning.Store(false)
+
+	ctx := context.Background()
+	closed := 0
+	// 按账户 id 游标遍历，出账失败的账户留到下一轮，不会阻塞后续账户
+	lastId := 0
+	for {
+		accounts, err := model.GetDuePostpaidAccounts(lastId, postpaidBillingBatchSize)
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("postpaid billing task failed to list due accounts: %v", err))
+			return
+		}
+		for _, account := range accounts {
+			lastId = account.Id
+			statement, err := model.ClosePostpaidCycle(account.UserId)
+			if err != nil {
+				logger.LogWarn(ctx, fmt.Sprintf("postpaid billing task failed to close cycle: user_id=%d, error=%v", account.UserId, err))
+				continue
+			}
+			closed++
+			notifyPostpaidStatement(statement)
+		}
+		if len(accounts) < postpaidBillingBatchSize {
+			break
+		}
+	}
+
+	setting := operation_setting.GetPostpaidSetting()
+	changed, err := model.RefreshPostpaidOverdueStatus(setting.ThrottleAfterDays, setting.SuspendAfterDays)
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("postpaid billing task failed to refresh overdue status: %v", err))
+	}
+	for _, account := range changed {
+		notifyPostpaidStatusChange(account)
+	}
+	if common.DebugEnabled && (closed > 0 || len(changed) > 0) {
+		logger.LogDebug(ctx, "postpaid billing: closed_count=%d, status_changed_count=%d", closed, len(changed))
+	}
+}
+
+func notifyPostpaidStatement(statement *model.PostpaidStatement) {
+	if statement == nil || statement.AmountDue <= 0 {
+		return
+	}
+	userCache, err := model.GetUserCache(statement.UserId)
+	if err != nil {
+		return
+	}
+	title := "后付费账单已生成"
+	content := "您本账期的消费金额为 {{value}}，请在 {{value}} 前完成付款。"
+	values := []interface{}{
+		logger.FormatQuota(int(statement.AmountDue)),
+		time.Unix(statement.DueTime, 0).Format("2006-01-02"),
+	}
+	if err := NotifyUser(statement.UserId, userCache.Email, userCache.GetSetting(), dto.NewNotify(dto.NotifyTypePostpaid, title, content, values)); err != nil {
+		common.SysLog(fmt.Sprintf("failed to notify postpaid statement: user_id=%d, error=%v", statement.UserId, err))
+	}
+}
+
+func notifyPostpaidStatusChange(account *model.PostpaidAccount) {
+	var content string
+	switch account.Status {
+	case model.PostpaidStatusOverdue:
+		content = "您的后付费账单已逾期，请尽快付款以免影响使用。"
+	case model.PostpaidStatusThrottled:
+		content = "您的后付费账单逾期未付，账户请求已被限流，请尽快付款。"
+	case model.PostpaidStatusSuspended:
+		content = "您的后付费账单逾期未付，账户已被暂停使用，请付款后联系管理员恢复。"
+	default:
+		return
+	}
+	userCache, err := model.GetUserCache(account.UserId)
+	if err != nil {
+		return
+	}
+	if err := NotifyUser(account.UserId, userCache.Email, userCache.GetSetting(), dto.NewNotify(dto.NotifyTypePostpaid, "后付费账户状态变更", content, nil)); err != nil {
+		common.SysLog(fmt.Sprintf("failed to notify postpaid status change: user_id=%d, error=%v", account.UserId, err))
+	}
+}
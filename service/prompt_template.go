@@ -0,0 +1,235 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 提示词模板：请求中的 "prompt": {"id": "support-bot", "version": 3, "variables": {...}} 在网关渲染为消息，
+// 插入到请求消息之前，再交给渠道适配器转换；使用的模板版本记录在日志 other.prompt_template 中
+
+var (
+	promptTemplateNameRegex     = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+	promptTemplateVariableRegex = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.-]+)\s*\}\}`)
+	promptTemplateRoles         = map[string]bool{"system": true, "developer": true, "user": true, "assistant": true}
+)
+
+// PromptTemplateMessage 模板中的一条消息
+type PromptTemplateMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// PromptTemplateReference 请求中对模板的引用，version 兼容数字与字符串
+type PromptTemplateReference struct {
+	Id        string          `json:"id"`
+	Version   json.RawMessage `json:"version,omitempty"`
+	Variables map[string]any  `json:"variables,omitempty"`
+}
+
+// PromptTemplateUsage 写入日志的模板使用信息
+type PromptTemplateUsage struct {
+	Id      string `json:"id"`
+	Version int    `json:"version"`
+	Global  bool   `json:"global,omitempty"`
+}
+
+// ValidatePromptTemplate 校验模板名称、消息与变量默认值
+func ValidatePromptTemplate(template *model.PromptTemplate) error {
+	template.Name = strings.TrimSpace(template.Name)
+	if !promptTemplateNameRegex.MatchString(template.Name) {
+		return errors.New("模板名称只能包含字母、数字、下划线、点和中划线，且不超过 64 个字符")
+	}
+	if len(template.Description) > 255 {
+		return errors.New("模板描述过长")
+	}
+	messages, err := parsePromptTemplateMessages(template.Messages)
+	if err != nil {
+		return err
+	}
+	if len(messages) == 0 {
+		return errors.New("模板至少需要一条消息")
+	}
+	for _, message := range messages {
+		if !promptTemplateRoles[message.Role] {
+			return fmt.Errorf("不支持的消息角色：%s", message.Role)
+		}
+	}
+	if strings.TrimSpace(template.Variables) != "" && !common.IsJsonObject(template.Variables) {
+		return errors.New("变量默认值必须是 JSON 对象")
+	}
+	return nil
+}
+
+func parsePromptTemplateMessages(data string) ([]PromptTemplateMessage, error) {
+	var messages []PromptTemplateMessage
+	if err := common.UnmarshalJsonStr(data, &messages); err != nil {
+		return nil, fmt.Errorf("模板消息格式错误：%w", err)
+	}
+	return messages, nil
+}
+
+// RenderPromptTemplate 使用默认值与请求变量渲染模板，缺少变量时返回错误
+func RenderPromptTemplate(template *model.PromptTemplate, variables map[string]any) ([]PromptTemplateMessage, error) {
+	messages, err := parsePromptTemplateMessages(template.Messages)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]any)
+	if strings.TrimSpace(template.Variables) != "" {
+		if err := common.UnmarshalJsonStr(template.Variables, &values); err != nil {
+			return nil, fmt.Errorf("invalid prompt template variables: %w", err)
+		}
+	}
+	for name, value := range variables {
+		values[name] = value
+	}
+
+	var missing []string
+	for i := range messages {
+		messages[i].Content = promptTemplateVariableRegex.ReplaceAllStringFunc(messages[i].Content, func(placeholder string) string {
+			name := promptTemplateVariableRegex.FindStringSubmatch(placeholder)[1]
+			value, ok := values[name]
+			if !ok {
+				missing = append(missing, name)
+				return placeholder
+			}
+			return promptTemplateVariableString(value)
+		})
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("prompt template %s missing variables: %s", template.Name, strings.Join(missing, ", "))
+	}
+	return messages, nil
+}
+
+func promptTemplateVariableString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	}
+	data, err := common.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+func parsePromptTemplateReference(data []byte) (*PromptTemplateReference, int, error) {
+	var reference PromptTemplateReference
+	if err := common.Unmarshal(data, &reference); err != nil {
+		return nil, 0, fmt.Errorf("invalid prompt: %w", err)
+	}
+	if reference.Id == "" {
+		return nil, 0, errors.New("prompt.id is required")
+	}
+	version := 0
+	if len(reference.Version) > 0 && string(reference.Version) != "null" {
+		raw := strings.Trim(string(reference.Version), `"`)
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			return nil, 0, fmt.Errorf("invalid prompt.version: %s", reference.Version)
+		}
+		version = parsed
+	}
+	return &reference, version, nil
+}
+
+// resolvePromptTemplateReference 查找并渲染模板，记录使用的版本
+func resolvePromptTemplateReference(c *gin.Context, data []byte) ([]PromptTemplateMessage, error) {
+	reference, version, err := parsePromptTemplateReference(data)
+	if err != nil {
+		return nil, err
+	}
+	template, err := model.ResolvePromptTemplate(common.GetContextKeyInt(c, constant.ContextKeyUserId), reference.Id, version)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := RenderPromptTemplate(template, reference.Variables)
+	if err != nil {
+		return nil, err
+	}
+	common.SetContextKey(c, constant.ContextKeyPromptTemplate, &PromptTemplateUsage{
+		Id:      template.Name,
+		Version: template.Version,
+		Global:  template.UserId == 0,
+	})
+	return messages, nil
+}
+
+// ApplyChatPromptTemplate 对话请求中 prompt 为模板引用时，将渲染后的消息插入到请求消息之前
+func ApplyChatPromptTemplate(c *gin.Context, request *dto.GeneralOpenAIRequest) error {
+	reference, ok := request.Prompt.(map[string]any)
+	if !ok {
+		return nil
+	}
+	if _, ok := reference["id"]; !ok {
+		return nil
+	}
+	data, err := common.Marshal(reference)
+	if err != nil {
+		return err
+	}
+	rendered, err := resolvePromptTemplateReference(c, data)
+	if err != nil {
+		return err
+	}
+	messages := make([]dto.Message, 0, len(rendered)+len(request.Messages))
+	for _, message := range rendered {
+		messages = append(messages, dto.Message{Role: message.Role, Content: message.Content})
+	}
+	request.Messages = append(messages, request.Messages...)
+	request.Prompt = nil
+	return nil
+}
+
+// ApplyResponsesPromptTemplate Responses 请求中的 prompt 命中网关模板时渲染为输入消息，
+// 未命中时保持原样，交由上游处理（如 OpenAI 托管的 prompt）
+func ApplyResponsesPromptTemplate(c *gin.Context, request *dto.OpenAIResponsesRequest) error {
+	if common.GetJsonType(request.Prompt) != "object" {
+		return nil
+	}
+	rendered, err := resolvePromptTemplateReference(c, request.Prompt)
+	if err != nil {
+		if errors.Is(err, model.ErrPromptTemplateNotFound) {
+			return nil
+		}
+		return err
+	}
+	input, err := normalizeResponsesInput(request.Input)
+	if err != nil {
+		return err
+	}
+	items := make([]map[string]any, 0, len(rendered)+len(input))
+	for _, message := range rendered {
+		items = append(items, map[string]any{"type": "message", "role": message.Role, "content": message.Content})
+	}
+	data, err := common.Marshal(append(items, input...))
+	if err != nil {
+		return err
+	}
+	request.Input = data
+	request.Prompt = nil
+	return nil
+}
+
+func appendPromptTemplateInfo(c *gin.Context, other map[string]interface{}) {
+	usage, ok := common.GetContextKeyType[*PromptTemplateUsage](c, constant.ContextKeyPromptTemplate)
+	if !ok || usage == nil {
+		return
+	}
+	other["prompt_template"] = usage
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func setupPromptTemplates(t *testing.T) {
+	t.Helper()
+	require.NoError(t, model.DB.AutoMigrate(&model.PromptTemplate{}))
+	t.Cleanup(func() {
+		model.DB.Exec("DELETE FROM prompt_templates")
+	})
+}
+
+func createPromptTemplateVersion(t *testing.T, userId int, name string, messages string, variables string) *model.PromptTemplate {
+	t.Helper()
+	template := &model.PromptTemplate{UserId: userId, Name: name, Messages: messages, Variables: variables}
+	require.NoError(t, ValidatePromptTemplate(template))
+	require.NoError(t, template.InsertNewVersion())
+	return template
+}
+
+func newPromptTemplateContext(userId int) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	common.SetContextKey(c, constant.ContextKeyUserId, userId)
+	return c
+}
+
+func TestValidatePromptTemplate(t *testing.T) {
+	assert.NoError(t, ValidatePromptTemplate(&model.PromptTemplate{Name: "support-bot", Messages: `[{"role":"system","content":"hi"}]`}))
+	assert.Error(t, ValidatePromptTemplate(&model.PromptTemplate{Name: "bad name", Messages: `[{"role":"system","content":"hi"}]`}))
+	assert.Error(t, ValidatePromptTemplate(&model.PromptTemplate{Name: "bot", Messages: `[]`}))
+	assert.Error(t, ValidatePromptTemplate(&model.PromptTemplate{Name: "bot", Messages: `[{"role":"tool","content":"hi"}]`}))
+	assert.Error(t, ValidatePromptTemplate(&model.PromptTemplate{Name: "bot", Messages: `[{"role":"system","content":"hi"}]`, Variables: `[1]`}))
+}
+
+func TestPromptTemplateVersions(t *testing.T) {
+	setupPromptTemplates(t)
+	v1 := createPromptTemplateVersion(t, 1, "support-bot", `[{"role":"system","content":"v1 for {{product}}"}]`, "")
+	v2 := createPromptTemplateVersion(t, 1, "support-bot", `[{"role":"system","content":"v2 for {{product}}"}]`, "")
+	assert.Equal(t, 1, v1.Version)
+	assert.Equal(t, 2, v2.Version)
+
+	// 未指定版本时取最新版本，设置默认版本后取默认版本
+	resolved, err := model.ResolvePromptTemplate(1, "support-bot", 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, resolved.Version)
+	_, err = model.ActivatePromptTemplate(v1.Id, 1)
+	require.NoError(t, err)
+	resolved, err = model.ResolvePromptTemplate(1, "support-bot", 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, resolved.Version)
+	resolved, err = model.ResolvePromptTemplate(1, "support-bot", 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, resolved.Version)
+
+	// 其他用户不可见，全局模板对所有用户可见
+	_, err = model.ResolvePromptTemplate(2, "support-bot", 0)
+	assert.ErrorIs(t, err, model.ErrPromptTemplateNotFound)
+	createPromptTemplateVersion(t, 0, "support-bot", `[{"role":"system","content":"global"}]`, "")
+	resolved, err = model.ResolvePromptTemplate(2, "support-bot", 0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, resolved.UserId)
+}
+
+func TestApplyChatPromptTemplate(t *testing.T) {
+	setupPromptTemplates(t)
+	createPromptTemplateVersion(t, 1, "support-bot", `[{"role":"system","content":"You support {{ product }} in {{lang}}."},{"role":"assistant","content":"Hello!"}]`, `{"lang":"English"}`)
+	createPromptTemplateVersion(t, 1, "support-bot", `[{"role":"system","content":"v2 {{product}}"}]`, "")
+
+	c := newPromptTemplateContext(1)
+	var request dto.GeneralOpenAIRequest
+	require.NoError(t, common.UnmarshalJsonStr(`{"model":"gpt-4o","prompt":{"id":"support-bot","version":"1","variables":{"product":"Acme"}},
+		"messages":[{"role":"user","content":"help"}]}`, &request))
+	require.NoError(t, ApplyChatPromptTemplate(c, &request))
+
+	require.Len(t, request.Messages, 3)
+	assert.Equal(t, "system", request.Messages[0].Role)
+	assert.Equal(t, "You support Acme in English.", request.Messages[0].StringContent())
+	assert.Equal(t, "assistant", request.Messages[1].Role)
+	assert.Equal(t, "help", request.Messages[2].StringContent())
+	assert.Nil(t, request.Prompt)
+
+	other := map[string]interface{}{}
+	appendPromptTemplateInfo(c, other)
+	assert.Equal(t, &PromptTemplateUsage{Id: "support-bot", Version: 1}, other["prompt_template"])
+
+	// 缺少变量与模板不存在
+	missing := dto.GeneralOpenAIRequest{Prompt: map[string]any{"id": "support-bot"}}
+	assert.ErrorContains(t, ApplyChatPromptTemplate(c, &missing), "product")
+	unknown := dto.GeneralOpenAIRequest{Prompt: map[string]any{"id": "unknown"}}
+	assert.ErrorIs(t, ApplyChatPromptTemplate(c, &unknown), model.ErrPromptTemplateNotFound)
+}
+
+func TestApplyResponsesPromptTemplate(t *testing.T) {
+	setupPromptTemplates(t)
+	createPromptTemplateVersion(t, 0, "triage", `[{"role":"developer","content":"Classify {{kind}} tickets."}]`, "")
+
+	c := newPromptTemplateContext(1)
+	request := &dto.OpenAIResponsesRequest{
+		Input:  []byte(`"my printer is broken"`),
+		Prompt: []byte(`{"id":"triage","variables":{"kind":"hardware"}}`),
+	}
+	require.NoError(t, ApplyResponsesPromptTemplate(c, request))
+	assert.Empty(t, request.Prompt)
+	assert.Equal(t, "developer", gjson.GetBytes(request.Input, "0.role").String())
+	assert.Equal(t, "Classify hardware tickets.", gjson.GetBytes(request.Input, "0.content").String())
+	assert.Equal(t, "my printer is broken", gjson.GetBytes(request.Input, "1.content").String())
+
+	// 网关未登记的 prompt 交由上游处理
+	hosted := &dto.OpenAIResponsesRequest{Prompt: []byte(`{"id":"pmpt_123","version":"2"}`)}
+	require.NoError(t, ApplyResponsesPromptTemplate(c, hosted))
+	assert.JSONEq(t, `{"id":"pmpt_123","version":"2"}`, string(hosted.Prompt))
+}
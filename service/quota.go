@@ -90,12 +90,12 @@ func PreWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usag
 	if relayInfo.UsePrice {
 		return nil
 	}
-	userQuota, err := model.GetUserQuota(relayInfo.UserId, false)
+	userQuota, availableCredit, err := model.GetUserQuotaWithCredit(relayInfo.UserId)
 	if err != nil {
 		return err
 	}
 
-	token, err := model.GetTokenByKey(strings.TrimPrefix(relayInfo.TokenKey, "sk-"), false)
+	token, err := model.GetTokenByStoredKey(strings.TrimPrefix(relayInfo.TokenKey, "sk-"))
 	if err != nil {
 		return err
 	}
@@ -138,7 +138,7 @@ func PreWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usag
 
 	quota := calculateAudioQuota(quotaInfo)
 
-	if userQuota < quota {
+	if userQuota+availableCredit < quota {
 		return fmt.Errorf("user quota is not enough, user quota: %s, need quota: %s", logger.FormatQuota(userQuota), logger.FormatQuota(quota))
 	}
 
@@ -146,8 +146,13 @@ func PreWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usag
 		return fmt.Errorf("token quota is not enough, token remain quota: %s, need quota: %s", logger.FormatQuota(token.RemainQuota), logger.FormatQuota(quota))
 	}
 
-	err = PostConsumeQuota(relayInfo, quota, 0, false)
+	if err := reserveScopedSpend(relayInfo, quota); err != nil {
+		return err
+	}
+
+	err = postConsumeQuota(relayInfo, quota, 0, false, true)
 	if err != nil {
+		recordScopedSpend(relayInfo, -quota)
 		return err
 	}
 	logger.LogInfo(ctx, "realtime streaming consume quota success, quota: "+fmt.Sprintf("%d", quota))
@@ -231,6 +236,7 @@ func PostWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, mod
 		UseTimeSeconds:   int(useTimeSeconds),
 		IsStream:         relayInfo.IsStream,
 		Group:            relayInfo.UsingGroup,
+		UpstreamCost:     CalculateUpstreamCost(relayInfo, quota),
 		Other:            other,
 	})
 }
@@ -332,6 +338,7 @@ func PostClaudeConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo,
 		UseTimeSeconds:   int(useTimeSeconds),
 		IsStream:         relayInfo.IsStream,
 		Group:            relayInfo.UsingGroup,
+		UpstreamCost:     CalculateUpstreamCost(relayInfo, quota),
 		Other:            other,
 	})
 
@@ -438,6 +445,7 @@ func PostAudioConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, u
 		UseTimeSeconds:   int(useTimeSeconds),
 		IsStream:         relayInfo.IsStream,
 		Group:            relayInfo.UsingGroup,
+		UpstreamCost:     CalculateUpstreamCost(relayInfo, quota),
 		Other:            other,
 	})
 }
@@ -452,21 +460,30 @@ func PreConsumeTokenQuota(relayInfo *relaycommon.RelayInfo, quota int) error {
 	//if relayInfo.TokenUnlimited {
 	//	return nil
 	//}
-	token, err := model.GetTokenByKey(relayInfo.TokenKey, false)
+	token, err := model.GetTokenByStoredKey(relayInfo.TokenKey)
 	if err != nil {
 		return err
 	}
 	if !relayInfo.TokenUnlimited && token.RemainQuota < quota {
 		return fmt.Errorf("token quota is not enough, token remain quota: %s, need quota: %s", logger.FormatQuota(token.RemainQuota), logger.FormatQuota(quota))
 	}
+	if err := reserveScopedSpend(relayInfo, quota); err != nil {
+		return err
+	}
 	err = model.DecreaseTokenQuota(relayInfo.TokenId, relayInfo.TokenKey, quota)
 	if err != nil {
+		recordScopedSpend(relayInfo, -quota)
 		return err
 	}
 	return nil
 }
 
 func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQuota int, sendEmail bool) (err error) {
+	return postConsumeQuota(relayInfo, quota, preConsumedQuota, sendEmail, false)
+}
+
+// postConsumeQuota scopedReserved 表示调用方已通过 reserveScopedSpend 占用了细分额度，此处不再重复累计
+func postConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQuota int, sendEmail bool, scopedReserved bool) (err error) {
 
 	// 1) Consume from wallet quota OR subscription item
 	if relayInfo != nil && relayInfo.BillingSource == BillingSourceSubscription {
@@ -490,6 +507,8 @@ func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQu
 		if err != nil {
 			return err
 		}
+		// 与 BillingSession.Settle 一致：限时额度按本次实际消耗全额（预扣 + 补差）扣减
+		drawQuotaBuckets(relayInfo.UserId, quota+preConsumedQuota)
 	}
 
 	if !relayInfo.IsPlayground {
@@ -501,6 +520,9 @@ func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQu
 		if err != nil {
 			return err
 		}
+		if !scopedReserved {
+			recordScopedSpend(relayInfo, quota)
+		}
 	}
 
 	if sendEmail {
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	quotaBucketExpireTickInterval = 5 * time.Minute
+	quotaBucketExpireBatchSize    = 200
+)
+
+var (
+	quotaBucketExpireOnce    sync.Once
+	quotaBucketExpireRunning atomic.Bool
+)
+
+// StartQuotaBucketExpireTask 启动限时额度过期任务（仅 master 节点）
+func StartQuotaBucketExpireTask() {
+	quotaBucketExpireOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("quota bucket expire task started: tick=%s", quotaBucketExpireTickInterval))
+			ticker := time.NewTicker(quotaBucketExpireTickInterval)
+			defer ticker.Stop()
+
+			runQuotaBucketExpireOnce()
+			for range ticker.C {
+				runQuotaBucketExpireOnce()
+			}
+		})
+	})
+}
+
+func runQuotaBucketExpireOnce() {
+	if !quotaBucketExpireRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer quotaBucketExpireRunning.Store(false)
+
+	ctx := context.Background()
+	total := 0
+	for {
+		n, err := model.ExpireDueQuotaBuckets(quotaBucketExpireBatchSize)
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("quota bucket expire task failed: %v", err))
+			return
+		}
+		total += n
+		if n < quotaBucketExpireBatchSize {
+			break
+		}
+	}
+	if common.DebugEnabled && total > 0 {
+		logger.LogDebug(ctx, "quota bucket maintenance: expired_count=%d", total)
+	}
+}
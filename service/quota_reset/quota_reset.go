@@ -603,7 +603,7 @@ func updateTokenRemainQuota(email string, quota int64) error {
 
 	// 同步 Redis 缓存（如果存在缓存且有 TTL），否则会出现“DB 已重置但 Redis 仍是旧额度”的不一致
 	if common.RedisEnabled && token.Key != "" {
-		hmacKey := common.GenerateHMAC(token.Key)
+		hmacKey := model.TokenCacheId(token.Key)
 		redisKey := fmt.Sprintf("token:%s", hmacKey)
 		_ = common.RedisHSetField(redisKey, constant.TokenFiledRemainQuota, int(quota))
 		if status, ok := updates["status"]; ok {
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// 网关侧的 Responses 响应存储：previous_response_id 在网关展开为完整输入后再发送到上游，
+// 对话链不再依赖保存了该响应的上游账号，渠道切换后仍可继续
+
+const (
+	defaultResponsesStoreRetentionDays = 30
+	storedResponseMaxChainLength       = 1000
+)
+
+// responsesExpansion 记录展开前的本轮输入与对话链，保存响应时只存本轮输入
+type responsesExpansion struct {
+	PreviousResponseId string
+	AncestorIds        []string
+	Input              json.RawMessage
+}
+
+func ResponsesStoreEnabled() bool {
+	return model_setting.GetGlobalSettings().ResponsesStorePolicy.Enabled
+}
+
+// ExpandPreviousResponse 将 previous_response_id 展开为「历史输入 + 历史输出 + 本次输入」，
+// 网关未保存该响应或对话链已不完整时保持原样，交由上游处理
+func ExpandPreviousResponse(c *gin.Context, request *dto.OpenAIResponsesRequest) error {
+	if !ResponsesStoreEnabled() || request.PreviousResponseID == "" {
+		return nil
+	}
+	stored, err := model.GetStoredResponse(request.PreviousResponseID, common.GetContextKeyInt(c, constant.ContextKeyTokenId))
+	if err != nil {
+		if errors.Is(err, model.ErrStoredResponseNotFound) {
+			return nil
+		}
+		return err
+	}
+	chain, err := loadStoredResponseChain(stored)
+	if err != nil {
+		if errors.Is(err, model.ErrStoredResponseNotFound) {
+			return nil
+		}
+		return err
+	}
+	history, err := storedResponseChainItems(chain, true)
+	if err != nil {
+		return err
+	}
+	input, err := normalizeResponsesInput(request.Input)
+	if err != nil {
+		return err
+	}
+	items := append(sanitizeResponsesHistoryItems(history), input...)
+	data, err := common.Marshal(items)
+	if err != nil {
+		return err
+	}
+	ancestorIds := make([]string, 0, len(chain))
+	for _, item := range chain {
+		ancestorIds = append(ancestorIds, item.ResponseId)
+	}
+	common.SetContextKey(c, constant.ContextKeyResponsesExpansion, &responsesExpansion{
+		PreviousResponseId: request.PreviousResponseID,
+		AncestorIds:        ancestorIds,
+		Input:              request.Input,
+	})
+	request.Input = data
+	request.PreviousResponseID = ""
+	return nil
+}
+
+// loadStoredResponseChain 沿 previous_response_id 加载对话链，按从起点到 stored 的顺序返回；
+// 链上任一响应缺失时返回 ErrStoredResponseNotFound
+func loadStoredResponseChain(stored *model.StoredResponse) ([]*model.StoredResponse, error) {
+	chain := []*model.StoredResponse{stored}
+	seen := map[string]bool{stored.ResponseId: true}
+	for previousId := stored.PreviousResponseId; previousId != ""; {
+		if len(chain) >= storedResponseMaxChainLength || seen[previousId] {
+			return nil, fmt.Errorf("stored response chain of %s is too long", stored.ResponseId)
+		}
+		seen[previousId] = true
+		previous, err := model.GetStoredResponse(previousId, stored.TokenId)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, previous)
+		previousId = previous.PreviousResponseId
+	}
+	slices.Reverse(chain)
+	return chain, nil
+}
+
+// storedResponseChainItems 依次拼接链上每轮的输入项与输出项，includeLastOutput 为 false 时不含最后一轮的输出
+func storedResponseChainItems(chain []*model.StoredResponse, includeLastOutput bool) ([]map[string]any, error) {
+	var items []map[string]any
+	for i, stored := range chain {
+		if len(stored.InputItems) > 0 {
+			var inputItems []map[string]any
+			if err := common.Unmarshal(stored.InputItems, &inputItems); err != nil {
+				return nil, fmt.Errorf("invalid stored input items: %w", err)
+			}
+			items = append(items, inputItems...)
+		}
+		if i == len(chain)-1 && !includeLastOutput {
+			break
+		}
+		output := gjson.GetBytes(stored.Response, "output")
+		if output.IsArray() {
+			var outputItems []map[string]any
+			if err := common.UnmarshalJsonStr(output.Raw, &outputItems); err != nil {
+				return nil, fmt.Errorf("invalid stored output items: %w", err)
+			}
+			items = append(items, outputItems...)
+		}
+	}
+	return items, nil
+}
+
+// GetStoredResponseInputItems 返回已保存响应的完整输入：对话链上的历史输入与输出加上本轮输入
+func GetStoredResponseInputItems(stored *model.StoredResponse) ([]map[string]any, error) {
+	chain, err := loadStoredResponseChain(stored)
+	if err != nil {
+		return nil, err
+	}
+	return storedResponseChainItems(chain, false)
+}
+
+func normalizeResponsesInput(input json.RawMessage) ([]map[string]any, error) {
+	switch common.GetJsonType(input) {
+	case "string":
+		var text string
+		if err := common.Unmarshal(input, &text); err != nil {
+			return nil, err
+		}
+		return []map[string]any{{"type": "message", "role": "user", "content": text}}, nil
+	case "array":
+		var items []map[string]any
+		if err := common.Unmarshal(input, &items); err != nil {
+			return nil, fmt.Errorf("invalid input: %w", err)
+		}
+		return items, nil
+	}
+	return nil, nil
+}
+
+// 历史项可能由其他上游账号生成，其 id 在当前上游不存在，发送前移除；
+// 没有 encrypted_content 的推理项无法脱离原账号复用，直接丢弃
+func sanitizeResponsesHistoryItems(items []map[string]any) []map[string]any {
+	sanitized := make([]map[string]any, 0, len(items))
+	for _, item := range items {
+		if item["type"] == "reasoning" {
+			if encrypted, _ := item["encrypted_content"].(string); encrypted == "" {
+				continue
+			}
+			sanitized = append(sanitized, item)
+			continue
+		}
+		delete(item, "id")
+		sanitized = append(sanitized, item)
+	}
+	return sanitized
+}
+
+// SaveResponsesResult 保存本轮输入、最终响应与上一轮响应 ID，请求中 store 为 false 时不保存
+func SaveResponsesResult(c *gin.Context, info *relaycommon.RelayInfo, request *dto.OpenAIResponsesRequest) {
+	if !ResponsesStoreEnabled() || string(request.Store) == "false" {
+		return
+	}
+	response, ok := common.GetContextKeyType[[]byte](c, constant.ContextKeyResponsesResult)
+	if !ok || len(response) == 0 {
+		return
+	}
+	responseId := gjson.GetBytes(response, "id").String()
+	if responseId == "" {
+		return
+	}
+	rawInput := request.Input
+	var previousResponseId string
+	var ancestorIds []string
+	if expansion, ok := common.GetContextKeyType[*responsesExpansion](c, constant.ContextKeyResponsesExpansion); ok && expansion != nil {
+		rawInput = expansion.Input
+		previousResponseId = expansion.PreviousResponseId
+		ancestorIds = expansion.AncestorIds
+	}
+	input, err := normalizeResponsesInput(rawInput)
+	if err != nil {
+		logger.LogError(c, "failed to store response: "+err.Error())
+		return
+	}
+	// 为没有 id 的输入项补充 id，供 input_items 分页使用
+	for _, item := range input {
+		if id, _ := item["id"].(string); id == "" {
+			item["id"] = "item_" + common.GetRandomString(24)
+		}
+	}
+	inputData, err := common.Marshal(input)
+	if err != nil {
+		logger.LogError(c, "failed to store response: "+err.Error())
+		return
+	}
+	// 上游收到的是展开后的请求，补回客户端传入的 previous_response_id
+	if original, ok := info.Request.(*dto.OpenAIResponsesRequest); ok && original.PreviousResponseID != "" {
+		if patched, err := sjson.SetBytes(response, "previous_response_id", original.PreviousResponseID); err == nil {
+			response = patched
+		}
+	}
+	retentionDays := model_setting.GetGlobalSettings().ResponsesStorePolicy.RetentionDays
+	if retentionDays <= 0 {
+		retentionDays = defaultResponsesStoreRetentionDays
+	}
+	stored := &model.StoredResponse{
+		ResponseId:         responseId,
+		UserId:             info.UserId,
+		TokenId:            info.TokenId,
+		Model:              info.OriginModelName,
+		PreviousResponseId: previousResponseId,
+		InputItems:         model.JSONValue(inputData),
+		Response:           model.JSONValue(response),
+		ExpiresTime:        common.GetTimestamp() + int64(retentionDays)*86400,
+	}
+	if err := model.CreateStoredResponse(stored, ancestorIds); err != nil {
+		logger.LogError(c, "failed to store response: "+err.Error())
+	}
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	storedResponseCleanupTickInterval = time.Hour
+	storedResponseCleanupBatchSize    = 500
+)
+
+var (
+	storedResponseCleanupOnce    sync.Once
+	storedResponseCleanupRunning atomic.Bool
+)
+
+// StartStoredResponseCleanupTask 启动网关侧 Responses 响应的过期清理任务（仅 master 节点）
+func StartStoredResponseCleanupTask() {
+	storedResponseCleanupOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("stored response cleanup task started: tick=%s", storedResponseCleanupTickInterval))
+			ticker := time.NewTicker(storedResponseCleanupTickInterval)
+			defer ticker.Stop()
+
+			runStoredResponseCleanupOnce()
+			for range ticker.C {
+				runStoredResponseCleanupOnce()
+			}
+		})
+	})
+}
+
+func runStoredResponseCleanupOnce() {
+	if !storedResponseCleanupRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer storedResponseCleanupRunning.Store(false)
+
+	ctx := context.Background()
+	total := 0
+	for {
+		n, err := model.DeleteExpiredStoredResponses(storedResponseCleanupBatchSize)
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("stored response cleanup task failed: %v", err))
+			return
+		}
+		total += n
+		if n < storedResponseCleanupBatchSize {
+			break
+		}
+	}
+	if common.DebugEnabled && total > 0 {
+		logger.LogDebug(ctx, "stored response cleanup: deleted_count=%d", total)
+	}
+}
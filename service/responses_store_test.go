@@ -0,0 +1,125 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func newResponsesStoreTestContext(tokenId int) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/responses", nil)
+	common.SetContextKey(c, constant.ContextKeyTokenId, tokenId)
+	return c
+}
+
+func TestResponsesStoreExpandPreviousResponse(t *testing.T) {
+	require.NoError(t, model.DB.AutoMigrate(&model.StoredResponse{}))
+	t.Cleanup(func() {
+		model.DB.Exec("DELETE FROM stored_responses")
+	})
+	policy := &model_setting.GetGlobalSettings().ResponsesStorePolicy
+	original := *policy
+	policy.Enabled = true
+	t.Cleanup(func() { *policy = original })
+
+	// 第一轮：保存输入与输出
+	c := newResponsesStoreTestContext(7)
+	firstRequest := &dto.OpenAIResponsesRequest{Model: "gpt-5", Input: []byte(`"weather in paris?"`)}
+	info := &relaycommon.RelayInfo{UserId: 1, TokenId: 7, OriginModelName: "gpt-5", Request: firstRequest}
+	common.SetContextKey(c, constant.ContextKeyResponsesResult, []byte(`{"id":"resp_1","object":"response","status":"completed","output":[
+		{"id":"rs_1","type":"reasoning","summary":[]},
+		{"id":"fc_1","type":"function_call","call_id":"call_1","name":"get_weather","arguments":"{}"}
+	]}`))
+	SaveResponsesResult(c, info, firstRequest)
+
+	stored, err := model.GetStoredResponse("resp_1", 7)
+	require.NoError(t, err)
+	assert.Equal(t, "user", gjson.GetBytes(stored.InputItems, "0.role").String())
+	assert.NotEmpty(t, gjson.GetBytes(stored.InputItems, "0.id").String())
+
+	// 其他令牌无法引用该响应
+	_, err = model.GetStoredResponse("resp_1", 8)
+	assert.ErrorIs(t, err, model.ErrStoredResponseNotFound)
+
+	// 第二轮：展开 previous_response_id
+	c = newResponsesStoreTestContext(7)
+	secondRequest := &dto.OpenAIResponsesRequest{
+		Model:              "gpt-5",
+		PreviousResponseID: "resp_1",
+		Input:              []byte(`[{"type":"function_call_output","call_id":"call_1","output":"sunny"}]`),
+	}
+	expanded, err := common.DeepCopy(secondRequest)
+	require.NoError(t, err)
+	require.NoError(t, ExpandPreviousResponse(c, expanded))
+	assert.Empty(t, expanded.PreviousResponseID)
+	items := gjson.ParseBytes(expanded.Input).Array()
+	require.Len(t, items, 3)
+	assert.Equal(t, "weather in paris?", items[0].Get("content").String())
+	assert.False(t, items[0].Get("id").Exists())
+	// 没有 encrypted_content 的推理项被丢弃，历史项的 id 被移除
+	assert.Equal(t, "function_call", items[1].Get("type").String())
+	assert.False(t, items[1].Get("id").Exists())
+	assert.Equal(t, "function_call_output", items[2].Get("type").String())
+
+	info = &relaycommon.RelayInfo{UserId: 1, TokenId: 7, OriginModelName: "gpt-5", Request: secondRequest}
+	common.SetContextKey(c, constant.ContextKeyResponsesResult, []byte(`{"id":"resp_2","object":"response","previous_response_id":null,"output":[]}`))
+	SaveResponsesResult(c, info, expanded)
+	stored, err = model.GetStoredResponse("resp_2", 7)
+	require.NoError(t, err)
+	assert.Equal(t, "resp_1", gjson.GetBytes(stored.Response, "previous_response_id").String())
+	// 只保存本轮输入，历史沿 previous_response_id 还原
+	assert.Equal(t, "resp_1", stored.PreviousResponseId)
+	assert.Len(t, gjson.GetBytes(stored.InputItems, "@this").Array(), 1)
+	inputItems, err := GetStoredResponseInputItems(stored)
+	require.NoError(t, err)
+	assert.Len(t, inputItems, 4)
+
+	// 第三轮：沿对话链展开两轮历史
+	third := &dto.OpenAIResponsesRequest{Model: "gpt-5", PreviousResponseID: "resp_2", Input: []byte(`"thanks"`)}
+	require.NoError(t, ExpandPreviousResponse(newResponsesStoreTestContext(7), third))
+	items = gjson.ParseBytes(third.Input).Array()
+	require.Len(t, items, 4)
+	assert.Equal(t, "function_call_output", items[2].Get("type").String())
+	assert.Equal(t, "thanks", items[3].Get("content").String())
+
+	// 对话链中的历史响应被删除后不再展开
+	require.NoError(t, model.DB.Where("response_id = ?", "resp_1").Delete(&model.StoredResponse{}).Error)
+	broken := &dto.OpenAIResponsesRequest{Model: "gpt-5", PreviousResponseID: "resp_2", Input: []byte(`"again"`)}
+	require.NoError(t, ExpandPreviousResponse(newResponsesStoreTestContext(7), broken))
+	assert.Equal(t, "resp_2", broken.PreviousResponseID)
+
+	// 未保存的响应保持原样交给上游
+	unknown := &dto.OpenAIResponsesRequest{Model: "gpt-5", PreviousResponseID: "resp_upstream", Input: []byte(`"hi"`)}
+	require.NoError(t, ExpandPreviousResponse(c, unknown))
+	assert.Equal(t, "resp_upstream", unknown.PreviousResponseID)
+
+	// store 为 false 时不保存
+	c = newResponsesStoreTestContext(7)
+	common.SetContextKey(c, constant.ContextKeyResponsesResult, []byte(`{"id":"resp_3","output":[]}`))
+	SaveResponsesResult(c, info, &dto.OpenAIResponsesRequest{Model: "gpt-5", Store: []byte(`false`)})
+	_, err = model.GetStoredResponse("resp_3", 7)
+	assert.ErrorIs(t, err, model.ErrStoredResponseNotFound)
+
+	require.NoError(t, model.DeleteStoredResponse("resp_2", 7))
+	assert.ErrorIs(t, model.DeleteStoredResponse("resp_2", 7), model.ErrStoredResponseNotFound)
+
+	// 过期清理
+	require.NoError(t, model.CreateStoredResponse(&model.StoredResponse{ResponseId: "resp_old", TokenId: 7, ExpiresTime: common.GetTimestamp() - 1}, nil))
+	deleted, err := model.DeleteExpiredStoredResponses(100)
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+)
+
+// 令牌之下的细分消费上限：临时令牌的消费上限、终端用户的每日额度。
+// 两者均按父令牌计费，仅额外累计计数用于校验
+
+func hasEphemeralSpendLimit(relayInfo *relaycommon.RelayInfo) bool {
+	return relayInfo.EphemeralTokenId != "" && relayInfo.EphemeralTokenMaxSpend > 0
+}
+
+func hasEndUserDailyQuota(relayInfo *relaycommon.RelayInfo) bool {
+	return relayInfo.EndUserId != "" && relayInfo.EndUserDailyQuota > 0
+}
+
+// hasScopedSpendLimit 请求是否受临时令牌消费上限或终端用户每日额度约束
+func hasScopedSpendLimit(relayInfo *relaycommon.RelayInfo) bool {
+	return hasEphemeralSpendLimit(relayInfo) || hasEndUserDailyQuota(relayInfo)
+}
+
+// checkScopedSpend 检查临时令牌消费上限与终端用户每日额度是否足够支付 quota
+func checkScopedSpend(relayInfo *relaycommon.RelayInfo, quota int) error {
+	if hasEphemeralSpendLimit(relayInfo) {
+		spent := model.GetEphemeralTokenSpend(relayInfo.EphemeralTokenId)
+		if spent+quota > relayInfo.EphemeralTokenMaxSpend {
+			return fmt.Errorf("ephemeral token spend limit is not enough, spent: %s, limit: %s, need quota: %s",
+				logger.FormatQuota(spent), logger.FormatQuota(relayInfo.EphemeralTokenMaxSpend), logger.FormatQuota(quota))
+		}
+	}
+	if hasEndUserDailyQuota(relayInfo) {
+		spent := model.GetEndUserDailySpend(relayInfo.TokenId, relayInfo.EndUserId)
+		if spent+quota > relayInfo.EndUserDailyQuota {
+			return fmt.Errorf("end user daily quota is not enough, spent: %s, limit: %s, need quota: %s",
+				logger.FormatQuota(spent), logger.FormatQuota(relayInfo.EndUserDailyQuota), logger.FormatQuota(quota))
+		}
+	}
+	return nil
+}
+
+// reserveScopedSpend 预扣费时占用临时令牌消费上限与终端用户每日额度，超出上限时不占用并返回错误；
+// 占用后若后续扣费失败，需调用 recordScopedSpend(relayInfo, -quota) 退还
+func reserveScopedSpend(relayInfo *relaycommon.RelayInfo, quota int) error {
+	if quota <= 0 {
+		return nil
+	}
+	if hasEphemeralSpendLimit(relayInfo) {
+		ok, err := model.ReserveEphemeralTokenSpend(relayInfo.EphemeralTokenId, quota, relayInfo.EphemeralTokenMaxSpend, relayInfo.EphemeralTokenExpiresAt)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("ephemeral token spend limit is not enough, spent: %s, limit: %s, need quota: %s",
+				logger.FormatQuota(model.GetEphemeralTokenSpend(relayInfo.EphemeralTokenId)), logger.FormatQuota(relayInfo.EphemeralTokenMaxSpend), logger.FormatQuota(quota))
+		}
+	}
+	if hasEndUserDailyQuota(relayInfo) {
+		ok, err := model.ReserveEndUserDailySpend(relayInfo.TokenId, relayInfo.EndUserId, quota, relayInfo.EndUserDailyQuota)
+		if err == nil && !ok {
+			err = fmt.Errorf("end user daily quota is not enough, spent: %s, limit: %s, need quota: %s",
+				logger.FormatQuota(model.GetEndUserDailySpend(relayInfo.TokenId, relayInfo.EndUserId)), logger.FormatQuota(relayInfo.EndUserDailyQuota), logger.FormatQuota(quota))
+		}
+		if err != nil {
+			// 撤销已占用的临时令牌额度
+			if hasEphemeralSpendLimit(relayInfo) {
+				if _, rollbackErr := model.AddEphemeralTokenSpend(relayInfo.EphemeralTokenId, -quota, relayInfo.EphemeralTokenExpiresAt); rollbackErr != nil {
+					common.SysLog(fmt.Sprintf("error releasing ephemeral token spend (tokenId=%d, quota=%d): %s", relayInfo.TokenId, quota, rollbackErr.Error()))
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// recordScopedSpend 累计临时令牌与终端用户的消费额度（delta 为负表示退还），失败时仅记录日志
+func recordScopedSpend(relayInfo *relaycommon.RelayInfo, delta int) {
+	if relayInfo == nil || delta == 0 {
+		return
+	}
+	if hasEphemeralSpendLimit(relayInfo) {
+		if _, err := model.AddEphemeralTokenSpend(relayInfo.EphemeralTokenId, delta, relayInfo.EphemeralTokenExpiresAt); err != nil {
+			common.SysLog(fmt.Sprintf("error recording ephemeral token spend (tokenId=%d, delta=%d): %s", relayInfo.TokenId, delta, err.Error()))
+		}
+	}
+	if hasEndUserDailyQuota(relayInfo) {
+		if _, err := model.AddEndUserDailySpend(relayInfo.TokenId, relayInfo.EndUserId, delta); err != nil {
+			common.SysLog(fmt.Sprintf("error recording end user spend (tokenId=%d, delta=%d): %s", relayInfo.TokenId, delta, err.Error()))
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// 网关计算器工具：支持 + - * / % ^（或 **）、括号、常量 pi/e 与常用数学函数
+
+var calculatorFunctions = map[string]func(args []float64) (float64, error){
+	"sqrt":  unaryCalculatorFunc(math.Sqrt),
+	"abs":   unaryCalculatorFunc(math.Abs),
+	"floor": unaryCalculatorFunc(math.Floor),
+	"ceil":  unaryCalculatorFunc(math.Ceil),
+	"round": unaryCalculatorFunc(math.Round),
+	"exp":   unaryCalculatorFunc(math.Exp),
+	"ln":    unaryCalculatorFunc(math.Log),
+	"log2":  unaryCalculatorFunc(math.Log2),
+	"log10": unaryCalculatorFunc(math.Log10),
+	"sin":   unaryCalculatorFunc(math.Sin),
+	"cos":   unaryCalculatorFunc(math.Cos),
+	"tan":   unaryCalculatorFunc(math.Tan),
+	"asin":  unaryCalculatorFunc(math.Asin),
+	"acos":  unaryCalculatorFunc(math.Acos),
+	"atan":  unaryCalculatorFunc(math.Atan),
+	"log": func(args []float64) (float64, error) {
+		switch len(args) {
+		case 1:
+			return math.Log10(args[0]), nil
+		case 2:
+			return math.Log(args[0]) / math.Log(args[1]), nil
+		}
+		return 0, errors.New("log expects 1 or 2 arguments")
+	},
+	"pow": func(args []float64) (float64, error) {
+		if len(args) != 2 {
+			return 0, errors.New("pow expects 2 arguments")
+		}
+		return math.Pow(args[0], args[1]), nil
+	},
+	"min": func(args []float64) (float64, error) {
+		if len(args) == 0 {
+			return 0, errors.New("min expects at least 1 argument")
+		}
+		result := args[0]
+		for _, arg := range args[1:] {
+			result = math.Min(result, arg)
+		}
+		return result, nil
+	},
+	"max": func(args []float64) (float64, error) {
+		if len(args) == 0 {
+			return 0, errors.New("max expects at least 1 argument")
+		}
+		result := args[0]
+		for _, arg := range args[1:] {
+			result = math.Max(result, arg)
+		}
+		return result, nil
+	},
+}
+
+var calculatorConstants = map[string]float64{
+	"pi": math.Pi,
+	"e":  math.E,
+}
+
+func unaryCalculatorFunc(fn func(float64) float64) func(args []float64) (float64, error) {
+	return func(args []float64) (float64, error) {
+		if len(args) != 1 {
+			return 0, errors.New("function expects 1 argument")
+		}
+		return fn(args[0]), nil
+	}
+}
+
+// EvaluateExpression 计算算术表达式
+func EvaluateExpression(expression string) (float64, error) {
+	parser := &calculatorParser{input: strings.ReplaceAll(expression, "**", "^")}
+	value, err := parser.parseExpression()
+	if err != nil {
+		return 0, err
+	}
+	parser.skipSpaces()
+	if parser.pos < len(parser.input) {
+		return 0, fmt.Errorf("unexpected %q at position %d", parser.input[parser.pos], parser.pos)
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, errors.New("result is not a finite number")
+	}
+	return value, nil
+}
+
+// FormatCalculatorResult 整数结果不带小数点，其余保留必要精度
+func FormatCalculatorResult(value float64) string {
+	return strconv.FormatFloat(value, 'g', 15, 64)
+}
+
+type calculatorParser struct {
+	input string
+	pos   int
+	depth int
+}
+
+const calculatorMaxDepth = 64
+
+func (p *calculatorParser) skipSpaces() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *calculatorParser) peek() byte {
+	p.skipSpaces()
+	if p.pos < len(p.input) {
+		return p.input[p.pos]
+	}
+	return 0
+}
+
+// parseExpression expression := term (('+' | '-') term)*
+func (p *calculatorParser) parseExpression() (float64, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > calculatorMaxDepth {
+		return 0, errors.New("expression is nested too deeply")
+	}
+	left, err := p.parseTerm()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := p.peek()
+		if op != '+' && op != '-' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseTerm()
+		if err != nil {
+			return 0, err
+		}
+		if op == '+' {
+			left += right
+		} else {
+			left -= right
+		}
+	}
+}
+
+// parseTerm term := unary (('*' | '/' | '%') unary)*
+func (p *calculatorParser) parseTerm() (float64, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := p.peek()
+		if op != '*' && op != '/' && op != '%' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case '*':
+			left *= right
+		case '/':
+			if right == 0 {
+				return 0, errors.New("division by zero")
+			}
+			left /= right
+		default:
+			if right == 0 {
+				return 0, errors.New("division by zero")
+			}
+			left = math.Mod(left, right)
+		}
+	}
+}
+
+// parseUnary unary := ('-' | '+') unary | power
+func (p *calculatorParser) parseUnary() (float64, error) {
+	switch p.peek() {
+	case '-':
+		p.pos++
+		value, err := p.parseUnary()
+		return -value, err
+	case '+':
+		p.pos++
+		return p.parseUnary()
+	}
+	return p.parsePower()
+}
+
+// parsePower power := primary ('^' unary)?，右结合
+func (p *calculatorParser) parsePower() (float64, error) {
+	base, err := p.parsePrimary()
+	if err != nil {
+		return 0, err
+	}
+	if p.peek() != '^' {
+		return base, nil
+	}
+	p.pos++
+	exponent, err := p.parseUnary()
+	if err != nil {
+		return 0, err
+	}
+	return math.Pow(base, exponent), nil
+}
+
+// parsePrimary primary := number | constant | function '(' args ')' | '(' expression ')'
+func (p *calculatorParser) parsePrimary() (float64, error) {
+	c := p.peek()
+	switch {
+	case c == '(':
+		p.pos++
+		value, err := p.parseExpression()
+		if err != nil {
+			return 0, err
+		}
+		if p.peek() != ')' {
+			return 0, errors.New("missing closing parenthesis")
+		}
+		p.pos++
+		return value, nil
+	case c == '.' || (c >= '0' && c <= '9'):
+		return p.parseNumber()
+	case unicode.IsLetter(rune(c)):
+		return p.parseIdentifier()
+	case c == 0:
+		return 0, errors.New("unexpected end of expression")
+	}
+	return 0, fmt.Errorf("unexpected %q at position %d", c, p.pos)
+}
+
+func (p *calculatorParser) parseNumber() (float64, error) {
+	start := p.pos
+	for p.pos < len(p.input) {
+		c := p.input[p.pos]
+		isExponentSign := (c == '+' || c == '-') && p.pos > start && (p.input[p.pos-1] == 'e' || p.input[p.pos-1] == 'E')
+		if (c >= '0' && c <= '9') || c == '.' || c == 'e' || c == 'E' || c == '_' || isExponentSign {
+			p.pos++
+			continue
+		}
+		break
+	}
+	value, err := strconv.ParseFloat(strings.ReplaceAll(p.input[start:p.pos], "_", ""), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", p.input[start:p.pos])
+	}
+	return value, nil
+}
+
+func (p *calculatorParser) parseIdentifier() (float64, error) {
+	start := p.pos
+	for p.pos < len(p.input) && (unicode.IsLetter(rune(p.input[p.pos])) || unicode.IsDigit(rune(p.input[p.pos]))) {
+		p.pos++
+	}
+	name := strings.ToLower(p.input[start:p.pos])
+	if p.peek() != '(' {
+		if value, ok := calculatorConstants[name]; ok {
+			return value, nil
+		}
+		return 0, fmt.Errorf("unknown constant %q", name)
+	}
+	fn, ok := calculatorFunctions[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown function %q", name)
+	}
+	p.pos++
+	var args []float64
+	if p.peek() != ')' {
+		for {
+			arg, err := p.parseExpression()
+			if err != nil {
+				return 0, err
+			}
+			args = append(args, arg)
+			if p.peek() != ',' {
+				break
+			}
+			p.pos++
+		}
+	}
+	if p.peek() != ')' {
+		return 0, fmt.Errorf("missing closing parenthesis for %s", name)
+	}
+	p.pos++
+	return fn(args)
+}
@@ -0,0 +1,319 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+// 网关侧工具：请求 tools 中声明 {"type":"gateway","function":{"name":"web_fetch"}} 的工具由网关补全定义并执行，
+// 上游返回这些工具的 tool_calls 时，网关执行工具、追加结果并再次请求模型
+
+const (
+	ServerToolTypeGateway = "gateway"
+
+	ServerToolWebFetch   = "web_fetch"
+	ServerToolCalculator = "calculator"
+
+	serverToolResultMaxChars     = 20000
+	serverToolResponseMaxBytes   = 2 << 20
+	serverToolWebFetchTimeout    = 20 * time.Second
+	serverToolHttpDefaultTimeout = 30 * time.Second
+)
+
+var (
+	htmlIgnoredBlockRegex = regexp.MustCompile(`(?is)<(script|style|noscript|svg|head)\b.*?</(script|style|noscript|svg|head)>`)
+	htmlBreakTagRegex     = regexp.MustCompile(`(?i)<(br|/p|/div|/li|/tr|/h[1-6]|/section|/article)\b[^>]*>`)
+	htmlTagRegex          = regexp.MustCompile(`(?s)<[^>]*>`)
+	blankLinesRegex       = regexp.MustCompile(`\n\s*\n+`)
+	inlineSpacesRegex     = regexp.MustCompile(`[ \t\f\r]+`)
+)
+
+type serverTool struct {
+	definition dto.FunctionRequest
+	execute    func(ctx context.Context, arguments string) (string, error)
+}
+
+// ServerToolSet 本次请求启用的网关工具
+type ServerToolSet struct {
+	MaxRounds int
+	tools     map[string]*serverTool
+}
+
+// availableServerTools 管理员启用的全部网关工具
+func availableServerTools(policy *model_setting.ServerToolPolicy) map[string]*serverTool {
+	tools := make(map[string]*serverTool)
+	if policy.WebFetchEnabled {
+		tools[ServerToolWebFetch] = &serverTool{
+			definition: dto.FunctionRequest{
+				Name:        ServerToolWebFetch,
+				Description: "Fetch a web page over HTTP(S) and return its text content.",
+				Parameters: map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"url": map[string]any{"type": "string", "description": "Absolute http or https URL to fetch."},
+					},
+					"required": []string{"url"},
+				},
+			},
+			execute: executeWebFetch,
+		}
+	}
+	if policy.CalculatorEnabled {
+		tools[ServerToolCalculator] = &serverTool{
+			definition: dto.FunctionRequest{
+				Name:        ServerToolCalculator,
+				Description: "Evaluate an arithmetic expression. Supports + - * / % ^, parentheses, pi, e and functions such as sqrt, abs, round, floor, ceil, exp, ln, log, sin, cos, tan, min, max and pow.",
+				Parameters: map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"expression": map[string]any{"type": "string", "description": "Expression to evaluate, e.g. (3 + 4) * sqrt(2)."},
+					},
+					"required": []string{"expression"},
+				},
+			},
+			execute: executeCalculator,
+		}
+	}
+	for _, httpTool := range policy.HttpTools {
+		if httpTool.Name == "" || httpTool.URL == "" {
+			continue
+		}
+		httpTool := httpTool
+		parameters := any(httpTool.Parameters)
+		if httpTool.Parameters == nil {
+			parameters = map[string]any{"type": "object", "properties": map[string]any{}}
+		}
+		tools[httpTool.Name] = &serverTool{
+			definition: dto.FunctionRequest{
+				Name:        httpTool.Name,
+				Description: httpTool.Description,
+				Parameters:  parameters,
+			},
+			execute: func(ctx context.Context, arguments string) (string, error) {
+				return executeHttpTool(ctx, &httpTool, arguments)
+			},
+		}
+	}
+	return tools
+}
+
+// PrepareServerTools 将请求 tools 中的网关工具替换为完整的函数定义；请求未使用网关工具时返回 nil
+func PrepareServerTools(request *dto.GeneralOpenAIRequest) (*ServerToolSet, error) {
+	var requested []string
+	clientTools := make(map[string]bool)
+	for _, tool := range request.Tools {
+		if tool.Type == ServerToolTypeGateway {
+			requested = append(requested, tool.Function.Name)
+		} else if tool.Function.Name != "" {
+			clientTools[tool.Function.Name] = true
+		}
+	}
+	if len(requested) == 0 {
+		return nil, nil
+	}
+	policy := &model_setting.GetGlobalSettings().ServerToolPolicy
+	if !policy.Enabled {
+		return nil, errors.New("gateway tools are not enabled")
+	}
+	available := availableServerTools(policy)
+	set := &ServerToolSet{
+		MaxRounds: policy.MaxRounds,
+		tools:     make(map[string]*serverTool, len(requested)),
+	}
+	if set.MaxRounds <= 0 {
+		set.MaxRounds = 1
+	}
+	for _, name := range requested {
+		tool, ok := available[name]
+		if !ok {
+			return nil, fmt.Errorf("gateway tool %q is not available", name)
+		}
+		if clientTools[name] {
+			return nil, fmt.Errorf("tool name %q conflicts with gateway tool", name)
+		}
+		set.tools[name] = tool
+	}
+
+	tools := make([]dto.ToolCallRequest, 0, len(request.Tools))
+	for _, tool := range request.Tools {
+		if tool.Type == ServerToolTypeGateway {
+			tool = dto.ToolCallRequest{Type: "function", Function: set.tools[tool.Function.Name].definition}
+		}
+		tools = append(tools, tool)
+	}
+	request.Tools = tools
+	return set, nil
+}
+
+// Owns 工具调用是否全部属于网关工具，部分属于客户端时交由客户端处理
+func (s *ServerToolSet) Owns(calls []dto.ToolCallRequest) bool {
+	if len(calls) == 0 {
+		return false
+	}
+	for _, call := range calls {
+		if _, ok := s.tools[call.Function.Name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Execute 执行工具调用，失败时将错误信息作为工具结果交给模型处理
+func (s *ServerToolSet) Execute(ctx context.Context, call dto.ToolCallRequest) string {
+	tool, ok := s.tools[call.Function.Name]
+	if !ok {
+		return fmt.Sprintf("error: unknown tool %s", call.Function.Name)
+	}
+	result, err := tool.execute(ctx, call.Function.Arguments)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	return truncateServerToolResult(result)
+}
+
+func truncateServerToolResult(result string) string {
+	if utf8.RuneCountInString(result) <= serverToolResultMaxChars {
+		return result
+	}
+	runes := []rune(result)
+	return string(runes[:serverToolResultMaxChars]) + "\n...[truncated]"
+}
+
+func parseServerToolArguments(arguments string, v any) error {
+	if strings.TrimSpace(arguments) == "" {
+		arguments = "{}"
+	}
+	if err := common.UnmarshalJsonStr(arguments, v); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
+
+func executeCalculator(_ context.Context, arguments string) (string, error) {
+	var args struct {
+		Expression string `json:"expression"`
+	}
+	if err := parseServerToolArguments(arguments, &args); err != nil {
+		return "", err
+	}
+	value, err := EvaluateExpression(args.Expression)
+	if err != nil {
+		return "", err
+	}
+	return FormatCalculatorResult(value), nil
+}
+
+func serverToolHttpClient() *http.Client {
+	if client := GetHttpClient(); client != nil {
+		return client
+	}
+	return http.DefaultClient
+}
+
+// executeWebFetch 抓取网页，受 SSRF 防护设置约束，HTML 转换为纯文本
+func executeWebFetch(ctx context.Context, arguments string) (string, error) {
+	var args struct {
+		URL string `json:"url"`
+	}
+	if err := parseServerToolArguments(arguments, &args); err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(args.URL, "http://") && !strings.HasPrefix(args.URL, "https://") {
+		return "", errors.New("url must start with http:// or https://")
+	}
+	fetchSetting := system_setting.GetFetchSetting()
+	if err := common.ValidateURLWithFetchSetting(args.URL, fetchSetting.EnableSSRFProtection, fetchSetting.AllowPrivateIp, fetchSetting.DomainFilterMode, fetchSetting.IpFilterMode, fetchSetting.DomainList, fetchSetting.IpList, fetchSetting.AllowedPorts, fetchSetting.ApplyIPFilterForDomain); err != nil {
+		return "", fmt.Errorf("url is not allowed: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, serverToolWebFetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, args.URL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; new-api web_fetch)")
+	req.Header.Set("Accept", "text/html,text/plain,application/json;q=0.9,*/*;q=0.5")
+	resp, err := serverToolHttpClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer CloseResponseBodyGracefully(resp)
+	body, err := io.ReadAll(io.LimitReader(resp.Body, serverToolResponseMaxBytes))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return "", fmt.Errorf("fetch failed with status %d", resp.StatusCode)
+	}
+	if strings.Contains(resp.Header.Get("Content-Type"), "html") {
+		return HtmlToText(string(body)), nil
+	}
+	return string(body), nil
+}
+
+// HtmlToText 粗略提取网页正文文本：移除脚本与样式，保留段落换行
+func HtmlToText(content string) string {
+	content = htmlIgnoredBlockRegex.ReplaceAllString(content, "")
+	content = htmlBreakTagRegex.ReplaceAllString(content, "\n")
+	content = htmlTagRegex.ReplaceAllString(content, "")
+	content = html.UnescapeString(content)
+	content = inlineSpacesRegex.ReplaceAllString(content, " ")
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	content = blankLinesRegex.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(content)
+}
+
+// executeHttpTool 将工具参数 POST 到管理员登记的地址，地址由管理员配置，不做 SSRF 限制
+func executeHttpTool(ctx context.Context, tool *model_setting.ServerHttpTool, arguments string) (string, error) {
+	if strings.TrimSpace(arguments) == "" {
+		arguments = "{}"
+	}
+	if !common.IsJsonObject(arguments) {
+		return "", errors.New("arguments must be a json object")
+	}
+	timeout := serverToolHttpDefaultTimeout
+	if tool.TimeoutSeconds > 0 {
+		timeout = time.Duration(tool.TimeoutSeconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tool.URL, bytes.NewBufferString(arguments))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range tool.Headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := serverToolHttpClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer CloseResponseBodyGracefully(resp)
+	body, err := io.ReadAll(io.LimitReader(resp.Body, serverToolResponseMaxBytes))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return "", fmt.Errorf("tool endpoint returned status %d: %s", resp.StatusCode, truncateServerToolResult(string(body)))
+	}
+	return string(body), nil
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluateExpression(t *testing.T) {
+	cases := map[string]string{
+		"1 + 2 * 3":          "7",
+		"(1 + 2) * 3":        "9",
+		"-2 ^ 2":             "-4",
+		"2 ** 3 ** 2":        "512",
+		"10 % 4":             "2",
+		"sqrt(16) + abs(-3)": "7",
+		"max(1, 5, 3)":       "5",
+		"log(8, 2)":          "3",
+		"0.1 + 0.2":          "0.3",
+		"1_000 * 1.5e2":      "150000",
+		"round(pi * 100)":    "314",
+	}
+	for expression, expected := range cases {
+		value, err := EvaluateExpression(expression)
+		require.NoError(t, err, expression)
+		assert.Equal(t, expected, FormatCalculatorResult(value), expression)
+	}
+
+	for _, expression := range []string{"", "1 +", "1 / 0", "(1 + 2", "foo(1)", "sqrt(-1)", "1 2"} {
+		_, err := EvaluateExpression(expression)
+		assert.Error(t, err, expression)
+	}
+}
+
+func TestHtmlToText(t *testing.T) {
+	text := HtmlToText(`<html><head><title>x</title><style>p{}</style></head><body>
+		<h1>Title</h1><script>alert(1)</script><p>Hello &amp; <b>welcome</b></p><ul><li>one</li><li>two</li></ul></body></html>`)
+	assert.Equal(t, "Title\nHello & welcome\none\ntwo", text)
+}
+
+func withServerToolPolicy(t *testing.T, policy model_setting.ServerToolPolicy) {
+	settings := model_setting.GetGlobalSettings()
+	original := settings.ServerToolPolicy
+	settings.ServerToolPolicy = policy
+	t.Cleanup(func() { settings.ServerToolPolicy = original })
+}
+
+func TestPrepareServerTools(t *testing.T) {
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secret", r.Header.Get("X-Api-Key"))
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write([]byte(`{"echo":` + string(body) + `}`))
+	}))
+	defer endpoint.Close()
+	withServerToolPolicy(t, model_setting.ServerToolPolicy{
+		Enabled:           true,
+		MaxRounds:         3,
+		CalculatorEnabled: true,
+		HttpTools: []model_setting.ServerHttpTool{{
+			Name: "lookup_order", Description: "Look up an order", URL: endpoint.URL, Headers: map[string]string{"X-Api-Key": "secret"},
+		}},
+	})
+
+	request := &dto.GeneralOpenAIRequest{Tools: []dto.ToolCallRequest{
+		{Type: ServerToolTypeGateway, Function: dto.FunctionRequest{Name: ServerToolCalculator}},
+		{Type: ServerToolTypeGateway, Function: dto.FunctionRequest{Name: "lookup_order"}},
+		{Type: "function", Function: dto.FunctionRequest{Name: "get_weather"}},
+	}}
+	tools, err := PrepareServerTools(request)
+	require.NoError(t, err)
+	require.NotNil(t, tools)
+	assert.Equal(t, 3, tools.MaxRounds)
+	require.Len(t, request.Tools, 3)
+	assert.Equal(t, "function", request.Tools[0].Type)
+	assert.NotEmpty(t, request.Tools[0].Function.Description)
+	assert.NotNil(t, request.Tools[1].Function.Parameters)
+
+	calculatorCall := dto.ToolCallRequest{Function: dto.FunctionRequest{Name: ServerToolCalculator, Arguments: `{"expression":"6*7"}`}}
+	orderCall := dto.ToolCallRequest{Function: dto.FunctionRequest{Name: "lookup_order", Arguments: `{"id":"o_1"}`}}
+	weatherCall := dto.ToolCallRequest{Function: dto.FunctionRequest{Name: "get_weather"}}
+	assert.True(t, tools.Owns([]dto.ToolCallRequest{calculatorCall, orderCall}))
+	assert.False(t, tools.Owns([]dto.ToolCallRequest{calculatorCall, weatherCall}))
+	assert.Equal(t, "42", tools.Execute(context.Background(), calculatorCall))
+	assert.Equal(t, `{"echo":{"id":"o_1"}}`, tools.Execute(context.Background(), orderCall))
+	assert.Contains(t, tools.Execute(context.Background(), dto.ToolCallRequest{Function: dto.FunctionRequest{Name: ServerToolCalculator, Arguments: `{"expression":"1/0"}`}}), "error:")
+
+	// 未使用网关工具
+	tools, err = PrepareServerTools(&dto.GeneralOpenAIRequest{Tools: []dto.ToolCallRequest{{Type: "function", Function: dto.FunctionRequest{Name: "get_weather"}}}})
+	assert.NoError(t, err)
+	assert.Nil(t, tools)
+
+	// 未启用的工具与重名工具
+	_, err = PrepareServerTools(&dto.GeneralOpenAIRequest{Tools: []dto.ToolCallRequest{{Type: ServerToolTypeGateway, Function: dto.FunctionRequest{Name: ServerToolWebFetch}}}})
+	assert.Error(t, err)
+	_, err = PrepareServerTools(&dto.GeneralOpenAIRequest{Tools: []dto.ToolCallRequest{
+		{Type: ServerToolTypeGateway, Function: dto.FunctionRequest{Name: ServerToolCalculator}},
+		{Type: "function", Function: dto.FunctionRequest{Name: ServerToolCalculator}},
+	}})
+	assert.Error(t, err)
+}
+
+func TestWebFetchRejectsPrivateAddress(t *testing.T) {
+	result, err := executeWebFetch(context.Background(), `{"url":"http://127.0.0.1/admin"}`)
+	assert.Error(t, err)
+	assert.Empty(t, result)
+}
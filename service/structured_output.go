@@ -0,0 +1,172 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/service/openaicompat"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 结构化输出校验：部分渠道忽略 response_format，网关校验最终回答，不符合时追加修复提示重新请求
+
+const defaultStructuredOutputRepairPrompt = "Your previous reply is not valid for the required JSON output format.\n" +
+	"Problems:\n{errors}\n" +
+	"Reply again with only a single JSON value that satisfies the schema below, without code fences or any other text.\n" +
+	"Schema:\n{schema}"
+
+// StructuredOutputValidator 本次请求的结构化输出要求
+type StructuredOutputValidator struct {
+	MaxRepairAttempts int
+	schema            *JSONSchemaValidator
+	schemaText        string
+	repairPrompt      string
+}
+
+// StructuredOutputAttempt 单个渠道上的校验记录，写入 admin_info.structured_output
+type StructuredOutputAttempt struct {
+	ChannelId int      `json:"channel_id"`
+	Repairs   int      `json:"repairs"`
+	Passed    bool     `json:"passed"`
+	Errors    []string `json:"errors,omitempty"`
+}
+
+// IsStructuredOutputEnforced 模型或分组是否启用了结构化输出校验
+func IsStructuredOutputEnforced(modelName string, group string) bool {
+	policy := model_setting.GetGlobalSettings().StructuredOutputPolicy
+	if !policy.Enabled {
+		return false
+	}
+	if len(policy.ModelPatterns) == 0 && len(policy.Groups) == 0 {
+		return true
+	}
+	if openaicompat.MatchAnyRegex(policy.ModelPatterns, modelName) {
+		return true
+	}
+	for _, g := range policy.Groups {
+		if strings.TrimSpace(g) == group && group != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// PrepareStructuredOutput 请求要求 JSON 输出且策略启用时返回校验器，否则返回 nil
+func PrepareStructuredOutput(request *dto.GeneralOpenAIRequest, modelName string, group string) (*StructuredOutputValidator, error) {
+	if request.ResponseFormat == nil {
+		return nil, nil
+	}
+	formatType := request.ResponseFormat.Type
+	if formatType != "json_schema" && formatType != "json_object" {
+		return nil, nil
+	}
+	if !IsStructuredOutputEnforced(modelName, group) {
+		return nil, nil
+	}
+	policy := model_setting.GetGlobalSettings().StructuredOutputPolicy
+	validator := &StructuredOutputValidator{
+		MaxRepairAttempts: policy.MaxRepairAttempts,
+		schemaText:        `{"type":"object"}`,
+		repairPrompt:      policy.RepairPrompt,
+	}
+	if validator.MaxRepairAttempts < 0 {
+		validator.MaxRepairAttempts = 0
+	}
+	if validator.repairPrompt == "" {
+		validator.repairPrompt = defaultStructuredOutputRepairPrompt
+	}
+	if formatType == "json_object" {
+		schema, _ := NewJSONSchemaValidator(validator.schemaText)
+		validator.schema = schema
+		return validator, nil
+	}
+
+	var format dto.FormatJsonSchema
+	if err := common.Unmarshal(request.ResponseFormat.JsonSchema, &format); err != nil {
+		return nil, fmt.Errorf("invalid response_format.json_schema: %w", err)
+	}
+	if format.Schema == nil {
+		// 未提供 schema 时仅要求输出 JSON
+		validator.schemaText = `{}`
+	} else {
+		schemaText, err := common.Marshal(format.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("invalid response_format.json_schema.schema: %w", err)
+		}
+		validator.schemaText = string(schemaText)
+	}
+	schema, err := NewJSONSchemaValidator(validator.schemaText)
+	if err != nil {
+		return nil, fmt.Errorf("invalid response_format.json_schema.schema: %w", err)
+	}
+	validator.schema = schema
+	return validator, nil
+}
+
+// Validate 校验回答内容，返回去除代码块包裹后的 JSON 文本与校验错误
+func (v *StructuredOutputValidator) Validate(content string) (string, []string) {
+	normalized := stripJSONCodeFence(content)
+	if normalized == "" {
+		return normalized, []string{"/: content is empty"}
+	}
+	var value any
+	if err := common.UnmarshalJsonStr(normalized, &value); err != nil {
+		return normalized, []string{"/: content is not valid JSON: " + err.Error()}
+	}
+	return normalized, v.schema.Validate(value)
+}
+
+// RepairMessage 生成修复提示
+func (v *StructuredOutputValidator) RepairMessage(validationErrors []string) string {
+	return strings.NewReplacer(
+		"{errors}", "- "+strings.Join(validationErrors, "\n- "),
+		"{schema}", v.schemaText,
+	).Replace(v.repairPrompt)
+}
+
+// stripJSONCodeFence 去除模型常见的 ```json 代码块包裹
+func stripJSONCodeFence(content string) string {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, "```") || !strings.HasSuffix(content, "```") || len(content) < 6 {
+		return content
+	}
+	content = strings.TrimSuffix(strings.TrimPrefix(content, "```"), "```")
+	if newline := strings.IndexByte(content, '\n'); newline >= 0 && !strings.ContainsAny(content[:newline], "{[\"") {
+		content = content[newline+1:]
+	}
+	return strings.TrimSpace(content)
+}
+
+// NewStructuredOutputError 修复次数用尽后返回的错误；策略允许时由渠道重试逻辑切换渠道
+func NewStructuredOutputError(repairs int, validationErrors []string) *types.NewAPIError {
+	err := fmt.Errorf("model output does not match the requested response_format after %d repair attempts: %s",
+		repairs, strings.Join(validationErrors, "; "))
+	if model_setting.GetGlobalSettings().StructuredOutputPolicy.RetryOtherChannel {
+		return types.NewErrorWithStatusCode(err, types.ErrorCodeStructuredOutputInvalid, http.StatusBadGateway)
+	}
+	return types.NewErrorWithStatusCode(err, types.ErrorCodeStructuredOutputInvalid, http.StatusBadGateway, types.ErrOptionWithSkipRetry())
+}
+
+// RecordStructuredOutputAttempt 记录校验结果，渠道重试时逐个追加
+func RecordStructuredOutputAttempt(c *gin.Context, attempt StructuredOutputAttempt) {
+	attempts, _ := common.GetContextKeyType[[]StructuredOutputAttempt](c, constant.ContextKeyStructuredOutputAttempts)
+	common.SetContextKey(c, constant.ContextKeyStructuredOutputAttempts, append(attempts, attempt))
+}
+
+func AppendStructuredOutputAdminInfo(c *gin.Context, adminInfo map[string]interface{}) {
+	if c == nil || adminInfo == nil {
+		return
+	}
+	attempts, ok := common.GetContextKeyType[[]StructuredOutputAttempt](c, constant.ContextKeyStructuredOutputAttempts)
+	if !ok || len(attempts) == 0 {
+		return
+	}
+	adminInfo["structured_output"] = attempts
+}
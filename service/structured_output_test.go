@@ -0,0 +1,153 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONSchemaValidator(t *testing.T) {
+	validator, err := NewJSONSchemaValidator(`{
+		"type": "object",
+		"properties": {
+			"name": {"type": "string", "minLength": 1},
+			"age": {"type": "integer", "minimum": 0},
+			"tags": {"type": "array", "items": {"$ref": "#/$defs/tag"}, "maxItems": 2},
+			"status": {"enum": ["active", "inactive"]},
+			"nickname": {"anyOf": [{"type": "string"}, {"type": "null"}]}
+		},
+		"required": ["name", "age"],
+		"additionalProperties": false,
+		"$defs": {"tag": {"type": "string", "pattern": "^[a-z]+$"}}
+	}`)
+	require.NoError(t, err)
+
+	var valid any
+	require.NoError(t, common.UnmarshalJsonStr(`{"name":"bob","age":3,"tags":["a","b"],"status":"active","nickname":null}`, &valid))
+	assert.Empty(t, validator.Validate(valid))
+
+	var invalid any
+	require.NoError(t, common.UnmarshalJsonStr(`{"name":"","age":1.5,"tags":["A","b","c"],"status":"gone","extra":1}`, &invalid))
+	assert.ElementsMatch(t, []string{
+		`/: unexpected property "extra"`,
+		"/age: expected integer, got number",
+		"/name: expected at least 1 characters",
+		`/status: value must be one of ["active","inactive"]`,
+		"/tags: expected at most 2 items, got 3",
+		`/tags/0: value does not match pattern "^[a-z]+$"`,
+	}, validator.Validate(invalid))
+
+	var missing any
+	require.NoError(t, common.UnmarshalJsonStr(`[]`, &missing))
+	assert.Equal(t, []string{"/: expected object, got array"}, validator.Validate(missing))
+}
+
+func TestJSONSchemaValidatorComplexity(t *testing.T) {
+	// 不消耗输入的 $ref 循环在解析时拒绝，经由 properties 的递归引用允许
+	_, err := NewJSONSchemaValidator(`{"allOf":[{"$ref":"#"},{"$ref":"#"}]}`)
+	assert.ErrorContains(t, err, "$ref cycle")
+	_, err = NewJSONSchemaValidator(`{"$defs":{"a":{"anyOf":[{"$ref":"#/$defs/b"}]},"b":{"not":{"$ref":"#/$defs/a"}}},"$ref":"#/$defs/a"}`)
+	assert.ErrorContains(t, err, "$ref cycle")
+	_, err = NewJSONSchemaValidator(`{"$ref":"#/$defs/missing"}`)
+	assert.Error(t, err)
+	tree, err := NewJSONSchemaValidator(`{"type":"object","properties":{"children":{"type":"array","items":{"$ref":"#"}}}}`)
+	require.NoError(t, err)
+	var value any
+	require.NoError(t, common.UnmarshalJsonStr(`{"children":[{"children":[]}]}`, &value))
+	assert.Empty(t, tree.Validate(value))
+
+	// 无循环但逐层翻倍的 allOf 超出步数预算后失败
+	defs := `"d20":{"type":"string"}`
+	for i := 19; i >= 0; i-- {
+		defs += fmt.Sprintf(`,"d%d":{"allOf":[{"$ref":"#/$defs/d%d"},{"$ref":"#/$defs/d%d"}]}`, i, i+1, i+1)
+	}
+	explosive, err := NewJSONSchemaValidator(`{"$defs":{` + defs + `},"$ref":"#/$defs/d0"}`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/: schema is too complex to validate"}, explosive.Validate("x"))
+}
+
+func withStructuredOutputPolicy(t *testing.T, policy model_setting.StructuredOutputPolicy) {
+	settings := model_setting.GetGlobalSettings()
+	original := settings.StructuredOutputPolicy
+	settings.StructuredOutputPolicy = policy
+	t.Cleanup(func() { settings.StructuredOutputPolicy = original })
+}
+
+func TestPrepareStructuredOutput(t *testing.T) {
+	withStructuredOutputPolicy(t, model_setting.StructuredOutputPolicy{
+		Enabled:           true,
+		ModelPatterns:     []string{"^llama"},
+		Groups:            []string{"vip"},
+		MaxRepairAttempts: 2,
+	})
+	request := &dto.GeneralOpenAIRequest{ResponseFormat: &dto.ResponseFormat{
+		Type:       "json_schema",
+		JsonSchema: []byte(`{"name":"answer","strict":true,"schema":{"type":"object","properties":{"answer":{"type":"number"}},"required":["answer"]}}`),
+	}}
+
+	validator, err := PrepareStructuredOutput(request, "llama3.1", "default")
+	require.NoError(t, err)
+	require.NotNil(t, validator)
+	assert.Equal(t, 2, validator.MaxRepairAttempts)
+
+	normalized, validationErrors := validator.Validate("```json\n{\"answer\": 42}\n```")
+	assert.Empty(t, validationErrors)
+	assert.Equal(t, `{"answer": 42}`, normalized)
+	_, validationErrors = validator.Validate(`{"answer": "42"}`)
+	assert.Equal(t, []string{"/answer: expected number, got string"}, validationErrors)
+	_, validationErrors = validator.Validate("The answer is 42.")
+	require.Len(t, validationErrors, 1)
+	assert.Contains(t, validationErrors[0], "not valid JSON")
+	assert.Contains(t, validator.RepairMessage(validationErrors), `"required":["answer"]`)
+
+	// 按分组启用；未命中模型与分组时不校验
+	validator, err = PrepareStructuredOutput(request, "gpt-4o", "vip")
+	require.NoError(t, err)
+	assert.NotNil(t, validator)
+	validator, err = PrepareStructuredOutput(request, "gpt-4o", "default")
+	require.NoError(t, err)
+	assert.Nil(t, validator)
+
+	validator, err = PrepareStructuredOutput(&dto.GeneralOpenAIRequest{ResponseFormat: &dto.ResponseFormat{Type: "json_object"}}, "llama3.1", "")
+	require.NoError(t, err)
+	_, validationErrors = validator.Validate(`[1, 2]`)
+	assert.NotEmpty(t, validationErrors)
+
+	_, err = PrepareStructuredOutput(&dto.GeneralOpenAIRequest{ResponseFormat: &dto.ResponseFormat{
+		Type: "json_schema", JsonSchema: []byte(`{"schema":"not a schema"}`),
+	}}, "llama3.1", "")
+	assert.Error(t, err)
+}
+
+func TestStructuredOutputErrorAndAdminInfo(t *testing.T) {
+	withStructuredOutputPolicy(t, model_setting.StructuredOutputPolicy{Enabled: true, RetryOtherChannel: false})
+	apiErr := NewStructuredOutputError(1, []string{"/: content is empty"})
+	assert.Equal(t, types.ErrorCodeStructuredOutputInvalid, apiErr.GetErrorCode())
+	assert.Equal(t, http.StatusBadGateway, apiErr.StatusCode)
+	assert.True(t, types.IsSkipRetryError(apiErr))
+
+	model_setting.GetGlobalSettings().StructuredOutputPolicy.RetryOtherChannel = true
+	assert.False(t, types.IsSkipRetryError(NewStructuredOutputError(1, nil)))
+
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	RecordStructuredOutputAttempt(c, StructuredOutputAttempt{ChannelId: 1, Repairs: 1, Errors: []string{"/: content is empty"}})
+	RecordStructuredOutputAttempt(c, StructuredOutputAttempt{ChannelId: 2, Passed: true})
+	adminInfo := map[string]interface{}{}
+	AppendStructuredOutputAdminInfo(c, adminInfo)
+	attempts, ok := adminInfo["structured_output"].([]StructuredOutputAttempt)
+	require.True(t, ok)
+	require.Len(t, attempts, 2)
+	assert.Equal(t, 2, attempts[1].ChannelId)
+	assert.True(t, attempts[1].Passed)
+}
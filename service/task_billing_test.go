@@ -44,6 +44,7 @@ func TestMain(m *testing.M) {
 		&model.Channel{},
 		&model.TopUp{},
 		&model.UserSubscription{},
+		&model.PostpaidAccount{},
 	); err != nil {
 		panic("failed to migrate: " + err.Error())
 	}
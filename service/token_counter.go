@@ -286,16 +286,10 @@ func EstimateRequestToken(c *gin.Context, meta *types.TokenCountMeta, info *rela
 				}
 				tkm += token
 			} else {
-				tkm += 520
+				tkm += estimateFileToken(file.FileType)
 			}
-		case types.FileTypeAudio:
-			tkm += 256
-		case types.FileTypeVideo:
-			tkm += 4096 * 2
-		case types.FileTypeFile:
-			tkm += 4096
 		default:
-			tkm += 4096 // Default case for unknown file types
+			tkm += estimateFileToken(file.FileType)
 		}
 	}
 
@@ -303,6 +297,40 @@ func EstimateRequestToken(c *gin.Context, meta *types.TokenCountMeta, info *rela
 	return tkm, nil
 }
 
+// estimateFileToken 按文件类型估算媒体文件的 token 数量
+func estimateFileToken(fileType types.FileType) int {
+	switch fileType {
+	case types.FileTypeImage:
+		return 520
+	case types.FileTypeAudio:
+		return 256
+	case types.FileTypeVideo:
+		return 4096 * 2
+	case types.FileTypeFile:
+		return 4096
+	default:
+		return 4096 // Default case for unknown file types
+	}
+}
+
+// CountTokenMeta 使用本地 tokenizer 统计请求的输入 token，供 token 计数接口在没有可用上游时使用；
+// 不受 CountToken 开关影响，也不下载媒体文件
+func CountTokenMeta(meta *types.TokenCountMeta, model string) int {
+	if meta == nil {
+		return 0
+	}
+	tkm := 0
+	if meta.TokenType == types.TokenTypeTextNumber {
+		tkm += utf8.RuneCountInString(meta.CombineText)
+	} else {
+		tkm += CountTextToken(meta.CombineText, model)
+	}
+	for _, file := range meta.Files {
+		tkm += estimateFileToken(file.FileType)
+	}
+	return tkm
+}
+
 func CountTokenRealtime(info *relaycommon.RelayInfo, request dto.RealtimeEvent, model string) (int, int, error) {
 	audioToken := 0
 	textToken := 0
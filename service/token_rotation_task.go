@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	tokenRotationTickInterval = time.Minute
+	tokenRotationBatchSize    = 200
+)
+
+var (
+	tokenRotationOnce    sync.Once
+	tokenRotationRunning atomic.Bool
+)
+
+// StartTokenRotationTask 启动令牌密钥自动轮换与旧密钥过期任务（仅 master 节点）
+func StartTokenRotationTask() {
+	tokenRotationOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("token rotation task started: tick=%s", tokenRotationTickInterval))
+			ticker := time.NewTicker(tokenRotationTickInterval)
+			defer ticker.Stop()
+
+			runTokenRotationOnce()
+			for range ticker.C {
+				runTokenRotationOnce()
+			}
+		})
+	})
+}
+
+func runTokenRotationOnce() {
+	if !tokenRotationRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer tokenRotationRunning.Store(false)
+
+	ctx := context.Background()
+	rotated := 0
+	tokens, err := model.GetTokensDueForRotation(tokenRotationBatchSize)
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("token rotation task failed: %v", err))
+		return
+	}
+	gracePeriod := operation_setting.GetTokenSetting().RotationGracePeriod
+	for _, token := range tokens {
+		if _, err := model.RotateTokenKey(token, gracePeriod); err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("failed to rotate token %d: %v", token.Id, err))
+			continue
+		}
+		rotated++
+		NotifyTokenKeyRotated(token)
+	}
+
+	expired := 0
+	for {
+		tokens, err := model.ExpirePreviousTokenKeys(tokenRotationBatchSize)
+		for _, token := range tokens {
+			NotifyPreviousTokenKeyExpired(token)
+		}
+		expired += len(tokens)
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("token previous key expire task failed: %v", err))
+			return
+		}
+		if len(tokens) < tokenRotationBatchSize {
+			break
+		}
+	}
+	if common.DebugEnabled && (rotated > 0 || expired > 0) {
+		logger.LogDebug(ctx, "token rotation: rotated_count=%d, previous_key_expired_count=%d", rotated, expired)
+	}
+}
+
+// NotifyTokenKeyRotated 通知令牌所有者密钥已轮换
+func NotifyTokenKeyRotated(token *model.Token) {
+	userCache, err := model.GetUserCache(token.UserId)
+	if err != nil {
+		return
+	}
+	title := "令牌密钥已轮换"
+	content := "您的令牌「{{value}}」已生成新密钥，旧密钥已立即失效，请尽快更新客户端配置。"
+	values := []interface{}{token.Name}
+	if token.PreviousKeyExpiresTime > 0 {
+		content = "您的令牌「{{value}}」已生成新密钥，旧密钥将在 {{value}} 后失效，请在此之前更新客户端配置。"
+		values = append(values, time.Unix(token.PreviousKeyExpiresTime, 0).Format("2006-01-02 15:04:05"))
+	}
+	if err := NotifyUser(token.UserId, userCache.Email, userCache.GetSetting(), dto.NewNotify(dto.NotifyTypeTokenRotation, title, content, values)); err != nil {
+		common.SysLog(fmt.Sprintf("failed to notify token rotation: token_id=%d, error=%v", token.Id, err))
+	}
+}
+
+// NotifyPreviousTokenKeyExpired 通知令牌所有者轮换前的旧密钥已失效
+func NotifyPreviousTokenKeyExpired(token *model.Token) {
+	userCache, err := model.GetUserCache(token.UserId)
+	if err != nil {
+		return
+	}
+	title := "令牌旧密钥已失效"
+	content := "您的令牌「{{value}}」轮换前的旧密钥已于 {{value}} 失效，仍在使用旧密钥的请求将被拒绝。"
+	values := []interface{}{
+		token.Name,
+		time.Unix(token.PreviousKeyExpiresTime, 0).Format("2006-01-02 15:04:05"),
+	}
+	if err := NotifyUser(token.UserId, userCache.Email, userCache.GetSetting(), dto.NewNotify(dto.NotifyTypeTokenRotation, title, content, values)); err != nil {
+		common.SysLog(fmt.Sprintf("failed to notify token previous key expiry: token_id=%d, error=%v", token.Id, err))
+	}
+}
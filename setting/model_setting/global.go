@@ -32,10 +32,51 @@ func (p ChatCompletionsToResponsesPolicy) IsChannelEnabled(channelID int, channe
 	return false
 }
 
+// ResponsesStorePolicy 网关侧保存 Responses 响应，previous_response_id 会在网关展开为完整输入，切换渠道后对话链不中断
+type ResponsesStorePolicy struct {
+	Enabled       bool `json:"enabled"`
+	RetentionDays int  `json:"retention_days"`
+}
+
+// ServerToolPolicy 网关侧执行的工具：请求 tools 中 type 为 gateway 的工具由网关执行，结果追加到对话后再次请求模型，
+// 直至模型给出最终回答或达到最大轮数，各轮用量合并计费
+type ServerToolPolicy struct {
+	Enabled           bool             `json:"enabled"`
+	MaxRounds         int              `json:"max_rounds"`
+	WebFetchEnabled   bool             `json:"web_fetch_enabled"`
+	CalculatorEnabled bool             `json:"calculator_enabled"`
+	HttpTools         []ServerHttpTool `json:"http_tools,omitempty"`
+}
+
+// ServerHttpTool 管理员登记的 HTTP 工具，网关将工具参数以 JSON 形式 POST 到 URL，响应体作为工具结果
+type ServerHttpTool struct {
+	Name           string            `json:"name"`
+	Description    string            `json:"description"`
+	Parameters     map[string]any    `json:"parameters,omitempty"`
+	URL            string            `json:"url"`
+	Headers        map[string]string `json:"headers,omitempty"`
+	TimeoutSeconds int               `json:"timeout_seconds,omitempty"`
+}
+
+// StructuredOutputPolicy 结构化输出校验：请求 response_format 为 json_schema/json_object 时，网关校验最终回答，
+// 不符合时追加修复提示重新请求，仍失败时可切换渠道重试。按模型（正则）或分组启用，两者均为空时对全部请求生效
+type StructuredOutputPolicy struct {
+	Enabled           bool     `json:"enabled"`
+	ModelPatterns     []string `json:"model_patterns,omitempty"`
+	Groups            []string `json:"groups,omitempty"`
+	MaxRepairAttempts int      `json:"max_repair_attempts"`
+	RetryOtherChannel bool     `json:"retry_other_channel"`
+	// RepairPrompt 修复提示，{errors} 替换为校验错误，{schema} 替换为 JSON Schema，留空使用默认提示
+	RepairPrompt string `json:"repair_prompt,omitempty"`
+}
+
 type GlobalSettings struct {
 	PassThroughRequestEnabled        bool                             `json:"pass_through_request_enabled"`
 	ThinkingModelBlacklist           []string                         `json:"thinking_model_blacklist"`
 	ChatCompletionsToResponsesPolicy ChatCompletionsToResponsesPolicy `json:"chat_completions_to_responses_policy"`
+	ResponsesStorePolicy             ResponsesStorePolicy             `json:"responses_store_policy"`
+	ServerToolPolicy                 ServerToolPolicy                 `json:"server_tool_policy"`
+	StructuredOutputPolicy           StructuredOutputPolicy           `json:"structured_output_policy"`
 }
 
 // 默认配置
@@ -49,6 +90,21 @@ var defaultOpenaiSettings = GlobalSettings{
 		Enabled:     false,
 		AllChannels: true,
 	},
+	ResponsesStorePolicy: ResponsesStorePolicy{
+		Enabled:       false,
+		RetentionDays: 30,
+	},
+	ServerToolPolicy: ServerToolPolicy{
+		Enabled:           false,
+		MaxRounds:         5,
+		WebFetchEnabled:   true,
+		CalculatorEnabled: true,
+	},
+	StructuredOutputPolicy: StructuredOutputPolicy{
+		Enabled:           false,
+		MaxRepairAttempts: 1,
+		RetryOtherChannel: true,
+	},
 }
 
 // 全局实例
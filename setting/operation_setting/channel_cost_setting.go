@@ -0,0 +1,28 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// ChannelCostSetting 渠道成本相关配置
+type ChannelCostSetting struct {
+	PreferCheapestChannel bool `json:"prefer_cheapest_channel"` // 同优先级下优先选择成本倍率最低的渠道
+}
+
+// 默认配置
+var channelCostSetting = ChannelCostSetting{
+	PreferCheapestChannel: false,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("channel_cost_setting", &channelCostSetting)
+}
+
+// GetChannelCostSetting 获取渠道成本配置
+func GetChannelCostSetting() *ChannelCostSetting {
+	return &channelCostSetting
+}
+
+// IsPreferCheapestChannelEnabled 是否在同优先级下优先选择成本最低的渠道
+func IsPreferCheapestChannelEnabled() bool {
+	return channelCostSetting.PreferCheapestChannel
+}
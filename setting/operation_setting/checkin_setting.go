@@ -7,6 +7,8 @@ type CheckinSetting struct {
 	Enabled  bool `json:"enabled"`   // 是否启用签到功能
 	MinQuota int  `json:"min_quota"` // 签到最小额度奖励
 	MaxQuota int  `json:"max_quota"` // 签到最大额度奖励
+	// 签到额度有效天数（0 = 永久有效）
+	QuotaExpireDays int `json:"quota_expire_days"`
 }
 
 // 默认配置
@@ -0,0 +1,27 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// PostpaidSetting 后付费账户逾期处理配置
+type PostpaidSetting struct {
+	ThrottleAfterDays int `json:"throttle_after_days"` // 账单逾期超过该天数后限流
+	SuspendAfterDays  int `json:"suspend_after_days"`  // 账单逾期超过该天数后暂停服务
+	ThrottledRPM      int `json:"throttled_rpm"`       // 限流状态下每分钟最多请求次数
+}
+
+// 默认配置
+var postpaidSetting = PostpaidSetting{
+	ThrottleAfterDays: 7,
+	SuspendAfterDays:  15,
+	ThrottledRPM:      10,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("postpaid_setting", &postpaidSetting)
+}
+
+// GetPostpaidSetting 获取后付费配置
+func GetPostpaidSetting() *PostpaidSetting {
+	return &postpaidSetting
+}
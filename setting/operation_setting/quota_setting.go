@@ -4,6 +4,8 @@ import "github.com/QuantumNous/new-api/setting/config"
 
 type QuotaSetting struct {
 	EnableFreeModelPreConsume bool `json:"enable_free_model_pre_consume"` // 是否对免费模型启用预消耗
+	// 邀请奖励（被邀请人赠送额度、邀请额度划转）的有效天数（0 = 永久有效）
+	AffQuotaExpireDays int `json:"aff_quota_expire_days"`
 }
 
 // 默认配置
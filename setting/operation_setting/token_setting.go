@@ -4,12 +4,17 @@ import "github.com/QuantumNous/new-api/setting/config"
 
 // TokenSetting 令牌相关配置
 type TokenSetting struct {
-	MaxUserTokens int `json:"max_user_tokens"` // 每用户最大令牌数量
+	MaxUserTokens       int   `json:"max_user_tokens"`       // 每用户最大令牌数量
+	HashNewTokens       bool  `json:"hash_new_tokens"`       // 新令牌仅存储前缀与哈希，完整密钥只在创建时显示
+	RotationGracePeriod int64 `json:"rotation_grace_period"` // 密钥轮换后旧密钥的默认宽限期（秒）
+
+	EndUserIdHeader string `json:"end_user_id_header"` // 读取终端用户标识的请求头，为空时仅从请求体读取
 }
 
 // 默认配置
 var tokenSetting = TokenSetting{
-	MaxUserTokens: 1000, // 默认每用户最多 1000 个令牌
+	MaxUserTokens:       1000,  // 默认每用户最多 1000 个令牌
+	RotationGracePeriod: 86400, // 默认旧密钥保留 1 天
 }
 
 func init() {